@@ -21,10 +21,11 @@
 package conf
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,22 +35,24 @@ import (
 	yaml "gopkg.in/yaml.v3"
 
 	"github.com/antigloss/go/conf/store"
+	"github.com/antigloss/go/utils/clock"
 )
 
+const kEnvTagName = "env" // Tag for specifying the ENV which overrides the field
+
 // New creates a ConfigParser object
-//   - T is the struct for unmarshalling configuration data
+//   - T is the struct for unmarshalling configuration data. It could also be a slice for documents whose top level is an array,
+//     or a map with string keys (such as map[string]Sub) for documents whose top level is a mapping of named sections.
+//     Keys of the map are lowercased, and `default` tags of Sub are applied to each of the sections
 func New[T any](opts ...option) *ConfigParser[T] {
-	isSlice := false
 	var t T
 	ty := reflect.TypeOf(t)
-	if ty.Kind() == reflect.Slice {
-		isSlice = true
-	}
 
 	c := &ConfigParser[T]{
-		isSlice:   isSlice,
+		isSlice:   ty.Kind() == reflect.Slice,
+		isMap:     ty.Kind() == reflect.Map && ty.Key().Kind() == reflect.String,
 		viper:     viper.New(),
-		changesCh: make(chan *store.ConfigChanges, 20),
+		changesCh: make(chan storeChanges, 20),
 		unwatchCh: make(chan int),
 	}
 	c.opts.apply(opts...)
@@ -62,82 +65,129 @@ type ConfigParser[T any] struct {
 	opts      options
 	isSlice   bool
 	sliceLen  int
+	isMap     bool
 	viper     *viper.Viper
-	changesCh chan *store.ConfigChanges
+	defaults  map[string]interface{}   // default values from the `default` tags
+	entryDefs map[string]interface{}   // default values of each section if `T` is a map
+	storeData []map[string]interface{} // configurations read from each Store, ordered by precedence
+	changesCh chan storeChanges
 	unwatchCh chan int
 	watchOnce sync.Once
+	mu        sync.Mutex
+	current   *T // latest configuration, used as ConfigEvent.Old on changes
+}
+
+// storeChanges is the changes from the Store at `idx` of ConfigParser.opts.stores
+type storeChanges struct {
+	idx      int
+	changes  *store.ConfigChanges  // changes reported by the Store
+	reloaded []store.ConfigContent // all contents reloaded from the Store by polling. Replace the old ones if not nil
 }
 
 // Parse reads configuration data from all Stores, then unmarshal it to `T`.
+// Configurations from Stores are merged by precedence, please refer to WithStorePriority and WithMergeStrategy for details.
 func (c *ConfigParser[T]) Parse() (*T, error) {
 	var t T
 
-	err := c.initDefaultValues(reflect.ValueOf(t))
-	if err != nil {
-		return nil, err
+	c.defaults = c.defaultValues(reflect.ValueOf(t))
+	if c.isMap {
+		et := reflect.TypeOf(t).Elem()
+		if et.Kind() == reflect.Pointer {
+			et = et.Elem()
+		}
+		c.entryDefs = c.defaultValues(reflect.New(et).Elem())
 	}
-
-	for _, store := range c.opts.stores {
+	c.storeData = make([]map[string]interface{}, len(c.opts.stores))
+	for i, store := range c.opts.stores {
 		contents, err := store.Load()
 		if err != nil {
 			return nil, err
 		}
 
-		for _, cont := range contents {
-			err = c.transformArray(&cont)
-			if err != nil {
-				return nil, err
-			}
-
-			c.viper.SetConfigType(cont.Type)
-			err = c.viper.MergeConfig(bytes.NewReader(cont.Content))
-			if err != nil {
-				return nil, err
-			}
+		c.storeData[i], err = c.mergeContents(contents)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	err = c.unmarshal(&t)
+	err := c.rebuild(&t)
 	if err != nil {
 		return nil, err
 	}
 
+	c.mu.Lock()
+	c.current = &t
+	c.mu.Unlock()
 	return &t, nil
 }
 
 // Watch watches configuration changes from all Stores, unmarshal the latest configuration data into `T`, then notify the caller via `cb`
 func (c *ConfigParser[T]) Watch(cb func(cfg *T, changes []store.ConfigChange)) error {
+	return c.WatchEvents(func(ev *ConfigEvent[T]) {
+		cb(ev.New, ev.Changes)
+	})
+}
+
+// WatchEvents is like Watch, but notifies the caller with both the previous and the latest configurations,
+// along with the changed fields between them, so that the caller can react only to the settings actually changed.
+// Only one of Watch and WatchEvents takes effect
+func (c *ConfigParser[T]) WatchEvents(cb func(ev *ConfigEvent[T])) error {
 	var err error
 
 	c.watchOnce.Do(func() {
-		for _, store := range c.opts.stores {
-			if err = store.Watch(c.changesCh); err != nil {
+		for i, s := range c.opts.stores {
+			ch := make(chan *store.ConfigChanges, 20)
+			if err = s.Watch(ch); err != nil {
 				return
 			}
+			go c.forwardChanges(i, ch)
+		}
+		if c.opts.pollInterval > 0 {
+			go c.poll()
 		}
 
 		go func() {
 			for {
 				select {
-				case changes := <-c.changesCh:
-					e := c.transformArray(&changes.Config)
-					if e != nil {
+				case sc := <-c.changesCh:
+					if sc.idx >= len(c.storeData) { // Parse not called
 						continue
 					}
 
-					c.viper.SetConfigType(changes.Config.Type)
-					e = c.viper.MergeConfig(bytes.NewReader(changes.Config.Content))
-					if e != nil {
-						continue
+					var changes []store.ConfigChange
+					if sc.reloaded != nil {
+						data, e := c.mergeContents(sc.reloaded)
+						if e != nil {
+							continue
+						}
+						changes = store.DiffKeys(c.storeData[sc.idx], data)
+						if len(changes) == 0 {
+							continue
+						}
+						c.storeData[sc.idx] = data
+					} else {
+						e := c.mergeContent(c.storeData[sc.idx], &sc.changes.Config)
+						if e != nil {
+							continue
+						}
+						changes = sc.changes.Changes
 					}
 
 					var t T
-					e = c.unmarshal(&t)
+					e := c.rebuild(&t)
 					if e != nil {
 						continue
 					}
 
-					cb(&t, changes.Changes)
+					c.mu.Lock()
+					ev := &ConfigEvent[T]{Old: c.current, New: &t, Changes: changes}
+					c.current = &t
+					c.mu.Unlock()
+
+					if ev.Old != nil {
+						ev.Diff = Diff(ev.Old, ev.New)
+					}
+					cb(ev)
 				case <-c.unwatchCh:
 					return
 				}
@@ -148,6 +198,125 @@ func (c *ConfigParser[T]) Watch(cb func(cfg *T, changes []store.ConfigChange)) e
 	return err
 }
 
+// forwardChanges forwards changes from the Store at `idx` to `c.changesCh`
+func (c *ConfigParser[T]) forwardChanges(idx int, ch <-chan *store.ConfigChanges) {
+	for {
+		select {
+		case changes := <-ch:
+			select {
+			case c.changesCh <- storeChanges{idx: idx, changes: changes}:
+			case <-c.unwatchCh:
+				return
+			}
+		case <-c.unwatchCh:
+			return
+		}
+	}
+}
+
+// poll reloads all Stores every `pollInterval`, and sends the reloaded configurations to `c.changesCh`
+func (c *ConfigParser[T]) poll() {
+	ticker := clock.OrReal(c.opts.clock).NewTicker(c.opts.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			for i, s := range c.opts.stores {
+				contents, err := s.Load()
+				if err != nil {
+					continue
+				}
+				if contents == nil {
+					contents = []store.ConfigContent{}
+				}
+
+				select {
+				case c.changesCh <- storeChanges{idx: i, reloaded: contents}:
+				case <-c.unwatchCh:
+					return
+				}
+			}
+		case <-c.unwatchCh:
+			return
+		}
+	}
+}
+
+// mergeContents parses and merges all contents of a Store
+func (c *ConfigParser[T]) mergeContents(contents []store.ConfigContent) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for _, cont := range contents {
+		err := c.mergeContent(data, &cont)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// mergeContent parses `cont` and merges it into `data`, the configurations of a Store.
+// Contents of the same Store are always deep merged, later contents override earlier ones
+func (c *ConfigParser[T]) mergeContent(data map[string]interface{}, cont *store.ConfigContent) error {
+	err := c.transformArray(cont)
+	if err != nil {
+		return err
+	}
+
+	m, err := store.ToMap(cont.Type, cont.Content)
+	if err != nil {
+		return err
+	}
+	mergeMaps(data, lowerKeys(m).(map[string]interface{}), MergeDeep)
+	return nil
+}
+
+// rebuild merges configurations of all Stores by precedence, applies ENV overrides, then unmarshal the result into `t`
+func (c *ConfigParser[T]) rebuild(t *T) error {
+	merged := map[string]interface{}{}
+	for _, i := range c.storeOrder() {
+		mergeMaps(merged, deepCopy(c.storeData[i]).(map[string]interface{}), c.opts.strategies[c.opts.stores[i]])
+	}
+	if _, err := c.opts.decryptValues(merged, ""); err != nil {
+		return err
+	}
+	if len(c.entryDefs) > 0 {
+		for key, val := range merged {
+			if entry, ok := val.(map[string]interface{}); ok {
+				withDefs := deepCopy(c.entryDefs).(map[string]interface{})
+				mergeMaps(withDefs, entry, MergeDeep)
+				merged[key] = withDefs
+			}
+		}
+	}
+
+	c.viper = viper.New()
+	c.viper.SetConfigType(store.ConfigTypeYAML)
+	err := c.viper.MergeConfigMap(c.defaults)
+	if err != nil {
+		return err
+	}
+	err = c.viper.MergeConfigMap(merged)
+	if err != nil {
+		return err
+	}
+
+	c.applyEnvOverrides(reflect.TypeOf(*t), nil)
+	return c.unmarshal(t)
+}
+
+// storeOrder returns indexes of Stores ordered by precedence from low to high
+func (c *ConfigParser[T]) storeOrder() []int {
+	order := make([]int, len(c.opts.stores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return c.opts.priorities[c.opts.stores[order[i]]] < c.opts.priorities[c.opts.stores[order[j]]]
+	})
+	return order
+}
+
 // Unwatch stops watching
 func (c *ConfigParser[T]) Unwatch() {
 	for _, store := range c.opts.stores {
@@ -156,14 +325,12 @@ func (c *ConfigParser[T]) Unwatch() {
 	close(c.unwatchCh)
 }
 
-func (c *ConfigParser[T]) initDefaultValues(v reflect.Value) error {
+func (c *ConfigParser[T]) defaultValues(v reflect.Value) map[string]interface{} {
+	m := map[string]interface{}{}
 	if v.Kind() == reflect.Struct {
-		m := map[string]interface{}{}
 		c.getDefaultValues(v.Type(), m)
-		c.viper.SetConfigType(store.ConfigTypeYAML)
-		return c.viper.MergeConfigMap(m)
 	}
-	return nil
+	return m
 }
 
 func (c *ConfigParser[T]) getDefaultValues(t reflect.Type, m map[string]interface{}) {
@@ -178,7 +345,7 @@ func (c *ConfigParser[T]) getDefaultValues(t reflect.Type, m map[string]interfac
 		if fv.Kind() == reflect.Pointer {
 			fv = fv.Elem()
 		}
-		if fv.Kind() != reflect.Struct {
+		if !isSection(fv) {
 			defVal := ft.Tag.Get("default")
 			if defVal != "" {
 				m[tagName] = defVal
@@ -194,6 +361,54 @@ func (c *ConfigParser[T]) getDefaultValues(t reflect.Type, m map[string]interfac
 	}
 }
 
+// applyEnvOverrides overrides configurations with ENV. Values set by viper.Set take precedence over values from all Stores,
+// and they are kept when configurations are changed during watching.
+func (c *ConfigParser[T]) applyEnvOverrides(t reflect.Type, keys []string) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if !ft.IsExported() {
+			continue
+		}
+
+		tagKey := c.opts.tagName
+		if tagKey == "" {
+			tagKey = "mapstructure"
+		}
+		tagName := strings.SplitN(ft.Tag.Get(tagKey), ",", 2)[0]
+		if tagName == "-" {
+			continue
+		}
+		if tagName == "" {
+			tagName = strings.ToLower(ft.Name)
+		}
+		fieldKeys := append(keys[:len(keys):len(keys)], tagName)
+
+		fv := ft.Type
+		if fv.Kind() == reflect.Pointer {
+			fv = fv.Elem()
+		}
+		if isSection(fv) && ft.Tag.Get(kEnvTagName) == "" {
+			c.applyEnvOverrides(fv, fieldKeys)
+			continue
+		}
+
+		envName := ft.Tag.Get(kEnvTagName)
+		if envName == "" {
+			if c.opts.envPrefix == "" {
+				continue
+			}
+			envName = c.opts.envPrefix + "_" + strings.ToUpper(strings.Join(fieldKeys, "_"))
+		}
+		if v, ok := os.LookupEnv(envName); ok {
+			c.viper.Set(strings.Join(fieldKeys, "."), v)
+		}
+	}
+}
+
 // transformArray 把数组格式的配置，转换成对象格式
 func (c *ConfigParser[T]) transformArray(cont *store.ConfigContent) error {
 	if !c.isSlice {
@@ -233,23 +448,18 @@ func (c *ConfigParser[T]) transformArray(cont *store.ConfigContent) error {
 }
 
 func (c *ConfigParser[T]) unmarshal(t *T) error {
+	if c.isMap {
+		return c.unmarshalMap(t)
+	}
 	if !c.isSlice {
-		return c.viper.Unmarshal(t, func(config *mapstructure.DecoderConfig) {
-			if c.opts.tagName != "" {
-				config.TagName = c.opts.tagName
-			}
-		}, viper.DecodeHook(decodeHook(c.opts.hook)))
+		return c.viper.Unmarshal(t, c.decoderOptions()...)
 	}
 
 	ty := reflect.TypeOf(*t)
 	v := reflect.ValueOf(*t)
 	for i := 0; i < c.sliceLen; i++ {
 		elem := reflect.New(ty.Elem())
-		err := c.viper.UnmarshalKey(strconv.Itoa(i), elem.Interface(), func(config *mapstructure.DecoderConfig) {
-			if c.opts.tagName != "" {
-				config.TagName = c.opts.tagName
-			}
-		}, viper.DecodeHook(decodeHook(c.opts.hook)))
+		err := c.viper.UnmarshalKey(strconv.Itoa(i), elem.Interface(), c.decoderOptions()...)
 		if err != nil {
 			return err
 		}
@@ -260,3 +470,29 @@ func (c *ConfigParser[T]) unmarshal(t *T) error {
 	*t = v.Interface().(T)
 	return nil
 }
+
+// unmarshalMap unmarshal each top level section into an entry of `t`
+func (c *ConfigParser[T]) unmarshalMap(t *T) error {
+	ty := reflect.TypeOf(*t)
+	settings := c.viper.AllSettings()
+	m := reflect.MakeMapWithSize(ty, len(settings))
+	for key := range settings {
+		elem := reflect.New(ty.Elem())
+		err := c.viper.UnmarshalKey(key, elem.Interface(), c.decoderOptions()...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		m.SetMapIndex(reflect.ValueOf(key).Convert(ty.Key()), elem.Elem())
+	}
+
+	*t = m.Interface().(T)
+	return nil
+}
+
+func (c *ConfigParser[T]) decoderOptions() []viper.DecoderConfigOption {
+	return []viper.DecoderConfigOption{func(config *mapstructure.DecoderConfig) {
+		if c.opts.tagName != "" {
+			config.TagName = c.opts.tagName
+		}
+	}, viper.DecodeHook(decodeHook(c.opts.hook))}
+}
@@ -0,0 +1,248 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/conf/store"
+	"github.com/antigloss/go/conf/store/file"
+	"github.com/antigloss/go/utils/clock"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	type config struct {
+		Name string
+		Port int `env:"CONF_TEST_PORT"`
+		DB   struct {
+			Host     string
+			User     string `mapstructure:"username"`
+			Password string `env:"CONF_TEST_DB_PASSWORD"`
+		}
+		Skip    string `mapstructure:"-"`
+		Started time.Time
+	}
+
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	content := "name: app\nport: 80\ndb:\n  host: localhost\n  username: root\n  password: pass\nstarted: 2020-01-02\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		prefix   string
+		envs     map[string]string
+		expected string
+	}{
+		{"no ENV", "", nil, "app 80 {localhost root pass} 2020-01-02"},
+		{"no prefix", "", map[string]string{"APP_NAME": "env", "CONF_TEST_PORT": "81"}, "app 81 {localhost root pass} 2020-01-02"},
+		{"nested env tag", "", map[string]string{"CONF_TEST_DB_PASSWORD": "secret"}, "app 80 {localhost root secret} 2020-01-02"},
+		{"prefix", "APP", map[string]string{
+			"APP_NAME":        "env",
+			"APP_DB_HOST":     "db.local",
+			"APP_DB_USERNAME": "admin",
+			"APP_DB_USER":     "ignored",
+			"APP_STARTED":     "2021-03-04",
+			"APP_SKIP":        "ignored",
+		}, "env 80 {db.local admin pass} 2021-03-04"},
+		{"prefix with trailing underscore", "APP_", map[string]string{"APP_NAME": "env"}, "env 80 {localhost root pass} 2020-01-02"},
+		{"tag over prefix", "APP", map[string]string{
+			"APP_PORT":              "82",
+			"APP_DB_PASSWORD":       "ignored",
+			"CONF_TEST_DB_PASSWORD": "secret",
+		}, "app 80 {localhost root secret} 2020-01-02"},
+		{"both tag and prefix set", "APP", map[string]string{"APP_PORT": "82", "CONF_TEST_PORT": "83"}, "app 83 {localhost root pass} 2020-01-02"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.envs {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := New[config](WithStores(file.New(file.WithConfigPaths(file.ConfigPath{Path: path}))), WithEnvPrefix(tc.prefix)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := fmt.Sprint(cfg.Name, " ", cfg.Port, " ", cfg.DB, " ", cfg.Started.Format("2006-01-02")); s != tc.expected {
+				t.Errorf("Unexpected configuration: %s, expecting %s", s, tc.expected)
+			}
+			if cfg.Skip != "" {
+				t.Errorf("Fields tagged with `-` should not be overridden: %q", cfg.Skip)
+			}
+		})
+	}
+}
+
+func TestPollReload(t *testing.T) {
+	type config struct {
+		Name string
+		Port int
+		DB   struct {
+			Host string
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("name: app\nport: 80\ndb:\n  host: localhost\n")
+
+	fc := clock.NewFake(time.Now())
+	c := New[config](WithStores(file.New(file.WithConfigPaths(file.ConfigPath{Path: path}))),
+		WithPollInterval(time.Minute), WithClock(fc))
+	if _, err := c.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan *ConfigEvent[config], 10)
+	if err := c.WatchEvents(func(ev *ConfigEvent[config]) { events <- ev }); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Unwatch()
+	fc.BlockUntil(1)
+
+	// reload advances the clock by one tick, and returns the event fired by the reload, or nil if nothing is changed
+	reload := func() *ConfigEvent[config] {
+		fc.Advance(time.Minute)
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(100 * time.Millisecond):
+			return nil
+		}
+	}
+	keys := func(changes []store.ConfigChange) string {
+		var ks []string
+		for _, ch := range changes {
+			ks = append(ks, fmt.Sprint(ch.Key, ":", ch.Type))
+		}
+		sort.Strings(ks)
+		return fmt.Sprint(ks)
+	}
+
+	if ev := reload(); ev != nil {
+		t.Fatalf("Unchanged configurations should not fire callbacks: %+v", ev)
+	}
+
+	write("name: app\nport: 81\ndb:\n  host: localhost\n")
+	ev := reload()
+	if ev == nil {
+		t.Fatal("Changed configurations should fire callbacks")
+	}
+	if s := keys(ev.Changes); s != fmt.Sprintf("[port:%d]", store.ChangeTypeUpdated) {
+		t.Errorf("Unexpected changes: %s", s)
+	}
+	if ev.Old.Port != 80 || ev.New.Port != 81 || len(ev.Diff) != 1 || ev.Diff[0].Path != "Port" || ev.Changed("DB") {
+		t.Errorf("Unexpected event: %+v", ev)
+	}
+
+	if ev = reload(); ev != nil {
+		t.Fatalf("Unchanged configurations should not fire callbacks: %+v", ev)
+	}
+
+	// Each tick reloads the Store
+	write("port: 81\ndb:\n  host: db.local\n  user: root\n")
+	if ev = reload(); ev == nil {
+		t.Fatal("Changed configurations should fire callbacks")
+	}
+	expected := fmt.Sprintf("[db.host:%d db.user:%d name:%d]", store.ChangeTypeUpdated, store.ChangeTypeAdded, store.ChangeTypeDeleted)
+	if s := keys(ev.Changes); s != expected {
+		t.Errorf("Unexpected changes: %s, expecting %s", s, expected)
+	}
+	if ev.Old.Name != "app" || ev.New.Name != "" || ev.New.DB.Host != "db.local" || !ev.Changed("DB.Host") || ev.Changed("Port") {
+		t.Errorf("Unexpected event: %+v", ev)
+	}
+}
+
+func TestMapRoot(t *testing.T) {
+	type section struct {
+		Host string `default:"localhost"`
+		Port int    `default:"80"`
+		TLS  struct {
+			Enabled bool `default:"true"`
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "servers.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Primary:\n  host: a.local\nbackup:\n  port: 81\n  tls:\n    enabled: false\n")
+	fs := file.New(file.WithConfigPaths(file.ConfigPath{Path: path}))
+
+	servers, err := New[map[string]section](WithStores(fs)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(*servers); s != "map[backup:{localhost 81 {false}} primary:{a.local 80 {true}}]" {
+		t.Errorf("Unexpected configuration: %s", s)
+	}
+
+	ptrs, err := New[map[string]*section](WithStores(fs)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*ptrs) != 2 || fmt.Sprint(*(*ptrs)["primary"]) != "{a.local 80 {true}}" {
+		t.Errorf("Unexpected configuration: %v", *ptrs)
+	}
+
+	// Added and removed sections are reported on reload
+	fc := clock.NewFake(time.Now())
+	c := New[map[string]section](WithStores(fs), WithPollInterval(time.Minute), WithClock(fc))
+	if _, err = c.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan *ConfigEvent[map[string]section], 1)
+	if err = c.WatchEvents(func(ev *ConfigEvent[map[string]section]) { events <- ev }); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Unwatch()
+	fc.BlockUntil(1)
+
+	write("primary:\n  host: b.local\nstandby:\n  host: c.local\n")
+	fc.Advance(time.Minute)
+	var ev *ConfigEvent[map[string]section]
+	select {
+	case ev = <-events:
+	case <-time.After(time.Second):
+		t.Fatal("Changed configurations should fire callbacks")
+	}
+
+	expected := "[{backup {localhost 81 {false}} <nil>} {primary.Host a.local b.local} {standby <nil> {c.local 80 {true}}}]"
+	if s := fmt.Sprint(ev.Diff); s != expected {
+		t.Errorf("Unexpected diff: %s, expecting %s", s, expected)
+	}
+	if !ev.Changed("backup") || !ev.Changed("standby.Port") || ev.Changed("primary.Port") {
+		t.Error("Unexpected result of Changed")
+	}
+	if _, ok := (*ev.New)["backup"]; ok || len(*ev.New) != 2 {
+		t.Errorf("Removed sections should not be kept: %v", *ev.New)
+	}
+}
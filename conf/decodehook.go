@@ -21,11 +21,47 @@ package conf
 
 import (
 	"crypto/rsa"
+	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/mitchellh/mapstructure"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Layouts tried in order for decoding strings into time.Time. Layouts without time zones are parsed in local time
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Units of byte sizes, in powers of 1024
+var byteUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+	"p": 1 << 50, "pb": 1 << 50, "pib": 1 << 50,
+}
+
+// Struct types decoded from strings by the built-in decoders. Fields of these types are leaves of configurations,
+// rather than sections holding nested fields
+var decodedStructs = map[reflect.Type]bool{
+	reflect.TypeOf(time.Time{}):      true,
+	reflect.TypeOf(rsa.PublicKey{}):  true,
+	reflect.TypeOf(rsa.PrivateKey{}): true,
+}
+
+// isSection checks if fields of type `t` hold nested fields
+func isSection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !decodedStructs[t]
+}
+
 func decodeHook(hook DecodeHook) mapstructure.DecodeHookFunc {
 	return mapstructure.ComposeDecodeHookFunc(
 		mapstructure.StringToTimeDurationHookFunc(),
@@ -48,6 +84,62 @@ func decoder(hook DecodeHook) func(f reflect.Type, t reflect.Type, data interfac
 			return jwt.ParseRSAPrivateKeyFromPEM([]byte(data.(string)))
 		}
 
-		return hook(t, data.(string))
+		if hook != nil {
+			var err error
+			data, err = hook(t, data.(string))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Built-in decoders apply if the user-defined decoder leaves the data as is
+		str, ok := data.(string)
+		if !ok {
+			return data, nil
+		}
+		switch {
+		case t == reflect.TypeOf(time.Time{}):
+			return parseTime(str)
+		case t.Kind() == reflect.Int64:
+			if _, err := strconv.ParseInt(str, 0, 64); err == nil {
+				return data, nil
+			}
+			if n, err := parseByteSize(str); err == nil {
+				return reflect.ValueOf(n).Convert(t).Interface(), nil
+			}
+		}
+		return data, nil
+	}
+}
+
+// parseTime parses `s` with the first matching layout in `timeLayouts`
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if tm, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return tm, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// parseByteSize parses sizes such as `512MB`, `1.5 GiB` or `64k` into number of bytes. Units are case-insensitive
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
 	}
+	return int64(n * float64(unit)), nil
 }
@@ -0,0 +1,96 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+type hookedConfig struct {
+	Timeout time.Duration `default:"1m30s"`
+	Start   time.Time     `default:"2020-01-02"`
+	MaxSize int64         `default:"64MB"`
+	Log     struct {
+		RotatedAt time.Time `default:"2021-03-04 05:06:07"`
+		MaxSize   int64     `default:"1.5 GiB"`
+	}
+}
+
+func TestDecodeHooks(t *testing.T) {
+	date := func(s string) time.Time {
+		tm, _ := parseTime(s)
+		return tm
+	}
+
+	cfg, err := New[hookedConfig]().Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout != 90*time.Second || !cfg.Start.Equal(date("2020-01-02")) || cfg.MaxSize != 64<<20 ||
+		!cfg.Log.RotatedAt.Equal(date("2021-03-04 05:06:07")) || cfg.Log.MaxSize != 3<<29 {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+
+	t.Setenv("APP_TIMEOUT", "2s")
+	t.Setenv("APP_START", "2022-05-06T07:08:09Z")
+	t.Setenv("APP_MAXSIZE", "512k")
+	t.Setenv("APP_LOG_ROTATEDAT", "2023-01-01")
+	t.Setenv("APP_LOG_MAXSIZE", "1024")
+	cfg, err = New[hookedConfig](WithEnvPrefix("APP")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout != 2*time.Second || !cfg.Start.Equal(date("2022-05-06T07:08:09Z")) || cfg.MaxSize != 512<<10 ||
+		!cfg.Log.RotatedAt.Equal(date("2023-01-01")) || cfg.Log.MaxSize != 1024 {
+		t.Errorf("Unexpected ENV overrides: %+v", cfg)
+	}
+
+	t.Setenv("APP_START", "yesterday")
+	if _, err = New[hookedConfig](WithEnvPrefix("APP")).Parse(); err == nil {
+		t.Error("Parse() should fail with an invalid time")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		s string
+		n int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512b", 512},
+		{"64k", 64 << 10},
+		{"512MB", 512 << 20},
+		{"1.5 GiB", 3 << 29},
+		{"2tb", 2 << 40},
+		{"1P", 1 << 50},
+	} {
+		if n, err := parseByteSize(tc.s); err != nil || n != tc.n {
+			t.Errorf("parseByteSize(%q) = %d, %v, expecting %d", tc.s, n, err, tc.n)
+		}
+	}
+
+	for _, s := range []string{"", "MB", "12XB", "1.2.3k"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("parseByteSize(%q) should fail", s)
+		}
+	}
+}
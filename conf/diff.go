@@ -0,0 +1,134 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/antigloss/go/conf/store"
+)
+
+// ConfigEvent is passed to the callback of WatchEvents when configurations are changed
+type ConfigEvent[T any] struct {
+	Old     *T                   // configuration before the change. Nil if Parse was not called before watching
+	New     *T                   // configuration after the change
+	Changes []store.ConfigChange // raw changes reported by the Store
+	Diff    []FieldChange        // changed fields between Old and New
+}
+
+// Changed returns true if the field at `path` or any field under it is changed.
+// `path` is the dotted Go field names from the root of `T`, such as `Database` or `Database.Host`
+func (e *ConfigEvent[T]) Changed(path string) bool {
+	for _, fc := range e.Diff {
+		if fc.Path == path || strings.HasPrefix(fc.Path, path+".") || strings.HasPrefix(path, fc.Path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldChange is a changed field of the configuration struct
+type FieldChange struct {
+	Path string      // dotted Go field names from the root of the configuration struct, such as `Database.Host`
+	Old  interface{} // value before the change
+	New  interface{} // value after the change
+}
+
+// Diff compares `old` with `new` field by field, and returns the changed fields.
+// Nested structs (and pointers to structs) are compared recursively, other fields (including maps, slices and time.Time) are compared as a whole.
+// If `T` is a map with string keys, entries are compared one by one, with their keys as the first elements of the paths.
+// Unexported fields are ignored
+func Diff[T any](old, new *T) []FieldChange {
+	var changes []FieldChange
+	o, n := reflect.ValueOf(old), reflect.ValueOf(new)
+	if !o.IsNil() && !n.IsNil() && o.Elem().Kind() == reflect.Map && o.Elem().Type().Key().Kind() == reflect.String {
+		diffMap(o.Elem(), n.Elem(), &changes)
+	} else {
+		diffValue(o, n, "", &changes)
+	}
+	return changes
+}
+
+// diffMap compares entries of maps `o` and `n`. Added or removed entries are reported with nil Old or New
+func diffMap(o, n reflect.Value, changes *[]FieldChange) {
+	keys := o.MapKeys()
+	for _, k := range n.MapKeys() {
+		if !o.MapIndex(k).IsValid() {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	for _, k := range keys {
+		ov, nv := o.MapIndex(k), n.MapIndex(k)
+		switch {
+		case !nv.IsValid():
+			*changes = append(*changes, FieldChange{Path: k.String(), Old: ov.Interface()})
+		case !ov.IsValid():
+			*changes = append(*changes, FieldChange{Path: k.String(), New: nv.Interface()})
+		default:
+			diffValue(ov, nv, k.String(), changes)
+		}
+	}
+}
+
+func diffValue(o, n reflect.Value, path string, changes *[]FieldChange) {
+	if o.Kind() == reflect.Pointer {
+		if o.IsNil() || n.IsNil() {
+			if o.IsNil() != n.IsNil() {
+				*changes = append(*changes, FieldChange{Path: path, Old: valueOf(o), New: valueOf(n)})
+			}
+			return
+		}
+		o, n = o.Elem(), n.Elem()
+	}
+
+	if !isSection(o.Type()) {
+		if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+			*changes = append(*changes, FieldChange{Path: path, Old: o.Interface(), New: n.Interface()})
+		}
+		return
+	}
+
+	t := o.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if !ft.IsExported() {
+			continue
+		}
+
+		p := ft.Name
+		if path != "" {
+			p = path + "." + ft.Name
+		}
+		diffValue(o.Field(i), n.Field(i), p, changes)
+	}
+}
+
+func valueOf(v reflect.Value) interface{} {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Interface()
+}
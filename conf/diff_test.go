@@ -0,0 +1,106 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type diffDB struct {
+	Host string
+	Port int
+}
+
+type diffConfig struct {
+	Name    string
+	DB      diffDB
+	Replica *diffDB
+	Tags    []string
+	Limits  map[string]int
+	Start   time.Time
+	secret  string
+}
+
+func TestDiff(t *testing.T) {
+	base := func() *diffConfig {
+		return &diffConfig{
+			Name:    "app",
+			DB:      diffDB{Host: "db", Port: 3306},
+			Replica: &diffDB{Host: "replica", Port: 3306},
+			Tags:    []string{"a", "b"},
+			Limits:  map[string]int{"qps": 100},
+			Start:   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			secret:  "s",
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		modify   func(c *diffConfig)
+		expected string
+	}{
+		{"unchanged", func(c *diffConfig) {}, "[]"},
+		{"unexported field ignored", func(c *diffConfig) { c.secret = "x" }, "[]"},
+		{"top level field", func(c *diffConfig) { c.Name = "new" }, "[{Name app new}]"},
+		{"nested struct", func(c *diffConfig) { c.DB.Port = 3307 }, "[{DB.Port 3306 3307}]"},
+		{"pointer to struct", func(c *diffConfig) { c.Replica.Host = "r2" }, "[{Replica.Host replica r2}]"},
+		{"slice as a whole", func(c *diffConfig) { c.Tags = append(c.Tags, "c") }, "[{Tags [a b] [a b c]}]"},
+		{"map as a whole", func(c *diffConfig) { c.Limits["qps"] = 200 }, "[{Limits map[qps:100] map[qps:200]}]"},
+		{"time as a whole", func(c *diffConfig) { c.Start = c.Start.AddDate(0, 0, 1) },
+			"[{Start 2020-01-02 00:00:00 +0000 UTC 2020-01-03 00:00:00 +0000 UTC}]"},
+		{"several fields", func(c *diffConfig) { c.Name = "new"; c.DB.Host = "db2"; c.Tags = nil },
+			"[{Name app new} {DB.Host db db2} {Tags [a b] []}]"},
+	} {
+		old, new := base(), base()
+		tc.modify(new)
+		if s := fmt.Sprint(Diff(old, new)); s != tc.expected {
+			t.Errorf("%s: unexpected diff %s, expecting %s", tc.name, s, tc.expected)
+		}
+	}
+
+	old, new := base(), base()
+	new.Replica = nil
+	if changes := Diff(old, new); len(changes) != 1 || changes[0].Path != "Replica" || changes[0].Old != old.Replica || changes[0].New != nil {
+		t.Errorf("pointer set to nil: unexpected diff %v", changes)
+	}
+
+	var nilCfg *diffConfig
+	if changes := Diff(nilCfg, base()); len(changes) != 1 || changes[0].Path != "" || changes[0].Old != nil {
+		t.Errorf("nil old configuration: unexpected diff %v", changes)
+	}
+}
+
+func TestDiffMap(t *testing.T) {
+	old := map[string]diffDB{"main": {Host: "db", Port: 3306}, "removed": {Host: "r"}}
+	new := map[string]diffDB{"main": {Host: "db", Port: 3307}, "added": {Host: "a"}}
+	expected := "[{added <nil> {a 0}} {main.Port 3306 3307} {removed {r 0} <nil>}]"
+	if s := fmt.Sprint(Diff(&old, &new)); s != expected {
+		t.Errorf("unexpected diff %s, expecting %s", s, expected)
+	}
+
+	ev := &ConfigEvent[map[string]diffDB]{Diff: Diff(&old, &new)}
+	for path, changed := range map[string]bool{"main": true, "main.Port": true, "main.Host": false, "added": true, "other": false} {
+		if ev.Changed(path) != changed {
+			t.Errorf("Changed(%q) should be %v", path, changed)
+		}
+	}
+}
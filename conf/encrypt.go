@@ -0,0 +1,143 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Encrypted values are strings in the form of `ENC[ALGORITHM,BASE64_DATA]`. Supported algorithms:
+//
+//   - AES256_GCM  decrypted with the key set by WithDecryptionKey. BASE64_DATA is the nonce followed by the ciphertext (with the tag).
+//     Use Encrypt to generate such values
+//   - KMS         decrypted by the KMSProvider set by WithKMSProvider. BASE64_DATA is the ciphertext returned by the KMS
+const (
+	kEncPrefix       = "ENC["
+	kEncSuffix       = "]"
+	kEncAlgAES256GCM = "AES256_GCM"
+	kEncAlgKMS       = "KMS"
+)
+
+// KMSProvider decrypts the values encrypted by a Key Management Service, such as AWS KMS or HashiCorp Vault Transit
+type KMSProvider interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// Encrypt encrypts `plaintext` with AES-256-GCM using `key`, and returns it in the form of `ENC[AES256_GCM,BASE64_DATA]`,
+// which can be put into configurations and decrypted with WithDecryptionKey
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return kEncPrefix + kEncAlgAES256GCM + "," + base64.StdEncoding.EncodeToString(data) + kEncSuffix, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("AES-256 key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptValues decrypts all the encrypted strings inside `v` recursively, and returns the decrypted `v`
+func (o *options) decryptValues(v interface{}, key string) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range val {
+			subKey := k
+			if key != "" {
+				subKey = key + "." + k
+			}
+			d, err := o.decryptValues(sub, subKey)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = d
+		}
+	case []interface{}:
+		for i, sub := range val {
+			d, err := o.decryptValues(sub, fmt.Sprintf("%s[%d]", key, i))
+			if err != nil {
+				return nil, err
+			}
+			val[i] = d
+		}
+	case string:
+		if strings.HasPrefix(val, kEncPrefix) && strings.HasSuffix(val, kEncSuffix) {
+			d, err := o.decrypt(val[len(kEncPrefix) : len(val)-len(kEncSuffix)])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %s", key, err.Error())
+			}
+			return d, nil
+		}
+	}
+	return v, nil
+}
+
+// decrypt decrypts `ALGORITHM,BASE64_DATA`
+func (o *options) decrypt(s string) (string, error) {
+	alg, b64, ok := strings.Cut(s, ",")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return "", err
+	}
+
+	switch alg {
+	case kEncAlgAES256GCM:
+		if o.decryptionKey == nil {
+			return "", fmt.Errorf("decryption key not set")
+		}
+		gcm, err := newGCM(o.decryptionKey)
+		if err != nil {
+			return "", err
+		}
+		if len(data) < gcm.NonceSize() {
+			return "", fmt.Errorf("malformed encrypted value")
+		}
+		plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+		return string(plaintext), err
+	case kEncAlgKMS:
+		if o.kms == nil {
+			return "", fmt.Errorf("KMSProvider not set")
+		}
+		plaintext, err := o.kms.Decrypt(data)
+		return string(plaintext), err
+	}
+	return "", fmt.Errorf("unsupported encryption algorithm: %s", alg)
+}
@@ -0,0 +1,98 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type reverseKMS struct{}
+
+func (reverseKMS) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, errors.New("empty ciphertext")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	for i, b := range ciphertext {
+		plaintext[len(ciphertext)-1-i] = b
+	}
+	return plaintext, nil
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	enc, err := Encrypt(key, "p@ssw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enc, "ENC[AES256_GCM,") || !strings.HasSuffix(enc, "]") {
+		t.Fatalf("Unexpected format: %s", enc)
+	}
+	if enc2, _ := Encrypt(key, "p@ssw0rd"); enc2 == enc {
+		t.Error("Nonce should be random")
+	}
+	if _, err := Encrypt(key[:16], "x"); err == nil {
+		t.Error("Encrypt should reject keys which are not 32 bytes")
+	}
+
+	o := &options{decryptionKey: key, kms: reverseKMS{}}
+	kmsValue := "ENC[KMS," + base64.StdEncoding.EncodeToString([]byte("terces")) + "]"
+	v, err := o.decryptValues(map[string]interface{}{
+		"db":    map[string]interface{}{"password": enc, "user": "root"},
+		"token": kmsValue,
+		"list":  []interface{}{1, enc},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]interface{})
+	if m["db"].(map[string]interface{})["password"] != "p@ssw0rd" || m["db"].(map[string]interface{})["user"] != "root" ||
+		m["token"] != "secret" || m["list"].([]interface{})[1] != "p@ssw0rd" {
+		t.Errorf("Unexpected decrypted values: %v", m)
+	}
+
+	b64 := enc[len("ENC[AES256_GCM,") : len(enc)-1]
+	data, _ := base64.StdEncoding.DecodeString(b64)
+	for name, tc := range map[string]struct {
+		opts  *options
+		value string
+		msg   string
+	}{
+		"wrong key":         {&options{decryptionKey: bytes.Repeat([]byte{2}, 32)}, enc, "authentication failed"},
+		"key not set":       {&options{}, enc, "decryption key not set"},
+		"bad key size":      {&options{decryptionKey: key[:16]}, enc, "32 bytes"},
+		"malformed base64":  {o, "ENC[AES256_GCM,not base64!]", "illegal base64"},
+		"short nonce":       {o, "ENC[AES256_GCM," + base64.StdEncoding.EncodeToString(data[:8]) + "]", "malformed encrypted value"},
+		"tampered":          {o, "ENC[AES256_GCM," + base64.StdEncoding.EncodeToString(append(data[:len(data)-1:len(data)-1], data[len(data)-1]^1)) + "]", "authentication failed"},
+		"no algorithm":      {o, "ENC[abc]", "malformed encrypted value"},
+		"unknown algorithm": {o, "ENC[DES,YWJj]", "unsupported encryption algorithm"},
+		"KMS not set":       {&options{}, kmsValue, "KMSProvider not set"},
+		"KMS failure":       {o, "ENC[KMS,]", "empty ciphertext"},
+	} {
+		_, err := tc.opts.decryptValues(map[string]interface{}{"a": []interface{}{tc.value}}, "")
+		if err == nil || !strings.Contains(err.Error(), tc.msg) || !strings.Contains(err.Error(), "a[0]") {
+			t.Errorf("%s: expecting error containing %q, but gets %v", name, tc.msg, err)
+		}
+	}
+}
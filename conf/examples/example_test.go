@@ -46,7 +46,7 @@ type ExampleConfig struct {
 }
 
 // An example for reading configurations from ENV
-func ExampleConfFromEnv() {
+func Example_fromEnv() {
 	c := conf.New[ExampleConfig](
 		conf.WithTagName("json"),   // Tag name must match with the tag name defined inside the struct for unmarshalling the configurations. Default tag name is mapstructure
 		conf.WithStores(env.New()), // Create a Store object for reading configurations from ENV
@@ -76,7 +76,7 @@ func ExampleConfFromEnv() {
 }
 
 // An example for reading configurations from local files
-func ExampleConfFromFile() {
+func Example_fromFile() {
 	c := conf.New[ExampleConfig](
 		conf.WithTagName("json"), // Tag name must match with the tag name defined inside the struct for unmarshalling the configurations. Default tag name is mapstructure
 		conf.WithStores(file.New(file.WithConfigPaths(file.ConfigPath{Path: "./conf.yaml"}))), // Create a Store object for reading configurations from local files
@@ -91,8 +91,42 @@ func ExampleConfFromFile() {
 	log.Println(*bc)
 }
 
+// An example for splitting configurations into fragments with the $include directive
+func Example_include() {
+	c := conf.New[ExampleConfig](
+		conf.WithTagName("json"),
+		// Fragments included by include.yaml are resolved relative to include.yaml and merged before parsing
+		conf.WithStores(file.New(file.WithConfigPaths(file.ConfigPath{Path: "include.yaml"}))),
+	)
+
+	bc, err := c.Parse()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	log.Println(*bc)
+}
+
+// An example for selecting a profile from a multi-document YAML
+func Example_profile() {
+	c := conf.New[ExampleConfig](
+		conf.WithTagName("json"),
+		// Documents without profile and documents of profile prod inside profiles.yaml are merged before parsing
+		conf.WithStores(file.New(file.WithConfigPaths(file.ConfigPath{Path: "profiles.yaml"}), file.WithProfile("prod"))),
+	)
+
+	bc, err := c.Parse()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	log.Println(*bc)
+}
+
 // An example for reading configurations from Apollo
-func ExampleConfFromApollo() {
+func Example_fromApollo() {
 	// Create an object for reading Apollo Access Key from a local file.
 	// This object can also be used to get configurations to override the configurations from other stores.
 	l, err := apollo.NewLocalConfig(
@@ -139,6 +173,33 @@ func ExampleConfFromApollo() {
 	c.Unwatch() // Stop watching
 }
 
+// An example for watching the changed fields of the configurations
+func Example_watchEvents() {
+	c := conf.New[ExampleConfig](
+		conf.WithTagName("json"),
+		conf.WithStores(apollo.New(apollo.WithAppID("APP_ID"), apollo.EnableWatch())),
+	)
+
+	_, err := c.Parse() // The configuration parsed here is notified as `ev.Old` on the first change
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = c.WatchEvents(func(ev *conf.ConfigEvent[ExampleConfig]) {
+		if ev.Changed("Locale") { // Only reacts to changes of Locale, such as Locale.DefaultLanguage
+			log.Println(ev.Old.Locale, "->", ev.New.Locale)
+		}
+		log.Println(ev.Diff) // All the changed fields
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.Unwatch() // Stop watching
+}
+
 // An example for using template in configurations
 func ExampleTemplateData() {
 	t, err := tdata.New(
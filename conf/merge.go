@@ -0,0 +1,107 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergeStrategy decides how configurations from a Store are merged with those from Stores of lower precedence
+type MergeStrategy int
+
+const (
+	// MergeDeep merges mappings recursively. Keys from the Store of higher precedence override the same keys from others,
+	// while keys only defined by the Stores of lower precedence are kept. Arrays are replaced as a whole, not merged
+	MergeDeep MergeStrategy = iota
+	// MergeAppend is like MergeDeep, but arrays are appended to the arrays of the same keys instead of replacing them
+	MergeAppend
+	// MergeReplace replaces the values of the top-level keys defined by the Store as a whole.
+	// For example, if the Store defines `database`, all the keys under `database` from Stores of lower precedence are dropped
+	MergeReplace
+)
+
+// mergeMaps merges `src` into `dst` according to `strategy`
+func mergeMaps(dst, src map[string]interface{}, strategy MergeStrategy) {
+	for k, v := range src {
+		if strategy == MergeReplace {
+			dst[k] = v
+			continue
+		}
+
+		switch sv := v.(type) {
+		case map[string]interface{}:
+			if dm, ok := dst[k].(map[string]interface{}); ok {
+				mergeMaps(dm, sv, strategy)
+				continue
+			}
+		case []interface{}:
+			if ds, ok := dst[k].([]interface{}); ok && strategy == MergeAppend {
+				dst[k] = append(ds[:len(ds):len(ds)], sv...)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// lowerKeys lowercases keys of the mappings inside `v` recursively, because keys are case-insensitive
+func lowerKeys(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, sub := range val {
+			m[strings.ToLower(k)] = lowerKeys(sub)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, sub := range val {
+			m[strings.ToLower(fmt.Sprint(k))] = lowerKeys(sub)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, sub := range val {
+			s[i] = lowerKeys(sub)
+		}
+		return s
+	}
+	return v
+}
+
+// deepCopy copies the mappings and arrays inside `v` recursively, so that merging won't modify `v`
+func deepCopy(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, sub := range val {
+			m[k] = deepCopy(sub)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, sub := range val {
+			s[i] = deepCopy(sub)
+		}
+		return s
+	}
+	return v
+}
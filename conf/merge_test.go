@@ -0,0 +1,111 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antigloss/go/conf/store/file"
+)
+
+func TestMergeMaps(t *testing.T) {
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name":  "base",
+			"db":    map[string]interface{}{"host": "localhost", "port": 3306},
+			"hosts": []interface{}{"a", "b"},
+		}
+	}
+	override := map[string]interface{}{
+		"db":    map[string]interface{}{"port": 3307},
+		"hosts": []interface{}{"c"},
+		"extra": 1,
+	}
+
+	for _, tc := range []struct {
+		strategy MergeStrategy
+		expected string
+	}{
+		{MergeDeep, "map[db:map[host:localhost port:3307] extra:1 hosts:[c] name:base]"},
+		{MergeAppend, "map[db:map[host:localhost port:3307] extra:1 hosts:[a b c] name:base]"},
+		{MergeReplace, "map[db:map[port:3307] extra:1 hosts:[c] name:base]"},
+	} {
+		dst := base()
+		hosts := dst["hosts"].([]interface{})
+		mergeMaps(dst, deepCopy(override).(map[string]interface{}), tc.strategy)
+		if s := fmt.Sprint(dst); s != tc.expected {
+			t.Errorf("strategy %d: unexpected result %s, expecting %s", tc.strategy, s, tc.expected)
+		}
+		if fmt.Sprint(hosts) != "[a b]" || fmt.Sprint(override["hosts"]) != "[c]" {
+			t.Errorf("strategy %d: merged arrays should not be modified", tc.strategy)
+		}
+	}
+
+	if s := fmt.Sprint(lowerKeys(map[string]interface{}{"DB": map[interface{}]interface{}{"Host": 1}, "L": []interface{}{map[string]interface{}{"K": 2}}})); s != "map[db:map[host:1] l:[map[k:2]]]" {
+		t.Errorf("Keys should be lowercased recursively: %s", s)
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	type config struct {
+		Name  string
+		Hosts []string
+		DB    struct {
+			Host string
+			Port int
+		}
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) file.ConfigPath {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file.ConfigPath{Path: p}
+	}
+	base := file.New(file.WithConfigPaths(write("base.yaml", "name: base\nhosts: [a, b]\ndb:\n  host: localhost\n  port: 3306\n")))
+	hosts := file.New(file.WithConfigPaths(write("hosts.yaml", "hosts: [c]\n")))
+	db := file.New(file.WithConfigPaths(write("db.yaml", "db:\n  port: 3307\n")))
+
+	c := New[config](
+		WithStores(base, hosts, db),
+		WithMergeStrategy(hosts, MergeAppend),
+		WithMergeStrategy(db, MergeReplace),
+	)
+	cfg, err := c.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(*cfg); s != "{base [a b c] { 3307}}" {
+		t.Errorf("Unexpected configuration: %s", s)
+	}
+
+	c = New[config](WithStores(base, hosts, db), WithStorePriority(base, 1))
+	if cfg, err = c.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(*cfg); s != "{base [a b] {localhost 3306}}" {
+		t.Errorf("Store with higher priority should take precedence: %s", s)
+	}
+}
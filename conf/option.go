@@ -21,8 +21,11 @@ package conf
 
 import (
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/antigloss/go/conf/store"
+	"github.com/antigloss/go/utils/clock"
 )
 
 // WithStores sets Stores to ConfigParser
@@ -43,19 +46,97 @@ func WithTagName(tag string) option {
 // It returns the decoded value as interface{} on success, otherwise, an error is returned.
 type DecodeHook func(to reflect.Type, data string) (interface{}, error)
 
-// WithDecodeHook sets a user-defined decoder
+// WithDecodeHook sets a user-defined decoder.
+// Built-in decoders for time.Time (such as `2006-01-02` or RFC3339) and int64 byte sizes (such as `512MB`, in powers of 1024)
+// still apply if `hook` returns the data string as is. time.Duration (such as `30s`) is decoded before `hook` is called
 func WithDecodeHook(hook DecodeHook) option {
 	return func(o *options) {
 		o.hook = hook
 	}
 }
 
+// WithEnvPrefix enables overriding configurations with ENV named after the keys of the fields.
+// For example, with prefix `APP`, ENV `APP_SERVER_PORT` overrides the field with key `server.port`.
+//
+// Fields tagged with `env:"NAME"` are always overridden by ENV `NAME` if it's set, no matter whether prefix is set or not.
+// Values from ENV take precedence over values from all Stores.
+func WithEnvPrefix(prefix string) option {
+	return func(o *options) {
+		o.envPrefix = strings.TrimSuffix(prefix, "_")
+	}
+}
+
+// WithStorePriority sets the priority of Store `s`, which must be one of the Stores set by WithStores.
+// Configurations from Stores with higher priorities take precedence over those with lower priorities.
+// Stores with the same priority (default is 0) take precedence by their order in WithStores, the latter the higher
+func WithStorePriority(s store.Store, priority int) option {
+	return func(o *options) {
+		if o.priorities == nil {
+			o.priorities = map[store.Store]int{}
+		}
+		o.priorities[s] = priority
+	}
+}
+
+// WithMergeStrategy sets how configurations from Store `s` are merged with those from Stores of lower precedence.
+// Default is MergeDeep
+func WithMergeStrategy(s store.Store, strategy MergeStrategy) option {
+	return func(o *options) {
+		if o.strategies == nil {
+			o.strategies = map[store.Store]MergeStrategy{}
+		}
+		o.strategies[s] = strategy
+	}
+}
+
+// WithPollInterval enables reloading all Stores every `d` while watching, which gives hot reload for Stores
+// without native watching, such as files and ENV. Reloaded configurations are compared with the previous ones,
+// and the changed keys are notified via the callback of Watch/WatchEvents
+func WithPollInterval(d time.Duration) option {
+	return func(o *options) {
+		o.pollInterval = d
+	}
+}
+
+// WithClock sets the source of the time used for polling set by WithPollInterval. Default is clock.Real.
+// Set it to a clock.Fake to test hot reload without sleeping.
+func WithClock(c clock.Clock) option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithDecryptionKey sets the AES-256 key (32 bytes) for decrypting values in the form of `ENC[AES256_GCM,BASE64_DATA]`
+// from all Stores. Values are decrypted transparently before unmarshalling, so secrets can live in git-managed files.
+// Use Encrypt to generate encrypted values
+func WithDecryptionKey(key []byte) option {
+	return func(o *options) {
+		o.decryptionKey = key
+	}
+}
+
+// WithKMSProvider sets the KMSProvider for decrypting values in the form of `ENC[KMS,BASE64_DATA]` from all Stores
+func WithKMSProvider(p KMSProvider) option {
+	return func(o *options) {
+		o.kms = p
+	}
+}
+
 type option func(opts *options)
 
 type options struct {
-	stores  []store.Store
-	tagName string
-	hook    DecodeHook
+	stores     []store.Store
+	tagName    string
+	hook       DecodeHook
+	envPrefix  string
+	priorities map[store.Store]int
+	strategies map[store.Store]MergeStrategy
+
+	pollInterval time.Duration
+	clock        clock.Clock
+
+	decryptionKey []byte
+	kms           KMSProvider
 }
 
 func (o *options) apply(opts ...option) {
@@ -0,0 +1,148 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	kConfTagName    = "conf"   // Tag for specifying field attributes, such as `conf:"secret"`
+	kConfTagSecret  = "secret" // Marks the field as a secret, which is masked by Redacted
+	kRedactedString = "******"
+)
+
+// Redacted renders the configuration `cfg` (typically returned by ConfigParser.Parse) in the same format as `%+v`,
+// but with the values of fields tagged with `conf:"secret"` masked, so that the effective configuration can be logged safely.
+// RSA private keys are always masked. Empty secrets are rendered as they are, so that missing secrets can still be spotted.
+//
+//	type Config struct {
+//		Database struct {
+//			Host     string
+//			Password string `conf:"secret"`
+//		}
+//	}
+//
+//	log.Println(conf.Redacted(cfg)) // &{Database:{Host:127.0.0.1 Password:******}}
+func Redacted(cfg interface{}) string {
+	var sb strings.Builder
+	writeRedacted(&sb, reflect.ValueOf(cfg), true)
+	return sb.String()
+}
+
+func writeRedacted(sb *strings.Builder, v reflect.Value, top bool) {
+	if !v.IsValid() {
+		sb.WriteString("<nil>")
+		return
+	}
+
+	if v.Type() == reflect.TypeOf(rsa.PrivateKey{}) {
+		sb.WriteString(kRedactedString)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			sb.WriteString("<nil>")
+			return
+		}
+		if top {
+			sb.WriteByte('&')
+		} else if v.Elem().Kind() != reflect.Struct {
+			fmt.Fprint(sb, v.Interface())
+			return
+		}
+		writeRedacted(sb, v.Elem(), false)
+	case reflect.Interface:
+		writeRedacted(sb, v.Elem(), false)
+	case reflect.Struct:
+		if _, ok := v.Interface().(fmt.Stringer); ok { // such as time.Time
+			fmt.Fprint(sb, v.Interface())
+			return
+		}
+
+		t := v.Type()
+		sb.WriteByte('{')
+		first := true
+		for i := 0; i < t.NumField(); i++ {
+			ft := t.Field(i)
+			if !ft.IsExported() {
+				continue
+			}
+			if !first {
+				sb.WriteByte(' ')
+			}
+			first = false
+
+			sb.WriteString(ft.Name)
+			sb.WriteByte(':')
+			if isSecret(ft) && !v.Field(i).IsZero() {
+				sb.WriteString(kRedactedString)
+				continue
+			}
+			writeRedacted(sb, v.Field(i), false)
+		}
+		sb.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 { // []byte
+			fmt.Fprint(sb, v.Interface())
+			return
+		}
+		sb.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			writeRedacted(sb, v.Index(i), false)
+		}
+		sb.WriteByte(']')
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		sb.WriteString("map[")
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprint(sb, k.Interface())
+			sb.WriteByte(':')
+			writeRedacted(sb, v.MapIndex(k), false)
+		}
+		sb.WriteByte(']')
+	default:
+		fmt.Fprint(sb, v.Interface())
+	}
+}
+
+func isSecret(ft reflect.StructField) bool {
+	for _, attr := range strings.Split(ft.Tag.Get(kConfTagName), ",") {
+		if attr == kConfTagSecret {
+			return true
+		}
+	}
+	return false
+}
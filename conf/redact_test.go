@@ -0,0 +1,100 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package conf
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type redactDB struct {
+	Host     string
+	Password string `conf:"secret"`
+}
+
+type redactConfig struct {
+	Name     string
+	Token    string `conf:"secret"`
+	Empty    string `conf:"secret"`
+	DB       redactDB
+	Replica  *redactDB
+	Nil      *redactDB
+	Backups  []redactDB
+	Shards   map[string]*redactDB
+	Any      interface{}
+	Keys     []string `conf:"omitempty,secret"`
+	Raw      []byte
+	Start    time.Time
+	internal redactDB
+}
+
+func TestRedacted(t *testing.T) {
+	start := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	cfg := &redactConfig{
+		Name:     "app",
+		Token:    "t0ken",
+		DB:       redactDB{Host: "db", Password: "p1"},
+		Replica:  &redactDB{Host: "replica", Password: "p2"},
+		Backups:  []redactDB{{Host: "b1", Password: "p3"}, {Host: "b2"}},
+		Shards:   map[string]*redactDB{"s2": {Host: "h2", Password: "p5"}, "s1": {Host: "h1", Password: "p4"}},
+		Any:      redactDB{Host: "any", Password: "p6"},
+		Keys:     []string{"k1"},
+		Raw:      []byte("raw"),
+		Start:    start,
+		internal: redactDB{Host: "internal", Password: "p7"},
+	}
+	before := fmt.Sprintf("%+v", *cfg)
+
+	expected := "&{Name:app Token:****** Empty: DB:{Host:db Password:******} Replica:{Host:replica Password:******} Nil:<nil> " +
+		"Backups:[{Host:b1 Password:******} {Host:b2 Password:}] " +
+		"Shards:map[s1:{Host:h1 Password:******} s2:{Host:h2 Password:******}] Any:{Host:any Password:******} " +
+		"Keys:****** Raw:[114 97 119] Start:2020-01-02 00:00:00 +0000 UTC}"
+	if s := Redacted(cfg); s != expected {
+		t.Errorf("Redacted() = %s\nexpecting %s", s, expected)
+	}
+	if s := Redacted(*cfg); s != expected[1:] {
+		t.Errorf("Redacted() = %s\nexpecting %s", s, expected[1:])
+	}
+	if after := fmt.Sprintf("%+v", *cfg); after != before {
+		t.Errorf("Redacted should not modify the configuration:\n%s\n%s", before, after)
+	}
+
+	m := map[string]redactDB{"main": {Host: "db", Password: "p"}}
+	if s := Redacted(m); s != "map[main:{Host:db Password:******}]" {
+		t.Errorf("Redacted() = %s", s)
+	}
+	if s := Redacted([]*redactDB{{Password: "p"}, nil}); s != "[{Host: Password:******} <nil>]" {
+		t.Errorf("Redacted() = %s", s)
+	}
+	if s := Redacted(nil); s != "<nil>" {
+		t.Errorf("Redacted() = %s", s)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := Redacted(struct{ Key *rsa.PrivateKey }{key}); s != "{Key:******}" {
+		t.Errorf("RSA private keys should be masked: %s", s)
+	}
+}
@@ -22,7 +22,9 @@ package apollo
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/magiconair/properties"
@@ -50,11 +52,20 @@ func New(opts ...option) store.Store {
 
 type apolloStore struct {
 	opts      options
-	client    apollo.Apollo
+	apps      []*appConf
 	watchOnce sync.Once
 	unwatchCh chan int
 }
 
+type appConf struct {
+	appID      string
+	accessKey  string
+	namespaces []string
+	client     apollo.Apollo
+	grayLock   sync.Mutex
+	grayConfs  map[string]apollo.Configurations // latest configurations fetched for gray releases, keyed by namespace
+}
+
 // Load reads configurations from Apollo
 func (a *apolloStore) Load() ([]store.ConfigContent, error) {
 	err := a.opts.validate()
@@ -62,22 +73,31 @@ func (a *apolloStore) Load() ([]store.ConfigContent, error) {
 		return nil, err
 	}
 
-	a.client, err = apollo.New(a.opts.addr, a.opts.appID, apollo.AutoFetchOnCacheMiss(), apollo.Cluster(a.opts.cluster),
-		apollo.AccessKey(a.opts.accessKey), apollo.PreloadNamespaces(a.opts.namespaces...))
-	if err != nil {
-		return nil, err
-	}
-
-	contents := make([]store.ConfigContent, len(a.opts.namespaces), len(a.opts.namespaces)+1)
-	for i, ns := range a.opts.namespaces {
-		contents[i].Type, err = store.ConfigType(ns)
-		if err != nil {
+	if len(a.apps) == 0 {
+		if a.apps, err = a.newApps(); err != nil {
 			return nil, err
 		}
+	} else {
+		// Clients are created once. When reloaded, they long poll Apollo to keep their cached configurations up to date
+		for _, app := range a.apps {
+			_ = app.client.Start()
+		}
+	}
 
-		contents[i].Content, err = a.nsToContent(ns, contents[i].Type)
-		if err != nil {
-			return nil, err
+	var contents []store.ConfigContent
+	for _, app := range a.apps {
+		for _, ns := range app.namespaces {
+			var content store.ConfigContent
+			content.Type, err = store.ConfigType(ns)
+			if err != nil {
+				return nil, err
+			}
+
+			content.Type, content.Content, err = a.nsToContent(app, ns, content.Type)
+			if err != nil {
+				return nil, err
+			}
+			contents = append(contents, content)
 		}
 	}
 
@@ -103,58 +123,56 @@ func (a *apolloStore) Load() ([]store.ConfigContent, error) {
 	if err != nil {
 		return nil, err
 	}
-	contents = append(contents, store.ConfigContent{Type: store.ConfigTypeDefault, Content: buff.Bytes()})
+	localContent := store.ConfigContent{Type: store.ConfigTypeDefault, Content: buff.Bytes()}
+	if a.opts.expandKeys {
+		localContent.Type = store.ConfigTypeJSON
+		localContent.Content, err = expandProps(localContent.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: local config", err.Error())
+		}
+	}
+	contents = append(contents, localContent)
 
 	return contents, nil
 }
 
+// newApps creates the Apollo clients of all apps. Namespaces of extra apps come first, so that they are overridden by namespaces of the main app
+func (a *apolloStore) newApps() ([]*appConf, error) {
+	var apps []*appConf
+	for _, extra := range a.opts.extraApps {
+		apps = append(apps, &appConf{appID: extra.appID, accessKey: a.opts.accessKeyOf(extra.appID), namespaces: extra.namespaces})
+	}
+	apps = append(apps, &appConf{appID: a.opts.appID, accessKey: a.opts.accessKey, namespaces: a.opts.namespaces})
+
+	for _, app := range apps {
+		var err error
+		app.client, err = apollo.New(a.opts.addr, app.appID, apollo.AutoFetchOnCacheMiss(), apollo.Cluster(a.opts.cluster),
+			apollo.AccessKey(app.accessKey), apollo.PreloadNamespaces(app.namespaces...))
+		if err != nil {
+			return nil, err
+		}
+		if a.opts.isGray() {
+			app.grayConfs = map[string]apollo.Configurations{}
+		}
+	}
+	return apps, nil
+}
+
 // Watch watches configuration changes from Apollo
 func (a *apolloStore) Watch(ch chan<- *store.ConfigChanges) error {
 	if !a.opts.watch {
 		return nil
 	}
 
-	if a.client == nil {
+	if len(a.apps) == 0 {
 		return fmt.Errorf("`Load()` must be called before `Watch()`")
 	}
 
 	a.watchOnce.Do(func() {
-		_ = a.client.Start()
-		watchCh := a.client.Watch()
-
-		go func() {
-			for {
-				select {
-				case resp := <-watchCh:
-					confType, err := store.ConfigType(resp.Namespace)
-					if err != nil {
-						continue
-					}
-
-					changes := &store.ConfigChanges{
-						Config: store.ConfigContent{Type: confType},
-					}
-					changes.Config.Content, _ = a.confToContent(resp.NewValue, resp.Namespace, confType)
-					if changes.Config.Content == nil {
-						continue
-					}
-
-					for _, change := range resp.Changes {
-						c := store.ConfigChange{Key: change.Key}
-						if change.Type == apollo.ChangeTypeUpdate {
-							c.Type = store.ChangeTypeUpdated
-						} else if change.Type == apollo.ChangeTypeDelete {
-							c.Type = store.ChangeTypeDeleted
-						}
-						changes.Changes = append(changes.Changes, c)
-					}
-
-					ch <- changes
-				case <-a.unwatchCh:
-					return
-				}
-			}
-		}()
+		for _, app := range a.apps {
+			_ = app.client.Start()
+			go a.watchApp(app, app.client.Watch(), ch)
+		}
 	})
 
 	return nil
@@ -162,17 +180,84 @@ func (a *apolloStore) Watch(ch chan<- *store.ConfigChanges) error {
 
 // Unwatch stops watching
 func (a *apolloStore) Unwatch() {
-	a.client.Stop()
+	for _, app := range a.apps {
+		app.client.Stop()
+	}
 	close(a.unwatchCh)
 }
 
-func (a *apolloStore) nsToContent(ns, confType string) ([]byte, error) {
-	return a.confToContent(a.client.GetNameSpace(ns), ns, confType)
+func (a *apolloStore) watchApp(app *appConf, watchCh <-chan *apollo.ApolloResponse, ch chan<- *store.ConfigChanges) {
+	for {
+		select {
+		case resp := <-watchCh:
+			confType, err := store.ConfigType(resp.Namespace)
+			if err != nil {
+				continue
+			}
+
+			conf := resp.NewValue
+			var changes []store.ConfigChange
+			if a.opts.isGray() {
+				// The notified value is the main release. Fetch again to get the release this client is grayed to
+				conf, err = a.fetchNamespace(app, resp.Namespace)
+				if err != nil {
+					continue
+				}
+				app.grayLock.Lock()
+				old := app.grayConfs[resp.Namespace]
+				app.grayConfs[resp.Namespace] = conf
+				app.grayLock.Unlock()
+				changes = store.DiffKeys(old, conf)
+				if len(changes) == 0 {
+					continue
+				}
+			} else {
+				for _, change := range resp.Changes {
+					c := store.ConfigChange{Key: change.Key}
+					if change.Type == apollo.ChangeTypeUpdate {
+						c.Type = store.ChangeTypeUpdated
+					} else if change.Type == apollo.ChangeTypeDelete {
+						c.Type = store.ChangeTypeDeleted
+					}
+					changes = append(changes, c)
+				}
+			}
+
+			cfgChanges := &store.ConfigChanges{
+				Config:  store.ConfigContent{Type: confType},
+				Changes: changes,
+			}
+			cfgChanges.Config.Type, cfgChanges.Config.Content, _ = a.confToContent(app, conf, resp.Namespace, confType)
+			if cfgChanges.Config.Content == nil {
+				continue
+			}
+
+			ch <- cfgChanges
+		case <-a.unwatchCh:
+			return
+		}
+	}
+}
+
+func (a *apolloStore) nsToContent(app *appConf, ns, confType string) (string, []byte, error) {
+	if !a.opts.isGray() {
+		return a.confToContent(app, app.client.GetNameSpace(ns), ns, confType)
+	}
+
+	conf, err := a.fetchNamespace(app, ns)
+	if err != nil {
+		return "", nil, err
+	}
+	app.grayLock.Lock()
+	app.grayConfs[ns] = conf
+	app.grayLock.Unlock()
+	return a.confToContent(app, conf, ns, confType)
 }
 
-func (a *apolloStore) confToContent(conf apollo.Configurations, ns, confType string) ([]byte, error) {
+// confToContent converts `conf` to configuration content. It returns the final configuration format and the content
+func (a *apolloStore) confToContent(app *appConf, conf apollo.Configurations, ns, confType string) (string, []byte, error) {
 	if len(conf) == 0 {
-		return nil, fmt.Errorf("empty apollo conf. addr=%s app=%s cluster=%s ns=%s", a.opts.addr, a.opts.appID, a.opts.cluster, ns)
+		return "", nil, fmt.Errorf("empty apollo conf. addr=%s app=%s cluster=%s ns=%s", a.opts.addr, app.appID, a.opts.cluster, ns)
 	}
 
 	var cont []byte
@@ -181,24 +266,32 @@ func (a *apolloStore) confToContent(conf apollo.Configurations, ns, confType str
 	switch confType {
 	case store.ConfigTypeDefault:
 		cont, err = propsToContent(conf)
-	case store.ConfigTypeJSON, store.ConfigTypeYAML, store.ConfigTypeYML:
+	case store.ConfigTypeJSON, store.ConfigTypeYAML, store.ConfigTypeYML, store.ConfigTypeTOML, store.ConfigTypeINI, store.ConfigTypeHCL:
 		cont, err = getContent(conf)
 	default:
 		err = fmt.Errorf("unsupported configuration type")
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("%s: %s-%s", err.Error(), a.opts.appID, ns)
+		return "", nil, fmt.Errorf("%s: %s-%s", err.Error(), app.appID, ns)
 	}
 
 	if a.opts.tData != nil {
 		cont, err = a.opts.tData.Replace(cont)
 		if err != nil {
-			return nil, fmt.Errorf("%s: %s-%s", err.Error(), a.opts.appID, ns)
+			return "", nil, fmt.Errorf("%s: %s-%s", err.Error(), app.appID, ns)
 		}
 	}
 
-	return cont, nil
+	if a.opts.expandKeys && confType == store.ConfigTypeDefault {
+		cont, err = expandProps(cont)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %s-%s", err.Error(), app.appID, ns)
+		}
+		confType = store.ConfigTypeJSON
+	}
+
+	return confType, cont, nil
 }
 
 const (
@@ -223,6 +316,42 @@ func propsToContent(conf map[string]interface{}) ([]byte, error) {
 	return buff.Bytes(), nil
 }
 
+// expandProps expands dotted keys of the properties content into nested objects, and returns them in JSON format.
+// For example, `server.http.port=80` is expanded into `{"server":{"http":{"port":"80"}}}`.
+func expandProps(cont []byte) ([]byte, error) {
+	p, err := properties.Load(cont, properties.UTF8)
+	if err != nil {
+		return nil, err
+	}
+
+	root := map[string]interface{}{}
+	for _, key := range p.Keys() {
+		val, _ := p.Get(key)
+		path := strings.Split(key, ".")
+		m := root
+		for i, k := range path[:len(path)-1] {
+			switch sub := m[k].(type) {
+			case nil:
+				next := map[string]interface{}{}
+				m[k] = next
+				m = next
+			case map[string]interface{}:
+				m = sub
+			default:
+				return nil, fmt.Errorf("key conflicts: %s and %s", strings.Join(path[:i+1], "."), key)
+			}
+		}
+
+		k := path[len(path)-1]
+		if _, ok := m[k]; ok {
+			return nil, fmt.Errorf("key conflicts: %s", key)
+		}
+		m[k] = val
+	}
+
+	return json.Marshal(root)
+}
+
 func getContent(conf map[string]interface{}) ([]byte, error) {
 	data, ok := conf[bulkConfigKey]
 	if !ok || data == nil || len(conf) != 1 {
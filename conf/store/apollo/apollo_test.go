@@ -0,0 +1,257 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package apollo
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/antigloss/go/conf"
+)
+
+// apolloServer is a fake Apollo Config Service
+type apolloServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	confs    map[string]map[string]string // keyed by `appID/namespace`, or `appID/namespace#label` for gray releases
+	keys     map[string]string            // access keys of the apps
+	gray     []string                     // requests for gray releases, in the form of `appID/cluster/namespace?query`
+	requests int
+	errs     []string
+}
+
+func newApolloServer(t *testing.T, confs map[string]map[string]string, keys map[string]string) *apolloServer {
+	// The Apollo client backs up configurations into the working directory
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	srv := &apolloServer{confs: confs, keys: keys}
+	srv.Server = httptest.NewServer(http.HandlerFunc(srv.serve))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *apolloServer) serve(w http.ResponseWriter, r *http.Request) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "configs" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	appID, cluster, ns := parts[1], parts[2], parts[3]
+	srv.requests++
+
+	query := r.URL.Query()
+	if _, ok := query["releaseKey"]; !ok { // Requests from fetchNamespace
+		srv.gray = append(srv.gray, appID+"/"+cluster+"/"+ns+"?"+r.URL.RawQuery)
+		if key := srv.keys[appID]; key != "" {
+			mac := hmac.New(sha1.New, []byte(key))
+			mac.Write([]byte(r.Header.Get("Timestamp") + "\n" + r.URL.RequestURI()))
+			if r.Header.Get("Authorization") != "Apollo "+appID+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+				srv.errs = append(srv.errs, "bad signature: "+r.URL.RequestURI())
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+	}
+
+	conf, ok := srv.confs[appID+"/"+ns+"#"+query.Get("label")]
+	if !ok {
+		conf, ok = srv.confs[appID+"/"+ns]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"appId":          appID,
+		"cluster":        cluster,
+		"namespaceName":  ns,
+		"configurations": conf,
+		"releaseKey":     "r1",
+	})
+}
+
+func (srv *apolloServer) stats() (requests int, gray []string, errs []string) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.requests, append([]string(nil), srv.gray...), append([]string(nil), srv.errs...)
+}
+
+func TestLoadExtraApps(t *testing.T) {
+	srv := newApolloServer(t, map[string]map[string]string{
+		"platform/application": {"log.level": "info", "shared": "platform"},
+		"platform/db.yaml":     {"content": "db:\n  host: platform.db\n  port: 3306\n"},
+		"svc/application":      {"shared": "svc", "port": "80"},
+		"svc/db.yaml":          {"content": "db:\n  host: svc.db\n"},
+	}, nil)
+
+	s := New(WithURL(srv.URL), WithAppID("svc"), WithCluster("dev"), WithNamespaces("application", "db.yaml"),
+		WithExtraApp("platform", "application", "db.yaml"), ExpandPropertiesKeys())
+	contents, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Namespaces of extra apps come first
+	var conts []string
+	for _, cont := range contents {
+		conts = append(conts, cont.Type+":"+strings.TrimSpace(string(cont.Content)))
+	}
+	expected := `json:{"log":{"level":"info"},"shared":"platform"}|yaml:db:` + "\n" + `  host: platform.db` + "\n" +
+		`  port: 3306|json:{"port":"80","shared":"svc"}|yaml:db:` + "\n" + `  host: svc.db`
+	if s := strings.Join(conts, "|"); s != expected {
+		t.Errorf("Unexpected contents:\n%s\nexpecting:\n%s", s, expected)
+	}
+
+	// Apollo clients are reused when reloaded
+	requests, gray, _ := srv.stats()
+	if _, err = s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _, _ := srv.stats(); n != requests || len(gray) != 0 {
+		t.Errorf("Reloading should read from the clients created before, requests: %d -> %d, gray: %v", requests, n, gray)
+	}
+
+	// Keys from the main app override those from the extra app
+	type config struct {
+		Log struct {
+			Level string
+		}
+		Shared string
+		Port   int
+		DB     struct {
+			Host string
+			Port int
+		}
+	}
+	cfg, err := conf.New[config](conf.WithStores(s)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprintf("%+v", *cfg); s != "{Log:{Level:info} Shared:svc Port:80 DB:{Host:svc.db Port:3306}}" {
+		t.Errorf("Unexpected configuration: %s", s)
+	}
+}
+
+func TestGrayRelease(t *testing.T) {
+	srv := newApolloServer(t, map[string]map[string]string{
+		"platform/application":        {"shared": "platform"},
+		"svc/application":             {"feature": "off"},
+		"svc/application#canary":      {"feature": "on"},
+		"platform/application#canary": {"shared": "platform canary"},
+	}, map[string]string{"svc": "svc-key", "platform": "platform-key"})
+
+	s := New(WithURL(srv.URL), WithAppID("svc"), WithCluster("dev"), WithAccessKey("svc-key"),
+		WithExtraApp("platform", "application"), WithAppAccessKey("platform", "platform-key"),
+		WithLabel("canary"), WithClientIP("10.0.0.1"))
+	contents, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 2 || strings.TrimSpace(string(contents[0].Content)) != "shared = platform canary" ||
+		strings.TrimSpace(string(contents[1].Content)) != "feature = on" {
+		t.Errorf("Unexpected contents: %q", contents)
+	}
+
+	_, gray, errs := srv.stats()
+	expected := "[platform/dev/application?ip=10.0.0.1&label=canary svc/dev/application?ip=10.0.0.1&label=canary]"
+	if fmt.Sprint(gray) != expected || len(errs) != 0 {
+		t.Errorf("Unexpected requests: %v, errors: %v", gray, errs)
+	}
+
+	// Client IP alone enables gray releases too
+	s = New(WithURL(srv.URL), WithAppID("svc"), WithCluster("dev"), WithAccessKey("svc-key"), WithClientIP("10.0.0.2"))
+	if contents, err = s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, gray, errs = srv.stats(); gray[len(gray)-1] != "svc/dev/application?ip=10.0.0.2" || len(errs) != 0 {
+		t.Errorf("Unexpected requests: %v, errors: %v", gray, errs)
+	}
+	if strings.TrimSpace(string(contents[0].Content)) != "feature = off" {
+		t.Errorf("Unexpected contents: %q", contents)
+	}
+
+	// Requests for gray releases are signed with the access keys
+	s = New(WithURL(srv.URL), WithAppID("svc"), WithCluster("dev"), WithAccessKey("bad-key"), WithLabel("canary"))
+	if _, err = s.Load(); err == nil || !strings.Contains(err.Error(), "status=401") {
+		t.Errorf("Load() should fail with a bad access key: %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	srv := newApolloServer(t, map[string]map[string]string{"svc/application": {"k": "v"}}, nil)
+	t.Setenv(envAppID, "")
+
+	for _, tc := range []struct {
+		name string
+		opts []option
+	}{
+		{"no AppID", []option{WithURL(srv.URL)}},
+		{"extra app without namespaces", []option{WithURL(srv.URL), WithAppID("svc"), WithExtraApp("platform")}},
+		{"missing namespace", []option{WithURL(srv.URL), WithAppID("svc"), WithNamespaces("application", "missing")}},
+		{"missing namespace of gray releases", []option{WithURL(srv.URL), WithAppID("svc"), WithNamespaces("missing"), WithLabel("canary")}},
+		{"unsupported namespace type", []option{WithURL(srv.URL), WithAppID("svc"), WithNamespaces("app.xml")}},
+	} {
+		if _, err := New(tc.opts...).Load(); err == nil {
+			t.Errorf("%s: Load() should fail", tc.name)
+		}
+	}
+}
+
+func TestExpandProps(t *testing.T) {
+	for _, tc := range []struct {
+		props    string
+		expected string // JSON, or empty if keys conflict
+	}{
+		{"", "{}"},
+		{"port=80\nname=app", `{"name":"app","port":"80"}`},
+		{"server.http.port=80\nserver.http.host=0.0.0.0\nserver.grpc.port=81",
+			`{"server":{"grpc":{"port":"81"},"http":{"host":"0.0.0.0","port":"80"}}}`},
+		{"a.b.c.d.e.f=deep\na.b.x=1", `{"a":{"b":{"c":{"d":{"e":{"f":"deep"}}},"x":"1"}}}`},
+		{"a=1\na.b=2", ""},
+		{"a.b=2\na=1", ""},
+		{"a.b.c=1\na.b=2", ""},
+		{"a.b=1\na.b.c.d=2", ""},
+	} {
+		cont, err := expandProps([]byte(tc.props))
+		if tc.expected == "" {
+			if err == nil || !strings.HasPrefix(err.Error(), "key conflicts") {
+				t.Errorf("expandProps(%q) = %s, %v, expecting key conflicts", tc.props, cont, err)
+			}
+		} else if err != nil || string(cont) != tc.expected {
+			t.Errorf("expandProps(%q) = %s, %v, expecting %s", tc.props, cont, err, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package apollo
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	apollo "github.com/taptap/go-apollo"
+)
+
+var grayClient = &http.Client{Timeout: 10 * time.Second}
+
+// fetchNamespace reads configurations of `ns` from Apollo Config Service, with the client label and IP attached
+// so that Apollo can pick the gray release this client belongs to
+func (a *apolloStore) fetchNamespace(app *appConf, ns string) (apollo.Configurations, error) {
+	query := url.Values{}
+	if a.opts.label != "" {
+		query.Set("label", a.opts.label)
+	}
+	if a.opts.clientIP != "" {
+		query.Set("ip", a.opts.clientIP)
+	}
+	path := fmt.Sprintf("/configs/%s/%s/%s?%s", url.PathEscape(app.appID), url.PathEscape(a.opts.cluster),
+		url.PathEscape(ns), query.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(a.opts.addr, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if app.accessKey != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha1.New, []byte(app.accessKey))
+		mac.Write([]byte(timestamp + "\n" + path))
+		req.Header.Set("Authorization", "Apollo "+app.appID+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		req.Header.Set("Timestamp", timestamp)
+	}
+
+	resp, err := grayClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch apollo conf. status=%d app=%s cluster=%s ns=%s", resp.StatusCode, app.appID, a.opts.cluster, ns)
+	}
+
+	var result struct {
+		Configurations map[string]string `json:"configurations"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s-%s", err.Error(), app.appID, ns)
+	}
+
+	conf := make(apollo.Configurations, len(result.Configurations))
+	for k, v := range result.Configurations {
+		conf[k] = v
+	}
+	return conf, nil
+}
@@ -61,6 +61,40 @@ func WithNamespaces(namespaces ...string) option {
 	}
 }
 
+// WithExtraApp loads namespaces from another AppID in addition to the ones of the main AppID.
+// It's useful for shared platform configurations maintained in a different AppID than service-specific ones.
+// Namespaces of extra apps are overridden by namespaces of the main AppID, and extra apps added later override those added earlier.
+// Access keys of extra apps are read from WithAppAccessKey, or from `apollo-keys` of LocalConfig
+func WithExtraApp(appID string, namespaces ...string) option {
+	return func(o *options) {
+		o.extraApps = append(o.extraApps, extraApp{appID: appID, namespaces: namespaces})
+	}
+}
+
+// WithAppAccessKey sets Apollo Access Key of the extra app `appID`
+func WithAppAccessKey(appID, ak string) option {
+	return func(o *options) {
+		if o.appKeys == nil {
+			o.appKeys = map[string]string{}
+		}
+		o.appKeys[appID] = ak
+	}
+}
+
+// WithLabel sets the client label for Apollo gray releases
+func WithLabel(label string) option {
+	return func(o *options) {
+		o.label = label
+	}
+}
+
+// WithClientIP sets the client IP for Apollo gray releases
+func WithClientIP(ip string) option {
+	return func(o *options) {
+		o.clientIP = ip
+	}
+}
+
 // WithTemplateData sets template data source.
 // Will use configurations from `tData` to replace templates in the configurations read from Apollo
 func WithTemplateData(tData tdata.TemplateData) option {
@@ -77,6 +111,15 @@ func WithLocalConfig(cfg *localConfig) option {
 	}
 }
 
+// ExpandPropertiesKeys expands dotted keys of properties namespaces into nested structures before merging,
+// so that `server.http.port` unmarshals into nested configuration structs the same way YAML namespaces do.
+// Conflicting keys such as `server` and `server.port` are reported as errors instead of silently overwritten.
+func ExpandPropertiesKeys() option {
+	return func(o *options) {
+		o.expandKeys = true
+	}
+}
+
 // EnableWatch enables watching configuration changes
 func EnableWatch() option {
 	return func(o *options) {
@@ -91,6 +134,7 @@ const (
 	envAccessKey  = "APOLLO_ACCESS_KEY"
 	envAccessKey2 = "APOLLO_ACCESSKEY_SECRET"
 	envNamespace  = "APOLLO_NAMESPACE"
+	envLabel      = "APOLLO_LABEL"
 
 	defaultAddr      = "http://apollo.meta"
 	defaultCluster   = "default"
@@ -108,6 +152,16 @@ type options struct {
 	local      *localConfig
 	tData      tdata.TemplateData
 	watch      bool
+	expandKeys bool
+	extraApps  []extraApp
+	appKeys    map[string]string
+	label      string
+	clientIP   string
+}
+
+type extraApp struct {
+	appID      string
+	namespaces []string
 }
 
 func (o *options) apply(opts ...option) {
@@ -153,6 +207,10 @@ func (o *options) apply(opts ...option) {
 		}
 	}
 
+	if o.label == "" {
+		o.label = os.Getenv(envLabel)
+	}
+
 	if o.accessKey == "" && o.appID != "" && o.local != nil {
 		if apolloKeys := o.local.conf["apollo-keys"]; apolloKeys != nil {
 			o.accessKey = apolloKeys[o.appID]
@@ -160,9 +218,30 @@ func (o *options) apply(opts ...option) {
 	}
 }
 
+// accessKeyOf returns Access Key of the extra app `appID`
+func (o *options) accessKeyOf(appID string) string {
+	if ak := o.appKeys[appID]; ak != "" {
+		return ak
+	}
+	if o.local != nil {
+		return o.local.conf["apollo-keys"][appID]
+	}
+	return ""
+}
+
+// isGray reports whether configurations should be read according to gray release rules
+func (o *options) isGray() bool {
+	return o.label != "" || o.clientIP != ""
+}
+
 func (o *options) validate() error {
 	if o.appID == "" {
 		return fmt.Errorf("AppID not specified")
 	}
+	for _, app := range o.extraApps {
+		if app.appID == "" || len(app.namespaces) == 0 {
+			return fmt.Errorf("AppID or namespaces of extra app not specified")
+		}
+	}
 	return nil
 }
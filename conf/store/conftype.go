@@ -20,6 +20,7 @@
 package store
 
 import (
+	"bytes"
 	"fmt"
 	"path/filepath"
 
@@ -32,6 +33,9 @@ const (
 	ConfigTypeYAML    = "yaml"       // YAML
 	ConfigTypeYML     = "yml"        // YAML
 	ConfigTypeEnv     = "env"        // environment
+	ConfigTypeTOML    = "toml"       // TOML
+	ConfigTypeINI     = "ini"        // INI
+	ConfigTypeHCL     = "hcl"        // HCL
 )
 
 // ConfigType uses file extension as configuration format, such as properties, xml, yml, yaml, json...
@@ -50,3 +54,30 @@ func ConfigType(filename string) (string, error) {
 	}
 	return ConfigTypeDefault, nil
 }
+
+// ToMap parses `content` of format `typ` into a map. Keys are lowercased for formats other than JSON and YAML,
+// which are parsed by viper.
+func ToMap(typ string, content []byte) (map[string]interface{}, error) {
+	switch typ {
+	case ConfigTypeJSON, ConfigTypeYAML, ConfigTypeYML:
+		node, err := unmarshalFragment(typ, content)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return map[string]interface{}{}, nil
+		}
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("configuration must be a mapping")
+		}
+		return m, nil
+	}
+
+	v := viper.New()
+	v.SetConfigType(typ)
+	if err := v.ReadConfig(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	return v.AllSettings(), nil
+}
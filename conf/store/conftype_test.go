@@ -0,0 +1,102 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestToMap(t *testing.T) {
+	for _, tc := range []struct {
+		typ      string
+		content  string
+		expected string // result of fmt.Sprint, or empty if an error is expected
+	}{
+		{ConfigTypeJSON, `{"Name": "app", "db": {"port": 3306, "hosts": ["a", "b"]}}`, "map[Name:app db:map[hosts:[a b] port:3306]]"},
+		{ConfigTypeJSON, `{}`, "map[]"},
+		{ConfigTypeJSON, `[1, 2]`, ""},
+		{ConfigTypeYAML, "Name: app\ndb:\n  port: 3306\n  hosts: [a, b]\n", "map[Name:app db:map[hosts:[a b] port:3306]]"},
+		{ConfigTypeYML, "- 1\n", ""},
+		{ConfigTypeTOML, "Name = \"app\"\n[db]\nport = 3306\nhosts = [\"a\", \"b\"]\n", "map[db:map[hosts:[a b] port:3306] name:app]"},
+		{ConfigTypeTOML, "name = \n", ""},
+		{ConfigTypeINI, "Name = app\n[db]\nport = 3306\n", "map[db:map[port:3306] default:map[name:app]]"},
+		{ConfigTypeHCL, "Name = \"app\"\ndb {\n  port = 3306\n  hosts = [\"a\", \"b\"]\n}\n", "map[db:[map[hosts:[a b] port:3306]] name:app]"},
+		{ConfigTypeHCL, "db {", ""},
+		{ConfigTypeDefault, "Name = app\ndb.port = 3306\n", "map[db:map[port:3306] name:app]"},
+	} {
+		m, err := ToMap(tc.typ, []byte(tc.content))
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("ToMap(%s, %q) = %v, expecting an error", tc.typ, tc.content, m)
+			}
+		} else if s := fmt.Sprint(m); err != nil || s != tc.expected {
+			t.Errorf("ToMap(%s, %q) = %s, %v, expecting %s", tc.typ, tc.content, s, err, tc.expected)
+		}
+	}
+}
+
+func TestConfigType(t *testing.T) {
+	for name, expected := range map[string]string{
+		"application":   ConfigTypeDefault,
+		"app.json":      ConfigTypeJSON,
+		"app.yml":       ConfigTypeYML,
+		"app.toml":      ConfigTypeTOML,
+		"app.ini":       ConfigTypeINI,
+		"app.hcl":       ConfigTypeHCL,
+		"app.xml":       "",
+		"conf.d/app.v1": "",
+	} {
+		typ, err := ConfigType(name)
+		if typ != expected || (expected == "") != (err != nil) {
+			t.Errorf("ConfigType(%s) = %s, %v, expecting %s", name, typ, err, expected)
+		}
+	}
+}
+
+func TestResolveIncludesFormats(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yaml":  "$include: [base.toml, log.ini, db.hcl]\nname: main\n",
+		"base.toml":  "Name = \"base\"\nLevel = 1\n",
+		"log.ini":    "[log]\nLevel = debug\n",
+		"db.hcl":     "db {\n  port = 3306\n}\n",
+		"bad.yaml":   "$include: bad.toml\n",
+		"bad.toml":   "name = \n",
+		"props.yaml": "$include: app.properties\n",
+		"env.yaml":   "$include: app.env\n",
+		"noext.yaml": "$include: app\n",
+	})
+
+	m, err := resolveFile(t, filepath.Join(dir, "main.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(m); s != "map[db:[map[port:3306]] level:1 log:map[level:debug] name:main]" {
+		t.Errorf("Unexpected result: %s", s)
+	}
+
+	for _, name := range []string{"bad.yaml", "props.yaml", "env.yaml", "noext.yaml"} {
+		if _, err = resolveFile(t, filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: ResolveIncludes should fail", name)
+		}
+	}
+}
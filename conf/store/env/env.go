@@ -22,13 +22,18 @@ package env
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/antigloss/go/conf/store"
 )
 
-// New creates a Store object to read configurations from os.Environ()
+// New creates a Store object to read configurations from os.Environ().
+// By default, all ENV are read as they are. With WithPrefix, WithSeparator or WithBindings, ENV names are turned
+// into lowercased keys (nested by the separator) instead, so that they can populate nested struct fields predictably.
+// For example, with prefix `MYAPP_` and separator `__`, ENV `MYAPP_DATABASE__HOST` is read as key `database.host`
 func New(opts ...option) store.Store {
 	a := &envStore{}
 	a.opts.apply(opts...)
@@ -41,6 +46,10 @@ type envStore struct {
 
 // Load reads configurations
 func (a *envStore) Load() ([]store.ConfigContent, error) {
+	if a.opts.structured() {
+		return a.loadStructured()
+	}
+
 	buf := bytes.NewBuffer(nil)
 	for _, env := range os.Environ() {
 		fmt.Fprintln(buf, env)
@@ -61,6 +70,87 @@ func (a *envStore) Load() ([]store.ConfigContent, error) {
 	return contents, nil
 }
 
+// loadStructured reads ENV into nested keys, and returns them in JSON format
+func (a *envStore) loadStructured() ([]store.ConfigContent, error) {
+	root := map[string]interface{}{}
+	for _, env := range os.Environ() {
+		name, val, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, a.opts.prefix) || len(name) == len(a.opts.prefix) {
+			continue
+		}
+
+		name = strings.ToLower(name[len(a.opts.prefix):])
+		path := []string{name}
+		if a.opts.separator != "" {
+			path = strings.Split(name, strings.ToLower(a.opts.separator))
+		}
+		if hasEmpty(path) {
+			continue
+		}
+		if err := a.set(root, path, val, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, name := range a.opts.bindings {
+		if val, ok := os.LookupEnv(name); ok {
+			if err := a.set(root, strings.Split(strings.ToLower(key), "."), val, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cont, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	return []store.ConfigContent{{Type: store.ConfigTypeJSON, Content: cont}}, nil
+}
+
+// set sets `val` to `path` inside `root`. Existing values are overridden if `override` is true
+func (a *envStore) set(root map[string]interface{}, path []string, val string, override bool) error {
+	if a.opts.tData != nil {
+		v, err := a.opts.tData.Replace([]byte(val))
+		if err != nil {
+			return fmt.Errorf("%s: ENV %s", err.Error(), strings.Join(path, "."))
+		}
+		val = string(v)
+	}
+
+	m := root
+	for i, k := range path[:len(path)-1] {
+		switch sub := m[k].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			m[k] = next
+			m = next
+		case map[string]interface{}:
+			m = sub
+		default:
+			return fmt.Errorf("ENV key conflicts: %s and %s", strings.Join(path[:i+1], "."), strings.Join(path, "."))
+		}
+	}
+
+	k := path[len(path)-1]
+	if _, ok := m[k].(map[string]interface{}); ok {
+		return fmt.Errorf("ENV key conflicts: %s", strings.Join(path, "."))
+	}
+	if _, ok := m[k]; ok && !override {
+		return fmt.Errorf("ENV key conflicts: %s", strings.Join(path, "."))
+	}
+	m[k] = val
+	return nil
+}
+
+func hasEmpty(path []string) bool {
+	for _, k := range path {
+		if k == "" {
+			return true
+		}
+	}
+	return false
+}
+
 // Watch watches configuration changes. Not yet supported
 func (a *envStore) Watch(ch chan<- *store.ConfigChanges) error {
 	return nil
@@ -0,0 +1,117 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package env
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/antigloss/go/conf/store"
+)
+
+func TestLoadStructured(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		envs     map[string]string
+		opts     []option
+		expected string // JSON content, or empty if an error is expected
+	}{
+		{"prefix",
+			map[string]string{"CONFTEST_NAME": "app", "CONFTEST_DB__HOST": "db", "CONFTEST": "ignored", "OTHER_NAME": "ignored"},
+			[]option{WithPrefix("CONFTEST_")},
+			`{"db__host":"db","name":"app"}`},
+		{"prefix and separator",
+			map[string]string{"CONFTEST_NAME": "app", "CONFTEST_DB__HOST": "db", "CONFTEST_DB__PORT": "3306", "CONFTEST_DB__POOL__SIZE": "10"},
+			[]option{WithPrefix("CONFTEST_"), WithSeparator("__")},
+			`{"db":{"host":"db","pool":{"size":"10"},"port":"3306"},"name":"app"}`},
+		{"empty segments skipped",
+			map[string]string{"CONFTEST___X": "1", "CONFTEST_A__": "2", "CONFTEST_B____C": "3", "CONFTEST_OK": "4"},
+			[]option{WithPrefix("CONFTEST_"), WithSeparator("__")},
+			`{"ok":"4"}`},
+		{"bindings",
+			map[string]string{"CONFTEST_NAME": "app", "DB_PASSWORD_CONFTEST": "secret"},
+			[]option{WithPrefix("CONFTEST_"), WithSeparator("__"), WithBindings(map[string]string{"DB.Password": "DB_PASSWORD_CONFTEST", "db.user": "UNSET_CONFTEST"})},
+			`{"db":{"password":"secret"},"name":"app"}`},
+		{"binding over prefixed key",
+			map[string]string{"CONFTEST_DB__HOST": "prefixed", "DB_HOST_CONFTEST": "bound"},
+			[]option{WithPrefix("CONFTEST_"), WithSeparator("__"), WithBindings(map[string]string{"db.host": "DB_HOST_CONFTEST"})},
+			`{"db":{"host":"bound"}}`},
+		{"binding conflicts with a prefixed section",
+			map[string]string{"CONFTEST_DB__HOST": "db", "DB_CONFTEST": "bound"},
+			[]option{WithPrefix("CONFTEST_"), WithSeparator("__"), WithBindings(map[string]string{"db": "DB_CONFTEST"})},
+			""},
+		{"binding nested under a prefixed value",
+			map[string]string{"CONFTEST_DB": "db", "DB_HOST_CONFTEST": "bound"},
+			[]option{WithPrefix("CONFTEST_"), WithSeparator("__"), WithBindings(map[string]string{"db.host": "DB_HOST_CONFTEST"})},
+			""},
+		{"prefixed keys conflict",
+			map[string]string{"CONFTEST_DB": "db", "CONFTEST_DB__HOST": "host"},
+			[]option{WithPrefix("CONFTEST_"), WithSeparator("__")},
+			""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.envs {
+				t.Setenv(k, v)
+			}
+
+			contents, err := New(tc.opts...).Load()
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("Load() should fail, but returns %s", contents[0].Content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(contents) != 1 || contents[0].Type != store.ConfigTypeJSON || string(contents[0].Content) != tc.expected {
+				t.Errorf("Load() = %s, expecting %s", contents[0].Content, tc.expected)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("CONFTEST_DB__HOST", "db")
+	t.Setenv("DB_HOST_CONFTEST", "bound")
+
+	// Without options, all ENV are read as they are
+	contents, err := New().Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 1 || contents[0].Type != store.ConfigTypeEnv || !strings.Contains(string(contents[0].Content), "CONFTEST_DB__HOST=db\n") {
+		t.Errorf("Unexpected contents: %v", contents)
+	}
+
+	// Bindings without prefix read all ENV as keys, and bound ENV take precedence
+	contents, err = New(WithBindings(map[string]string{"conftest_db__host": "DB_HOST_CONFTEST"})).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(contents[0].Content, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["conftest_db__host"] != "bound" || m["db_host_conftest"] != "bound" {
+		t.Errorf("Unexpected contents: %s", contents[0].Content)
+	}
+}
@@ -29,10 +29,42 @@ func WithTemplateData(tData tdata.TemplateData) option {
 	}
 }
 
+// WithPrefix makes the Store read only ENV whose names start with `prefix`, such as `MYAPP_`.
+// The prefix is stripped from the names before they're turned into keys
+func WithPrefix(prefix string) option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithSeparator sets the separator for nesting keys. For example, with separator `__`,
+// ENV `DATABASE__HOST` is read as key `database.host`, so that it can populate nested struct fields
+func WithSeparator(sep string) option {
+	return func(o *options) {
+		o.separator = sep
+	}
+}
+
+// WithBindings binds keys to ENV explicitly. `bindings` maps dotted keys to ENV names, such as `database.host` to `DB_HOST`.
+// Bound ENV are read regardless of the prefix, and take precedence over the other ENV mapped to the same keys
+func WithBindings(bindings map[string]string) option {
+	return func(o *options) {
+		o.bindings = bindings
+	}
+}
+
 type option func(options *options)
 
 type options struct {
-	tData tdata.TemplateData
+	tData     tdata.TemplateData
+	prefix    string
+	separator string
+	bindings  map[string]string
+}
+
+// structured returns true if ENV should be turned into nested keys instead of being read as they are
+func (o *options) structured() bool {
+	return o.prefix != "" || o.separator != "" || len(o.bindings) > 0
 }
 
 func (o *options) apply(opts ...option) {
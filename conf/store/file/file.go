@@ -65,6 +65,16 @@ func (a *fileStore) Load() ([]store.ConfigContent, error) {
 				return nil, fmt.Errorf("%s: %s", err.Error(), p)
 			}
 		}
+
+		err = store.SelectProfile(&contents[i], a.opts.profile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", err.Error(), p)
+		}
+
+		err = store.ResolveIncludes(&contents[i], p, a.includeOptions()...)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return contents, nil
 }
@@ -78,6 +88,18 @@ func (a *fileStore) Watch(ch chan<- *store.ConfigChanges) error {
 func (a *fileStore) Unwatch() {
 }
 
+func (a *fileStore) includeOptions() []store.IncludeOption {
+	if a.opts.tData == nil {
+		return nil
+	}
+
+	return []store.IncludeOption{
+		store.WithIncludeTransformer(func(content []byte, source string) ([]byte, error) {
+			return a.opts.tData.Replace(content)
+		}),
+	}
+}
+
 func (a *fileStore) calculateFilePaths() ([]string, error) {
 	var paths []string
 
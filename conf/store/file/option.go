@@ -42,11 +42,21 @@ func WithTemplateData(tData tdata.TemplateData) option {
 	}
 }
 
+// WithProfile sets the active profile. For YAML files containing multiple documents separated by `---`,
+// documents without `profile` and documents with `profile` matching the active profile are merged,
+// others are ignored. Please refer to store.SelectProfile for details
+func WithProfile(profile string) option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
 type option func(options *options)
 
 type options struct {
-	paths []ConfigPath
-	tData tdata.TemplateData
+	paths   []ConfigPath
+	tData   tdata.TemplateData
+	profile string
 }
 
 func (o *options) apply(opts ...option) {
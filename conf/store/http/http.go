@@ -0,0 +1,209 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package http implements a Store for reading and watching configurations from HTTP(S) endpoints.
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antigloss/go/conf/store"
+)
+
+// New creates a Store object for reading configurations from an HTTP(S) endpoint set by WithURL.
+// Requests are conditional with ETag/If-Modified-Since, so unchanged configurations won't be transferred again.
+// Watching is implemented by polling the endpoint every interval set by WithPollInterval.
+func New(opts ...option) store.Store {
+	h := &httpStore{
+		unwatchCh: make(chan int),
+	}
+	h.opts.apply(opts...)
+	return h
+}
+
+type httpStore struct {
+	opts         options
+	lock         sync.Mutex
+	etag         string
+	lastModified string
+	content      store.ConfigContent
+	watchOnce    sync.Once
+	unwatchOnce  sync.Once
+	unwatchCh    chan int
+}
+
+// Load reads configurations
+func (h *httpStore) Load() ([]store.ConfigContent, error) {
+	cont, _, err := h.fetch()
+	if err != nil {
+		return nil, err
+	}
+	return []store.ConfigContent{cont}, nil
+}
+
+// Watch watches configuration changes by polling
+func (h *httpStore) Watch(ch chan<- *store.ConfigChanges) error {
+	h.watchOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(h.opts.pollInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					h.lock.Lock()
+					old := h.content
+					h.lock.Unlock()
+
+					cont, modified, err := h.fetch()
+					if err != nil || !modified || bytes.Equal(cont.Content, old.Content) {
+						continue
+					}
+
+					changes := &store.ConfigChanges{Config: cont}
+					oldMap, e1 := store.ToMap(old.Type, old.Content)
+					newMap, e2 := store.ToMap(cont.Type, cont.Content)
+					if e1 == nil && e2 == nil {
+						changes.Changes = store.DiffKeys(oldMap, newMap)
+					}
+
+					select {
+					case ch <- changes:
+					case <-h.unwatchCh:
+						return
+					}
+				case <-h.unwatchCh:
+					return
+				}
+			}
+		}()
+	})
+	return nil
+}
+
+// Unwatch stops watching
+func (h *httpStore) Unwatch() {
+	h.unwatchOnce.Do(func() {
+		close(h.unwatchCh)
+	})
+}
+
+// fetch requests the endpoint conditionally. If the configurations are not modified, the cached content is returned
+func (h *httpStore) fetch() (store.ConfigContent, bool, error) {
+	if h.opts.url == "" {
+		return store.ConfigContent{}, false, fmt.Errorf("URL not specified")
+	}
+
+	req, err := nethttp.NewRequest(nethttp.MethodGet, h.opts.url, nil)
+	if err != nil {
+		return store.ConfigContent{}, false, err
+	}
+	for k, vals := range h.opts.header {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+	if h.opts.username != "" || h.opts.password != "" {
+		req.SetBasicAuth(h.opts.username, h.opts.password)
+	}
+
+	h.lock.Lock()
+	if h.content.Content != nil {
+		if h.etag != "" {
+			req.Header.Set("If-None-Match", h.etag)
+		}
+		if h.lastModified != "" {
+			req.Header.Set("If-Modified-Since", h.lastModified)
+		}
+	}
+	h.lock.Unlock()
+
+	rsp, err := h.opts.httpClient.Do(req)
+	if err != nil {
+		return store.ConfigContent{}, false, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == nethttp.StatusNotModified {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		return h.content, false, nil
+	}
+	if rsp.StatusCode != nethttp.StatusOK {
+		return store.ConfigContent{}, false, fmt.Errorf("failed to fetch %s: %s", h.opts.url, rsp.Status)
+	}
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return store.ConfigContent{}, false, err
+	}
+
+	cont := store.ConfigContent{Content: body}
+	cont.Type, err = h.configType(rsp)
+	if err != nil {
+		return store.ConfigContent{}, false, err
+	}
+	if h.opts.tData != nil {
+		cont.Content, err = h.opts.tData.Replace(cont.Content)
+		if err != nil {
+			return store.ConfigContent{}, false, fmt.Errorf("%s: %s", err.Error(), h.opts.url)
+		}
+	}
+	err = store.ResolveIncludes(&cont, h.opts.url)
+	if err != nil {
+		return store.ConfigContent{}, false, err
+	}
+
+	h.lock.Lock()
+	h.content = cont
+	h.etag = rsp.Header.Get("ETag")
+	h.lastModified = rsp.Header.Get("Last-Modified")
+	h.lock.Unlock()
+	return cont, true, nil
+}
+
+// configType returns the format set by WithConfigType, or detects it from the URL path or the Content-Type of `rsp`
+func (h *httpStore) configType(rsp *nethttp.Response) (string, error) {
+	if h.opts.configType != "" {
+		return h.opts.configType, nil
+	}
+
+	if u, err := url.Parse(h.opts.url); err == nil && path.Ext(u.Path) != "" {
+		return store.ConfigType(path.Base(u.Path))
+	}
+
+	ct := rsp.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(ct, "json"):
+		return store.ConfigTypeJSON, nil
+	case strings.Contains(ct, "yaml"):
+		return store.ConfigTypeYAML, nil
+	case strings.Contains(ct, "toml"):
+		return store.ConfigTypeTOML, nil
+	}
+	return store.ConfigTypeDefault, nil
+}
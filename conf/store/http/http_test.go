@@ -0,0 +1,143 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/conf/store"
+)
+
+type configServer struct {
+	lock        sync.Mutex
+	content     string
+	contentType string
+	version     int
+	requests    int32
+	notModified int32
+}
+
+func (s *configServer) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	atomic.AddInt32(&s.requests, 1)
+	if user, pass, _ := r.BasicAuth(); user != "u" || pass != "p" || r.Header.Get("X-Api-Key") != "key" {
+		w.WriteHeader(nethttp.StatusUnauthorized)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	etag := fmt.Sprintf(`"v%d"`, s.version)
+	if r.Header.Get("If-None-Match") == etag {
+		atomic.AddInt32(&s.notModified, 1)
+		w.WriteHeader(nethttp.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", s.contentType)
+	fmt.Fprint(w, s.content)
+}
+
+func (s *configServer) update(content string) {
+	s.lock.Lock()
+	s.content = content
+	s.version++
+	s.lock.Unlock()
+}
+
+func TestHTTPStore(t *testing.T) {
+	cs := &configServer{content: `{"name": "a", "db": {"port": 3306}}`, contentType: "application/json"}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	s := New(WithURL(srv.URL+"/conf"), WithBasicAuth("u", "p"), WithHeader("X-Api-Key", "key"), WithPollInterval(10*time.Millisecond))
+	conts, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conts) != 1 || conts[0].Type != store.ConfigTypeJSON || !strings.Contains(string(conts[0].Content), `"name": "a"`) {
+		t.Fatalf("Unexpected content: %+v", conts)
+	}
+
+	// Conditional request, cached content is returned
+	if conts, err = s.Load(); err != nil || !strings.Contains(string(conts[0].Content), `"name": "a"`) || atomic.LoadInt32(&cs.notModified) != 1 {
+		t.Fatalf("Cached content should be returned on 304: %v %d", err, cs.notModified)
+	}
+
+	ch := make(chan *store.ConfigChanges, 1)
+	if err = s.Watch(ch); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Unwatch()
+	time.Sleep(30 * time.Millisecond) // Unchanged content should not be notified
+	cs.update(`{"name": "b", "db": {"port": 3306}}`)
+	select {
+	case changes := <-ch:
+		if len(changes.Changes) != 1 || changes.Changes[0].Key != "name" || changes.Changes[0].Type != store.ChangeTypeUpdated {
+			t.Errorf("Unexpected changes: %+v", changes.Changes)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Changes should be notified")
+	}
+}
+
+func TestHTTPStoreConfigType(t *testing.T) {
+	cs := &configServer{content: "name: a\n", contentType: "text/yaml"}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path     string
+		opts     []option
+		expected string
+	}{
+		{"/conf", nil, store.ConfigTypeYAML},                   // From Content-Type
+		{"/conf.toml", nil, store.ConfigTypeTOML},              // From URL path
+		{"/conf.toml", []option{WithConfigType("yml")}, "yml"}, // Set explicitly
+	} {
+		opts := append([]option{WithURL(srv.URL + tc.path), WithBasicAuth("u", "p"), WithHeader("X-Api-Key", "key")}, tc.opts...)
+		conts, err := New(opts...).Load()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if conts[0].Type != tc.expected {
+			t.Errorf("%s: expecting type %s, but gets %s", tc.path, tc.expected, conts[0].Type)
+		}
+	}
+}
+
+func TestHTTPStoreErrors(t *testing.T) {
+	cs := &configServer{content: "{}", contentType: "application/json"}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	if _, err := New().Load(); err == nil || !strings.Contains(err.Error(), "URL not specified") {
+		t.Errorf("Expecting URL not specified, but gets %v", err)
+	}
+	if _, err := New(WithURL(srv.URL), WithBearerToken("t")).Load(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expecting 401, but gets %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	nethttp "net/http"
+	"time"
+
+	"github.com/antigloss/go/conf/tdata"
+)
+
+// WithURL sets the URL to read configurations from
+func WithURL(url string) option {
+	return func(o *options) {
+		o.url = url
+	}
+}
+
+// WithConfigType sets the configuration format, such as json, yaml, toml or properties.
+// If not set, it's detected from the extension of the URL path, then the Content-Type of the response.
+// Default is properties
+func WithConfigType(typ string) option {
+	return func(o *options) {
+		o.configType = typ
+	}
+}
+
+// WithHeader adds a header to the requests, such as an API key
+func WithHeader(key, value string) option {
+	return func(o *options) {
+		o.header.Add(key, value)
+	}
+}
+
+// WithBearerToken sets the bearer token for authenticating with the endpoint
+func WithBearerToken(token string) option {
+	return func(o *options) {
+		o.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithBasicAuth sets the username and password for authenticating with the endpoint
+func WithBasicAuth(username, password string) option {
+	return func(o *options) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithHTTPClient sets the HTTP client for requesting the endpoint. Default timeout is 10s
+func WithHTTPClient(client *nethttp.Client) option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithPollInterval sets the interval for polling the endpoint while watching. Default is 30s
+func WithPollInterval(d time.Duration) option {
+	return func(o *options) {
+		o.pollInterval = d
+	}
+}
+
+// WithTemplateData sets template data source.
+// Will use configurations from `tData` to replace templates in the configurations read from the endpoint
+func WithTemplateData(tData tdata.TemplateData) option {
+	return func(o *options) {
+		o.tData = tData
+	}
+}
+
+type option func(options *options)
+
+type options struct {
+	url          string
+	configType   string
+	header       nethttp.Header
+	username     string
+	password     string
+	httpClient   *nethttp.Client
+	pollInterval time.Duration
+	tData        tdata.TemplateData
+}
+
+func (o *options) apply(opts ...option) {
+	o.header = nethttp.Header{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.httpClient == nil {
+		o.httpClient = &nethttp.Client{Timeout: 10 * time.Second}
+	}
+	if o.pollInterval <= 0 {
+		o.pollInterval = 30 * time.Second
+	}
+}
@@ -0,0 +1,331 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// IncludeKey is the directive for including other configuration fragments into a JSON/YAML configuration.
+// Its value can be a path/URL, or a list of paths/URLs. Relative paths are resolved against the including file/URL.
+//
+//	$include: common.yaml
+//	database:
+//	  $include:
+//	    - db/default.yaml
+//	    - https://config.example.com/db.json
+//	  pool_size: 20 # keys defined alongside $include override keys from the included fragments
+//
+// Fragments are merged in order, so later fragments override earlier ones.
+// An included fragment can be of any supported format, such as JSON, YAML, TOML, INI or HCL, and must be a mapping.
+// JSON/YAML fragments can include other fragments as well.
+const IncludeKey = "$include"
+
+// WithIncludeTransformer sets a function to transform the content of each included fragment before it's parsed,
+// such as replacing templates. `source` is the absolute path or URL of the fragment
+func WithIncludeTransformer(fn func(content []byte, source string) ([]byte, error)) IncludeOption {
+	return func(o *includeOptions) {
+		o.transformer = fn
+	}
+}
+
+// WithIncludeHTTPClient sets the HTTP client for fetching fragments included via URLs. Default timeout is 10s
+func WithIncludeHTTPClient(client *http.Client) IncludeOption {
+	return func(o *includeOptions) {
+		o.httpClient = client
+	}
+}
+
+// ResolveIncludes processes the `$include` directives inside `cont` recursively, and replaces `cont.Content` with the merged result.
+// `source` is the path or URL where `cont` was read from, it's used to resolve relative paths and to detect include cycles.
+// Contents of formats other than JSON and YAML are left untouched.
+func ResolveIncludes(cont *ConfigContent, source string, opts ...IncludeOption) error {
+	switch cont.Type {
+	case ConfigTypeJSON, ConfigTypeYAML, ConfigTypeYML:
+	default:
+		return nil
+	}
+	if !bytes.Contains(cont.Content, []byte(IncludeKey)) {
+		return nil
+	}
+
+	r := &includeResolver{}
+	r.httpClient = &http.Client{Timeout: 10 * time.Second}
+	for _, opt := range opts {
+		opt(&r.includeOptions)
+	}
+
+	src, err := normalizeSource(source)
+	if err != nil {
+		return err
+	}
+
+	node, err := unmarshalFragment(cont.Type, cont.Content)
+	if err != nil {
+		return fmt.Errorf("%s: %s", err.Error(), src)
+	}
+
+	r.stack = append(r.stack, src)
+	node, err = r.expand(node, src)
+	if err != nil {
+		return err
+	}
+
+	if cont.Type == ConfigTypeJSON {
+		cont.Content, err = json.Marshal(node)
+	} else {
+		cont.Content, err = yaml.Marshal(node)
+	}
+	return err
+}
+
+// IncludeOption configures how ResolveIncludes loads the included fragments
+type IncludeOption func(opts *includeOptions)
+
+type includeOptions struct {
+	transformer func(content []byte, source string) ([]byte, error)
+	httpClient  *http.Client
+}
+
+type includeResolver struct {
+	includeOptions
+	stack []string // fragments being resolved, used for detecting include cycles
+}
+
+// expand replaces `$include` directives inside `node` with the fragments they refer to
+func (r *includeResolver) expand(node interface{}, base string) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		merged := map[string]interface{}{}
+		if v, ok := n[IncludeKey]; ok {
+			refs, err := includeRefs(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", err.Error(), base)
+			}
+
+			for _, ref := range refs {
+				frag, err := r.load(ref, base)
+				if err != nil {
+					return nil, err
+				}
+				mergeMaps(merged, frag)
+			}
+		}
+
+		own := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			if k == IncludeKey {
+				continue
+			}
+
+			v, err := r.expand(v, base)
+			if err != nil {
+				return nil, err
+			}
+			own[k] = v
+		}
+		mergeMaps(merged, own)
+		return merged, nil
+	case []interface{}:
+		s := make([]interface{}, len(n))
+		for i, v := range n {
+			v, err := r.expand(v, base)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		return s, nil
+	}
+	return node, nil
+}
+
+// load reads, parses and expands the fragment referred by `ref`
+func (r *includeResolver) load(ref, base string) (map[string]interface{}, error) {
+	src, err := resolveRef(ref, base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err.Error(), base)
+	}
+
+	for _, s := range r.stack {
+		if s == src {
+			return nil, fmt.Errorf("include cycle detected: %s -> %s", strings.Join(r.stack, " -> "), src)
+		}
+	}
+	r.stack = append(r.stack, src)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	typ, err := fragmentType(src)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := r.read(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.transformer != nil {
+		content, err = r.transformer(content, src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", err.Error(), src)
+		}
+	}
+
+	m, err := ToMap(typ, content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err.Error(), src)
+	}
+
+	node, err := r.expand(m, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.(map[string]interface{}), nil
+}
+
+func (r *includeResolver) read(src string) ([]byte, error) {
+	if !isURL(src) {
+		return os.ReadFile(src)
+	}
+
+	rsp, err := r.httpClient.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", src, rsp.Status)
+	}
+	return io.ReadAll(rsp.Body)
+}
+
+func includeRefs(v interface{}) ([]string, error) {
+	switch val := v.(type) {
+	case string:
+		return []string{val}, nil
+	case []interface{}:
+		refs := make([]string, len(val))
+		for i, ref := range val {
+			s, ok := ref.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s value: %v", IncludeKey, ref)
+			}
+			refs[i] = s
+		}
+		return refs, nil
+	}
+	return nil, fmt.Errorf("invalid %s value: %v", IncludeKey, v)
+}
+
+// resolveRef resolves `ref` against `base`, and returns an absolute path or URL
+func resolveRef(ref, base string) (string, error) {
+	if isURL(ref) {
+		return ref, nil
+	}
+
+	if isURL(base) {
+		b, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		r, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		return b.ResolveReference(r).String(), nil
+	}
+
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(filepath.Dir(base), ref)
+	}
+	return filepath.Clean(ref), nil
+}
+
+func normalizeSource(source string) (string, error) {
+	if isURL(source) {
+		return source, nil
+	}
+	return filepath.Abs(source)
+}
+
+func fragmentType(src string) (string, error) {
+	p := src
+	if isURL(src) {
+		u, err := url.Parse(src)
+		if err != nil {
+			return "", err
+		}
+		p = path.Base(u.Path)
+	}
+
+	typ, err := ConfigType(p)
+	if err != nil {
+		return "", err
+	}
+
+	switch typ {
+	case ConfigTypeDefault, ConfigTypeEnv:
+		return "", fmt.Errorf("unsupported format of included fragment: %s", src)
+	}
+	return typ, nil
+}
+
+func unmarshalFragment(typ string, content []byte) (interface{}, error) {
+	var node interface{}
+	var err error
+	if typ == ConfigTypeJSON {
+		err = json.Unmarshal(content, &node)
+	} else {
+		err = yaml.Unmarshal(content, &node)
+	}
+	return node, err
+}
+
+// mergeMaps merges `src` into `dst` recursively. Values from `src` take precedence
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sm, ok1 := v.(map[string]interface{})
+		dm, ok2 := dst[k].(map[string]interface{})
+		if ok1 && ok2 {
+			mergeMaps(dm, sm)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
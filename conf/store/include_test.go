@@ -0,0 +1,167 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func resolveFile(t *testing.T, path string, opts ...IncludeOption) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, _ := ConfigType(path)
+	cont := &ConfigContent{Type: typ, Content: content}
+	if err := ResolveIncludes(cont, path, opts...); err != nil {
+		return nil, err
+	}
+	return ToMap(cont.Type, cont.Content)
+}
+
+func TestResolveIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yaml": `
+$include: [common.yaml, override.json]
+name: main
+database:
+  $include: db/default.yaml
+  pool_size: 20
+servers:
+  - $include: db/default.yaml
+`,
+		"common.yaml":     "name: common\nlevel: 1\nlocale: en\n",
+		"override.json":   `{"level": 2, "extra": {"a": 1}}`,
+		"db/default.yaml": "$include: ../db_base.yaml\nhost: db.local\npool_size: 10\n",
+		"db_base.yaml":    "port: 3306\nhost: localhost\n",
+	})
+
+	m, err := resolveFile(t, filepath.Join(dir, "main.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Own keys override included ones, later fragments override earlier ones,
+	// and nested includes are resolved relative to the including fragment
+	expected := "map[database:map[host:db.local pool_size:20 port:3306] extra:map[a:1] level:2 locale:en name:main servers:[map[host:db.local pool_size:10 port:3306]]]"
+	if s := fmt.Sprint(m); s != expected {
+		t.Errorf("Unexpected result:\n%s\nexpecting:\n%s", s, expected)
+	}
+}
+
+func TestResolveIncludesErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"cycle_a.yaml":   "$include: cycle_b.yaml\na: 1\n",
+		"cycle_b.yaml":   "$include: sub/../cycle_a.yaml\nb: 1\n",
+		"self.json":      `{"$include": "self.json"}`,
+		"invalid.yaml":   "$include: 1\n",
+		"invalid2.yaml":  "$include: [a.yaml, 2]\n",
+		"missing.yaml":   "$include: none.yaml\n",
+		"env.yaml":       "$include: x.env\n",
+		"list.yaml":      "$include: list_frag.yaml\n",
+		"list_frag.yaml": "- 1\n- 2\n",
+	})
+
+	for name, msg := range map[string]string{
+		"cycle_a.yaml":  "include cycle detected",
+		"self.json":     "include cycle detected",
+		"invalid.yaml":  "invalid $include value",
+		"invalid2.yaml": "invalid $include value",
+		"missing.yaml":  "none.yaml",
+		"env.yaml":      "unsupported format",
+		"list.yaml":     "must be a mapping",
+	} {
+		if _, err := resolveFile(t, filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expecting error containing %q, but gets %v", name, msg, err)
+		}
+	}
+}
+
+func TestResolveIncludesURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/conf/app.yaml":
+			fmt.Fprint(w, "$include: common/base.json\napp: remote\n")
+		case "/conf/common/base.json":
+			fmt.Fprint(w, `{"app": "base", "region": "${REGION}"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yaml":    fmt.Sprintf("$include: %s/conf/app.yaml\nlocal: true\n", srv.URL),
+		"missing.yaml": fmt.Sprintf("$include: %s/conf/none.yaml\n", srv.URL),
+	})
+
+	var sources []string
+	transformer := func(content []byte, source string) ([]byte, error) {
+		sources = append(sources, source)
+		return bytes.ReplaceAll(content, []byte("${REGION}"), []byte("eu")), nil
+	}
+	m, err := resolveFile(t, filepath.Join(dir, "main.yaml"), WithIncludeTransformer(transformer), WithIncludeHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(m); s != "map[app:remote local:true region:eu]" {
+		t.Errorf("Unexpected result: %v", m)
+	}
+	if len(sources) != 2 || sources[0] != srv.URL+"/conf/app.yaml" || sources[1] != srv.URL+"/conf/common/base.json" {
+		t.Errorf("Relative URL should be resolved against the including URL: %v", sources)
+	}
+
+	if _, err := resolveFile(t, filepath.Join(dir, "missing.yaml")); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expecting 404 error, but gets %v", err)
+	}
+}
+
+func TestResolveIncludesUntouched(t *testing.T) {
+	for _, cont := range []*ConfigContent{
+		{Type: ConfigTypeDefault, Content: []byte("$include = a.yaml\n")},
+		{Type: ConfigTypeYAML, Content: []byte("a: 1 # no include\n")},
+	} {
+		orig := string(cont.Content)
+		if err := ResolveIncludes(cont, "conf.yaml"); err != nil || string(cont.Content) != orig {
+			t.Errorf("Content should be left untouched: %q %v", cont.Content, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ProfileKey is the key for naming the profile of a document inside a multi-document YAML.
+// Its value can be a profile name, or a list of profile names.
+//
+//	server:
+//	  port: 8080 # documents without profile are shared by all profiles
+//	---
+//	profile: prod
+//	server:
+//	  port: 80
+//	---
+//	profile: [dev, staging]
+//	server:
+//	  port: 8081
+const ProfileKey = "profile"
+
+// SelectProfile merges the documents of a multi-document YAML `cont` into one, and replaces `cont.Content` with the merged result.
+// Documents without ProfileKey are merged in order first, followed by the documents whose ProfileKey matches `profile`.
+// ProfileKey itself is removed from the merged result.
+// An error is returned if `profile` is not empty but none of the documents matches it while some of them have ProfileKey.
+// Contents of formats other than YAML, and YAML with a single document without ProfileKey, are left untouched.
+func SelectProfile(cont *ConfigContent, profile string) error {
+	switch cont.Type {
+	case ConfigTypeYAML, ConfigTypeYML:
+	default:
+		return nil
+	}
+
+	var docs []map[string]interface{}
+	hasProfile := false
+	dec := yaml.NewDecoder(bytes.NewReader(cont.Content))
+	for {
+		var doc map[string]interface{}
+		err := dec.Decode(&doc)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if doc == nil { // empty document
+			continue
+		}
+		if _, ok := doc[ProfileKey]; ok {
+			hasProfile = true
+		}
+		docs = append(docs, doc)
+	}
+
+	if len(docs) <= 1 && !hasProfile {
+		return nil
+	}
+
+	merged := map[string]interface{}{}
+	for _, doc := range docs {
+		if _, ok := doc[ProfileKey]; !ok {
+			mergeMaps(merged, doc)
+		}
+	}
+
+	matched := false
+	for _, doc := range docs {
+		v, ok := doc[ProfileKey]
+		if !ok {
+			continue
+		}
+
+		names, err := profileNames(v)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if name == profile && profile != "" {
+				delete(doc, ProfileKey)
+				mergeMaps(merged, doc)
+				matched = true
+				break
+			}
+		}
+	}
+	if profile != "" && hasProfile && !matched {
+		return fmt.Errorf("profile not found: %s", profile)
+	}
+
+	var err error
+	cont.Content, err = yaml.Marshal(merged)
+	return err
+}
+
+func profileNames(v interface{}) ([]string, error) {
+	switch val := v.(type) {
+	case string:
+		return []string{val}, nil
+	case []interface{}:
+		names := make([]string, len(val))
+		for i, name := range val {
+			s, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s value: %v", ProfileKey, name)
+			}
+			names[i] = s
+		}
+		return names, nil
+	}
+	return nil, fmt.Errorf("invalid %s value: %v", ProfileKey, v)
+}
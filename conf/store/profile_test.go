@@ -0,0 +1,86 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSelectProfile(t *testing.T) {
+	const content = `
+server:
+  host: localhost
+  port: 8080
+log: info
+---
+profile: prod
+server:
+  port: 80
+log: warn
+---
+profile: [dev, staging]
+server:
+  port: 8081
+---
+debug: true
+---
+`
+	for _, tc := range []struct {
+		profile  string
+		expected string
+	}{
+		{"", "map[debug:true log:info server:map[host:localhost port:8080]]"},
+		{"prod", "map[debug:true log:warn server:map[host:localhost port:80]]"},
+		{"staging", "map[debug:true log:info server:map[host:localhost port:8081]]"},
+	} {
+		cont := &ConfigContent{Type: ConfigTypeYAML, Content: []byte(content)}
+		if err := SelectProfile(cont, tc.profile); err != nil {
+			t.Fatalf("profile=%q: %v", tc.profile, err)
+		}
+		m, err := ToMap(cont.Type, cont.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprint(m); s != tc.expected {
+			t.Errorf("profile=%q: unexpected result %s, expecting %s", tc.profile, s, tc.expected)
+		}
+	}
+
+	cont := &ConfigContent{Type: ConfigTypeYAML, Content: []byte(content)}
+	if err := SelectProfile(cont, "test"); err == nil || !strings.Contains(err.Error(), "profile not found") {
+		t.Errorf("Expecting profile not found, but gets %v", err)
+	}
+	cont = &ConfigContent{Type: ConfigTypeYAML, Content: []byte("a: 1\n---\nprofile: [1]\n")}
+	if err := SelectProfile(cont, "prod"); err == nil || !strings.Contains(err.Error(), "invalid profile value") {
+		t.Errorf("Expecting invalid profile value, but gets %v", err)
+	}
+
+	for _, cont := range []*ConfigContent{
+		{Type: ConfigTypeYAML, Content: []byte("a: 1 # single document\n")},
+		{Type: ConfigTypeJSON, Content: []byte(`{"profile": "prod"}`)},
+	} {
+		orig := string(cont.Content)
+		if err := SelectProfile(cont, "prod"); err != nil || string(cont.Content) != orig {
+			t.Errorf("Content should be left untouched: %q %v", cont.Content, err)
+		}
+	}
+}
@@ -20,6 +20,8 @@
 // Package store defines the Store interface, some common types and some common functions.
 package store
 
+import "reflect"
+
 // Store is the interface from which configurations can be read and watched
 type Store interface {
 	Load() ([]ConfigContent, error)       // read configurations
@@ -53,3 +55,35 @@ type ConfigChanges struct {
 	Config  ConfigContent
 	Changes []ConfigChange
 }
+
+// DiffKeys compares configurations `old` with `new` key by key recursively, and returns the changed keys.
+// Keys of nested mappings are joined with dots, such as `database.host`
+func DiffKeys(old, new map[string]interface{}) []ConfigChange {
+	return diffKeys(old, new, "")
+}
+
+func diffKeys(old, new map[string]interface{}, prefix string) []ConfigChange {
+	var changes []ConfigChange
+	for k, nv := range new {
+		key := prefix + k
+		ov, ok := old[k]
+		if !ok {
+			changes = append(changes, ConfigChange{Type: ChangeTypeAdded, Key: key})
+			continue
+		}
+
+		om, ok1 := ov.(map[string]interface{})
+		nm, ok2 := nv.(map[string]interface{})
+		if ok1 && ok2 {
+			changes = append(changes, diffKeys(om, nm, key+".")...)
+		} else if !reflect.DeepEqual(ov, nv) {
+			changes = append(changes, ConfigChange{Type: ChangeTypeUpdated, Key: key})
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, ConfigChange{Type: ChangeTypeDeleted, Key: prefix + k})
+		}
+	}
+	return changes
+}
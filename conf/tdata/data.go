@@ -24,6 +24,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"text/template"
 
 	"github.com/spf13/viper"
@@ -34,6 +35,13 @@ import (
 //   - env KEY      replace `env KEY` with the value of `KEY` read from ENV
 //   - hostname     replace `hostname` with the value of os.Hostname()
 //   - value KEY    replace `value KEY` with the value of `KEY` read from Stores assigned to the TemplateData object
+//   - default KEY FALLBACK  like `value KEY`, but replaced with FALLBACK if `KEY` is not found
+//   - required KEY  like `value KEY`, but fails the replacement if `KEY` is not found or its value is empty
+//   - file PATH    replace `file PATH` with the content of file `PATH`
+//   - secret "PATH#FIELD"  replace `secret "PATH#FIELD"` with the field `FIELD` of the secret at `PATH` read from the SecretProvider
+//     set by WithSecretProvider, such as `secret "secret/data/db#password"`
+//
+// More functions can be registered with WithFuncs.
 func New(opts ...option) (TemplateData, error) {
 	t := &templateData{viper: viper.New()}
 	t.opts.apply(opts...)
@@ -73,7 +81,12 @@ func (t *templateData) Replace(tpl []byte) ([]byte, error) {
 		"env":      os.Getenv,
 		"hostname": hostname,
 		"value":    t.value,
+		"default":  t.defaultValue,
+		"required": t.required,
+		"file":     readFile,
+		"secret":   t.secret,
 	})
+	tp.Funcs(t.opts.funcs)
 
 	tp, err := tp.Parse(string(tpl))
 	if err != nil {
@@ -99,6 +112,56 @@ func (t *templateData) value(key string) string {
 	return ""
 }
 
+func (t *templateData) defaultValue(key, fallback string) string {
+	if t.viper.Get(key) == nil {
+		return fallback
+	}
+	return t.value(key)
+}
+
+func (t *templateData) required(key string) (string, error) {
+	if t.viper.Get(key) == nil {
+		return "", fmt.Errorf("required key not found: %s", key)
+	}
+	v := t.value(key)
+	if v == "" {
+		return "", fmt.Errorf("required key is empty: %s", key)
+	}
+	return v, nil
+}
+
+func readFile(path string) (string, error) {
+	cont, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(cont), nil
+}
+
+func (t *templateData) secret(ref string) (string, error) {
+	if t.opts.secrets == nil {
+		return "", fmt.Errorf("secret %q: no SecretProvider", ref)
+	}
+
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("secret %q: should be PATH#FIELD", ref)
+	}
+
+	data, err := t.opts.secrets.Secret(path)
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %s", ref, err.Error())
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("secret %q: field not found", ref)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
 func hostname() string {
 	name, _ := os.Hostname()
 	return name
@@ -0,0 +1,108 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/antigloss/go/conf/store"
+)
+
+// memStore is a Store holding a fixed YAML content
+type memStore string
+
+func (s memStore) Load() ([]store.ConfigContent, error) {
+	return []store.ConfigContent{{Type: store.ConfigTypeYAML, Content: []byte(s)}}, nil
+}
+
+func (s memStore) Watch(ch chan<- *store.ConfigChanges) error {
+	return nil
+}
+
+func (s memStore) Unwatch() {
+}
+
+func TestReplace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("s3cret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TDATA_TEST_ENV", "from env")
+
+	td, err := New(WithStores(memStore("name: app\nempty: \"\"\nport: 80\ndb:\n  host: localhost\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tpl      string
+		expected string
+		fails    bool
+	}{
+		{`{{ value "name" }}:{{ value "port" }}:{{ value "db.host" }}:{{ value "missing" }}`, "app:80:localhost:", false},
+		{`{{ env "TDATA_TEST_ENV" }}`, "from env", false},
+		{`{{ default "name" "fallback" }}`, "app", false},
+		{`{{ default "empty" "fallback" }}`, "", false},
+		{`{{ default "missing" "fallback" }}`, "fallback", false},
+		{`{{ default "db.missing" "fallback" }}`, "fallback", false},
+		{`{{ required "db.host" }}`, "localhost", false},
+		{`{{ required "missing" }}`, "", true},
+		{`{{ required "empty" }}`, "", true},
+		{`token: {{ file "` + filepath.ToSlash(path) + `" }}`, "token: s3cret", false},
+		{`{{ file "` + filepath.ToSlash(path) + `.missing" }}`, "", true},
+		{`{{ secret "secret/data/db#password" }}`, "", true},
+		{`{{ unknown }}`, "", true},
+	} {
+		cont, err := td.Replace([]byte(tc.tpl))
+		if tc.fails {
+			if err == nil {
+				t.Errorf("Replace(%s) should fail, but returns %q", tc.tpl, cont)
+			}
+		} else if err != nil || string(cont) != tc.expected {
+			t.Errorf("Replace(%s) = %q, %v, expecting %q", tc.tpl, cont, err, tc.expected)
+		}
+	}
+
+	if name, _ := os.Hostname(); name != "" {
+		if cont, err := td.Replace([]byte(`{{ hostname }}`)); err != nil || string(cont) != name {
+			t.Errorf("Replace(hostname) = %q, %v", cont, err)
+		}
+	}
+}
+
+func TestWithFuncs(t *testing.T) {
+	t.Setenv("TDATA_TEST_ENV", "from env")
+	td, err := New(WithStores(memStore("name: app\n")), WithFuncs(template.FuncMap{
+		"env":   func(key string) string { return "overridden " + key },
+		"upper": strings.ToUpper,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cont, err := td.Replace([]byte(`{{ env "TDATA_TEST_ENV" }}, {{ upper (value "name") }}`))
+	if err != nil || string(cont) != "overridden TDATA_TEST_ENV, APP" {
+		t.Errorf("Replace() = %q, %v", cont, err)
+	}
+}
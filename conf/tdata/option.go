@@ -19,7 +19,11 @@
 
 package tdata
 
-import "github.com/antigloss/go/conf/store"
+import (
+	"text/template"
+
+	"github.com/antigloss/go/conf/store"
+)
 
 // WithStores sets Stores from which data is read into TemplateData
 func WithStores(stores ...store.Store) option {
@@ -28,10 +32,33 @@ func WithStores(stores ...store.Store) option {
 	}
 }
 
+// SecretProvider provides secrets for the `secret` template function
+type SecretProvider interface {
+	// Secret returns the fields of the secret at `path`. It's called each time a `secret` template function is executed,
+	// so it's better to cache the secrets. Please refer to package vault for an implementation backed by HashiCorp Vault
+	Secret(path string) (map[string]interface{}, error)
+}
+
+// WithSecretProvider sets the SecretProvider for the `secret` template function
+func WithSecretProvider(p SecretProvider) option {
+	return func(o *options) {
+		o.secrets = p
+	}
+}
+
+// WithFuncs registers user-defined template functions. Functions with the same names as the built-in ones override them
+func WithFuncs(funcs template.FuncMap) option {
+	return func(o *options) {
+		o.funcs = funcs
+	}
+}
+
 type option func(opts *options)
 
 type options struct {
-	stores []store.Store
+	stores  []store.Store
+	secrets SecretProvider
+	funcs   template.FuncMap
 }
 
 func (o *options) apply(opts ...option) {
@@ -0,0 +1,122 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package vault
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// WithAddress sets Vault address, such as https://vault.example.com:8200
+func WithAddress(addr string) option {
+	return func(o *options) {
+		o.addr = addr
+	}
+}
+
+// WithToken sets the token for authenticating with Vault
+func WithToken(token string) option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithNamespace sets Vault Enterprise namespace
+func WithNamespace(ns string) option {
+	return func(o *options) {
+		o.namespace = ns
+	}
+}
+
+// WithHTTPClient sets the HTTP client for requesting Vault. Default timeout is 10s
+func WithHTTPClient(client *http.Client) option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithCacheTTL sets the maximum duration for caching a secret. Secrets with shorter lease durations are cached
+// until their leases expire. Default is 5 minutes
+func WithCacheTTL(ttl time.Duration) option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithTokenRenewal enables renewing the token every `interval`, so that a renewable token won't expire
+// while the process is running. Call Vault.Close to stop renewing
+func WithTokenRenewal(interval time.Duration) option {
+	return func(o *options) {
+		o.renewInterval = interval
+	}
+}
+
+const (
+	envAddr      = "VAULT_ADDR"
+	envToken     = "VAULT_TOKEN"
+	envNamespace = "VAULT_NAMESPACE"
+
+	defaultAddr     = "https://127.0.0.1:8200"
+	defaultCacheTTL = 5 * time.Minute
+)
+
+type option func(options *options)
+
+type options struct {
+	addr          string
+	token         string
+	namespace     string
+	httpClient    *http.Client
+	cacheTTL      time.Duration
+	renewInterval time.Duration
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.addr == "" {
+		if v := os.Getenv(envAddr); v != "" {
+			o.addr = v
+		} else {
+			o.addr = defaultAddr
+		}
+	}
+	o.addr = strings.TrimSuffix(o.addr, "/")
+
+	if o.token == "" {
+		o.token = os.Getenv(envToken)
+	}
+
+	if o.namespace == "" {
+		o.namespace = os.Getenv(envNamespace)
+	}
+
+	if o.httpClient == nil {
+		o.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if o.cacheTTL <= 0 {
+		o.cacheTTL = defaultCacheTTL
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package vault implements a tdata.SecretProvider which reads secrets from HashiCorp Vault.
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// New creates a SecretProvider which reads secrets from HashiCorp Vault via its HTTP API.
+// Both KV version 1 and version 2 secrets engines are supported. For KV version 2, `path` should contain `data`,
+// such as `secret/data/db`. Secrets are cached until their lease durations (or the TTL set by WithCacheTTL) expire.
+// Unspecified options could be read from ENV.
+//
+//	Relations of options and ENV keys:
+//	  - Address:    VAULT_ADDR . If not found in ENV, default is https://127.0.0.1:8200
+//	  - Token:      VAULT_TOKEN
+//	  - Namespace:  VAULT_NAMESPACE
+func New(opts ...option) *Vault {
+	v := &Vault{
+		cache: map[string]*cachedSecret{},
+		quit:  make(chan struct{}),
+	}
+	v.opts.apply(opts...)
+
+	if v.opts.renewInterval > 0 {
+		go v.renewToken()
+	}
+	return v
+}
+
+// Vault is a SecretProvider which reads secrets from HashiCorp Vault
+type Vault struct {
+	opts      options
+	lock      sync.Mutex
+	cache     map[string]*cachedSecret
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+type cachedSecret struct {
+	data     map[string]interface{}
+	expireAt time.Time
+}
+
+// Secret returns the fields of the secret at `path`
+func (v *Vault) Secret(path string) (map[string]interface{}, error) {
+	path = strings.Trim(path, "/")
+
+	v.lock.Lock()
+	s := v.cache[path]
+	v.lock.Unlock()
+	if s != nil && time.Now().Before(s.expireAt) {
+		return s.data, nil
+	}
+
+	var rsp secretResponse
+	if err := v.request(http.MethodGet, path, &rsp); err != nil {
+		return nil, err
+	}
+	if rsp.Data == nil {
+		return nil, fmt.Errorf("secret not found: %s", path)
+	}
+
+	data := rsp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data["metadata"]; ok { // KV version 2
+			data = inner
+		}
+	}
+
+	ttl := v.opts.cacheTTL
+	if rsp.LeaseDuration > 0 && time.Duration(rsp.LeaseDuration)*time.Second < ttl {
+		ttl = time.Duration(rsp.LeaseDuration) * time.Second
+	}
+	v.lock.Lock()
+	v.cache[path] = &cachedSecret{data: data, expireAt: time.Now().Add(ttl)}
+	v.lock.Unlock()
+	return data, nil
+}
+
+// Close stops renewing the token
+func (v *Vault) Close() {
+	v.closeOnce.Do(func() {
+		close(v.quit)
+	})
+}
+
+// renewToken renews the token periodically, so that it won't expire while the process is running
+func (v *Vault) renewToken() {
+	ticker := time.NewTicker(v.opts.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = v.request(http.MethodPost, "auth/token/renew-self", nil)
+		case <-v.quit:
+			return
+		}
+	}
+}
+
+func (v *Vault) request(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, v.opts.addr+"/v1/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.opts.token)
+	if v.opts.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.namespace)
+	}
+
+	rsp, err := v.opts.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		var errRsp struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(rsp.Body).Decode(&errRsp)
+		if len(errRsp.Errors) == 0 {
+			return fmt.Errorf("vault %s %s: %s", method, path, rsp.Status)
+		}
+		return fmt.Errorf("vault %s %s: %s: %s", method, path, rsp.Status, strings.Join(errRsp.Errors, "; "))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
+
+type secretResponse struct {
+	LeaseDuration int64                  `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+}
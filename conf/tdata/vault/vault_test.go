@@ -0,0 +1,174 @@
+/*
+ *
+ * Copyright (C) 2023 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/conf/tdata"
+)
+
+// vaultServer is a fake Vault which serves secrets of both KV version 1 and version 2
+type vaultServer struct {
+	*httptest.Server
+	reads   int32
+	renewal int32
+}
+
+func newVaultServer(t *testing.T) *vaultServer {
+	srv := &vaultServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := func(status int, body string) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			reply(http.StatusForbidden, `{"errors":["permission denied"]}`)
+			return
+		}
+
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/auth/token/renew-self" {
+			atomic.AddInt32(&srv.renewal, 1)
+			reply(http.StatusOK, `{}`)
+			return
+		}
+		if r.Method != http.MethodGet {
+			reply(http.StatusMethodNotAllowed, `{"errors":["unsupported operation"]}`)
+			return
+		}
+
+		atomic.AddInt32(&srv.reads, 1)
+		switch r.URL.Path {
+		case "/v1/kv/db":
+			reply(http.StatusOK, `{"lease_duration":3600,"data":{"user":"root","password":"v1pass"}}`)
+		case "/v1/kv/empty":
+			reply(http.StatusOK, `{"data":null}`)
+		case "/v1/secret/data/db":
+			reply(http.StatusOK, `{"data":{"data":{"password":"v2pass","port":3306},"metadata":{"version":3}}}`)
+		case "/v1/kv/nested":
+			reply(http.StatusOK, `{"data":{"data":{"password":"not v2"}}}`)
+		case "/v1/kv/unavailable":
+			reply(http.StatusServiceUnavailable, `not json`)
+		default:
+			reply(http.StatusNotFound, `{"errors":[]}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSecret(t *testing.T) {
+	srv := newVaultServer(t)
+	v := New(WithAddress(srv.URL+"/"), WithToken("s.token"), WithNamespace("team"))
+	defer v.Close()
+
+	for _, tc := range []struct {
+		path     string
+		expected string // JSON of the secret, or the error message
+	}{
+		{"kv/db", `{"password":"v1pass","user":"root"}`},
+		{"/secret/data/db/", `{"password":"v2pass","port":3306}`},
+		{"kv/nested", `{"data":{"password":"not v2"}}`},
+		{"kv/empty", "secret not found: kv/empty"},
+		{"secret/data/missing", "vault GET secret/data/missing: 404 Not Found"},
+		{"kv/unavailable", "vault GET kv/unavailable: 503 Service Unavailable"},
+	} {
+		var result string
+		data, err := v.Secret(tc.path)
+		if err != nil {
+			result = err.Error()
+		} else {
+			bs, _ := json.Marshal(data)
+			result = string(bs)
+		}
+		if result != tc.expected {
+			t.Errorf("Secret(%q) = %s, expecting %s", tc.path, result, tc.expected)
+		}
+	}
+
+	// Secrets are cached
+	reads := atomic.LoadInt32(&srv.reads)
+	if _, err := v.Secret("kv/db"); err != nil || atomic.LoadInt32(&srv.reads) != reads {
+		t.Errorf("Secret should be read from the cache: %v", err)
+	}
+
+	// The token is sent with each request
+	v = New(WithAddress(srv.URL), WithToken("bad"), WithNamespace("team"))
+	defer v.Close()
+	if _, err := v.Secret("kv/db"); err == nil || !strings.HasSuffix(err.Error(), "403 Forbidden: permission denied") {
+		t.Errorf("Secret() should fail with a bad token: %v", err)
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	srv := newVaultServer(t)
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+	t.Setenv("VAULT_NAMESPACE", "team")
+
+	v := New(WithCacheTTL(time.Nanosecond), WithTokenRenewal(time.Millisecond))
+	defer v.Close()
+	for i := 0; i < 2; i++ {
+		if data, err := v.Secret("kv/db"); err != nil || data["user"] != "root" {
+			t.Fatalf("Secret() = %v, %v", data, err)
+		}
+	}
+	if reads := atomic.LoadInt32(&srv.reads); reads != 2 {
+		t.Errorf("Expired secrets should be read again, reads=%d", reads)
+	}
+
+	for i := 0; atomic.LoadInt32(&srv.renewal) == 0; i++ {
+		if i == 100 {
+			t.Fatal("Token should be renewed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSecretTemplateFunc(t *testing.T) {
+	srv := newVaultServer(t)
+	v := New(WithAddress(srv.URL), WithToken("s.token"), WithNamespace("team"))
+	defer v.Close()
+
+	td, err := tdata.New(tdata.WithSecretProvider(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont, err := td.Replace([]byte(`password: {{ secret "secret/data/db#password" }}, port: {{ secret "secret/data/db#port" }}, user: {{ secret "kv/db#user" }}`))
+	if err != nil || string(cont) != "password: v2pass, port: 3306, user: root" {
+		t.Errorf("Replace() = %s, %v", cont, err)
+	}
+
+	for _, tpl := range []string{
+		`{{ secret "secret/data/db#missing" }}`,
+		`{{ secret "secret/data/missing#password" }}`,
+		`{{ secret "secret/data/db" }}`,
+	} {
+		if cont, err = td.Replace([]byte(tpl)); err == nil {
+			t.Errorf("Replace(%s) should fail, but returns %s", tpl, cont)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ *
+ * lru - LRU cache package
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lru
+
+import (
+	"context"
+	"sync"
+)
+
+// keyMutex is a set of mutexes, one per key. Mutexes are created on demand and released as soon as nobody holds or waits for them.
+type keyMutex struct {
+	mtx   sync.Mutex
+	locks map[interface{}]*keyLock
+}
+
+type keyLock struct {
+	ch   chan struct{} // acts as a mutex which can be waited with select
+	refs int           // number of goroutines holding or waiting for this lock
+}
+
+// lock locks `key`. It blocks until the lock is acquired or `ctx` is done, in which case ctx.Err() is returned.
+func (km *keyMutex) lock(ctx context.Context, key interface{}) error {
+	km.mtx.Lock()
+	if km.locks == nil {
+		km.locks = make(map[interface{}]*keyLock)
+	}
+	kl := km.locks[key]
+	if kl == nil {
+		kl = &keyLock{ch: make(chan struct{}, 1)}
+		km.locks[key] = kl
+	}
+	kl.refs++
+	km.mtx.Unlock()
+
+	select {
+	case kl.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		km.mtx.Lock()
+		km.release(key, kl)
+		km.mtx.Unlock()
+		return ctx.Err()
+	}
+}
+
+// unlock unlocks `key`. It panics if `key` is not locked.
+func (km *keyMutex) unlock(key interface{}) {
+	km.mtx.Lock()
+	defer km.mtx.Unlock()
+
+	kl := km.locks[key]
+	if kl != nil {
+		select {
+		case <-kl.ch:
+			km.release(key, kl)
+			return
+		default:
+		}
+	}
+	panic("lru: unlock of unlocked key")
+}
+
+// release should be called with `km.mtx` locked
+func (km *keyMutex) release(key interface{}, kl *keyLock) {
+	kl.refs--
+	if kl.refs == 0 {
+		delete(km.locks, key)
+	}
+}
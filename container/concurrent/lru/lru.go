@@ -31,13 +31,27 @@ Basic example:
 	cache.Add(Key, CachedObj, CachedObjSize)
 	// Gets a cached object
 	cachedObj, ok := cache.Get(Key)
+
+Example with expiration:
+
+	// Objects expire after 10 minutes by default, expired objects are purged every minute
+	cache := lru.NewCache(MaxCachedFileNum, MaxCachedSize, nil, lru.WithDefaultTTL(10*time.Minute), lru.WithSweepInterval(time.Minute))
+	defer cache.Close()
+	// Caches an object which expires after 1 minute
+	cache.AddWithTTL(Key, CachedObj, CachedObjSize, time.Minute)
+
+New code should use "github.com/antigloss/go/container/concurrent/lru/v2", which is type safe and supports TTL and single-flight loading.
 */
 package lru
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/golang/groupcache/lru"
+
+	"github.com/antigloss/go/utils/clock"
 )
 
 // Cache is a goroutine safe LRU cache base on "github.com/golang/groupcache/lru".
@@ -47,11 +61,52 @@ type Cache struct {
 	memoryUsed    int64
 	maxCachedSize int64
 	onEvictedImpl func(key, value interface{})
+	keyLocks      keyMutex
+	defaultTTL    time.Duration
+	clock         clock.Clock
+	expirable     map[interface{}]*cachedNode // cached objects with expiration time, scanned by the sweeper
+	stopSweeping  chan struct{}
+	onEvictReason func(key, value interface{}, reason EvictReason)
+	evictReason   EvictReason // reason of the ongoing eviction
+	hits          uint64
+	misses        uint64
+	evictions     [EvictReasonCount]uint64
+}
+
+// EvictReason tells why an object is purged from the cache.
+type EvictReason int
+
+const (
+	EvictReasonCapacity       EvictReason = iota // The number of cached objects exceeds the limit.
+	EvictReasonSize                              // The total size of cached objects exceeds the limit.
+	EvictReasonExpired                           // The object is expired.
+	EvictReasonExplicit                          // The object is removed by Remove, RemoveCachedObjects or Clear.
+	EvictReasonMemoryPressure                    // The object is purged by TrimToSize, usually called by MemoryWatcher.
+	EvictReasonCount                             // Number of different evict reasons.
+)
+
+// Stats holds statistics of a Cache.
+type Stats struct {
+	Hits      uint64                   // Number of Get calls which found the object
+	Misses    uint64                   // Number of Get calls which didn't find the object, expired objects included
+	Evictions [EvictReasonCount]uint64 // Number of purged objects, indexed by EvictReason
+	Entries   int                      // Number of objects currently cached
+	Bytes     int64                    // Total size of objects currently cached
+}
+
+// HitRate returns Hits / (Hits + Misses), or 0 if Get has never been called.
+func (s *Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
 }
 
 type cachedNode struct {
-	value interface{}
-	size  int64
+	value    interface{}
+	size     int64
+	expireAt time.Time // zero means never expire
 }
 
 // NewCache creates a ready-to-use Cache.
@@ -59,30 +114,108 @@ type cachedNode struct {
 //	maxEntries: Limit of cached objects, LRU eviction will be triggered when reached.
 //	maxCachedSize: Limit of total cached objects' size in bytes, LRU eviction will be triggered when reached.
 //	onEvicted: Optionally specificies a callback function to be executed when an entry is purged from the cache.
-func NewCache(maxEntries int, maxCachedSize int64, onEvicted func(key, object interface{})) *Cache {
+//	opts: Optional settings such as WithDefaultTTL and WithSweepInterval.
+func NewCache(maxEntries int, maxCachedSize int64, onEvicted func(key, object interface{}), opts ...option) *Cache {
+	var o options
+	o.apply(opts...)
+
 	c := &Cache{
 		c: &lru.Cache{
 			MaxEntries: maxEntries,
 		},
 		maxCachedSize: maxCachedSize,
+		onEvictedImpl: onEvicted,
+		defaultTTL:    o.defaultTTL,
+		clock:         clock.OrReal(o.clock),
+		onEvictReason: o.onEvictReason,
+		expirable:     make(map[interface{}]*cachedNode),
 	}
-	if onEvicted != nil {
-		c.onEvictedImpl = onEvicted
-		c.c.OnEvicted = c.onEvicted
+	c.c.OnEvicted = c.onEvicted
+	if o.sweepInterval > 0 {
+		c.stopSweeping = make(chan struct{})
+		go c.sweep(o.sweepInterval)
 	}
 
 	return c
 }
 
+// WithDefaultTTL sets the default time-to-live of the objects added by Add. <=0 means never expire, which is the default.
+func WithDefaultTTL(ttl time.Duration) option {
+	return func(o *options) {
+		o.defaultTTL = ttl
+	}
+}
+
+// WithSweepInterval starts a background goroutine to purge expired objects every `interval`.
+// Otherwise, expired objects are purged only when they are looked up or evicted by LRU.
+// Cache.Close must be called to stop the goroutine.
+func WithSweepInterval(interval time.Duration) option {
+	return func(o *options) {
+		o.sweepInterval = interval
+	}
+}
+
+// WithEvictReasonCallback sets a callback function to be executed with the reason when an object is purged from the cache.
+// It's called after the `onEvicted` callback passed to NewCache, with the cache locked.
+func WithEvictReasonCallback(onEvict func(key, object interface{}, reason EvictReason)) option {
+	return func(o *options) {
+		o.onEvictReason = onEvict
+	}
+}
+
+// WithClock sets the source of the time used for TTLs and sweeping. Default is clock.Real.
+// Set it to a clock.Fake to test expiration without sleeping.
+func WithClock(c clock.Clock) option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	defaultTTL    time.Duration
+	sweepInterval time.Duration
+	onEvictReason func(key, object interface{}, reason EvictReason)
+	clock         clock.Clock
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
 // Add adds an object to the cache, LRU eviction will be triggered if limit reached after adding.
 //
 //	key: Key of the cached object.
 //	object: Object to be cached.
 //	objectSize: Size in bytes of the cached object.
 func (c *Cache) Add(key, object interface{}, objectSize int64) {
+	c.AddWithTTL(key, object, objectSize, c.defaultTTL)
+}
+
+// AddWithTTL adds an object which expires after `ttl` to the cache, overriding the default TTL. <=0 means never expire.
+// LRU eviction will be triggered if limit reached after adding.
+func (c *Cache) AddWithTTL(key, object interface{}, objectSize int64, ttl time.Duration) {
+	node := &cachedNode{value: object, size: objectSize}
+	if ttl > 0 {
+		node.expireAt = c.clock.Now().Add(ttl)
+	}
+
 	c.mtx.Lock()
-	c.c.Add(key, &cachedNode{object, objectSize})
+	if old, ok := c.c.Get(key); ok { // `old` is replaced by `node` without eviction
+		oldNode := old.(*cachedNode)
+		c.memoryUsed -= oldNode.size
+		delete(c.expirable, key)
+	}
+	c.evictReason = EvictReasonCapacity
+	c.c.Add(key, node)
 	c.memoryUsed += objectSize
+	if ttl > 0 {
+		c.expirable[key] = node
+	}
+	c.evictReason = EvictReasonSize
 	for c.memoryUsed > c.maxCachedSize {
 		c.c.RemoveOldest()
 	}
@@ -90,11 +223,24 @@ func (c *Cache) Add(key, object interface{}, objectSize int64) {
 }
 
 // Get looks up a key's object from the cache. It returns true and the object if found, false and nil otherwise.
+// Expired objects are purged and reported as not found.
 func (c *Cache) Get(key interface{}) (object interface{}, ok bool) {
 	c.mtx.Lock()
 	object, ok = c.c.Get(key)
 	if ok {
-		object = object.(*cachedNode).value
+		node := object.(*cachedNode)
+		if node.expired(c.clock.Now()) {
+			c.evictReason = EvictReasonExpired
+			c.c.Remove(key)
+			object, ok = nil, false
+		} else {
+			object = node.value
+		}
+	}
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
 	}
 	c.mtx.Unlock()
 
@@ -113,6 +259,7 @@ func (c *Cache) CurCachedSize() (size int64) {
 // Remove removes a key's object from the cache.
 func (c *Cache) Remove(key interface{}) {
 	c.mtx.Lock()
+	c.evictReason = EvictReasonExplicit
 	c.c.Remove(key)
 	c.mtx.Unlock()
 }
@@ -120,6 +267,7 @@ func (c *Cache) Remove(key interface{}) {
 // RemoveCachedObjects removes objects specified in `keys` from the cache.
 func (c *Cache) RemoveCachedObjects(keys []interface{}) {
 	c.mtx.Lock()
+	c.evictReason = EvictReasonExplicit
 	for _, key := range keys {
 		c.c.Remove(key)
 	}
@@ -129,12 +277,107 @@ func (c *Cache) RemoveCachedObjects(keys []interface{}) {
 // Clear purges all cached objects from the cache.
 func (c *Cache) Clear() {
 	c.mtx.Lock()
+	c.evictReason = EvictReasonExplicit
 	c.c.Clear()
 	c.mtx.Unlock()
 }
 
+// TrimToSize purges the least recently used objects until the total cached objects' size is no more than `bytes`.
+// It returns the number of purged objects.
+func (c *Cache) TrimToSize(bytes int64) (n int) {
+	c.mtx.Lock()
+	c.evictReason = EvictReasonMemoryPressure
+	for c.memoryUsed > bytes && c.c.Len() > 0 {
+		c.c.RemoveOldest()
+		n++
+	}
+	c.mtx.Unlock()
+	return
+}
+
+// Stats returns statistics of the cache.
+func (c *Cache) Stats() (stats Stats) {
+	c.mtx.Lock()
+	stats = Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   c.c.Len(),
+		Bytes:     c.memoryUsed,
+	}
+	c.mtx.Unlock()
+	return
+}
+
+// Close stops the background goroutine started by WithSweepInterval. Cached objects are kept.
+func (c *Cache) Close() {
+	if c.stopSweeping != nil {
+		close(c.stopSweeping)
+	}
+}
+
+// LockKey locks `key` so that callers composing multi-step cache-fill logic (check cache, fetch, transform, add)
+// can be serialized per key without a global mutex. It doesn't lock the cache itself.
+// It blocks until the lock is acquired or `ctx` is done, in which case ctx.Err() is returned.
+//
+// Example:
+//
+//	if err := cache.LockKey(ctx, key); err != nil {
+//		return err
+//	}
+//	defer cache.UnlockKey(key)
+//	obj, ok := cache.Get(key)
+//	if !ok {
+//		obj = load(key)
+//		cache.Add(key, obj, size)
+//	}
+func (c *Cache) LockKey(ctx context.Context, key interface{}) error {
+	return c.keyLocks.lock(ctx, key)
+}
+
+// UnlockKey unlocks `key` locked by LockKey. It panics if `key` is not locked.
+func (c *Cache) UnlockKey(key interface{}) {
+	c.keyLocks.unlock(key)
+}
+
 func (c *Cache) onEvicted(key lru.Key, value interface{}) {
 	cachedNode := value.(*cachedNode)
-	c.onEvictedImpl(key, cachedNode.value)
+	if !cachedNode.expireAt.IsZero() {
+		delete(c.expirable, key)
+	}
+	if c.onEvictedImpl != nil {
+		c.onEvictedImpl(key, cachedNode.value)
+	}
+	if c.onEvictReason != nil {
+		c.onEvictReason(key, cachedNode.value, c.evictReason)
+	}
+	c.evictions[c.evictReason]++
 	c.memoryUsed -= cachedNode.size
 }
+
+// sweep purges expired objects every `interval`
+func (c *Cache) sweep(interval time.Duration) {
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			c.mtx.Lock()
+			now := c.clock.Now()
+			c.evictReason = EvictReasonExpired
+			for key, node := range c.expirable {
+				if node.expired(now) {
+					c.c.Remove(key)
+				}
+			}
+			c.mtx.Unlock()
+		case <-c.stopSweeping:
+			return
+		}
+	}
+}
+
+func (n *cachedNode) expired(now time.Time) bool {
+	return !n.expireAt.IsZero() && !now.Before(n.expireAt)
+}
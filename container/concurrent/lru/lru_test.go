@@ -0,0 +1,157 @@
+/*
+ *
+ * lru - LRU cache package
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lru
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+func TestLockKey(t *testing.T) {
+	c := NewCache(10, 1024, nil)
+	if err := c.LockKey(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LockKey(context.Background(), "other"); err != nil {
+		t.Fatal("Locking a different key should not block:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.LockKey(ctx, "k"); err != context.DeadlineExceeded {
+		t.Fatal("LockKey should time out:", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.LockKey(context.Background(), "k")
+		c.UnlockKey("k")
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.UnlockKey("k")
+	<-done
+	c.UnlockKey("other")
+
+	if len(c.keyLocks.locks) != 0 {
+		t.Errorf("Key locks should be released: %v", c.keyLocks.locks)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	var evicted []interface{}
+	fc := clock.NewFake(time.Now())
+	c := NewCache(10, 1024, func(key, object interface{}) {
+		evicted = append(evicted, key)
+	}, WithDefaultTTL(time.Hour), WithSweepInterval(5*time.Millisecond), WithClock(fc))
+	defer c.Close()
+
+	c.Add("default", 1, 10)
+	c.AddWithTTL("short", 2, 10, time.Millisecond)
+	c.AddWithTTL("forever", 3, 10, 0)
+	c.AddWithTTL("lazy", 4, 10, time.Millisecond)
+	c.Add("lazy", 5, 10) // replaced with the default TTL
+	if c.CurCachedSize() != 40 {
+		t.Errorf("Unexpected cached size %d", c.CurCachedSize())
+	}
+
+	fc.Advance(59 * time.Minute)
+	if _, ok := c.Get("short"); ok {
+		t.Error("short should be expired")
+	}
+	for _, key := range []string{"default", "forever", "lazy"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should not be expired", key)
+		}
+	}
+	if len(evicted) != 1 || evicted[0] != "short" || c.CurCachedSize() != 30 {
+		t.Errorf("Only short should be evicted: %v %d", evicted, c.CurCachedSize())
+	}
+}
+
+func TestStats(t *testing.T) {
+	reasons := map[interface{}]EvictReason{}
+	c := NewCache(2, 100, nil, WithEvictReasonCallback(func(key, object interface{}, reason EvictReason) {
+		reasons[key] = reason
+	}))
+
+	c.Add("a", 1, 10)
+	c.Add("b", 2, 10)
+	c.Add("c", 3, 10) // a evicted by capacity
+	c.Add("d", 4, 95) // b evicted by capacity, then c evicted by size
+	c.AddWithTTL("e", 5, 1, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	c.Get("e") // expired
+	c.Get("d")
+	c.Remove("d")
+
+	expected := map[interface{}]EvictReason{"a": EvictReasonCapacity, "b": EvictReasonCapacity, "c": EvictReasonSize, "e": EvictReasonExpired, "d": EvictReasonExplicit}
+	for key, reason := range expected {
+		if reasons[key] != reason {
+			t.Errorf("Unexpected reason of %v: %d", key, reasons[key])
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.HitRate() != 0.5 || stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.Evictions != [EvictReasonCount]uint64{2, 1, 1, 1} {
+		t.Errorf("Unexpected evictions: %v", stats.Evictions)
+	}
+}
+
+func TestMemoryWatcher(t *testing.T) {
+	c := NewCache(0, 1000, nil)
+	for i := 0; i < 10; i++ {
+		c.Add(i, i, 100)
+	}
+
+	var pressured bool
+	w := NewMemoryWatcher([]Trimmer{c}, WithMemoryLimit(1000), WithCheckInterval(time.Hour), WithPressureCallback(func(used, limit int64) {
+		pressured = true
+	}))
+	defer w.Close()
+
+	w.memoryUsage = func() int64 { return 800 }
+	w.check()
+	if pressured || c.CurCachedSize() != 1000 {
+		t.Fatalf("Should not be trimmed below the high watermark: %d", c.CurCachedSize())
+	}
+
+	w.memoryUsage = func() int64 { return 900 }
+	w.check()
+	if !pressured || c.CurCachedSize() != 500 {
+		t.Fatalf("Should be trimmed to half: %d", c.CurCachedSize())
+	}
+	if _, ok := c.Get(4); ok {
+		t.Error("Least recently used objects should be purged")
+	}
+	if _, ok := c.Get(5); !ok {
+		t.Error("Most recently used objects should be kept")
+	}
+	if stats := c.Stats(); stats.Evictions[EvictReasonMemoryPressure] != 5 {
+		t.Errorf("Unexpected evictions: %v", stats.Evictions)
+	}
+}
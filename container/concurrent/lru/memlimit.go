@@ -0,0 +1,30 @@
+//go:build go1.19
+
+/*
+ *
+ * lru - LRU cache package
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lru
+
+import "runtime/debug"
+
+// memoryLimit returns the memory limit set by debug.SetMemoryLimit or GOMEMLIMIT
+func memoryLimit() int64 {
+	return debug.SetMemoryLimit(-1)
+}
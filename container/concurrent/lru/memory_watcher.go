@@ -0,0 +1,178 @@
+/*
+ *
+ * lru - LRU cache package
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lru
+
+import (
+	"math"
+	"runtime"
+	"time"
+)
+
+// Trimmer is a cache which can be shrunk on memory pressure. Both Cache and the generic Cache from
+// "github.com/antigloss/go/container/concurrent/lru/v2" implement it.
+type Trimmer interface {
+	CurCachedSize() int64
+	TrimToSize(bytes int64) int
+}
+
+// MemoryWatcher watches the memory usage of the process, and shrinks caches proactively
+// before the process hits its memory limit.
+type MemoryWatcher struct {
+	caches        []Trimmer
+	limit         int64
+	highWatermark float64
+	trimRatio     float64
+	onPressure    func(used, limit int64)
+	memoryUsage   func() int64 // returns the memory used by the Go runtime
+	stop          chan struct{}
+}
+
+// NewMemoryWatcher creates a MemoryWatcher which checks the memory usage every second by default.
+// When the memory used by the Go runtime reaches 90% (WithHighWatermark) of the memory limit,
+// each of `caches` is trimmed to 50% (WithTrimRatio) of its current size.
+//
+// The memory limit is the one set by debug.SetMemoryLimit or GOMEMLIMIT (requires Go 1.19+), unless overridden by WithMemoryLimit.
+// Nothing will be trimmed if there is no memory limit. MemoryWatcher.Close must be called to stop watching.
+//
+// Example:
+//
+//	w := lru.NewMemoryWatcher([]lru.Trimmer{cache1, cache2}, lru.WithMemoryLimit(2<<30))
+//	defer w.Close()
+func NewMemoryWatcher(caches []Trimmer, opts ...watcherOption) *MemoryWatcher {
+	o := watcherOptions{
+		checkInterval: time.Second,
+		highWatermark: 0.9,
+		trimRatio:     0.5,
+	}
+	o.apply(opts...)
+
+	w := &MemoryWatcher{
+		caches:        caches,
+		limit:         o.limit,
+		highWatermark: o.highWatermark,
+		trimRatio:     o.trimRatio,
+		onPressure:    o.onPressure,
+		memoryUsage:   runtimeMemoryUsage,
+		stop:          make(chan struct{}),
+	}
+	go w.watch(o.checkInterval)
+	return w
+}
+
+// WithMemoryLimit sets the memory limit in bytes, overriding the one set by debug.SetMemoryLimit or GOMEMLIMIT.
+func WithMemoryLimit(bytes int64) watcherOption {
+	return func(o *watcherOptions) {
+		o.limit = bytes
+	}
+}
+
+// WithHighWatermark sets the ratio of the memory limit at which caches are trimmed. Default is 0.9.
+func WithHighWatermark(ratio float64) watcherOption {
+	return func(o *watcherOptions) {
+		o.highWatermark = ratio
+	}
+}
+
+// WithTrimRatio sets the ratio of the current size to which caches are trimmed on memory pressure. Default is 0.5.
+func WithTrimRatio(ratio float64) watcherOption {
+	return func(o *watcherOptions) {
+		o.trimRatio = ratio
+	}
+}
+
+// WithCheckInterval sets how often the memory usage is checked. Default is 1 second.
+func WithCheckInterval(interval time.Duration) watcherOption {
+	return func(o *watcherOptions) {
+		o.checkInterval = interval
+	}
+}
+
+// WithPressureCallback sets a callback function to be executed after caches are trimmed on memory pressure.
+func WithPressureCallback(onPressure func(used, limit int64)) watcherOption {
+	return func(o *watcherOptions) {
+		o.onPressure = onPressure
+	}
+}
+
+type watcherOption func(opts *watcherOptions)
+
+type watcherOptions struct {
+	limit         int64
+	highWatermark float64
+	trimRatio     float64
+	checkInterval time.Duration
+	onPressure    func(used, limit int64)
+}
+
+func (o *watcherOptions) apply(opts ...watcherOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// Close stops watching.
+func (w *MemoryWatcher) Close() {
+	close(w.stop)
+}
+
+func (w *MemoryWatcher) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// check trims all the caches if the memory usage reaches the high watermark
+func (w *MemoryWatcher) check() {
+	limit := w.limit
+	if limit <= 0 {
+		limit = memoryLimit()
+	}
+	if limit <= 0 || limit == math.MaxInt64 { // No memory limit
+		return
+	}
+
+	used := w.memoryUsage()
+	if float64(used) < float64(limit)*w.highWatermark {
+		return
+	}
+
+	for _, c := range w.caches {
+		c.TrimToSize(int64(float64(c.CurCachedSize()) * w.trimRatio))
+	}
+	if w.onPressure != nil {
+		w.onPressure(used, limit)
+	}
+}
+
+// runtimeMemoryUsage returns the memory used by the Go runtime, which is what the memory limit is compared against
+func runtimeMemoryUsage() int64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.Sys - ms.HeapReleased)
+}
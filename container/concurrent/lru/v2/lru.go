@@ -0,0 +1,326 @@
+/*
+ *
+ * lru - LRU cache package
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+/*
+Package lru provides a goroutine safe, generic LRU cache implementation.
+Compared to its predecessor "github.com/antigloss/go/container/concurrent/lru", it's type safe,
+supports per-entry TTL, and never loads the same key concurrently.
+
+Basic example:
+
+	// Creates a cache
+	cache := lru.NewCache[string, *File](MaxCachedFileNum, MaxCachedSize, func(key string, file *File) {
+		// Jobs to do on evicted
+	})
+	// Caches an object
+	cache.Add(Key, CachedFile, CachedFileSize)
+	// Caches an object which expires after 1 minute
+	cache.AddWithTTL(Key, CachedFile, CachedFileSize, time.Minute)
+	// Gets a cached object
+	cachedFile, ok := cache.Get(Key)
+	// Gets a cached object, loads it if not cached. Concurrent calls with the same key share a single load.
+	cachedFile, err := cache.GetOrLoad(ctx, Key, func(ctx context.Context, key string) (*File, int64, time.Duration, error) {
+		file, err := loadFile(ctx, key)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		return file, file.Size, time.Minute, nil
+	})
+*/
+package lru
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/antigloss/go/container/list"
+	"github.com/antigloss/go/utils/clock"
+)
+
+// Loader loads the value of `key` on cache miss.
+// It returns the value, the value's size in bytes, and the value's TTL (<=0 means never expire).
+type Loader[K comparable, V any] func(ctx context.Context, key K) (value V, size int64, ttl time.Duration, err error)
+
+// Cache is a goroutine safe, generic LRU cache.
+type Cache[K comparable, V any] struct {
+	mtx           sync.Mutex
+	ll            *list.List[*entry[K, V]]
+	items         map[K]*list.Element[*entry[K, V]]
+	loads         map[K]*loadCall[V] // in-flight loads
+	maxEntries    int
+	maxCachedSize int64
+	memoryUsed    int64
+	onEvicted     func(key K, value V)
+	clock         clock.Clock
+}
+
+type entry[K comparable, V any] struct {
+	key      K
+	value    V
+	size     int64
+	expireAt time.Time // zero means never expire
+}
+
+type loadCall[V any] struct {
+	done  chan struct{} // closed when the load completes
+	value V
+	err   error
+}
+
+// NewCache creates a ready-to-use Cache.
+//
+//	maxEntries: Limit of cached objects, LRU eviction will be triggered when reached. 0 means unlimited.
+//	maxCachedSize: Limit of total cached objects' size in bytes, LRU eviction will be triggered when reached. 0 means unlimited.
+//	onEvicted: Optionally specifies a callback function to be executed when an entry is purged from the cache.
+//	           It's called with the cache locked, so it must not call any method of the cache.
+//	opts: Optional settings such as WithClock.
+func NewCache[K comparable, V any](maxEntries int, maxCachedSize int64, onEvicted func(key K, value V), opts ...option) *Cache[K, V] {
+	var o options
+	o.apply(opts...)
+
+	return &Cache[K, V]{
+		ll:            list.New[*entry[K, V]](),
+		items:         make(map[K]*list.Element[*entry[K, V]]),
+		loads:         make(map[K]*loadCall[V]),
+		maxEntries:    maxEntries,
+		maxCachedSize: maxCachedSize,
+		onEvicted:     onEvicted,
+		clock:         clock.OrReal(o.clock),
+	}
+}
+
+// WithClock sets the source of the time used for TTLs. Default is clock.Real.
+// Set it to a clock.Fake to test expiration without sleeping.
+func WithClock(c clock.Clock) option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	clock clock.Clock
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// Add adds an object to the cache, LRU eviction will be triggered if limit reached after adding.
+//
+//	key: Key of the cached object.
+//	value: Object to be cached.
+//	size: Size in bytes of the cached object.
+func (c *Cache[K, V]) Add(key K, value V, size int64) {
+	c.AddWithTTL(key, value, size, 0)
+}
+
+// AddWithTTL adds an object which expires after `ttl` to the cache. <=0 means never expire.
+// LRU eviction will be triggered if limit reached after adding.
+func (c *Cache[K, V]) AddWithTTL(key K, value V, size int64, ttl time.Duration) {
+	c.mtx.Lock()
+	c.add(key, value, size, ttl)
+	c.mtx.Unlock()
+}
+
+// Get looks up a key's object from the cache. It returns the object and true if found, zero value and false otherwise.
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	c.mtx.Lock()
+	value, ok = c.get(key)
+	c.mtx.Unlock()
+	return
+}
+
+// GetOrLoad looks up a key's object from the cache. If not found, it calls `loader` to load the object and caches it.
+// Concurrent calls with the same key share a single call to `loader`, and all of them get the same result.
+// `loader` is called in another goroutine with a context which carries the values of `ctx` of the first caller
+// but is never canceled, so that a canceled caller never fails the others. If `ctx` is done before the load
+// is finished, ctx.Err() is returned, and the load keeps going for the other callers.
+// Errors returned by `loader` are not cached, and panics of `loader` are returned as errors.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	c.mtx.Lock()
+	if value, ok := c.get(key); ok {
+		c.mtx.Unlock()
+		return value, nil
+	}
+	if call := c.loads[key]; call != nil {
+		c.mtx.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+	call := &loadCall[V]{done: make(chan struct{})}
+	c.loads[key] = call
+	c.mtx.Unlock()
+
+	go c.load(detachedContext{ctx}, key, loader, call)
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Len returns the number of cached objects, expired ones which are not purged yet included.
+func (c *Cache[K, V]) Len() (n int) {
+	c.mtx.Lock()
+	n = c.ll.Len()
+	c.mtx.Unlock()
+	return
+}
+
+// CurCachedSize returns the total cached objects' size in bytes.
+func (c *Cache[K, V]) CurCachedSize() (size int64) {
+	c.mtx.Lock()
+	size = c.memoryUsed
+	c.mtx.Unlock()
+	return
+}
+
+// Remove removes a key's object from the cache.
+func (c *Cache[K, V]) Remove(key K) {
+	c.mtx.Lock()
+	if elem := c.items[key]; elem != nil {
+		c.removeElement(elem)
+	}
+	c.mtx.Unlock()
+}
+
+// Clear purges all cached objects from the cache.
+func (c *Cache[K, V]) Clear() {
+	c.mtx.Lock()
+	for c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back())
+	}
+	c.mtx.Unlock()
+}
+
+// TrimToSize purges the least recently used objects until the total cached objects' size is no more than `bytes`.
+// It returns the number of purged objects. It can be used with MemoryWatcher from "github.com/antigloss/go/container/concurrent/lru".
+func (c *Cache[K, V]) TrimToSize(bytes int64) (n int) {
+	c.mtx.Lock()
+	for c.memoryUsed > bytes && c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back())
+		n++
+	}
+	c.mtx.Unlock()
+	return
+}
+
+// load calls `loader` and publishes the result to `call`
+func (c *Cache[K, V]) load(ctx context.Context, key K, loader Loader[K, V], call *loadCall[V]) {
+	var size int64
+	var ttl time.Duration
+	defer func() { // Waiters must be released even if `loader` panics
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("lru: the loader panicked: %v", r)
+		}
+		c.mtx.Lock()
+		if call.err == nil {
+			c.add(key, call.value, size, ttl)
+		}
+		delete(c.loads, key)
+		c.mtx.Unlock()
+		close(call.done)
+	}()
+
+	call.value, size, ttl, call.err = loader(ctx, key)
+}
+
+// add should be called with `c.mtx` locked
+func (c *Cache[K, V]) add(key K, value V, size int64, ttl time.Duration) {
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = c.clock.Now().Add(ttl)
+	}
+
+	if elem := c.items[key]; elem != nil {
+		c.ll.MoveToFront(elem)
+		e := elem.Value
+		c.memoryUsed += size - e.size
+		e.value = value
+		e.size = size
+		e.expireAt = expireAt
+	} else {
+		c.items[key] = c.ll.PushFront(&entry[K, V]{key, value, size, expireAt})
+		c.memoryUsed += size
+	}
+
+	for c.ll.Len() > 0 && ((c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxCachedSize > 0 && c.memoryUsed > c.maxCachedSize)) {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// get should be called with `c.mtx` locked
+func (c *Cache[K, V]) get(key K) (value V, ok bool) {
+	elem := c.items[key]
+	if elem == nil {
+		return
+	}
+	e := elem.Value
+	if !e.expireAt.IsZero() && !c.clock.Now().Before(e.expireAt) {
+		c.removeElement(elem)
+		return
+	}
+	c.ll.MoveToFront(elem)
+	return e.value, true
+}
+
+// detachedContext carries the values of its parent but is never canceled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// removeElement should be called with `c.mtx` locked
+func (c *Cache[K, V]) removeElement(elem *list.Element[*entry[K, V]]) {
+	e := c.ll.Remove(elem)
+	delete(c.items, e.key)
+	c.memoryUsed -= e.size
+	if c.onEvicted != nil {
+		c.onEvicted(e.key, e.value)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ *
+ * lru - LRU cache package
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lru
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+func TestCache(t *testing.T) {
+	var evicted []string
+	fc := clock.NewFake(time.Now())
+	c := NewCache[string, int](2, 100, func(key string, value int) {
+		evicted = append(evicted, key)
+	}, WithClock(fc))
+
+	c.Add("a", 1, 10)
+	c.Add("b", 2, 10)
+	c.Get("a")
+	c.Add("c", 3, 10) // evicts b
+	if _, ok := c.Get("b"); ok || len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("b should be evicted: %v", evicted)
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("unexpected value of a: %d %v", v, ok)
+	}
+
+	c.Add("d", 4, 95) // evicts c and a
+	if c.Len() != 1 || c.CurCachedSize() != 95 {
+		t.Errorf("unexpected len %d and size %d", c.Len(), c.CurCachedSize())
+	}
+
+	c.AddWithTTL("e", 5, 1, time.Millisecond)
+	fc.Advance(time.Millisecond)
+	if _, ok := c.Get("e"); ok {
+		t.Error("e should be expired")
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	c := NewCache[int, string](0, 0, nil)
+
+	var loads int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key int) (string, int64, time.Duration, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "v", 1, 0, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.GetOrLoad(context.Background(), 1, loader); v != "v" || err != nil {
+				t.Errorf("unexpected result: %q %v", v, err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := c.GetOrLoad(ctx, 1, loader); err != context.DeadlineExceeded {
+		t.Errorf("expecting DeadlineExceeded but gets %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	if loads != 1 {
+		t.Errorf("loader should be called once but called %d times", loads)
+	}
+	if v, ok := c.Get(1); !ok || v != "v" {
+		t.Errorf("loaded value should be cached: %q %v", v, ok)
+	}
+}
+
+func TestTrimToSize(t *testing.T) {
+	c := NewCache[int, int](0, 0, nil)
+	for i := 0; i < 10; i++ {
+		c.Add(i, i, 10)
+	}
+	if n := c.TrimToSize(35); n != 7 || c.CurCachedSize() != 30 {
+		t.Fatalf("TrimToSize() = %d, size = %d", n, c.CurCachedSize())
+	}
+	if _, ok := c.Get(7); !ok {
+		t.Error("Most recently used objects should be kept")
+	}
+}
+
+func TestGetOrLoadFirstCallerCanceled(t *testing.T) {
+	c := NewCache[int, string](0, 0, nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key int) (string, int64, time.Duration, error) {
+		close(started)
+		<-release
+		if ctx.Err() != nil {
+			return "", 0, 0, ctx.Err()
+		}
+		return "v", 1, 0, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := c.GetOrLoad(ctx, 1, loader)
+		firstErr <- err
+	}()
+	<-started
+
+	secondRes := make(chan string)
+	go func() {
+		v, err := c.GetOrLoad(context.Background(), 1, loader)
+		if err != nil {
+			t.Errorf("the second caller should not fail: %v", err)
+		}
+		secondRes <- v
+	}()
+
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("the first caller should abandon its wait: %v", err)
+	}
+	close(release)
+	if v := <-secondRes; v != "v" {
+		t.Errorf("the second caller should get the loaded value: %q", v)
+	}
+	if v, ok := c.Get(1); !ok || v != "v" {
+		t.Errorf("loaded value should be cached: %q %v", v, ok)
+	}
+
+	if _, err := c.GetOrLoad(context.Background(), 2, func(context.Context, int) (string, int64, time.Duration, error) {
+		panic("boom")
+	}); err == nil {
+		t.Error("panic of the loader should be returned as an error")
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ *
+ * pool - Goroutine-safe object pools.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package pool
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// DefaultSizeClasses is used by NewBufferPool if no size class is specified.
+var DefaultSizeClasses = []int{512, 4 << 10, 64 << 10}
+
+// NewBufferPool is the only way to get a new, ready-to-use BufferPool for buffers of type []T.
+//
+//	sizeClasses: Capacities (in number of elements) of the pooled buffers. Get returns a buffer from the smallest class
+//	             which can hold the requested size. DefaultSizeClasses is used if it's empty.
+//	maxRetainedBytes: Hard limit of the total size in bytes of the buffers retained by BufferPool. <=0 means unlimited.
+//
+// Example:
+//
+//	bp := pool.NewBufferPool[byte](nil, 64<<20) // retains at most 64MB buffers of 512B/4KB/64KB
+//	buf := bp.Get(1000)                        // len(buf) == 0 && cap(buf) >= 1000
+//	buf = append(buf, data...)
+//	bp.Put(buf)                                 // returns buf to BufferPool
+func NewBufferPool[T any](sizeClasses []int, maxRetainedBytes int64) *BufferPool[T] {
+	if len(sizeClasses) == 0 {
+		sizeClasses = DefaultSizeClasses
+	}
+	sizes := append([]int(nil), sizeClasses...)
+	sort.Ints(sizes)
+
+	bp := &BufferPool[T]{maxRetained: maxRetainedBytes, elemSize: int64(unsafe.Sizeof(*new(T)))}
+	for _, size := range sizes {
+		if size <= 0 || (len(bp.classes) > 0 && bp.classes[len(bp.classes)-1].size == size) {
+			continue
+		}
+		bp.classes = append(bp.classes, &sizeClass[T]{size: size})
+	}
+	if len(bp.classes) == 0 {
+		panic("pool: no valid size class for BufferPool")
+	}
+	return bp
+}
+
+// BufferPool is a goroutine-safe generic pool for buffers of type []T. Buffers are bucketed by size classes,
+// so that small requests don't waste memory on oversized buffers, and large requests don't re-grow small buffers.
+type BufferPool[T any] struct {
+	classes     []*sizeClass[T]
+	retained    int64 // Total size in bytes of the retained buffers
+	maxRetained int64
+	elemSize    int64
+}
+
+// Get returns a buffer with length 0 and capacity no less than `size`.
+// Requests larger than the largest size class are allocated directly.
+func (bp *BufferPool[T]) Get(size int) []T {
+	for _, c := range bp.classes {
+		if c.size < size {
+			continue
+		}
+
+		c.lock.Lock()
+		n := len(c.free)
+		if n == 0 {
+			c.lock.Unlock()
+			return make([]T, 0, c.size)
+		}
+		buf := c.free[n-1]
+		c.free[n-1] = nil
+		c.free = c.free[:n-1]
+		c.lock.Unlock()
+
+		atomic.AddInt64(&bp.retained, -bp.bytes(buf))
+		return buf
+	}
+	return make([]T, 0, size)
+}
+
+// Put returns a buffer to BufferPool. Buffers smaller than the smallest size class or larger than the largest size class
+// are dropped, as well as buffers which would make the retained bytes exceed the limit.
+// Elements of the buffer are not zeroed, `buf` must not be used after Put.
+func (bp *BufferPool[T]) Put(buf []T) {
+	capacity := cap(buf)
+	if capacity > bp.classes[len(bp.classes)-1].size {
+		return
+	}
+
+	// The largest class that `buf` can serve
+	i := sort.Search(len(bp.classes), func(i int) bool { return bp.classes[i].size > capacity }) - 1
+	if i < 0 {
+		return
+	}
+
+	n := bp.bytes(buf)
+	if retained := atomic.AddInt64(&bp.retained, n); bp.maxRetained > 0 && retained > bp.maxRetained {
+		atomic.AddInt64(&bp.retained, -n)
+		return
+	}
+
+	c := bp.classes[i]
+	c.lock.Lock()
+	c.free = append(c.free, buf[:0])
+	c.lock.Unlock()
+}
+
+// RetainedBytes returns the total size in bytes of the buffers retained by BufferPool.
+func (bp *BufferPool[T]) RetainedBytes() int64 {
+	return atomic.LoadInt64(&bp.retained)
+}
+
+func (bp *BufferPool[T]) bytes(buf []T) int64 {
+	return int64(cap(buf)) * bp.elemSize
+}
+
+// sizeClass holds free buffers with capacity no less than `size`
+type sizeClass[T any] struct {
+	lock sync.Mutex
+	size int
+	free [][]T
+}
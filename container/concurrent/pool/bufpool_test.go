@@ -0,0 +1,55 @@
+/*
+ *
+ * pool - Goroutine-safe object pools.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package pool
+
+import (
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	bp := NewBufferPool[byte]([]int{4096, 512, 512}, 5000)
+
+	buf := bp.Get(1000)
+	if len(buf) != 0 || cap(buf) != 4096 {
+		t.Fatalf("Unexpected buffer: len=%d cap=%d", len(buf), cap(buf))
+	}
+	if buf := bp.Get(10000); cap(buf) != 10000 {
+		t.Errorf("Oversized request should be allocated directly: cap=%d", cap(buf))
+	}
+
+	bp.Put(append(buf, 1, 2, 3))
+	bp.Put(make([]byte, 0, 600)) // Serves the 512 class
+	bp.Put(make([]byte, 0, 512)) // Exceeds the retained bytes limit
+	bp.Put(make([]byte, 0, 100)) // Too small
+	if n := bp.RetainedBytes(); n != 4096+600 {
+		t.Fatalf("RetainedBytes() = %d", n)
+	}
+
+	if buf := bp.Get(100); cap(buf) != 600 || len(buf) != 0 {
+		t.Errorf("Unexpected buffer: len=%d cap=%d", len(buf), cap(buf))
+	}
+	if buf := bp.Get(4000); cap(buf) != 4096 {
+		t.Errorf("Unexpected buffer: cap=%d", cap(buf))
+	}
+	if n := bp.RetainedBytes(); n != 0 {
+		t.Errorf("RetainedBytes() = %d", n)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ *
+ * pool - Goroutine-safe object pools.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package pool
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Future holds the result of a task submitted by SubmitWithResult, which will be available once the task is finished.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Done returns a channel which is closed when the task is finished.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get blocks until the task is finished or `ctx` is done, and returns the result of the task, or ctx.Err().
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// PanicError is the error returned in place of a panic from a task run by SubmitWithResult, ForEach or Map.
+type PanicError struct {
+	Value interface{} // Value passed to panic
+	Stack []byte      // Stack trace of the panicked goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("pool: task panicked: %v", e.Value)
+}
+
+// MultiError holds all the errors returned by ForEach or Map.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// SubmitWithResult queues `f` to be run by a goroutine from `goPool`, and returns a Future holding its result.
+// It blocks until `f` is queued or `ctx` is done, as GoRoutinePool.SubmitWait. A panic from `f` is returned as *PanicError.
+//
+// Example:
+//
+//	future, err := pool.SubmitWithResult(ctx, goPool, func() (int, error) { return compute() })
+//	if err != nil {
+//		return err
+//	}
+//	result, err := future.Get(ctx)
+func SubmitWithResult[T any](ctx context.Context, goPool *GoRoutinePool, f func() (T, error)) (*Future[T], error) {
+	future := &Future[T]{done: make(chan struct{})}
+	err := goPool.SubmitWait(ctx, func() {
+		defer close(future.done)
+		future.err = callSafely(func() (err error) {
+			future.value, err = f()
+			return
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return future, nil
+}
+
+// ForEach runs `f` over `items` with goroutines from `goPool`, so the parallelism is bounded by the pool,
+// and blocks until all of them are finished. Errors returned by `f` (panics as *PanicError) are collected
+// into a MultiError along with the index of the item. If `ctx` is done, the remaining items are skipped,
+// and ctx.Err() is collected as well. It returns nil if all goes well.
+//
+// ForEach must not be called from a task of `goPool`, otherwise it might deadlock when the pool is saturated.
+//
+// Example:
+//
+//	err := pool.ForEach(ctx, goPool, urls, func(ctx context.Context, i int, url string) error {
+//		return download(ctx, url)
+//	})
+func ForEach[T any](ctx context.Context, goPool *GoRoutinePool, items []T, f func(ctx context.Context, i int, item T) error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(items))
+	var submitErr error
+	for i := range items {
+		if submitErr = ctx.Err(); submitErr != nil {
+			break
+		}
+
+		i := i
+		wg.Add(1)
+		submitErr = goPool.SubmitWait(ctx, func() {
+			defer wg.Done()
+			errs[i] = callSafely(func() error {
+				return f(ctx, i, items[i])
+			})
+		})
+		if submitErr != nil {
+			wg.Done()
+			break
+		}
+	}
+	wg.Wait()
+
+	var me MultiError
+	for i, err := range errs {
+		if err != nil {
+			me = append(me, fmt.Errorf("item %d: %w", i, err))
+		}
+	}
+	if submitErr != nil {
+		me = append(me, submitErr)
+	}
+	if len(me) == 0 {
+		return nil
+	}
+	return me
+}
+
+// Map runs `f` over `items` with goroutines from `goPool` as ForEach, and returns the results in the same order as `items`.
+// Results of the failed items are zero values.
+func Map[T, R any](ctx context.Context, goPool *GoRoutinePool, items []T, f func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	results := make([]R, len(items))
+	err := ForEach(ctx, goPool, items, func(ctx context.Context, i int, item T) (err error) {
+		results[i], err = f(ctx, item)
+		return
+	})
+	return results, err
+}
+
+// callSafely calls `f` and converts its panic into *PanicError
+func callSafely(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,75 @@
+/*
+ *
+ * pool - Goroutine-safe object pools.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestSubmitWithResult(t *testing.T) {
+	goPool := NewGoRoutinePool(2)
+	defer goPool.Shutdown(context.Background())
+
+	future, err := SubmitWithResult(context.Background(), goPool, func() (int, error) { return 42, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := future.Get(context.Background()); v != 42 || err != nil {
+		t.Errorf("Get() = %d, %v", v, err)
+	}
+
+	future, _ = SubmitWithResult(context.Background(), goPool, func() (int, error) { panic("boom") })
+	var pe *PanicError
+	if _, err := future.Get(context.Background()); !errors.As(err, &pe) || pe.Value != "boom" {
+		t.Errorf("Expecting PanicError but gets %v", err)
+	}
+}
+
+func TestMap(t *testing.T) {
+	goPool := NewGoRoutinePool(3)
+	defer goPool.Shutdown(context.Background())
+
+	errBad := errors.New("bad")
+	items := []string{"1", "2", "x", "4"}
+	results, err := Map(context.Background(), goPool, items, func(ctx context.Context, s string) (int, error) {
+		if s == "x" {
+			return 0, errBad
+		}
+		return strconv.Atoi(s)
+	})
+
+	var me MultiError
+	if !errors.As(err, &me) || len(me) != 1 || !errors.Is(me[0], errBad) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if results[0] != 1 || results[1] != 2 || results[2] != 0 || results[3] != 4 {
+		t.Errorf("Unexpected results: %v", results)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ForEach(ctx, goPool, items, func(context.Context, int, string) error { return nil }); err == nil {
+		t.Error("ForEach should fail with a canceled context")
+	}
+}
@@ -21,85 +21,387 @@
 package pool
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrPoolFull is returned by Submit if the pending queue of GoRoutinePool is full
+	ErrPoolFull = errors.New("pool: pending queue is full")
+	// ErrPoolClosed is returned by Submit and SubmitWait after GoRoutinePool is shut down
+	ErrPoolClosed = errors.New("pool: pool is shut down")
 )
 
 // NewGoRoutinePool is the only way to get a new, ready-to-use GoRoutinePool.
 //
 // If you use `var goPool pool.GoRoutinePool`, or `new(pool.GoRoutinePool)`,
 // or the like to obtain a GoRoutinePool, it'll still work,
-// but it won't pool even a single goroutine.
+// but it won't pool even a single goroutine, the same as NewGoRoutinePool(0).
 //
-//	maxGoRoutineNum: Maximum number of goroutines that will be pooled in GoRoutinePool
+//	maxGoRoutineNum: Maximum number of goroutines running tasks concurrently.
+//	                 If it's not greater than 0, every task is run by a new goroutine without queueing.
+//	opts: Optional settings such as WithQueueSize, WithIdleTimeout and WithPanicHandler.
 //
 // Example:
 //
-//	goPool := pool.NewGoRoutinePool(100)
-//	goPool.Run(func(){ fmt.Println("Hello, GoRoutinePool!") }) // runs a function using a pooled goroutine
-func NewGoRoutinePool(maxGoRoutineNum int) *GoRoutinePool {
-	return &GoRoutinePool{maxNum: maxGoRoutineNum}
+//	goPool := pool.NewGoRoutinePool(100, pool.WithQueueSize(1000))
+//	err := goPool.Submit(func(){ fmt.Println("Hello, GoRoutinePool!") }) // runs a function using a pooled goroutine
+//	goPool.Wait()                                                       // waits for all submitted tasks to finish
+//	err = goPool.Shutdown(ctx)                                          // drains pending tasks and stops all goroutines
+func NewGoRoutinePool(maxGoRoutineNum int, opts ...goPoolOption) *GoRoutinePool {
+	o := goPoolOptions{
+		queueSize:   maxGoRoutineNum,
+		idleTimeout: time.Minute,
+	}
+	o.apply(opts...)
+
+	goPool := &GoRoutinePool{
+		maxNum:       maxGoRoutineNum,
+		idleTimeout:  o.idleTimeout,
+		panicHandler: o.panicHandler,
+	}
+	if maxGoRoutineNum > 0 {
+		goPool.tasks = make(chan func(), o.queueSize)
+	}
+	goPool.initOnce.Do(goPool.init)
+	return goPool
 }
 
-// GoRoutinePool is a goroutine-safe pool for goroutines.
-//
-// After benchmarking, I found that use raw `go` keyword performs much better than this GoRoutinePool.
-// So it makes no sense to use this GoRoutinePool.
+// WithQueueSize sets the maximum number of pending tasks. Default is the same as maxGoRoutineNum.
+func WithQueueSize(size int) goPoolOption {
+	return func(o *goPoolOptions) {
+		o.queueSize = size
+	}
+}
+
+// WithIdleTimeout sets how long an idle goroutine waits for a new task before it exits. Default is 1 minute.
+func WithIdleTimeout(timeout time.Duration) goPoolOption {
+	return func(o *goPoolOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithPanicHandler sets a callback function to be executed with the recovered value and the stack trace when a task panics.
+// By default, they are written to os.Stderr.
+func WithPanicHandler(handler func(r interface{}, stack []byte)) goPoolOption {
+	return func(o *goPoolOptions) {
+		o.panicHandler = handler
+	}
+}
+
+type goPoolOption func(opts *goPoolOptions)
+
+type goPoolOptions struct {
+	queueSize    int
+	idleTimeout  time.Duration
+	panicHandler func(r interface{}, stack []byte)
+}
+
+func (o *goPoolOptions) apply(opts ...goPoolOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// GoRoutinePool is a goroutine-safe worker pool. Tasks are queued in a bounded pending queue, and run by at most
+// maxGoRoutineNum goroutines. Goroutines are started on demand, and exit after being idle for a while.
+// Panics from tasks are recovered, so a bad task never crashes the process.
 type GoRoutinePool struct {
-	lock     sync.Mutex
-	freeList *goroutine
-	freeNum  int
-	maxNum   int
+	lock         sync.Mutex
+	sendLock     sync.RWMutex // Held by submissions, so that Shutdown can wait for them
+	initOnce     sync.Once
+	closeOnce    sync.Once
+	idleCond     sync.Cond // Signaled when there is no unfinished task
+	curNum       int       // Number of pooled goroutines
+	unpooledNum  int       // Number of goroutines started for a single task, see goUnpooled
+	idleNum      int       // Number of goroutines waiting for tasks
+	unfinished   int       // Number of tasks submitted but not finished yet
+	closed       bool      // Set after all ongoing submissions are finished on shutdown
+	maxNum       int
+	idleTimeout  time.Duration
+	panicHandler func(r interface{}, stack []byte)
+	tasks        chan func()   // nil if maxNum <= 0
+	closing      chan struct{} // Closed when Shutdown is called
+	exited       chan struct{} // Closed when all goroutines exit after shutdown
+	submitted    uint64
+	completed    uint64
+	panicked     uint64
+	rejected     uint64
 }
 
-// Run executes a function using a pooled goroutine.
+// GoRoutinePoolStats holds statistics of a GoRoutinePool.
+type GoRoutinePoolStats struct {
+	GoRoutines int    // Number of goroutines, unpooled ones included
+	Idle       int    // Number of idle goroutines
+	Pending    int    // Number of tasks waiting in the queue
+	Submitted  uint64 // Number of submitted tasks
+	Completed  uint64 // Number of finished tasks, panicked ones included
+	Panicked   uint64 // Number of panicked tasks
+	Rejected   uint64 // Number of tasks rejected by Submit because the pending queue is full
+}
+
+// Submit queues `f` to be run by a pooled goroutine. It returns ErrPoolFull immediately if the pending queue is full,
+// or ErrPoolClosed if the pool is shut down.
+func (goPool *GoRoutinePool) Submit(f func()) error {
+	return goPool.submit(nil, f)
+}
+
+// SubmitWait queues `f` to be run by a pooled goroutine. It blocks until `f` is queued or `ctx` is done,
+// in which case ctx.Err() is returned. ErrPoolClosed is returned if the pool is shut down.
+func (goPool *GoRoutinePool) SubmitWait(ctx context.Context, f func()) error {
+	return goPool.submit(ctx, f)
+}
+
+// Run executes a function using a pooled goroutine. It never blocks: if the pending queue is full,
+// `f` is run by a new goroutine instead. `f` is dropped if the pool is shut down.
+//
+// Deprecated: Use Submit or SubmitWait, which report errors.
 func (goPool *GoRoutinePool) Run(f func()) {
+	if goPool.Submit(f) == ErrPoolFull {
+		goPool.goUnpooled(f)
+	}
+}
+
+// Wait blocks until all the submitted tasks are finished.
+func (goPool *GoRoutinePool) Wait() {
+	goPool.initOnce.Do(goPool.init)
 	goPool.lock.Lock()
-	gr := goPool.freeList
-	if gr != nil {
-		goPool.freeList = gr.next
-		goPool.freeNum--
+	for goPool.unfinished > 0 {
+		goPool.idleCond.Wait()
 	}
 	goPool.lock.Unlock()
+}
 
-	if gr == nil {
-		gr = &goroutine{
-			ch:     make(chan func(), 1),
-			goPool: goPool,
-		}
-		go gr.worker()
+// Shutdown stops accepting new tasks, and waits for the pending tasks to be finished and all goroutines to exit.
+// It returns ctx.Err() if `ctx` is done before that, while the pending tasks are still being run in the background.
+func (goPool *GoRoutinePool) Shutdown(ctx context.Context) error {
+	goPool.initOnce.Do(goPool.init)
+	goPool.closeOnce.Do(func() {
+		close(goPool.closing)  // Unblocks SubmitWait
+		goPool.sendLock.Lock() // Waits for the ongoing submissions
+		goPool.sendLock.Unlock()
+
+		goPool.lock.Lock()
+		goPool.closed = true
+		goPool.checkExited()
+		goPool.lock.Unlock()
+	})
+
+	select {
+	case <-goPool.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	gr.ch <- f
 }
 
-// put returns a goroutine to the GoRoutinePool.
-func (goPool *GoRoutinePool) put(gr *goroutine) {
+// Stats returns statistics of the pool.
+func (goPool *GoRoutinePool) Stats() GoRoutinePoolStats {
 	goPool.lock.Lock()
-	if goPool.freeNum < goPool.maxNum {
-		gr.next = goPool.freeList
-		goPool.freeList = gr
-		goPool.freeNum++
-	} else {
-		gr.ch <- nil
+	stats := GoRoutinePoolStats{
+		GoRoutines: goPool.curNum + goPool.unpooledNum,
+		Idle:       goPool.idleNum,
+		Pending:    len(goPool.tasks),
 	}
 	goPool.lock.Unlock()
+
+	stats.Submitted = atomic.LoadUint64(&goPool.submitted)
+	stats.Completed = atomic.LoadUint64(&goPool.completed)
+	stats.Panicked = atomic.LoadUint64(&goPool.panicked)
+	stats.Rejected = atomic.LoadUint64(&goPool.rejected)
+	return stats
 }
 
-// goroutine holds a channel for communicating with the goroutine worker
-type goroutine struct {
-	ch     chan func()
-	goPool *GoRoutinePool
-	next   *goroutine
+// submit queues `f`. It blocks until `f` is queued or `ctx` is done if `ctx` is not nil
+func (goPool *GoRoutinePool) submit(ctx context.Context, f func()) error {
+	if goPool.tasks == nil {
+		return goPool.goUnpooled(f)
+	}
+
+	goPool.sendLock.RLock()
+	defer goPool.sendLock.RUnlock()
+
+	select {
+	case <-goPool.closing:
+		return ErrPoolClosed
+	default:
+	}
+
+	goPool.lock.Lock()
+	goPool.unfinished++
+	// Start a new goroutine beforehand if idle goroutines are not enough for the pending tasks
+	if len(goPool.tasks) >= goPool.idleNum && goPool.curNum < goPool.maxNum {
+		goPool.curNum++
+		go goPool.worker()
+	}
+	goPool.lock.Unlock()
+
+	var err error
+	if ctx == nil {
+		select {
+		case goPool.tasks <- f:
+		default:
+			atomic.AddUint64(&goPool.rejected, 1)
+			err = ErrPoolFull
+		}
+	} else {
+		select {
+		case goPool.tasks <- f:
+		case <-goPool.closing:
+			err = ErrPoolClosed
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	if err != nil {
+		goPool.finish()
+		return err
+	}
+	atomic.AddUint64(&goPool.submitted, 1)
+	return nil
+}
+
+// worker runs tasks until it's idle for `idleTimeout` or the pool is shut down
+func (goPool *GoRoutinePool) worker() {
+	idleTimer := time.NewTimer(goPool.idleTimeout)
+	defer idleTimer.Stop()
+
+	for {
+		goPool.lock.Lock()
+		goPool.idleNum++
+		goPool.lock.Unlock()
+
+		select {
+		case f := <-goPool.tasks:
+			goPool.lock.Lock()
+			goPool.idleNum--
+			goPool.lock.Unlock()
+
+			goPool.run(f)
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(goPool.idleTimeout)
+		case <-goPool.closing:
+			goPool.lock.Lock()
+			goPool.idleNum--
+			goPool.lock.Unlock()
+			goPool.drain()
+			return
+		case <-idleTimer.C:
+			goPool.lock.Lock()
+			goPool.idleNum--
+			// Pending tasks (including the ones being submitted) must not be left without a goroutine
+			if goPool.unfinished >= goPool.curNum {
+				goPool.lock.Unlock()
+				idleTimer.Reset(goPool.idleTimeout)
+				continue
+			}
+			goPool.curNum--
+			goPool.checkExited()
+			goPool.lock.Unlock()
+			return
+		}
+	}
+}
+
+// goUnpooled runs `f` by a new goroutine without queueing. It's used if the pool is created with maxGoRoutineNum <= 0,
+// or by Run if the pending queue is full.
+func (goPool *GoRoutinePool) goUnpooled(f func()) error {
+	goPool.initOnce.Do(goPool.init)
+	goPool.sendLock.RLock()
+	defer goPool.sendLock.RUnlock()
+
+	select {
+	case <-goPool.closing:
+		return ErrPoolClosed
+	default:
+	}
+
+	goPool.lock.Lock()
+	goPool.unfinished++
+	goPool.unpooledNum++
+	goPool.lock.Unlock()
+	atomic.AddUint64(&goPool.submitted, 1)
+
+	go func() {
+		goPool.run(f)
+		goPool.lock.Lock()
+		goPool.unpooledNum--
+		goPool.checkExited()
+		goPool.lock.Unlock()
+	}()
+	return nil
 }
 
-// goroutine worker
-func (gr *goroutine) worker() {
+// drain runs the pending tasks after shutdown, and exits when there is none left
+func (goPool *GoRoutinePool) drain() {
 	for {
-		f := <-gr.ch
-		if f != nil {
-			f()
-			gr.goPool.put(gr)
-		} else {
-			break
+		select {
+		case f := <-goPool.tasks:
+			goPool.run(f)
+		default:
+			goPool.sendLock.Lock() // Ongoing submissions must be finished before exit
+			goPool.sendLock.Unlock()
+			if len(goPool.tasks) > 0 {
+				continue
+			}
+
+			goPool.lock.Lock()
+			goPool.curNum--
+			goPool.checkExited()
+			goPool.lock.Unlock()
+			return
 		}
 	}
 }
+
+// checkExited closes `exited` if the pool is shut down and all goroutines exit. It must be called with `lock` held.
+func (goPool *GoRoutinePool) checkExited() {
+	if goPool.closed && goPool.curNum == 0 && goPool.unpooledNum == 0 {
+		close(goPool.exited)
+	}
+}
+
+// init makes the zero value of GoRoutinePool usable
+func (goPool *GoRoutinePool) init() {
+	goPool.idleCond.L = &goPool.lock
+	goPool.closing = make(chan struct{})
+	goPool.exited = make(chan struct{})
+}
+
+// finish should be called when a submitted task is finished or failed to be queued
+func (goPool *GoRoutinePool) finish() {
+	goPool.lock.Lock()
+	goPool.unfinished--
+	if goPool.unfinished == 0 {
+		goPool.idleCond.Broadcast()
+	}
+	goPool.lock.Unlock()
+}
+
+// run runs `f` and recovers from its panic
+func (goPool *GoRoutinePool) run(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&goPool.panicked, 1)
+			if goPool.panicHandler != nil {
+				goPool.panicHandler(r, debug.Stack())
+			} else {
+				fmt.Fprintf(os.Stderr, "pool: task panicked: %v\n%s", r, debug.Stack())
+			}
+		}
+
+		atomic.AddUint64(&goPool.completed, 1)
+		goPool.finish()
+	}()
+
+	f()
+}
@@ -0,0 +1,138 @@
+/*
+ *
+ * pool - Goroutine-safe object pools.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package pool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoRoutinePool(t *testing.T) {
+	var panicked int32
+	goPool := NewGoRoutinePool(4, WithQueueSize(8), WithIdleTimeout(10*time.Millisecond), WithPanicHandler(func(r interface{}, stack []byte) {
+		atomic.AddInt32(&panicked, 1)
+	}))
+
+	var sum int64
+	for i := 1; i <= 100; i++ {
+		i := i
+		if err := goPool.SubmitWait(context.Background(), func() { atomic.AddInt64(&sum, int64(i)) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	goPool.SubmitWait(context.Background(), func() { panic("boom") })
+	goPool.Wait()
+	if sum != 5050 || atomic.LoadInt32(&panicked) != 1 {
+		t.Fatalf("sum = %d, panicked = %d", sum, panicked)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if stats := goPool.Stats(); stats.GoRoutines != 0 || stats.Submitted != 101 || stats.Completed != 101 || stats.Panicked != 1 {
+		t.Errorf("Idle goroutines should be reaped: %+v", stats)
+	}
+
+	// Fill up the goroutines and the pending queue
+	block := make(chan struct{})
+	started := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		if err := goPool.Submit(func() { started <- struct{}{}; <-block }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		<-started
+	}
+	for i := 0; i < 8; i++ {
+		if err := goPool.Submit(func() { <-block }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := goPool.Submit(func() {}); err != ErrPoolFull {
+		t.Errorf("Submit should fail: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := goPool.SubmitWait(ctx, func() {}); err != context.DeadlineExceeded {
+		t.Errorf("SubmitWait should time out: %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- goPool.Shutdown(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	if err := goPool.Submit(func() {}); err != ErrPoolClosed {
+		t.Errorf("Submit should fail after shutdown: %v", err)
+	}
+	close(block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if stats := goPool.Stats(); stats.GoRoutines != 0 || stats.Completed != 113 {
+		t.Errorf("Pending tasks should be drained: %+v", stats)
+	}
+}
+
+func TestUnpooledGoRoutinePool(t *testing.T) {
+	var zero GoRoutinePool
+	for _, goPool := range []*GoRoutinePool{NewGoRoutinePool(0), &zero} {
+		var sum int64
+		block := make(chan struct{})
+		for i := 1; i <= 100; i++ {
+			i := i
+			if err := goPool.Submit(func() { <-block; atomic.AddInt64(&sum, int64(i)) }); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if stats := goPool.Stats(); stats.GoRoutines != 100 || stats.Pending != 0 {
+			t.Errorf("Every task should be run by its own goroutine: %+v", stats)
+		}
+		close(block)
+		goPool.Wait()
+		if sum != 5050 {
+			t.Fatalf("sum = %d", sum)
+		}
+
+		if err := goPool.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := goPool.Submit(func() {}); err != ErrPoolClosed {
+			t.Errorf("Submit after Shutdown should fail: %v", err)
+		}
+	}
+}
+
+func TestRunNeverBlocks(t *testing.T) {
+	goPool := NewGoRoutinePool(1, WithQueueSize(1))
+	block := make(chan struct{})
+	var done int32
+	for i := 0; i < 10; i++ {
+		goPool.Run(func() { <-block; atomic.AddInt32(&done, 1) }) // Must not block although the pending queue is full
+	}
+	close(block)
+	goPool.Wait()
+	if done != 10 {
+		t.Errorf("done = %d", done)
+	}
+	if err := goPool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
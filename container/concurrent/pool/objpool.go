@@ -18,28 +18,39 @@
  *
  */
 
-// Package pool provides some goroutine-safe object pools such as ObjectPool.
+// Package pool provides some goroutine-safe object pools such as ObjectPool and BufferPool.
 package pool
 
 import (
 	"sync"
+	"time"
 )
 
 // CreateFunc is used by ObjectPool to create a new object when it's empty.
 type CreateFunc[T any] func() *T
 
+// CreateErrFunc is used by ObjectPool to create a new object when it's empty. It's for objects whose creation might fail.
+type CreateErrFunc[T any] func() (*T, error)
+
 // ClearFunc is used by ObjectPool to reset a used object to it's initial state for reuse.
 type ClearFunc[T any] func(*T)
 
+// ValidateFunc is used by ObjectPool to check whether a pooled object is still usable. Broken objects are destroyed.
+type ValidateFunc[T any] func(*T) bool
+
+// DestroyFunc is used by ObjectPool to release the resources held by an object which is discarded.
+type DestroyFunc[T any] func(*T)
+
 // NewObjectPool is the only way to get a new, ready-to-use ObjectPool for objects of a specified type.
 //
 // If you use `var op pool.ObjectPool`, or `new(pool.ObjectPool)`, or the like to obtain an ObjectPool, it'll
 // crash when you call Get().
 //
 //	maxObjectNum: Maximum number of objects that will be pooled in ObjectPool.
-//	createObj: Called to create a new object when ObjectPool is empty. Cannot be nil.
+//	createObj: Called to create a new object when ObjectPool is empty. Cannot be nil unless WithCreateErrFunc is specified.
 //	clearObj: Called to reset a used object to it's initial state for reuse. Could be nil if it need not be reset.
 //	          ObjectPool will perform about 12% faster if `clearObj` is nil.
+//	opts: Optional settings such as WithCreateErrFunc, WithValidateFunc, WithDestroyFunc and WithMaxIdleTime.
 //
 // Example:
 //
@@ -50,56 +61,223 @@ type ClearFunc[T any] func(*T)
 //	obj := op.Get() // get a ready-to-use bytes.Buffer
 //	// do something with `buf`
 //	op.Put(obj) // return obj to ObjectPool.
-func NewObjectPool[T any](maxObjectNum int, createObj CreateFunc[T], clearObj ClearFunc[T]) *ObjectPool[T] {
-	return &ObjectPool[T]{maxObjNum: maxObjectNum, createFunc: createObj, clearFunc: clearObj}
+func NewObjectPool[T any](maxObjectNum int, createObj CreateFunc[T], clearObj ClearFunc[T], opts ...ObjectPoolOption[T]) *ObjectPool[T] {
+	var o objPoolOptions[T]
+	o.apply(opts...)
+
+	op := &ObjectPool[T]{maxObjNum: maxObjectNum, clearFunc: clearObj, maxIdleTime: o.maxIdleTime}
+	if createObj != nil {
+		op.createFunc = func() (*T, error) { return createObj(), nil }
+	}
+	if o.create != nil {
+		op.createFunc = o.create
+	}
+	op.validateFunc = o.validate
+	op.destroyFunc = o.destroy
+	if op.maxIdleTime > 0 {
+		op.closeCh = make(chan struct{})
+		go op.reap()
+	}
+	return op
+}
+
+// WithCreateErrFunc sets a function to create new objects which might fail, in place of `createObj` passed to NewObjectPool.
+// Errors from `fn` are returned by ObjectPool.Acquire.
+func WithCreateErrFunc[T any](fn CreateErrFunc[T]) ObjectPoolOption[T] {
+	return func(o *objPoolOptions[T]) {
+		o.create = fn
+	}
+}
+
+// WithValidateFunc sets a function to check pooled objects before they are returned by Get/Acquire.
+// Objects failing the check are destroyed, and another object is got from the pool or created.
+func WithValidateFunc[T any](fn ValidateFunc[T]) ObjectPoolOption[T] {
+	return func(o *objPoolOptions[T]) {
+		o.validate = fn
+	}
+}
+
+// WithDestroyFunc sets a function to release the resources held by objects which are discarded by ObjectPool,
+// such as objects failing validation, objects idle for too long, objects put to a full pool, and pooled objects on Close.
+func WithDestroyFunc[T any](fn DestroyFunc[T]) ObjectPoolOption[T] {
+	return func(o *objPoolOptions[T]) {
+		o.destroy = fn
+	}
+}
+
+// WithMaxIdleTime sets how long an object can stay in the pool. Objects idle for longer are destroyed by a background goroutine.
+// Default is 0, which means forever. Call ObjectPool.Close to stop the background goroutine if it's set.
+// The object type must be specified explicitly, such as `WithMaxIdleTime[bytes.Buffer](time.Minute)`.
+func WithMaxIdleTime[T any](d time.Duration) ObjectPoolOption[T] {
+	return func(o *objPoolOptions[T]) {
+		o.maxIdleTime = d
+	}
+}
+
+// ObjectPoolOption is an optional setting of ObjectPool. It's typed by the object type,
+// so that functions for objects of other types are rejected by the compiler.
+type ObjectPoolOption[T any] func(opts *objPoolOptions[T])
+
+type objPoolOptions[T any] struct {
+	create      CreateErrFunc[T]
+	validate    ValidateFunc[T]
+	destroy     DestroyFunc[T]
+	maxIdleTime time.Duration
+}
+
+func (o *objPoolOptions[T]) apply(opts ...ObjectPoolOption[T]) {
+	for _, opt := range opts {
+		opt(o)
+	}
 }
 
 // ObjectPool is a goroutine-safe generic pool for objects of any type.
 type ObjectPool[T any] struct {
-	lock       sync.Mutex
-	freeList   *object[T]
-	freeObjNum int
-	maxObjNum  int
-	createFunc CreateFunc[T]
-	clearFunc  ClearFunc[T]
+	lock         sync.Mutex
+	freeList     *object[T] // Most recently put objects come first
+	freeObjNum   int
+	maxObjNum    int
+	closed       bool
+	createFunc   CreateErrFunc[T]
+	clearFunc    ClearFunc[T]
+	validateFunc ValidateFunc[T]
+	destroyFunc  DestroyFunc[T]
+	maxIdleTime  time.Duration
+	closeCh      chan struct{} // Closed on Close to stop the reaper
 }
 
-// Get returns a ready-to-use object.
+// Get returns a ready-to-use object. It returns nil if a new object can't be created or ObjectPool is closed,
+// use Acquire instead to get the error.
 func (op *ObjectPool[T]) Get() *T {
-	op.lock.Lock()
-	o := op.freeList
-	if o != nil {
-		op.freeList = o.next
-		op.freeObjNum--
-	}
-	op.lock.Unlock()
+	obj, _ := op.Acquire()
+	return obj
+}
 
-	var obj *T
-	if o != nil {
-		obj = o.obj
-		if op.clearFunc != nil {
-			op.clearFunc(obj)
+// Acquire returns a ready-to-use object, or an error if a new object can't be created.
+// ErrPoolClosed is returned if ObjectPool is closed.
+func (op *ObjectPool[T]) Acquire() (*T, error) {
+	for {
+		op.lock.Lock()
+		if op.closed {
+			op.lock.Unlock()
+			return nil, ErrPoolClosed
+		}
+		o := op.freeList
+		if o != nil {
+			op.freeList = o.next
+			op.freeObjNum--
+		}
+		op.lock.Unlock()
+
+		if o == nil {
+			return op.createFunc()
 		}
+
+		obj := o.obj
 		o.obj = nil
 		o.next = nil
-	} else {
-		obj = op.createFunc()
+		if op.validateFunc != nil && !op.validateFunc(obj) {
+			op.destroy(obj)
+			continue
+		}
+		if op.clearFunc != nil {
+			op.clearFunc(obj)
+		}
+		return obj, nil
 	}
-	return obj
 }
 
-// Put returns an object to ObjectPool.
+// Put returns an object to ObjectPool. The object is destroyed if ObjectPool is full or closed.
 func (op *ObjectPool[T]) Put(obj *T) {
 	op.lock.Lock()
-	if op.freeObjNum < op.maxObjNum {
-		op.freeList = &object[T]{obj, op.freeList}
+	if !op.closed && op.freeObjNum < op.maxObjNum {
+		o := &object[T]{obj: obj, next: op.freeList}
+		if op.maxIdleTime > 0 {
+			o.idleSince = time.Now()
+		}
+		op.freeList = o
 		op.freeObjNum++
+		obj = nil
+	}
+	op.lock.Unlock()
+
+	if obj != nil {
+		op.destroy(obj)
+	}
+}
+
+// Close destroys all pooled objects, and stops the background goroutine started by WithMaxIdleTime.
+// Get/Acquire fail and Put destroys the object after ObjectPool is closed. Close is idempotent.
+func (op *ObjectPool[T]) Close() {
+	op.lock.Lock()
+	if op.closed {
+		op.lock.Unlock()
+		return
 	}
+	op.closed = true
+	o := op.freeList
+	op.freeList = nil
+	op.freeObjNum = 0
 	op.lock.Unlock()
+
+	if op.closeCh != nil {
+		close(op.closeCh)
+	}
+	op.destroyList(o)
+}
+
+// reap destroys objects idle for longer than maxIdleTime periodically
+func (op *ObjectPool[T]) reap() {
+	interval := op.maxIdleTime / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			op.destroyList(op.detachExpired(time.Now().Add(-op.maxIdleTime)))
+		case <-op.closeCh:
+			return
+		}
+	}
+}
+
+// detachExpired removes objects put before `deadline` from the free list, and returns them.
+// Objects in the free list are ordered by the time they are put, so the expired ones are all at the tail.
+func (op *ObjectPool[T]) detachExpired(deadline time.Time) *object[T] {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+
+	link := &op.freeList
+	for *link != nil && !(*link).idleSince.Before(deadline) {
+		link = &(*link).next
+	}
+	expired := *link
+	*link = nil
+	for o := expired; o != nil; o = o.next {
+		op.freeObjNum--
+	}
+	return expired
+}
+
+func (op *ObjectPool[T]) destroyList(o *object[T]) {
+	for ; o != nil; o = o.next {
+		op.destroy(o.obj)
+	}
+}
+
+func (op *ObjectPool[T]) destroy(obj *T) {
+	if op.destroyFunc != nil {
+		op.destroyFunc(obj)
+	}
 }
 
 // object holds an object of arbitrary type for reuse.
 type object[T any] struct {
-	obj  *T
-	next *object[T]
+	obj       *T
+	next      *object[T]
+	idleSince time.Time
 }
@@ -0,0 +1,100 @@
+/*
+ *
+ * pool - Goroutine-safe object pools.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package pool
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testConn struct {
+	id     int
+	broken bool
+}
+
+func TestObjectPool(t *testing.T) {
+	var created, destroyed int32
+	errDial := errors.New("dial failed")
+	failNext := false
+	op := NewObjectPool[testConn](2, nil, nil,
+		WithCreateErrFunc(func() (*testConn, error) {
+			if failNext {
+				return nil, errDial
+			}
+			return &testConn{id: int(atomic.AddInt32(&created, 1))}, nil
+		}),
+		WithValidateFunc(func(c *testConn) bool { return !c.broken }),
+		WithDestroyFunc(func(c *testConn) { atomic.AddInt32(&destroyed, 1) }),
+	)
+
+	c1, _ := op.Acquire()
+	c2, _ := op.Acquire()
+	c3, _ := op.Acquire()
+	op.Put(c1)
+	op.Put(c2)
+	op.Put(c3) // pool is full, c3 is destroyed
+	if destroyed != 1 {
+		t.Fatalf("destroyed=%d", destroyed)
+	}
+
+	c2.broken = true
+	if c, err := op.Acquire(); c != c1 || err != nil { // c2 is broken and destroyed
+		t.Fatalf("Acquire() = %v, %v", c, err)
+	}
+	if destroyed != 2 {
+		t.Fatalf("destroyed=%d", destroyed)
+	}
+
+	failNext = true
+	if _, err := op.Acquire(); err != errDial {
+		t.Fatalf("Expecting errDial but gets %v", err)
+	}
+
+	op.Put(c1)
+	op.Close()
+	if destroyed != 3 {
+		t.Fatalf("destroyed=%d", destroyed)
+	}
+	if _, err := op.Acquire(); err != ErrPoolClosed {
+		t.Fatalf("Expecting ErrPoolClosed but gets %v", err)
+	}
+}
+
+func TestObjectPoolMaxIdleTime(t *testing.T) {
+	var destroyed int32
+	op := NewObjectPool[testConn](10, func() *testConn { return &testConn{} }, nil,
+		WithDestroyFunc(func(c *testConn) { atomic.AddInt32(&destroyed, 1) }),
+		WithMaxIdleTime[testConn](20*time.Millisecond),
+	)
+	defer op.Close()
+
+	op.Put(op.Get())
+	op.Put(op.Get())
+	op.Put(&testConn{})
+	for i := 0; i < 100 && atomic.LoadInt32(&destroyed) != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&destroyed); n != 2 {
+		t.Errorf("destroyed=%d", n)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ *
+ * queue - Goroutine-safe Queue implementations
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// BoundedQueue is a goroutine-safe, fixed-capacity, multi-producer multi-consumer Queue implementation based on a lock-free ring buffer.
+// Unlike LockfreeQueue, it never grows, so it's suitable for applying backpressure to bursty producers.
+type BoundedQueue[T any] struct {
+	_          [kCacheLineSz]byte
+	enqueuePos uint64
+	_          [kCacheLineSz - 8]byte
+	dequeuePos uint64
+	_          [kCacheLineSz - 8]byte
+	cells      []bqCell[T]
+	capacity   uint64
+	notEmpty   chan struct{} // Notifies the blocked Pop that there might be elements to pop
+	notFull    chan struct{} // Notifies the blocked Push that there might be room to push
+}
+
+// NewBoundedQueue is the only way to get a new, ready-to-use BoundedQueue.
+//
+//	capacity: Maximum number of elements the queue can hold. Must be greater than 0.
+//
+// Example:
+//
+//	bq := queue.NewBoundedQueue[int](1024)
+//	ok := bq.TryPush(100)          // returns false immediately if the queue is full
+//	err := bq.Push(ctx, 100)       // blocks until there is room or ctx is done
+//	v, ok := bq.TryPop()           // returns false immediately if the queue is empty
+//	v, err = bq.Pop(ctx)           // blocks until there is an element or ctx is done
+func NewBoundedQueue[T any](capacity int) *BoundedQueue[T] {
+	if capacity <= 0 {
+		panic("queue: capacity of BoundedQueue must be greater than 0")
+	}
+
+	bq := &BoundedQueue[T]{
+		cells:    make([]bqCell[T], capacity),
+		capacity: uint64(capacity),
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+	}
+	for i := range bq.cells {
+		bq.cells[i].seq = uint64(i)
+	}
+	return bq
+}
+
+// TryPush inserts an element to the back of the queue. It returns false immediately if the queue is full.
+func (bq *BoundedQueue[T]) TryPush(val T) bool {
+	pos := atomic.LoadUint64(&bq.enqueuePos)
+	for {
+		cell := &bq.cells[pos%bq.capacity]
+		seq := atomic.LoadUint64(&cell.seq)
+		if dif := int64(seq - pos); dif == 0 {
+			if atomic.CompareAndSwapUint64(&bq.enqueuePos, pos, pos+1) {
+				cell.val = val
+				atomic.StoreUint64(&cell.seq, pos+1)
+				notify(bq.notEmpty)
+				return true
+			}
+		} else if dif < 0 { // The cell hasn't been popped yet, i.e. the queue is full
+			return false
+		}
+		pos = atomic.LoadUint64(&bq.enqueuePos)
+	}
+}
+
+// TryPop returns (and removes) an element from the front of the queue and true if the queue is not empty,
+// otherwise it returns a default value and false immediately.
+func (bq *BoundedQueue[T]) TryPop() (T, bool) {
+	pos := atomic.LoadUint64(&bq.dequeuePos)
+	for {
+		cell := &bq.cells[pos%bq.capacity]
+		seq := atomic.LoadUint64(&cell.seq)
+		if dif := int64(seq - (pos + 1)); dif == 0 {
+			if atomic.CompareAndSwapUint64(&bq.dequeuePos, pos, pos+1) {
+				val := cell.val
+				var zero T
+				cell.val = zero // Don't keep a reference to the popped element
+				atomic.StoreUint64(&cell.seq, pos+bq.capacity)
+				notify(bq.notFull)
+				return val, true
+			}
+		} else if dif < 0 { // The cell hasn't been pushed yet, i.e. the queue is empty
+			var zero T
+			return zero, false
+		}
+		pos = atomic.LoadUint64(&bq.dequeuePos)
+	}
+}
+
+// Push inserts an element to the back of the queue. It blocks until there is room in the queue or `ctx` is done,
+// in which case ctx.Err() is returned.
+func (bq *BoundedQueue[T]) Push(ctx context.Context, val T) error {
+	for !bq.TryPush(val) {
+		select {
+		case <-bq.notFull:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if bq.Len() < int(bq.capacity) {
+		notify(bq.notFull) // Pass the notification on to other blocked producers
+	}
+	return nil
+}
+
+// Pop returns (and removes) an element from the front of the queue. It blocks until the queue is not empty or `ctx` is done,
+// in which case ctx.Err() is returned.
+func (bq *BoundedQueue[T]) Pop(ctx context.Context) (T, error) {
+	for {
+		if val, ok := bq.TryPop(); ok {
+			if bq.Len() > 0 {
+				notify(bq.notEmpty) // Pass the notification on to other blocked consumers
+			}
+			return val, nil
+		}
+		select {
+		case <-bq.notEmpty:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Len returns the number of elements in the queue. It's only a snapshot under concurrent access.
+func (bq *BoundedQueue[T]) Len() int {
+	for {
+		deq := atomic.LoadUint64(&bq.dequeuePos)
+		enq := atomic.LoadUint64(&bq.enqueuePos)
+		if deq == atomic.LoadUint64(&bq.dequeuePos) {
+			if n := int(enq - deq); n >= 0 {
+				return n
+			}
+			return 0
+		}
+	}
+}
+
+// Cap returns the capacity of the queue.
+func (bq *BoundedQueue[T]) Cap() int {
+	return int(bq.capacity)
+}
+
+const kCacheLineSz = 64
+
+type bqCell[T any] struct {
+	seq uint64 // Sequence number for synchronizing producers and consumers
+	val T
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ *
+ * queue - Goroutine-safe Queue implementations
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBoundedQueue(t *testing.T) {
+	bq := NewBoundedQueue[int](3)
+	for i := 0; i < 3; i++ {
+		if !bq.TryPush(i) {
+			t.Fatalf("TryPush(%d) should succeed", i)
+		}
+	}
+	if bq.TryPush(3) || bq.Len() != 3 || bq.Cap() != 3 {
+		t.Fatal("Queue should be full")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bq.Push(ctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("Push should time out: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if v, ok := bq.TryPop(); !ok || v != i {
+			t.Errorf("TryPop() = %d, %v, expecting %d", v, ok, i)
+		}
+	}
+	if _, ok := bq.TryPop(); ok {
+		t.Error("Queue should be empty")
+	}
+	if _, err := bq.Pop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Pop should time out: %v", err)
+	}
+}
+
+func TestBoundedQueueConcurrency(t *testing.T) {
+	const kProducers, kConsumers, kItems = 8, 8, 20000
+
+	bq := NewBoundedQueue[int](16)
+	var wg sync.WaitGroup
+	results := make([][]int, kConsumers)
+	for i := 0; i < kConsumers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < kProducers*kItems/kConsumers; j++ {
+				v, err := bq.Pop(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results[n] = append(results[n], v)
+			}
+		}(i)
+	}
+	for i := 0; i < kProducers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < kItems; j++ {
+				bq.Push(context.Background(), j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var all []int
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	sort.Ints(all)
+	if len(all) != kProducers*kItems {
+		t.Fatalf("Expecting %d elements but gets %d", kProducers*kItems, len(all))
+	}
+	for i, v := range all {
+		if v != i/kProducers {
+			t.Fatalf("Invalid result at %d: %d", i, v)
+		}
+	}
+}
@@ -18,20 +18,31 @@
  *
  */
 
-// Package queue offers goroutine-safe Queue implementations such as LockfreeQueue(Lock free queue).
+// Package queue offers goroutine-safe Queue implementations such as LockfreeQueue(Lock free queue), BoundedQueue, PriorityQueue and MPSCQueue.
 package queue
 
 import (
+	"context"
+	"errors"
 	"sync/atomic"
 	"unsafe"
 )
 
+// ErrQueueClosed is returned by PopWait when the queue is closed and drained
+var ErrQueueClosed = errors.New("queue: queue closed")
+
 // LockfreeQueue is a goroutine-safe Queue implementation.
 // The overall performance of LockfreeQueue is much better than List+Mutex(standard package).
 type LockfreeQueue[T any] struct {
-	head  unsafe.Pointer
-	tail  unsafe.Pointer
-	dummy lfqNode[T]
+	head     unsafe.Pointer
+	tail     unsafe.Pointer
+	dummy    lfqNode[T]
+	chunk    unsafe.Pointer // *lfqNodeChunk[T] from which new nodes are allocated
+	length   int64          // Approximate number of elements in the queue
+	waiters  int32          // Number of goroutines blocked in PopWait
+	closed   int32          // 1 if the queue is closed
+	notEmpty chan struct{}  // Notifies the blocked PopWait that there might be elements to pop
+	closeCh  chan struct{}  // Closed by Close to unblock all the blocked PopWait
 }
 
 // NewLockfreeQueue is the only way to get a new, ready-to-use LockfreeQueue.
@@ -41,10 +52,15 @@ type LockfreeQueue[T any] struct {
 //	lfq := queue.NewLockfreeQueue[int]()
 //	lfq.Push(100)
 //	v, ok := lfq.Pop()
+//	v, err := lfq.PopWait(ctx) // blocks until there is an element, ctx is done, or lfq is closed
+//	lfq.Close()
 func NewLockfreeQueue[T any]() *LockfreeQueue[T] {
 	var lfq LockfreeQueue[T]
 	lfq.head = unsafe.Pointer(&lfq.dummy)
 	lfq.tail = lfq.head
+	lfq.chunk = unsafe.Pointer(&lfqNodeChunk[T]{})
+	lfq.notEmpty = make(chan struct{}, 1)
+	lfq.closeCh = make(chan struct{})
 	return &lfq
 }
 
@@ -57,8 +73,12 @@ func (lfq *LockfreeQueue[T]) Pop() (T, bool) {
 		rh := (*lfqNode[T])(h)
 		n := (*lfqNode[T])(atomic.LoadPointer(&rh.next))
 		if n != nil {
-			if atomic.CompareAndSwapPointer(&lfq.head, h, rh.next) {
-				return n.val, true
+			if atomic.CompareAndSwapPointer(&lfq.head, h, unsafe.Pointer(n)) {
+				atomic.AddInt64(&lfq.length, -1)
+				v := n.val
+				var zero T
+				n.val = zero // `n` becomes the new dummy node, don't keep a reference to the popped element
+				return v, true
 			} else {
 				continue
 			}
@@ -72,7 +92,9 @@ func (lfq *LockfreeQueue[T]) Pop() (T, bool) {
 // Push inserts an element to the back of the queue.
 // It performs exactly the same as list.List.PushBack() with sync.Mutex.
 func (lfq *LockfreeQueue[T]) Push(val T) {
-	node := unsafe.Pointer(&lfqNode[T]{val: val})
+	rn := lfq.newNode()
+	rn.val = val
+	node := unsafe.Pointer(rn)
 	for {
 		rt := (*lfqNode[T])(atomic.LoadPointer(&lfq.tail))
 		//t := atomic.LoadPointer(&lfq.tail)
@@ -81,6 +103,10 @@ func (lfq *LockfreeQueue[T]) Push(val T) {
 			atomic.StorePointer(&lfq.tail, node)
 			// If dead loop occurs, use CompareAndSwapPointer instead of StorePointer
 			// atomic.CompareAndSwapPointer(&lfq.tail, t, node)
+			atomic.AddInt64(&lfq.length, 1)
+			if atomic.LoadInt32(&lfq.waiters) > 0 {
+				notify(lfq.notEmpty)
+			}
 			return
 		} else {
 			continue
@@ -88,7 +114,89 @@ func (lfq *LockfreeQueue[T]) Push(val T) {
 	}
 }
 
+// PopWait returns (and removes) an element from the front of the queue. If the queue is empty, it blocks until
+// an element is pushed, `ctx` is done, or the queue is closed. It returns ctx.Err() if `ctx` is done,
+// or ErrQueueClosed if the queue is closed and there is no element left.
+func (lfq *LockfreeQueue[T]) PopWait(ctx context.Context) (T, error) {
+	if v, ok := lfq.Pop(); ok {
+		return v, nil
+	}
+
+	atomic.AddInt32(&lfq.waiters, 1)
+	defer atomic.AddInt32(&lfq.waiters, -1)
+	for {
+		// Must check again after increasing `waiters`, otherwise the notification from Push might be missed
+		if v, ok := lfq.Pop(); ok {
+			if !lfq.empty() {
+				notify(lfq.notEmpty) // Pass the notification on to other blocked consumers
+			}
+			return v, nil
+		}
+
+		select {
+		case <-lfq.notEmpty:
+		case <-lfq.closeCh:
+			if v, ok := lfq.Pop(); ok {
+				return v, nil
+			}
+			var v T
+			return v, ErrQueueClosed
+		case <-ctx.Done():
+			var v T
+			return v, ctx.Err()
+		}
+	}
+}
+
+// Close closes the queue and unblocks all the goroutines blocked in PopWait.
+// Elements remaining in the queue can still be popped after Close. It's safe to call Close more than once.
+func (lfq *LockfreeQueue[T]) Close() {
+	if atomic.CompareAndSwapInt32(&lfq.closed, 0, 1) {
+		close(lfq.closeCh)
+	}
+}
+
+// Len returns the approximate number of elements in the queue.
+// It's exact if there is no concurrent Push/Pop, otherwise it's only a snapshot which is good enough for backpressure decisions.
+func (lfq *LockfreeQueue[T]) Len() int {
+	if n := atomic.LoadInt64(&lfq.length); n > 0 {
+		return int(n)
+	}
+	return 0 // Pop might decrease `length` before the corresponding Push increases it
+}
+
+// newNode allocates a node from the current chunk, and allocates a new chunk if the current one is used up.
+// Nodes are never recycled, because a popped node might still be accessed by other goroutines, reusing it without
+// hazard pointers may lose elements. Allocating nodes in chunks reduces the number of allocations instead,
+// a chunk is garbage collected as soon as all of its nodes are popped.
+func (lfq *LockfreeQueue[T]) newNode() *lfqNode[T] {
+	for {
+		c := atomic.LoadPointer(&lfq.chunk)
+		rc := (*lfqNodeChunk[T])(c)
+		if i := atomic.AddInt32(&rc.used, 1); i <= kNodeChunkSz {
+			return &rc.nodes[i-1]
+		}
+
+		nc := &lfqNodeChunk[T]{used: 1}
+		if atomic.CompareAndSwapPointer(&lfq.chunk, c, unsafe.Pointer(nc)) {
+			return &nc.nodes[0]
+		}
+	}
+}
+
+func (lfq *LockfreeQueue[T]) empty() bool {
+	h := (*lfqNode[T])(atomic.LoadPointer(&lfq.head))
+	return atomic.LoadPointer(&h.next) == nil
+}
+
 type lfqNode[T any] struct {
 	val  T
 	next unsafe.Pointer
 }
+
+const kNodeChunkSz = 64
+
+type lfqNodeChunk[T any] struct {
+	nodes [kNodeChunkSz]lfqNode[T]
+	used  int32 // Number of nodes allocated from this chunk
+}
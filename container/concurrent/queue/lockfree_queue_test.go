@@ -21,10 +21,12 @@
 package queue
 
 import (
+	"context"
 	"runtime"
 	"sort"
 	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -111,3 +113,79 @@ func pop_while_pushing(n int) {
 	}
 	wg.Done()
 }
+
+func TestLockfreeQueuePopWait(t *testing.T) {
+	q := NewLockfreeQueue[int]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.PopWait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("PopWait should time out: %v", err)
+	}
+
+	const kConsumers, kItems = 4, 10000
+	var cwg sync.WaitGroup
+	var mtx sync.Mutex
+	var results []int
+	for i := 0; i < kConsumers; i++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				v, err := q.PopWait(context.Background())
+				if err != nil {
+					if err != ErrQueueClosed {
+						t.Error(err)
+					}
+					return
+				}
+				mtx.Lock()
+				results = append(results, v)
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < kItems; i++ {
+		q.Push(i)
+	}
+	q.Close()
+	q.Close()
+	cwg.Wait()
+
+	sort.Ints(results)
+	if len(results) != kItems {
+		t.Fatalf("Expecting %d elements but gets %d", kItems, len(results))
+	}
+	for i, v := range results {
+		if v != i {
+			t.Fatalf("Invalid result at %d: %d", i, v)
+		}
+	}
+}
+
+func TestLockfreeQueueLen(t *testing.T) {
+	q := NewLockfreeQueue[int]()
+	for i := 0; i < kNodeChunkSz*3; i++ {
+		q.Push(i)
+		if q.Len() != i+1 {
+			t.Fatalf("Len() = %d, expecting %d", q.Len(), i+1)
+		}
+	}
+	for i := 0; i < kNodeChunkSz*3; i++ {
+		if v, ok := q.Pop(); !ok || v != i {
+			t.Fatalf("Pop() = %d, %v, expecting %d", v, ok, i)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d, expecting 0", q.Len())
+	}
+}
+
+func BenchmarkLockfreeQueuePush(b *testing.B) {
+	q := NewLockfreeQueue[int]()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		q.Push(i)
+	}
+}
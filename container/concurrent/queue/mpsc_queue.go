@@ -0,0 +1,136 @@
+/*
+ *
+ * queue - Goroutine-safe Queue implementations
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package queue
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// MPSCNode is a node of MPSCQueue. Nodes are allocated by the caller, so they can be pooled and reused
+// once they are popped from the queue. A node must not be pushed again before it's popped.
+type MPSCNode[T any] struct {
+	next  unsafe.Pointer
+	Value T
+}
+
+// Next returns the next node in the batch popped by MPSCQueue.PopBatch, or nil if `n` is the last one.
+func (n *MPSCNode[T]) Next() *MPSCNode[T] {
+	return (*MPSCNode[T])(atomic.LoadPointer(&n.next))
+}
+
+// MPSCQueue is an intrusive multi-producer single-consumer queue. Push and PushBatch are wait-free, each of them costs
+// only one atomic swap no matter how many nodes are pushed. PopBatch takes as many nodes as possible from the queue
+// at once, which makes it suitable for consumers such as async writers that process thousands of items per wakeup.
+//
+// Push and PushBatch can be called from any goroutine, while Pop and PopBatch must be called from one goroutine at a time.
+type MPSCQueue[T any] struct {
+	tail unsafe.Pointer // Last pushed node, modified by producers
+	_    [kCacheLineSz - 8]byte
+	head *MPSCNode[T] // First node not yet popped, accessed by the consumer only
+	stub MPSCNode[T]
+}
+
+// NewMPSCQueue is the only way to get a new, ready-to-use MPSCQueue.
+//
+// Example:
+//
+//	q := queue.NewMPSCQueue[[]byte]()
+//	q.Push(&queue.MPSCNode[[]byte]{Value: []byte("log")}) // producer side
+//	for n := q.PopBatch(0); n != nil; n = n.Next() {     // consumer side
+//		process(n.Value)
+//	}
+func NewMPSCQueue[T any]() *MPSCQueue[T] {
+	q := &MPSCQueue[T]{}
+	q.tail = unsafe.Pointer(&q.stub)
+	q.head = &q.stub
+	return q
+}
+
+// Push inserts a node to the back of the queue.
+func (q *MPSCQueue[T]) Push(n *MPSCNode[T]) {
+	q.PushBatch(n, n)
+}
+
+// PushBatch inserts a batch of nodes linked from `first` to `last` to the back of the queue in one shot.
+// Producers can build the batch locally with Link, and then publish it with only one atomic operation.
+func (q *MPSCQueue[T]) PushBatch(first, last *MPSCNode[T]) {
+	atomic.StorePointer(&last.next, nil)
+	prev := (*MPSCNode[T])(atomic.SwapPointer(&q.tail, unsafe.Pointer(last)))
+	// Nodes pushed by this call are invisible to the consumer until the following store completes
+	atomic.StorePointer(&prev.next, unsafe.Pointer(first))
+}
+
+// Pop returns (and removes) the node at the front of the queue, or nil if the queue is empty.
+func (q *MPSCQueue[T]) Pop() *MPSCNode[T] {
+	return q.PopBatch(1)
+}
+
+// PopBatch returns (and removes) at most `max` nodes from the front of the queue as a linked batch, which can be
+// traversed with MPSCNode.Next. `max <= 0` means no limit. It returns nil if the queue is empty.
+//
+// A node whose producer hasn't finished pushing yet is left in the queue along with the nodes behind it,
+// they'll be returned by the next call.
+func (q *MPSCQueue[T]) PopBatch(max int) *MPSCNode[T] {
+	var first, last *MPSCNode[T]
+	cur := q.head
+	for n := 0; max <= 0 || n < max; {
+		next := (*MPSCNode[T])(atomic.LoadPointer(&cur.next))
+		if next == nil {
+			// `cur` can be popped only after it has a successor, otherwise a producer might still write to cur.next
+			if cur == &q.stub || unsafe.Pointer(cur) != atomic.LoadPointer(&q.tail) {
+				break // Either empty, or a producer is linking a new node after `cur`
+			}
+			q.Push(&q.stub)
+			if next = (*MPSCNode[T])(atomic.LoadPointer(&cur.next)); next == nil {
+				break // Another producer has swapped the tail before us, `cur` will be popped next time
+			}
+		}
+
+		if cur != &q.stub {
+			if last == nil {
+				first = cur
+			} else {
+				atomic.StorePointer(&last.next, unsafe.Pointer(cur))
+			}
+			last = cur
+			n++
+		}
+		cur = next
+	}
+
+	q.head = cur
+	if last != nil {
+		atomic.StorePointer(&last.next, nil)
+	}
+	return first
+}
+
+// Link links `nodes` one after another, and returns the first and the last node, which can be passed to PushBatch.
+func Link[T any](nodes ...*MPSCNode[T]) (first, last *MPSCNode[T]) {
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	for i := 1; i < len(nodes); i++ {
+		atomic.StorePointer(&nodes[i-1].next, unsafe.Pointer(nodes[i]))
+	}
+	return nodes[0], nodes[len(nodes)-1]
+}
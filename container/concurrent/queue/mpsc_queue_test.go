@@ -0,0 +1,92 @@
+/*
+ *
+ * queue - Goroutine-safe Queue implementations
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package queue
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMPSCQueue(t *testing.T) {
+	q := NewMPSCQueue[int]()
+	if q.Pop() != nil || q.PopBatch(0) != nil {
+		t.Fatal("Queue should be empty")
+	}
+
+	first, last := Link(&MPSCNode[int]{Value: 1}, &MPSCNode[int]{Value: 2}, &MPSCNode[int]{Value: 3})
+	q.PushBatch(first, last)
+	q.Push(&MPSCNode[int]{Value: 4})
+	if n := q.Pop(); n == nil || n.Value != 1 || n.Next() != nil {
+		t.Fatal("Pop should return exactly one node")
+	}
+	expected := 2
+	for n := q.PopBatch(0); n != nil; n = n.Next() {
+		if n.Value != expected {
+			t.Fatalf("Expecting %d but gets %d", expected, n.Value)
+		}
+		expected++
+	}
+	if expected != 5 || q.Pop() != nil {
+		t.Fatal("All the nodes should be popped")
+	}
+}
+
+func TestMPSCQueueConcurrency(t *testing.T) {
+	const kProducers, kItems, kBatchSz = 8, 50000, 10
+
+	q := NewMPSCQueue[[2]int]()
+	var wg sync.WaitGroup
+	for i := 0; i < kProducers; i++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for j := 0; j < kItems; {
+				if j%(kBatchSz*2) == 0 { // Push a batch
+					nodes := make([]*MPSCNode[[2]int], kBatchSz)
+					for k := range nodes {
+						nodes[k] = &MPSCNode[[2]int]{Value: [2]int{p, j}}
+						j++
+					}
+					q.PushBatch(Link(nodes...))
+				} else {
+					q.Push(&MPSCNode[[2]int]{Value: [2]int{p, j}})
+					j++
+				}
+			}
+		}(i)
+	}
+
+	var nextSeq [kProducers]int
+	for total := 0; total < kProducers*kItems; {
+		for n := q.PopBatch(100); n != nil; n = n.Next() {
+			p, seq := n.Value[0], n.Value[1]
+			if seq != nextSeq[p] {
+				t.Fatalf("Producer %d: expecting %d but gets %d", p, nextSeq[p], seq)
+			}
+			nextSeq[p]++
+			total++
+		}
+	}
+	wg.Wait()
+	if q.Pop() != nil {
+		t.Error("Queue should be empty")
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ *
+ * queue - Goroutine-safe Queue implementations
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package queue
+
+import (
+	"sync"
+)
+
+// PriorityQueue is a goroutine-safe, heap-based priority queue. The element with the highest priority
+// (the one which is "less" than all the others according to the user-supplied `less` function) is popped first.
+type PriorityQueue[T any] struct {
+	mtx      sync.Mutex
+	elems    []T
+	less     func(a, b T) bool
+	capacity int
+}
+
+// NewPriorityQueue is the only way to get a new, ready-to-use PriorityQueue.
+//
+//	less: Returns true if `a` has a higher priority than `b`.
+//	capacity: Maximum number of elements the queue can hold. 0 means unlimited.
+//
+// Example:
+//
+//	pq := queue.NewPriorityQueue(func(a, b int) bool { return a < b }, 0) // min-heap
+//	pq.Push(100)
+//	v, ok := pq.Peek()
+//	v, ok = pq.Pop()
+func NewPriorityQueue[T any](less func(a, b T) bool, capacity int) *PriorityQueue[T] {
+	if capacity < 0 {
+		panic("queue: capacity of PriorityQueue must not be negative")
+	}
+	return &PriorityQueue[T]{less: less, capacity: capacity}
+}
+
+// Push inserts an element into the queue. It returns false if the queue is full.
+func (pq *PriorityQueue[T]) Push(val T) bool {
+	pq.mtx.Lock()
+	defer pq.mtx.Unlock()
+
+	if pq.capacity > 0 && len(pq.elems) >= pq.capacity {
+		return false
+	}
+	pq.elems = append(pq.elems, val)
+	pq.up(len(pq.elems) - 1)
+	return true
+}
+
+// Pop returns (and removes) the element with the highest priority and true if the queue is not empty,
+// otherwise it returns a default value and false.
+func (pq *PriorityQueue[T]) Pop() (T, bool) {
+	pq.mtx.Lock()
+	defer pq.mtx.Unlock()
+
+	var zero T
+	n := len(pq.elems) - 1
+	if n < 0 {
+		return zero, false
+	}
+
+	val := pq.elems[0]
+	pq.elems[0] = pq.elems[n]
+	pq.elems[n] = zero // Don't keep a reference to the popped element
+	pq.elems = pq.elems[:n]
+	pq.down(0)
+	return val, true
+}
+
+// Peek returns (without removing) the element with the highest priority and true if the queue is not empty,
+// otherwise it returns a default value and false.
+func (pq *PriorityQueue[T]) Peek() (T, bool) {
+	pq.mtx.Lock()
+	defer pq.mtx.Unlock()
+
+	if len(pq.elems) == 0 {
+		var zero T
+		return zero, false
+	}
+	return pq.elems[0], true
+}
+
+// Len returns the number of elements in the queue.
+func (pq *PriorityQueue[T]) Len() int {
+	pq.mtx.Lock()
+	defer pq.mtx.Unlock()
+	return len(pq.elems)
+}
+
+// Cap returns the capacity of the queue. 0 means unlimited.
+func (pq *PriorityQueue[T]) Cap() int {
+	return pq.capacity
+}
+
+func (pq *PriorityQueue[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !pq.less(pq.elems[i], pq.elems[parent]) {
+			break
+		}
+		pq.elems[i], pq.elems[parent] = pq.elems[parent], pq.elems[i]
+		i = parent
+	}
+}
+
+func (pq *PriorityQueue[T]) down(i int) {
+	n := len(pq.elems)
+	for {
+		child := 2*i + 1
+		if child >= n {
+			break
+		}
+		if right := child + 1; right < n && pq.less(pq.elems[right], pq.elems[child]) {
+			child = right
+		}
+		if !pq.less(pq.elems[child], pq.elems[i]) {
+			break
+		}
+		pq.elems[i], pq.elems[child] = pq.elems[child], pq.elems[i]
+		i = child
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ *
+ * queue - Goroutine-safe Queue implementations
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package queue
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	pq := NewPriorityQueue(func(a, b int) bool { return a > b }, 0)
+	if _, ok := pq.Peek(); ok {
+		t.Error("Queue should be empty")
+	}
+
+	const kGoroutines, kItems = 8, 1000
+	var wg sync.WaitGroup
+	var expected []int
+	for i := 0; i < kGoroutines; i++ {
+		vals := rand.Perm(kItems)
+		expected = append(expected, vals...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, v := range vals {
+				pq.Push(v)
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Sort(sort.Reverse(sort.IntSlice(expected)))
+
+	if pq.Len() != len(expected) {
+		t.Fatalf("Len() = %d, expecting %d", pq.Len(), len(expected))
+	}
+	if v, ok := pq.Peek(); !ok || v != expected[0] {
+		t.Errorf("Peek() = %d, %v, expecting %d", v, ok, expected[0])
+	}
+	for i, e := range expected {
+		if v, ok := pq.Pop(); !ok || v != e {
+			t.Fatalf("Pop() #%d = %d, %v, expecting %d", i, v, ok, e)
+		}
+	}
+	if _, ok := pq.Pop(); ok {
+		t.Error("Queue should be empty")
+	}
+}
+
+func TestPriorityQueueCapacity(t *testing.T) {
+	pq := NewPriorityQueue(func(a, b string) bool { return a < b }, 2)
+	if !pq.Push("b") || !pq.Push("a") || pq.Push("c") {
+		t.Fatal("Only 2 elements should be pushed")
+	}
+	if v, _ := pq.Pop(); v != "a" {
+		t.Errorf("Pop() = %q, expecting a", v)
+	}
+	if !pq.Push("c") {
+		t.Error("Push should succeed after Pop")
+	}
+}
@@ -0,0 +1,395 @@
+/*
+ *
+ * skiplist - Goroutine-safe ordered map based on skip list
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+/*
+Package skiplist provides SkipList, a goroutine-safe ordered map based on the lazy skip list algorithm.
+
+Lookups and iterations are lock free, while insertions and deletions only lock the few nodes adjacent to the key
+being modified, so goroutines operating on different keys hardly block each other. It's a better choice than
+guarding a lomap.LinkedOrderedMap with a global mutex when the map is accessed by many goroutines at the same time.
+
+Basic example:
+
+	sl := skiplist.New[int, string]()
+	sl.Insert(1, "a") // inserts if the key doesn't exist
+	sl.Set(2, "b") // inserts or updates
+	v, found := sl.Get(1)
+	sl.ForEachRange(1, 10, func(k int, v string) bool { // iterates over keys in [1, 10)
+		fmt.Println(k, v)
+		return true
+	})
+	sl.Erase(1)
+*/
+package skiplist
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/exp/constraints"
+)
+
+// SkipList is a goroutine-safe ordered map. All of its methods can be called from multiple goroutines simultaneously.
+// Iterations are weakly consistent: they never block writers, and elements inserted or erased during an iteration may or may not be visited.
+type SkipList[K constraints.Ordered, V any] struct {
+	head   *slNode[K, V]
+	length int64  // Number of elements in the list
+	seed   uint64 // Used to generate random levels
+}
+
+// New is the only way to get a new, ready-to-use SkipList.
+func New[K constraints.Ordered, V any]() *SkipList[K, V] {
+	return &SkipList[K, V]{head: newNode[K, V](*new(K), nil, kMaxLevel)}
+}
+
+// Insert inserts a new element into the list if `key` doesn't exist yet.
+// It returns true if the element is inserted, false if `key` already exists.
+func (sl *SkipList[K, V]) Insert(key K, value V) bool {
+	_, inserted := sl.getOrInsert(key, func() V { return value }, false)
+	return inserted
+}
+
+// Set inserts a new element into the list, or updates the value of `key` if it already exists.
+// It returns true if the element is inserted, false if an existing value is updated.
+func (sl *SkipList[K, V]) Set(key K, value V) bool {
+	_, inserted := sl.getOrInsert(key, func() V { return value }, true)
+	return inserted
+}
+
+// GetOrInsert returns the value of `key` and false if it exists,
+// otherwise it inserts the value returned by `create` and returns it along with true.
+// `create` is called without holding any lock, it might be called even if the value it returns is finally discarded
+// because another goroutine inserts `key` first.
+func (sl *SkipList[K, V]) GetOrInsert(key K, create func() V) ( /*value*/ V /*inserted*/, bool) {
+	return sl.getOrInsert(key, create, false)
+}
+
+// Get returns the value of `key` and true if `key` exists, otherwise it returns a default value and false.
+// It never blocks.
+func (sl *SkipList[K, V]) Get(key K) ( /*value*/ V /*found*/, bool) {
+	pred := sl.head
+	for level := kMaxLevel - 1; level >= 0; level-- {
+		curr := pred.loadNext(level)
+		for curr != nil && curr.key < key {
+			pred = curr
+			curr = pred.loadNext(level)
+		}
+		if curr != nil && curr.key == key {
+			if curr.isFullyLinked() && !curr.isMarked() {
+				return curr.loadValue(), true
+			}
+			break
+		}
+	}
+
+	var v V
+	return v, false
+}
+
+// Contains returns true if `key` exists in the list.
+func (sl *SkipList[K, V]) Contains(key K) bool {
+	_, found := sl.Get(key)
+	return found
+}
+
+// Erase erases the element of `key` from the list. It returns the erased value and true if `key` exists,
+// otherwise it returns a default value and false.
+func (sl *SkipList[K, V]) Erase(key K) ( /*value*/ V /*erased*/, bool) {
+	var preds, succs [kMaxLevel]*slNode[K, V]
+	var victim *slNode[K, V]
+	for {
+		lFound := sl.find(key, &preds, &succs)
+		if victim == nil {
+			// A node not fully linked is still being inserted, and a node not found in its top level is being erased
+			if lFound == -1 || !succs[lFound].isFullyLinked() || len(succs[lFound].next)-1 != lFound {
+				var v V
+				return v, false
+			}
+
+			victim = succs[lFound]
+			victim.mtx.Lock()
+			if victim.isMarked() {
+				victim.mtx.Unlock()
+				var v V
+				return v, false
+			}
+			atomic.StoreInt32(&victim.marked, 1)
+		}
+
+		topLevel := len(victim.next)
+		highestLocked, valid := lockPreds(&preds, topLevel, func(level int, pred *slNode[K, V]) bool {
+			return !pred.isMarked() && pred.loadNext(level) == victim
+		})
+		if !valid {
+			unlockPreds(&preds, highestLocked)
+			continue
+		}
+
+		for level := topLevel - 1; level >= 0; level-- {
+			preds[level].storeNext(level, victim.loadNext(level))
+		}
+		victim.mtx.Unlock()
+		unlockPreds(&preds, highestLocked)
+		atomic.AddInt64(&sl.length, -1)
+		return victim.loadValue(), true
+	}
+}
+
+// First returns the first (smallest) key-value pair and true if the list is not empty,
+// otherwise it returns default values and false.
+func (sl *SkipList[K, V]) First() (K, V, bool) {
+	for node := sl.head.loadNext(0); node != nil; node = node.loadNext(0) {
+		if node.isFullyLinked() && !node.isMarked() {
+			return node.key, node.loadValue(), true
+		}
+	}
+
+	var k K
+	var v V
+	return k, v, false
+}
+
+// PopFirst erases the first (smallest) element from the list and returns its key-value pair and true,
+// or returns default values and false if the list is empty.
+func (sl *SkipList[K, V]) PopFirst() (K, V, bool) {
+	for {
+		k, _, ok := sl.First()
+		if !ok {
+			var v V
+			return k, v, false
+		}
+		if v, erased := sl.Erase(k); erased {
+			return k, v, true
+		}
+		// Erased by another goroutine, try the next one
+	}
+}
+
+// Empty returns true if the list is empty.
+func (sl *SkipList[K, V]) Empty() bool {
+	return sl.Size() == 0
+}
+
+// Size returns the number of elements in the list.
+// It's only a snapshot if there are concurrent insertions or deletions.
+func (sl *SkipList[K, V]) Size() int {
+	return int(atomic.LoadInt64(&sl.length))
+}
+
+// ForEach calls `fn` for each key-value pair in ascend order until `fn` returns false. It never blocks.
+func (sl *SkipList[K, V]) ForEach(fn func(key K, value V) bool) {
+	sl.forEach(sl.head.loadNext(0), nil, fn)
+}
+
+// ForEachRange calls `fn` for each key-value pair whose key is in [from, to) in ascend order until `fn` returns false.
+// It never blocks.
+func (sl *SkipList[K, V]) ForEachRange(from, to K, fn func(key K, value V) bool) {
+	pred := sl.head
+	for level := kMaxLevel - 1; level >= 0; level-- {
+		curr := pred.loadNext(level)
+		for curr != nil && curr.key < from {
+			pred = curr
+			curr = pred.loadNext(level)
+		}
+	}
+	sl.forEach(pred.loadNext(0), &to, fn)
+}
+
+// Keys returns all the keys of the list in ascend order.
+func (sl *SkipList[K, V]) Keys() []K {
+	keys := make([]K, 0, sl.Size())
+	sl.ForEach(func(key K, _ V) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (sl *SkipList[K, V]) forEach(node *slNode[K, V], to *K, fn func(key K, value V) bool) {
+	for ; node != nil; node = node.loadNext(0) {
+		if to != nil && node.key >= *to {
+			return
+		}
+		if node.isFullyLinked() && !node.isMarked() {
+			if !fn(node.key, node.loadValue()) {
+				return
+			}
+		}
+	}
+}
+
+func (sl *SkipList[K, V]) getOrInsert(key K, create func() V, update bool) (V, bool) {
+	var preds, succs [kMaxLevel]*slNode[K, V]
+	var value *V
+	topLevel := sl.randomLevel()
+	for {
+		lFound := sl.find(key, &preds, &succs)
+		if lFound != -1 {
+			node := succs[lFound]
+			if !node.isMarked() {
+				for !node.isFullyLinked() {
+					runtime.Gosched() // Being inserted by another goroutine
+				}
+				if update {
+					if value == nil {
+						v := create()
+						value = &v
+					}
+					node.storeValue(value)
+					return *value, false
+				}
+				return node.loadValue(), false
+			}
+			runtime.Gosched() // Being erased by another goroutine
+			continue
+		}
+
+		highestLocked, valid := lockPreds(&preds, topLevel, func(level int, pred *slNode[K, V]) bool {
+			succ := succs[level]
+			return !pred.isMarked() && (succ == nil || !succ.isMarked()) && pred.loadNext(level) == succ
+		})
+		if !valid {
+			unlockPreds(&preds, highestLocked)
+			continue
+		}
+
+		if value == nil {
+			v := create()
+			value = &v
+		}
+		node := newNode(key, value, topLevel)
+		for level := 0; level < topLevel; level++ {
+			node.next[level] = unsafe.Pointer(succs[level])
+		}
+		for level := 0; level < topLevel; level++ {
+			preds[level].storeNext(level, node)
+		}
+		atomic.StoreInt32(&node.fullyLinked, 1)
+		unlockPreds(&preds, highestLocked)
+		atomic.AddInt64(&sl.length, 1)
+		return *value, true
+	}
+}
+
+// find fills `preds` and `succs` with the predecessors and successors of `key` in each level,
+// and returns the highest level in which `key` is found, or -1 if `key` is not found.
+func (sl *SkipList[K, V]) find(key K, preds, succs *[kMaxLevel]*slNode[K, V]) int {
+	lFound := -1
+	pred := sl.head
+	for level := kMaxLevel - 1; level >= 0; level-- {
+		curr := pred.loadNext(level)
+		for curr != nil && curr.key < key {
+			pred = curr
+			curr = pred.loadNext(level)
+		}
+		if lFound == -1 && curr != nil && curr.key == key {
+			lFound = level
+		}
+		preds[level] = pred
+		succs[level] = curr
+	}
+	return lFound
+}
+
+// lockPreds locks the predecessors from level 0 to `topLevel`-1, and checks them with `validate`.
+// It returns the highest level locked and whether all the predecessors are still valid.
+// The same node might be the predecessor in several consecutive levels, it's locked only once.
+func lockPreds[K constraints.Ordered, V any](preds *[kMaxLevel]*slNode[K, V], topLevel int, validate func(level int, pred *slNode[K, V]) bool) (int, bool) {
+	highestLocked := -1
+	valid := true
+	var prevPred *slNode[K, V]
+	for level := 0; valid && level < topLevel; level++ {
+		pred := preds[level]
+		if pred != prevPred {
+			pred.mtx.Lock()
+			highestLocked = level
+			prevPred = pred
+		}
+		valid = validate(level, pred)
+	}
+	return highestLocked, valid
+}
+
+func unlockPreds[K constraints.Ordered, V any](preds *[kMaxLevel]*slNode[K, V], highestLocked int) {
+	var prevPred *slNode[K, V]
+	for level := 0; level <= highestLocked; level++ {
+		if pred := preds[level]; pred != prevPred {
+			pred.mtx.Unlock()
+			prevPred = pred
+		}
+	}
+}
+
+// randomLevel returns a random level in [1, kMaxLevel]. A node has a probability of 1/4 to be promoted to the next level.
+func (sl *SkipList[K, V]) randomLevel() int {
+	// splitmix64
+	r := atomic.AddUint64(&sl.seed, 0x9E3779B97F4A7C15)
+	r = (r ^ (r >> 30)) * 0xBF58476D1CE4E5B9
+	r = (r ^ (r >> 27)) * 0x94D049BB133111EB
+	r ^= r >> 31
+
+	level := 1
+	for level < kMaxLevel && r&3 == 0 {
+		level++
+		r >>= 2
+	}
+	return level
+}
+
+const kMaxLevel = 24
+
+type slNode[K constraints.Ordered, V any] struct {
+	key         K
+	val         unsafe.Pointer   // *V
+	next        []unsafe.Pointer // *slNode[K, V] of each level
+	mtx         sync.Mutex
+	marked      int32 // 1 if the node is being erased
+	fullyLinked int32 // 1 if the node is linked in all of its levels
+}
+
+func newNode[K constraints.Ordered, V any](key K, value *V, level int) *slNode[K, V] {
+	return &slNode[K, V]{key: key, val: unsafe.Pointer(value), next: make([]unsafe.Pointer, level)}
+}
+
+func (n *slNode[K, V]) loadNext(level int) *slNode[K, V] {
+	return (*slNode[K, V])(atomic.LoadPointer(&n.next[level]))
+}
+
+func (n *slNode[K, V]) storeNext(level int, next *slNode[K, V]) {
+	atomic.StorePointer(&n.next[level], unsafe.Pointer(next))
+}
+
+func (n *slNode[K, V]) loadValue() V {
+	return *(*V)(atomic.LoadPointer(&n.val))
+}
+
+func (n *slNode[K, V]) storeValue(value *V) {
+	atomic.StorePointer(&n.val, unsafe.Pointer(value))
+}
+
+func (n *slNode[K, V]) isMarked() bool {
+	return atomic.LoadInt32(&n.marked) == 1
+}
+
+func (n *slNode[K, V]) isFullyLinked() bool {
+	return atomic.LoadInt32(&n.fullyLinked) == 1
+}
@@ -0,0 +1,169 @@
+/*
+ *
+ * skiplist - Goroutine-safe ordered map based on skip list
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package skiplist
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestSkipList(t *testing.T) {
+	sl := New[int, string]()
+	if !sl.Empty() {
+		t.Fatal("New list should be empty")
+	}
+	if _, _, ok := sl.First(); ok {
+		t.Fatal("First of an empty list should fail")
+	}
+
+	for _, k := range []int{5, 1, 9, 3, 7} {
+		if !sl.Insert(k, "v") {
+			t.Fatalf("Insert(%d) should succeed", k)
+		}
+	}
+	if sl.Insert(5, "x") {
+		t.Error("Insert of an existing key should fail")
+	}
+	if sl.Set(5, "five") || !sl.Set(2, "two") {
+		t.Error("Set should return true only if the key is inserted")
+	}
+	if v, found := sl.Get(5); !found || v != "five" {
+		t.Errorf("Get(5) = %q, %v", v, found)
+	}
+	if _, found := sl.Get(4); found || sl.Contains(4) {
+		t.Error("4 should not be found")
+	}
+	if v, inserted := sl.GetOrInsert(2, func() string { return "x" }); inserted || v != "two" {
+		t.Errorf("GetOrInsert(2) = %q, %v", v, inserted)
+	}
+	if v, inserted := sl.GetOrInsert(4, func() string { return "four" }); !inserted || v != "four" {
+		t.Errorf("GetOrInsert(4) = %q, %v", v, inserted)
+	}
+	if sl.Size() != 7 {
+		t.Errorf("Size() = %d", sl.Size())
+	}
+
+	keys := sl.Keys()
+	if !sort.IntsAreSorted(keys) || len(keys) != 7 {
+		t.Errorf("Keys() = %v", keys)
+	}
+	var ranged []int
+	sl.ForEachRange(2, 7, func(k int, _ string) bool {
+		ranged = append(ranged, k)
+		return true
+	})
+	if len(ranged) != 4 || ranged[0] != 2 || ranged[3] != 5 {
+		t.Errorf("ForEachRange(2, 7) = %v", ranged)
+	}
+	n := 0
+	sl.ForEach(func(int, string) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("ForEach should stop when fn returns false: %d", n)
+	}
+
+	if v, erased := sl.Erase(5); !erased || v != "five" {
+		t.Errorf("Erase(5) = %q, %v", v, erased)
+	}
+	if _, erased := sl.Erase(5); erased || sl.Contains(5) {
+		t.Error("5 should have been erased")
+	}
+	if k, _, ok := sl.PopFirst(); !ok || k != 1 {
+		t.Errorf("PopFirst() = %d, %v", k, ok)
+	}
+	if k, _, ok := sl.First(); !ok || k != 2 {
+		t.Errorf("First() = %d, %v", k, ok)
+	}
+	for _, _, ok := sl.PopFirst(); ok; _, _, ok = sl.PopFirst() {
+	}
+	if sl.Size() != 0 || len(sl.Keys()) != 0 {
+		t.Error("List should be empty")
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	const kGoroutines, kKeys, kOps = 8, 1000, 20000
+	sl := New[int, int]()
+	var wg sync.WaitGroup
+	var inserted, erased [kGoroutines]int
+	for i := 0; i < kGoroutines; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(id)))
+			for j := 0; j < kOps; j++ {
+				k := r.Intn(kKeys)
+				switch r.Intn(4) {
+				case 0:
+					if _, ok := sl.Erase(k); ok {
+						erased[id]++
+					}
+				case 1:
+					if sl.Set(k, k) {
+						inserted[id]++
+					}
+				case 2:
+					if v, found := sl.Get(k); found && v != k {
+						t.Errorf("Get(%d) = %d", k, v)
+					}
+				default:
+					if _, ok := sl.GetOrInsert(k, func() int { return k }); ok {
+						inserted[id]++
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i := 0; i < kGoroutines; i++ {
+		total += inserted[i] - erased[i]
+	}
+	keys := sl.Keys()
+	if sl.Size() != total || len(keys) != total {
+		t.Fatalf("Size() = %d, len(Keys()) = %d, expecting %d", sl.Size(), len(keys), total)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatalf("Keys not in ascend order: %v", keys)
+		}
+	}
+}
+
+func BenchmarkSkipListParallel(b *testing.B) {
+	sl := New[int, int]()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			k := r.Intn(100000)
+			if r.Intn(10) == 0 {
+				sl.Set(k, k)
+			} else {
+				sl.Get(k)
+			}
+		}
+	})
+}
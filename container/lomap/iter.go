@@ -0,0 +1,67 @@
+//go:build go1.23
+
+/*
+ *
+ * lomap - Linked Ordered Map, an ordered map that supports iteration in insertion order.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lomap
+
+import "iter"
+
+// All returns an iterator over key-value pairs of the map in ascend order.
+// The map must not be modified during the iteration.
+//
+// Example:
+//
+//	for k, v := range lom.All() {
+//		fmt.Println(k, v)
+//	}
+func (m *LinkedOrderedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for node := m.orderedHead; node != nil; node = node.orderedNext {
+			if !yield(node.k, node.v) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over key-value pairs of the map in descend order.
+// The map must not be modified during the iteration.
+func (m *LinkedOrderedMap[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for node := m.orderedTail; node != nil; node = node.orderedPrev {
+			if !yield(node.k, node.v) {
+				return
+			}
+		}
+	}
+}
+
+// InsertionOrder returns an iterator over key-value pairs of the map in insertion order.
+// The map must not be modified during the iteration.
+func (m *LinkedOrderedMap[K, V]) InsertionOrder() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for node := m.head; node != nil; node = node.next {
+			if !yield(node.k, node.v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+//go:build go1.23
+
+/*
+ *
+ * lomap - Linked Ordered Map, an ordered map that supports iteration in insertion order.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lomap
+
+import (
+	"iter"
+	"testing"
+)
+
+func TestIterSeq2(tt *testing.T) {
+	lom := New[int, string]()
+	for _, k := range []int{3, 1, 2} {
+		lom.Insert(k, "")
+	}
+
+	collect := func(seq iter.Seq2[int, string], limit int) (keys []int) {
+		seq(func(k int, _ string) bool {
+			keys = append(keys, k)
+			return len(keys) < limit
+		})
+		return
+	}
+
+	cases := []struct {
+		seq  iter.Seq2[int, string]
+		want []int
+	}{
+		{lom.All(), []int{1, 2, 3}},
+		{lom.Backward(), []int{3, 2, 1}},
+		{lom.InsertionOrder(), []int{3, 1, 2}},
+	}
+	for i, c := range cases {
+		keys := collect(c.seq, 3)
+		if len(keys) != len(c.want) || keys[0] != c.want[0] || keys[1] != c.want[1] || keys[2] != c.want[2] {
+			tt.Errorf("case %d: expecting %v but gets %v", i, c.want, keys)
+		}
+		if keys = collect(c.seq, 1); len(keys) != 1 {
+			tt.Errorf("case %d: iteration should stop early: %v", i, keys)
+		}
+	}
+}
@@ -34,7 +34,8 @@ type LinkedOrderedMap[K constraints.Ordered, V any] struct {
 	tail        *lrbtNode[K, V]
 	orderedHead *lrbtNode[K, V] // orderedHead and orderedTail forms an double linked list in ascend order
 	orderedTail *lrbtNode[K, V]
-	size        int // size of the map
+	size        int  // size of the map
+	orderStats  bool // maintain subtree sizes for Rank and SelectByRank
 }
 
 // New is the only way to get a new, ready-to-use LinkedOrderedMap object.
@@ -42,8 +43,32 @@ type LinkedOrderedMap[K constraints.Ordered, V any] struct {
 // Example:
 //
 //	lom := New[int, int]()
-func New[K constraints.Ordered, V any]() *LinkedOrderedMap[K, V] {
-	return &LinkedOrderedMap[K, V]{}
+//	ranked := New[int, string](WithOrderStatistics()) // Rank and SelectByRank run in O(log n)
+func New[K constraints.Ordered, V any](opts ...option) *LinkedOrderedMap[K, V] {
+	var o options
+	o.apply(opts...)
+	return &LinkedOrderedMap[K, V]{orderStats: o.orderStats}
+}
+
+// WithOrderStatistics makes the LinkedOrderedMap maintain the size of every subtree,
+// so that Rank and SelectByRank run in O(log n) instead of O(n).
+// It costs an extra O(log n) walk for every insertion and deletion.
+func WithOrderStatistics() option {
+	return func(o *options) {
+		o.orderStats = true
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	orderStats bool
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
 }
 
 // Insert inserts a new element into the LinkedOrderedMap if it doesn't already contain an element with an equivalent key.
@@ -80,6 +105,51 @@ func (m *LinkedOrderedMap[K, V]) Get(key K) ( /*value*/ V /*found*/, bool) {
 	return v, false
 }
 
+// GetOrInsert returns value of the key and false if the given key is found.
+// Otherwise, it inserts a new element with the value returned by `create` and returns the new value and true.
+// Only one search is performed in either case. `create` must not modify the map.
+func (m *LinkedOrderedMap[K, V]) GetOrInsert(key K, create func() V) ( /*value*/ V /*inserted*/, bool) {
+	node, inserted := m.findOrInsert(key)
+	if inserted {
+		node.v = create()
+	}
+	return node.v, inserted
+}
+
+// Update replaces value of the key with the value returned by `update` if the given key is found.
+// It returns true if the update took place and false if the key is not found. `update` must not modify the map.
+func (m *LinkedOrderedMap[K, V]) Update(key K, update func(old V) V) bool {
+	node := m.search(key)
+	if node != nil {
+		node.v = update(node.v)
+		return true
+	}
+	return false
+}
+
+// UpsertWith inserts a new element or updates the existing element with the value returned by `upsert`.
+// `old` is the current value of the key and `found` reports if the key exists. `upsert` must not modify the map.
+//
+// Return value: true if the insertion took place and false if the update took place.
+func (m *LinkedOrderedMap[K, V]) UpsertWith(key K, upsert func(old V, found bool) V) bool {
+	node, inserted := m.findOrInsert(key)
+	node.v = upsert(node.v, !inserted)
+	return inserted
+}
+
+// GetAndMoveToBack returns value of the key and true if the given key is found,
+// and moves the element to the back of the linked list as if it is just inserted.
+// If the given key is not found, it returns a zero value and false.
+func (m *LinkedOrderedMap[K, V]) GetAndMoveToBack(key K) ( /*value*/ V /*found*/, bool) {
+	node := m.search(key)
+	if node != nil {
+		m.moveToBack(node)
+		return node.v, true
+	}
+	var v V
+	return v, false
+}
+
 // Erase removes the element with the given key from the map.
 // Key should adhere to the comparator's type assertion, otherwise it will panic.
 func (m *LinkedOrderedMap[K, V]) Erase(key K) {
@@ -120,7 +190,10 @@ func (m *LinkedOrderedMap[K, V]) FindLinkedIterator(key K) *LinkedIterator[K, V]
 
 // MoveToBack move the element specified by `iter` to the back of the linked list as if it is just inserted.
 func (m *LinkedOrderedMap[K, V]) MoveToBack(iter *LinkedIterator[K, V]) {
-	node := iter.node
+	m.moveToBack(iter.node)
+}
+
+func (m *LinkedOrderedMap[K, V]) moveToBack(node *lrbtNode[K, V]) {
 	if node == nil || node.next == nil { // node is nil or the last node
 		return
 	}
@@ -148,6 +221,154 @@ func (m *LinkedOrderedMap[K, V]) EraseFront() {
 	m.erase(m.head)
 }
 
+// First returns the element with the smallest key and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) First() (K, V, bool) {
+	return m.peek(m.orderedHead)
+}
+
+// Last returns the element with the largest key and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) Last() (K, V, bool) {
+	return m.peek(m.orderedTail)
+}
+
+// FrontInserted returns the earliest inserted element and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) FrontInserted() (K, V, bool) {
+	return m.peek(m.head)
+}
+
+// BackInserted returns the latest inserted element and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) BackInserted() (K, V, bool) {
+	return m.peek(m.tail)
+}
+
+// PopFirst removes and returns the element with the smallest key and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) PopFirst() (K, V, bool) {
+	return m.pop(m.orderedHead)
+}
+
+// PopLast removes and returns the element with the largest key and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) PopLast() (K, V, bool) {
+	return m.pop(m.orderedTail)
+}
+
+// PopFront removes and returns the earliest inserted element and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) PopFront() (K, V, bool) {
+	return m.pop(m.head)
+}
+
+// PopBack removes and returns the latest inserted element and true. If the map is empty, it returns zero values and false.
+func (m *LinkedOrderedMap[K, V]) PopBack() (K, V, bool) {
+	return m.pop(m.tail)
+}
+
+// Keys returns the keys of the map in ascend order.
+func (m *LinkedOrderedMap[K, V]) Keys() []K {
+	keys := make([]K, 0, m.size)
+	for node := m.orderedHead; node != nil; node = node.orderedNext {
+		keys = append(keys, node.k)
+	}
+	return keys
+}
+
+// KeysInInsertionOrder returns the keys of the map in insertion order.
+func (m *LinkedOrderedMap[K, V]) KeysInInsertionOrder() []K {
+	keys := make([]K, 0, m.size)
+	for node := m.head; node != nil; node = node.next {
+		keys = append(keys, node.k)
+	}
+	return keys
+}
+
+// Values returns the values of the map in ascend order of their keys.
+func (m *LinkedOrderedMap[K, V]) Values() []V {
+	values := make([]V, 0, m.size)
+	for node := m.orderedHead; node != nil; node = node.orderedNext {
+		values = append(values, node.v)
+	}
+	return values
+}
+
+// ValuesInInsertionOrder returns the values of the map in insertion order.
+func (m *LinkedOrderedMap[K, V]) ValuesInInsertionOrder() []V {
+	values := make([]V, 0, m.size)
+	for node := m.head; node != nil; node = node.next {
+		values = append(values, node.v)
+	}
+	return values
+}
+
+// ForEach calls `fn` for each element of the map in ascend order, until `fn` returns false.
+// `fn` must not modify the map.
+func (m *LinkedOrderedMap[K, V]) ForEach(fn func(key K, value V) bool) {
+	for node := m.orderedHead; node != nil; node = node.orderedNext {
+		if !fn(node.k, node.v) {
+			return
+		}
+	}
+}
+
+// ForEachInInsertionOrder calls `fn` for each element of the map in insertion order, until `fn` returns false.
+// `fn` must not modify the map.
+func (m *LinkedOrderedMap[K, V]) ForEachInInsertionOrder(fn func(key K, value V) bool) {
+	for node := m.head; node != nil; node = node.next {
+		if !fn(node.k, node.v) {
+			return
+		}
+	}
+}
+
+// Clone returns a copy of the map, including its insertion order. It runs in O(n) by copying the tree as is, without rebalancing.
+// Values are copied by assignment, so values such as pointers or slices are shared between the two maps.
+func (m *LinkedOrderedMap[K, V]) Clone() *LinkedOrderedMap[K, V] {
+	c := &LinkedOrderedMap[K, V]{size: m.size, orderStats: m.orderStats}
+	if m.root == nil {
+		return c
+	}
+
+	clones := make(map[*lrbtNode[K, V]]*lrbtNode[K, V], m.size)
+	c.root = cloneSubtree(m.root, nil, clones)
+	var prev *lrbtNode[K, V]
+	for node := m.orderedHead; node != nil; node = node.orderedNext {
+		n := clones[node]
+		n.orderedPrev = prev
+		if prev != nil {
+			prev.orderedNext = n
+		} else {
+			c.orderedHead = n
+		}
+		prev = n
+	}
+	c.orderedTail = prev
+
+	prev = nil
+	for node := m.head; node != nil; node = node.next {
+		n := clones[node]
+		n.prev = prev
+		if prev != nil {
+			prev.next = n
+		} else {
+			c.head = n
+		}
+		prev = n
+	}
+	c.tail = prev
+	return c
+}
+
+// Equal returns true if the map and `other` contain the same keys, and values of the same keys are equal as reported by `eq`.
+// Insertion order is not compared.
+func (m *LinkedOrderedMap[K, V]) Equal(other *LinkedOrderedMap[K, V], eq func(a, b V) bool) bool {
+	if m.size != other.size {
+		return false
+	}
+	for n1, n2 := m.orderedHead, other.orderedHead; n1 != nil; n1, n2 = n1.orderedNext, n2.orderedNext {
+		if n1.k != n2.k || !eq(n1.v, n2.v) {
+			return false
+		}
+	}
+	return true
+}
+
 // ReverseLinkedIterator returns an iterator for iterating the LinkedOrderedMap in reverse insertion order.
 func (m *LinkedOrderedMap[K, V]) ReverseLinkedIterator() *ReverseLinkedIterator[K, V] {
 	return &ReverseLinkedIterator[K, V]{m.tail}
@@ -173,9 +394,77 @@ func (m *LinkedOrderedMap[K, V]) Count(key K) int {
 	return 0
 }
 
+// Rank returns the number of elements whose keys are less than `key`, and true if `key` is found.
+// In other words, it returns the 0-based position of `key` in ascend order.
+// It runs in O(log n) if WithOrderStatistics is enabled, otherwise it runs in O(n).
+func (m *LinkedOrderedMap[K, V]) Rank(key K) (rank int, found bool) {
+	if !m.orderStats {
+		for node := m.orderedHead; node != nil && node.k <= key; node = node.orderedNext {
+			if node.k == key {
+				return rank, true
+			}
+			rank++
+		}
+		return rank, false
+	}
+
+	node := m.root
+	for node != nil {
+		if key > node.k {
+			rank += node.left.subtreeSize() + 1
+			node = node.right
+		} else if key < node.k {
+			node = node.left
+		} else {
+			return rank + node.left.subtreeSize(), true
+		}
+	}
+	return rank, false
+}
+
+// SelectByRank returns an iterator to the element whose 0-based position in ascend order is `rank`.
+// If `rank` is out of range, Iterator.IsValid() returns false.
+// It runs in O(log n) if WithOrderStatistics is enabled, otherwise it runs in O(n).
+func (m *LinkedOrderedMap[K, V]) SelectByRank(rank int) *Iterator[K, V] {
+	if rank < 0 || rank >= m.size {
+		return &Iterator[K, V]{}
+	}
+
+	if !m.orderStats {
+		node := m.orderedHead
+		for ; rank > 0; rank-- {
+			node = node.orderedNext
+		}
+		return &Iterator[K, V]{node}
+	}
+
+	node := m.root
+	for {
+		leftSize := node.left.subtreeSize()
+		if rank < leftSize {
+			node = node.left
+		} else if rank > leftSize {
+			rank -= leftSize + 1
+			node = node.right
+		} else {
+			return &Iterator[K, V]{node}
+		}
+	}
+}
+
 // set inserts a new node into the LinkedOrderedMap or updates the existing node with the new value.
 func (m *LinkedOrderedMap[K, V]) set(key K, value V, updateIfExist bool) bool {
-	newNode := &lrbtNode[K, V]{k: key, v: value}
+	node, inserted := m.findOrInsert(key)
+	if inserted || updateIfExist {
+		node.v = value
+	}
+	return inserted
+}
+
+// findOrInsert returns the node with the given key and false if found,
+// otherwise it inserts a new node holding a zero value and returns the new node and true.
+func (m *LinkedOrderedMap[K, V]) findOrInsert(key K) (*lrbtNode[K, V], bool) {
+	newNode := &lrbtNode[K, V]{k: key, subtreeSz: 1}
 	if m.root != nil {
 		node := m.root
 		for {
@@ -195,15 +484,16 @@ func (m *LinkedOrderedMap[K, V]) set(key K, value V, updateIfExist bool) bool {
 					newNode.nodeType = kLRBTNodeTypeLeftChild
 					break
 				}
-			} else { // k already exists, updates the value.
-				if updateIfExist {
-					node.k = key
-					node.v = value
-				}
-				return false
+			} else { // k already exists
+				return node, false
 			}
 		}
 		newNode.parent = node
+		if m.orderStats {
+			for ; node != nil; node = node.parent {
+				node.subtreeSz++
+			}
+		}
 		m.insertCase2(newNode)
 		// insert ordered linked list
 		newNode.prev = m.tail
@@ -257,7 +547,7 @@ func (m *LinkedOrderedMap[K, V]) set(key K, value V, updateIfExist bool) bool {
 	}
 
 	m.size++
-	return true
+	return newNode, true
 }
 
 // Case 1: root node
@@ -384,6 +674,21 @@ func (m *LinkedOrderedMap[K, V]) deleteCase6(node *lrbtNode[K, V]) {
 	}
 }
 
+func (m *LinkedOrderedMap[K, V]) peek(node *lrbtNode[K, V]) (k K, v V, ok bool) {
+	if node != nil {
+		return node.k, node.v, true
+	}
+	return
+}
+
+func (m *LinkedOrderedMap[K, V]) pop(node *lrbtNode[K, V]) (k K, v V, ok bool) {
+	if node != nil {
+		k, v, ok = node.k, node.v, true // erase might overwrite node with its predecessor
+		m.erase(node)
+	}
+	return
+}
+
 func (m *LinkedOrderedMap[K, V]) rotateLeft(node *lrbtNode[K, V]) {
 	right := node.right
 	m.replaceNode(node, right)
@@ -395,6 +700,10 @@ func (m *LinkedOrderedMap[K, V]) rotateLeft(node *lrbtNode[K, V]) {
 	right.left = node
 	node.parent = right
 	node.nodeType = kLRBTNodeTypeLeftChild
+	if m.orderStats {
+		right.subtreeSz = node.subtreeSz
+		node.subtreeSz = node.left.subtreeSize() + node.right.subtreeSize() + 1
+	}
 }
 
 func (m *LinkedOrderedMap[K, V]) rotateRight(node *lrbtNode[K, V]) {
@@ -408,6 +717,10 @@ func (m *LinkedOrderedMap[K, V]) rotateRight(node *lrbtNode[K, V]) {
 	left.right = node
 	node.parent = left
 	node.nodeType = kLRBTNodeTypeRightChild
+	if m.orderStats {
+		left.subtreeSz = node.subtreeSz
+		node.subtreeSz = node.left.subtreeSize() + node.right.subtreeSize() + 1
+	}
 }
 
 func (m *LinkedOrderedMap[K, V]) search(key K) (node *lrbtNode[K, V]) {
@@ -525,7 +838,13 @@ func (m *LinkedOrderedMap[K, V]) erase(node *lrbtNode[K, V]) {
 		needFixList = false
 	}
 
-	// At this point, it's certain that node has at most one children
+	// At this point, it's certain that node has at most one children.
+	// Subtree sizes are fixed before rebalancing so that rotations can recalculate them from the children.
+	if m.orderStats {
+		for n := node; n != nil; n = n.parent {
+			n.subtreeSz--
+		}
+	}
 	var child *lrbtNode[K, V]
 	if node.right == nil {
 		child = node.left
@@ -688,6 +1007,7 @@ type lrbtNode[K constraints.Ordered, V any] struct {
 	v           V
 	isBlack     bool
 	nodeType    lrbtNodeType
+	subtreeSz   int // number of nodes in the subtree rooted at this node, maintained only if order statistics is enabled
 	left        *lrbtNode[K, V]
 	right       *lrbtNode[K, V]
 	parent      *lrbtNode[K, V]
@@ -697,6 +1017,19 @@ type lrbtNode[K constraints.Ordered, V any] struct {
 	orderedNext *lrbtNode[K, V]
 }
 
+// cloneSubtree copies the subtree rooted at `node` without the linked lists, and records the copies in `clones`
+func cloneSubtree[K constraints.Ordered, V any](node, parent *lrbtNode[K, V], clones map[*lrbtNode[K, V]]*lrbtNode[K, V]) *lrbtNode[K, V] {
+	if node == nil {
+		return nil
+	}
+
+	n := &lrbtNode[K, V]{k: node.k, v: node.v, isBlack: node.isBlack, nodeType: node.nodeType, subtreeSz: node.subtreeSz, parent: parent}
+	clones[node] = n
+	n.left = cloneSubtree(node.left, n, clones)
+	n.right = cloneSubtree(node.right, n, clones)
+	return n
+}
+
 func (node *lrbtNode[K, V]) sibling() *lrbtNode[K, V] {
 	if node.parent != nil {
 		if node.isLeftChild() {
@@ -721,6 +1054,13 @@ func (node *lrbtNode[K, V]) leftmostChild() *lrbtNode[K, V] {
 	return node
 }
 
+func (node *lrbtNode[K, V]) subtreeSize() int {
+	if node != nil {
+		return node.subtreeSz
+	}
+	return 0
+}
+
 func (node *lrbtNode[K, V]) isBlackNode() bool {
 	if node != nil {
 		return node.isBlack
@@ -232,3 +232,223 @@ func verifySortedOrder(msg string, rbt *LinkedOrderedMap[int, int], insertedNums
 
 	return true
 }
+
+func TestOrderStatistics(tt *testing.T) {
+	for _, rbt := range []*LinkedOrderedMap[int, int]{New[int, int](), New[int, int](WithOrderStatistics())} {
+		m := map[int]int{}
+		for i := 0; i != 20000; i++ {
+			n := rand.Intn(50000)
+			if i%3 == 0 {
+				rbt.Erase(n)
+				delete(m, n)
+			} else {
+				rbt.Set(n, n)
+				m[n] = n
+			}
+		}
+
+		var sortedNums sort.IntSlice
+		for k := range m {
+			sortedNums = append(sortedNums, k)
+		}
+		sortedNums.Sort()
+
+		for i, n := range sortedNums {
+			rank, found := rbt.Rank(n)
+			if !found || rank != i {
+				tt.Fatalf("Rank(%d) failed! Expecting %d but gets %d %v", n, i, rank, found)
+			}
+			rank, found = rbt.Rank(n + 1)
+			if rbt.Count(n+1) == 0 && (found || rank != i+1) {
+				tt.Fatalf("Rank(%d) failed! Expecting %d but gets %d %v", n+1, i+1, rank, found)
+			}
+			it := rbt.SelectByRank(i)
+			if !it.IsValid() || it.Key() != n {
+				tt.Fatalf("SelectByRank(%d) failed! Expecting %d", i, n)
+			}
+		}
+		if rbt.SelectByRank(-1).IsValid() || rbt.SelectByRank(len(sortedNums)).IsValid() {
+			tt.Fatal("SelectByRank should return an invalid iterator if rank is out of range!")
+		}
+	}
+}
+
+func TestReadModifyHelpers(tt *testing.T) {
+	lom := New[string, int]()
+	v, inserted := lom.GetOrInsert("a", func() int { return 1 })
+	if v != 1 || !inserted {
+		tt.Errorf("GetOrInsert should insert a new element: %d %v", v, inserted)
+	}
+	v, inserted = lom.GetOrInsert("a", func() int { return 2 })
+	if v != 1 || inserted {
+		tt.Errorf("GetOrInsert should return the existing element: %d %v", v, inserted)
+	}
+
+	if !lom.Update("a", func(old int) int { return old + 10 }) || lom.Update("b", func(old int) int { return old }) {
+		tt.Error("Update should only update existing elements")
+	}
+	if v, _ = lom.Get("a"); v != 11 {
+		tt.Errorf("Unexpected value after Update: %d", v)
+	}
+
+	add := func(old int, found bool) int {
+		if found {
+			return old + 1
+		}
+		return 100
+	}
+	if !lom.UpsertWith("b", add) || lom.UpsertWith("a", add) {
+		tt.Error("UpsertWith returns wrong result")
+	}
+	if v, _ = lom.Get("b"); v != 100 {
+		tt.Errorf("Unexpected value after UpsertWith: %d", v)
+	}
+
+	if v, found := lom.GetAndMoveToBack("a"); v != 12 || !found {
+		tt.Errorf("Unexpected result of GetAndMoveToBack: %d %v", v, found)
+	}
+	if it := lom.ReverseLinkedIterator(); it.Key() != "a" {
+		tt.Errorf("GetAndMoveToBack should move the element to the back: %s", it.Key())
+	}
+	if _, found := lom.GetAndMoveToBack("c"); found {
+		tt.Error("GetAndMoveToBack should not find a nonexistent key")
+	}
+}
+
+func TestPeekAndPop(tt *testing.T) {
+	lom := New[int, int]()
+	if _, _, ok := lom.First(); ok {
+		tt.Error("First should fail on an empty map")
+	}
+	if _, _, ok := lom.PopBack(); ok {
+		tt.Error("PopBack should fail on an empty map")
+	}
+
+	for _, k := range []int{5, 2, 8, 1, 9, 3} {
+		lom.Insert(k, k*10)
+	}
+
+	check := func(name string, k, v int, ok bool, expect int) {
+		if !ok || k != expect || v != expect*10 {
+			tt.Errorf("%s: expecting %d but gets %d %d %v", name, expect, k, v, ok)
+		}
+	}
+	k, v, ok := lom.First()
+	check("First", k, v, ok, 1)
+	k, v, ok = lom.Last()
+	check("Last", k, v, ok, 9)
+	k, v, ok = lom.FrontInserted()
+	check("FrontInserted", k, v, ok, 5)
+	k, v, ok = lom.BackInserted()
+	check("BackInserted", k, v, ok, 3)
+
+	k, v, ok = lom.PopFront()
+	check("PopFront", k, v, ok, 5)
+	k, v, ok = lom.PopFirst()
+	check("PopFirst", k, v, ok, 1)
+	k, v, ok = lom.PopLast()
+	check("PopLast", k, v, ok, 9)
+	k, v, ok = lom.PopBack()
+	check("PopBack", k, v, ok, 3)
+	if lom.Size() != 2 || lom.Count(2) != 1 || lom.Count(8) != 1 {
+		tt.Errorf("Unexpected elements left after popping. size=%d", lom.Size())
+	}
+}
+
+func TestKeysValuesAndForEach(tt *testing.T) {
+	lom := New[int, string]()
+	if len(lom.Keys()) != 0 || len(lom.ValuesInInsertionOrder()) != 0 {
+		tt.Error("Keys and values of an empty map should be empty")
+	}
+	for _, k := range []int{5, 2, 8, 1} {
+		lom.Insert(k, string(rune('a'+k)))
+	}
+
+	equal := func(name string, got, expect []int) {
+		if len(got) != len(expect) {
+			tt.Errorf("%s: expecting %v but gets %v", name, expect, got)
+			return
+		}
+		for i := range got {
+			if got[i] != expect[i] {
+				tt.Errorf("%s: expecting %v but gets %v", name, expect, got)
+				return
+			}
+		}
+	}
+	equal("Keys", lom.Keys(), []int{1, 2, 5, 8})
+	equal("KeysInInsertionOrder", lom.KeysInInsertionOrder(), []int{5, 2, 8, 1})
+	if v := lom.Values(); len(v) != 4 || v[0] != "b" || v[3] != "i" {
+		tt.Errorf("Values: %v", v)
+	}
+	if v := lom.ValuesInInsertionOrder(); len(v) != 4 || v[0] != "f" || v[3] != "b" {
+		tt.Errorf("ValuesInInsertionOrder: %v", v)
+	}
+
+	var visited []int
+	lom.ForEach(func(k int, v string) bool {
+		visited = append(visited, k)
+		return k < 5
+	})
+	equal("ForEach", visited, []int{1, 2, 5})
+	visited = nil
+	lom.ForEachInInsertionOrder(func(k int, v string) bool {
+		visited = append(visited, k)
+		return true
+	})
+	equal("ForEachInInsertionOrder", visited, []int{5, 2, 8, 1})
+}
+
+func TestCloneAndEqual(tt *testing.T) {
+	eq := func(a, b int) bool { return a == b }
+	lom := New[int, int](WithOrderStatistics())
+	if c := lom.Clone(); !c.Empty() || !c.Equal(lom, eq) {
+		tt.Error("Clone of an empty map should be empty")
+	}
+	for _, k := range []int{5, 2, 8, 1, 9, 3, 7} {
+		lom.Insert(k, k*10)
+	}
+
+	c := lom.Clone()
+	if !c.Equal(lom, eq) || !lom.Equal(c, eq) {
+		tt.Fatal("Clone should be equal to the original map")
+	}
+	if k := c.KeysInInsertionOrder(); k[0] != 5 || k[6] != 7 {
+		tt.Errorf("Insertion order should be cloned: %v", k)
+	}
+	if it := c.SelectByRank(3); !it.IsValid() || it.Key() != 5 {
+		tt.Error("Order statistics should be cloned")
+	}
+
+	// The clone is independent of the original map
+	c.Erase(5)
+	c.Set(1, 0)
+	for i := 10; i < 100; i++ {
+		c.Insert(i, i)
+	}
+	if lom.Size() != 7 || lom.Count(5) != 1 || c.Count(5) != 0 {
+		tt.Error("Modifying the clone should not affect the original map")
+	}
+	if v, _ := lom.Get(1); v != 10 {
+		tt.Errorf("Value of the original map is changed to %d", v)
+	}
+	if rank, _ := c.Rank(50); rank != 46 {
+		tt.Errorf("Rank(50) of the modified clone = %d", rank)
+	}
+
+	c = lom.Clone()
+	c.Set(9, 0)
+	if c.Equal(lom, eq) {
+		tt.Error("Maps with different values should not be equal")
+	}
+	c.Set(9, 90)
+	c.MoveToBack(c.FindLinkedIterator(5))
+	if !c.Equal(lom, eq) {
+		tt.Error("Insertion order should not be compared")
+	}
+	c.Erase(9)
+	c.Insert(10, 90)
+	if c.Equal(lom, eq) {
+		tt.Error("Maps with different keys should not be equal")
+	}
+}
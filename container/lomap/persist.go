@@ -0,0 +1,187 @@
+/*
+ *
+ * lomap - Linked Ordered Map, an ordered map that supports iteration in insertion order.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lomap
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Encoder encodes values to a stream. *gob.Encoder and *json.Encoder satisfy this interface.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// Decoder decodes values from a stream. *gob.Decoder and *json.Decoder satisfy this interface.
+type Decoder interface {
+	Decode(v any) error
+}
+
+const (
+	kEncodingVersion  = 1
+	kMaxPreallocNodes = 1 << 16
+)
+
+// Encode writes a snapshot of the LinkedOrderedMap to `w` in gob format. Both ascend order and insertion order are preserved.
+// Keys and values must be encodable by gob.
+func (m *LinkedOrderedMap[K, V]) Encode(w io.Writer) error {
+	return m.EncodeWith(gob.NewEncoder(w))
+}
+
+// Decode replaces the content of the LinkedOrderedMap with the snapshot read from `r`, which is written by Encode.
+// The tree is rebuilt in O(n) instead of inserting the elements one by one.
+func (m *LinkedOrderedMap[K, V]) Decode(r io.Reader) error {
+	return m.DecodeWith(gob.NewDecoder(r))
+}
+
+// EncodeWith writes a snapshot of the LinkedOrderedMap with `enc`, so that custom formats can be used.
+//
+// The snapshot consists of a format version, the number of elements, keys and values in ascend order,
+// and then the ascend order positions of the elements in insertion order.
+func (m *LinkedOrderedMap[K, V]) EncodeWith(enc Encoder) (err error) {
+	if err = enc.Encode(kEncodingVersion); err != nil {
+		return
+	}
+	if err = enc.Encode(m.size); err != nil {
+		return
+	}
+
+	positions := make(map[*lrbtNode[K, V]]int, m.size)
+	for node := m.orderedHead; node != nil; node = node.orderedNext {
+		if err = enc.Encode(node.k); err != nil {
+			return
+		}
+		if err = enc.Encode(node.v); err != nil {
+			return
+		}
+		positions[node] = len(positions)
+	}
+	for node := m.head; node != nil; node = node.next {
+		if err = enc.Encode(positions[node]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// DecodeWith replaces the content of the LinkedOrderedMap with the snapshot read by `dec`, which is written by EncodeWith.
+// The LinkedOrderedMap is left unchanged if an error is returned.
+func (m *LinkedOrderedMap[K, V]) DecodeWith(dec Decoder) error {
+	var version, size int
+	if err := dec.Decode(&version); err != nil {
+		return err
+	}
+	if version != kEncodingVersion {
+		return fmt.Errorf("unsupported encoding version %d", version)
+	}
+	if err := dec.Decode(&size); err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("invalid size %d", size)
+	}
+
+	// `size` is read from the snapshot, don't trust it before the nodes are successfully decoded
+	capacity := size
+	if capacity > kMaxPreallocNodes {
+		capacity = kMaxPreallocNodes
+	}
+	nodes := make([]*lrbtNode[K, V], 0, capacity)
+	for i := 0; i < size; i++ {
+		node := &lrbtNode[K, V]{}
+		if err := dec.Decode(&node.k); err != nil {
+			return err
+		}
+		if err := dec.Decode(&node.v); err != nil {
+			return err
+		}
+		if i > 0 {
+			if node.k <= nodes[i-1].k {
+				return fmt.Errorf("keys are not in strictly ascend order at %d", i)
+			}
+			node.orderedPrev = nodes[i-1]
+			nodes[i-1].orderedNext = node
+		}
+		nodes = append(nodes, node)
+	}
+
+	var head, prev *lrbtNode[K, V]
+	linked := make([]bool, size)
+	for i := 0; i < size; i++ {
+		var pos int
+		if err := dec.Decode(&pos); err != nil {
+			return err
+		}
+		if pos < 0 || pos >= size || linked[pos] {
+			return fmt.Errorf("invalid insertion order position %d", pos)
+		}
+		linked[pos] = true
+		node := nodes[pos]
+		node.prev = prev
+		if prev != nil {
+			prev.next = node
+		} else {
+			head = node
+		}
+		prev = node
+	}
+
+	m.Clear()
+	if size > 0 {
+		m.root = buildTree(nodes, 0, bits.Len(uint(size))-1)
+		m.root.nodeType = kLRBTNodeTypeRoot
+		m.root.isBlack = true
+		m.orderedHead = nodes[0]
+		m.orderedTail = nodes[size-1]
+		m.head = head
+		m.tail = prev
+		m.size = size
+	}
+	return nil
+}
+
+// buildTree builds a balanced red-black tree from `nodes` sorted in ascend order.
+// All the levels except the deepest one are full, so the tree is valid if only nodes at the deepest level are red.
+func buildTree[K constraints.Ordered, V any](nodes []*lrbtNode[K, V], depth, redDepth int) *lrbtNode[K, V] {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	mid := len(nodes) / 2
+	node := nodes[mid]
+	node.isBlack = depth != redDepth
+	node.subtreeSz = len(nodes)
+	node.left = buildTree(nodes[:mid], depth+1, redDepth)
+	if node.left != nil {
+		node.left.parent = node
+		node.left.nodeType = kLRBTNodeTypeLeftChild
+	}
+	node.right = buildTree(nodes[mid+1:], depth+1, redDepth)
+	if node.right != nil {
+		node.right.parent = node
+		node.right.nodeType = kLRBTNodeTypeRightChild
+	}
+	return node
+}
@@ -0,0 +1,148 @@
+/*
+ *
+ * lomap - Linked Ordered Map, an ordered map that supports iteration in insertion order.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lomap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/exp/constraints"
+)
+
+func TestEncodeDecode(tt *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 7, 8, 100, 1000} {
+		src := New[int, string]()
+		for src.Size() < n {
+			k := rand.Intn(n * 10)
+			src.Insert(k, string(rune('a'+k%26)))
+		}
+
+		var buf bytes.Buffer
+		if err := src.Encode(&buf); err != nil {
+			tt.Fatalf("n=%d: Encode failed: %v", n, err)
+		}
+		dst := New[int, string](WithOrderStatistics())
+		dst.Insert(-1, "stale")
+		if err := dst.Decode(&buf); err != nil {
+			tt.Fatalf("n=%d: Decode failed: %v", n, err)
+		}
+		verifyDecoded(tt, n, src, dst)
+
+		// The rebuilt tree must keep working
+		for i := 0; i < n; i++ {
+			k := rand.Intn(n * 10)
+			src.Erase(k)
+			dst.Erase(k)
+			src.Insert(k+1, "x")
+			dst.Insert(k+1, "x")
+		}
+		verifyDecoded(tt, n, src, dst)
+	}
+
+	src := New[string, int]()
+	src.Insert("b", 2)
+	src.Insert("a", 1)
+	var buf bytes.Buffer
+	if err := src.EncodeWith(json.NewEncoder(&buf)); err != nil {
+		tt.Fatal(err)
+	}
+	dst := New[string, int]()
+	if err := dst.DecodeWith(json.NewDecoder(&buf)); err != nil {
+		tt.Fatal(err)
+	}
+	if k, v, _ := dst.FrontInserted(); k != "b" || v != 2 || dst.Size() != 2 {
+		tt.Errorf("unexpected result decoded from json: %q %d", k, v)
+	}
+}
+
+func verifyDecoded(tt *testing.T, n int, src, dst *LinkedOrderedMap[int, string]) {
+	if dst.Size() != src.Size() {
+		tt.Fatalf("n=%d: size mismatch %d != %d", n, dst.Size(), src.Size())
+	}
+	for a, b := src.Iterator(), dst.Iterator(); a.IsValid(); a.Next() {
+		if !b.IsValid() || a.Key() != b.Key() || a.Value() != b.Value() {
+			tt.Fatalf("n=%d: ascend order mismatch", n)
+		}
+		b.Next()
+	}
+	for a, b := src.ReverseLinkedIterator(), dst.ReverseLinkedIterator(); a.IsValid(); a.Next() {
+		if !b.IsValid() || a.Key() != b.Key() {
+			tt.Fatalf("n=%d: insertion order mismatch", n)
+		}
+		b.Next()
+	}
+	for i := 0; i < dst.Size(); i++ {
+		if it := dst.SelectByRank(i); !it.IsValid() {
+			tt.Fatalf("n=%d: SelectByRank(%d) failed", n, i)
+		}
+	}
+	if dst.root != nil && (!dst.root.isBlack || dst.root.parent != nil) {
+		tt.Fatalf("n=%d: invalid root", n)
+	}
+	if _, ok := blackHeight(dst.root); !ok {
+		tt.Fatalf("n=%d: red-black tree properties violated", n)
+	}
+}
+
+func blackHeight[K constraints.Ordered, V any](node *lrbtNode[K, V]) (int, bool) {
+	if node == nil {
+		return 1, true
+	}
+	if !node.isBlack && (!node.left.isBlackNode() || !node.right.isBlackNode()) {
+		return 0, false
+	}
+	if (node.left != nil && (node.left.parent != node || !node.left.isLeftChild())) ||
+		(node.right != nil && (node.right.parent != node || !node.right.isRightChild())) {
+		return 0, false
+	}
+	lh, lok := blackHeight(node.left)
+	rh, rok := blackHeight(node.right)
+	if !lok || !rok || lh != rh || node.subtreeSz != node.left.subtreeSize()+node.right.subtreeSize()+1 {
+		return 0, false
+	}
+	if node.isBlack {
+		lh++
+	}
+	return lh, true
+}
+
+func TestDecodeHugeSize(tt *testing.T) {
+	for _, size := range []int{1 << 40, math.MaxInt} {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		enc.Encode(kEncodingVersion)
+		enc.Encode(size)
+		enc.Encode(1) // Truncated after the first element
+
+		m := New[int, int]()
+		m.Insert(1, 1)
+		if err := m.Decode(&buf); err == nil {
+			tt.Errorf("size=%d: Decode should fail", size)
+		}
+		if m.Size() != 1 {
+			tt.Errorf("size=%d: map should be left unchanged", size)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+/*
+ *
+ * lomultimap - Linked Ordered MultiMap, an ordered map that allows duplicate keys and supports iteration in insertion order.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package lomultimap implements a linked ordered multimap which allows multiple values per key.
+// Keys are kept in ascend order with the same red-black tree as lomap, and values of each key are kept in insertion order.
+// Iteration in insertion order across all keys is supported as well. lomultimap is short for Linked Ordered MultiMap.
+//
+// Caution: This package is not goroutine-safe!
+package lomultimap
+
+import (
+	"golang.org/x/exp/constraints"
+
+	"github.com/antigloss/go/container/lomap"
+)
+
+// LinkedOrderedMultiMap is a linked ordered map which allows multiple values per key.
+// Elements are ordered by keys, and elements with equivalent keys are ordered by insertion.
+type LinkedOrderedMultiMap[K constraints.Ordered, V any] struct {
+	keys *lomap.LinkedOrderedMap[K, *bucket[K, V]]
+	head *entry[K, V] // head and tail forms an double linked list in insertion order
+	tail *entry[K, V]
+	size int // number of elements
+}
+
+// New is the only way to get a new, ready-to-use LinkedOrderedMultiMap object.
+//
+// Example:
+//
+//	lomm := New[string, int]()
+//	lomm.Insert("a", 1)
+//	lomm.Insert("a", 2)
+//	for it := lomm.EqualRange("a"); it.IsValid(); it.Next() {
+//		fmt.Println(it.Key(), it.Value()) // a 1, then a 2
+//	}
+func New[K constraints.Ordered, V any]() *LinkedOrderedMultiMap[K, V] {
+	return &LinkedOrderedMultiMap[K, V]{keys: lomap.New[K, *bucket[K, V]]()}
+}
+
+// Insert inserts a new element into the LinkedOrderedMultiMap. Elements with equivalent keys are allowed,
+// and the new element is placed after them.
+func (m *LinkedOrderedMultiMap[K, V]) Insert(key K, value V) {
+	b, _ := m.keys.GetOrInsert(key, func() *bucket[K, V] { return &bucket[K, V]{} })
+	e := &entry[K, V]{key: key, value: value, bucket: b}
+
+	e.keyPrev = b.tail
+	if b.tail != nil {
+		b.tail.keyNext = e
+	} else {
+		b.head = e
+	}
+	b.tail = e
+	b.size++
+
+	e.prev = m.tail
+	if m.tail != nil {
+		m.tail.next = e
+	} else {
+		m.head = e
+	}
+	m.tail = e
+	m.size++
+}
+
+// Get returns values of the key in insertion order, or nil if the key is not found.
+func (m *LinkedOrderedMultiMap[K, V]) Get(key K) []V {
+	b, found := m.keys.Get(key)
+	if !found {
+		return nil
+	}
+
+	values := make([]V, 0, b.size)
+	for e := b.head; e != nil; e = e.keyNext {
+		values = append(values, e.value)
+	}
+	return values
+}
+
+// Count returns the number of elements with the key.
+func (m *LinkedOrderedMultiMap[K, V]) Count(key K) int {
+	if b, found := m.keys.Get(key); found {
+		return b.size
+	}
+	return 0
+}
+
+// Erase removes all the elements with the key, and returns the number of elements removed.
+func (m *LinkedOrderedMultiMap[K, V]) Erase(key K) int {
+	b, found := m.keys.Get(key)
+	if !found {
+		return 0
+	}
+
+	n := b.size
+	for e := b.head; e != nil; e = e.keyNext {
+		m.unlink(e)
+	}
+	m.keys.Erase(key)
+	return n
+}
+
+// EraseIf removes the elements with the key for which `pred` returns true, and returns the number of elements removed.
+// `pred` must not modify the map.
+func (m *LinkedOrderedMultiMap[K, V]) EraseIf(key K, pred func(value V) bool) (n int) {
+	b, found := m.keys.Get(key)
+	if !found {
+		return 0
+	}
+
+	for e := b.head; e != nil; e = e.keyNext {
+		if pred(e.value) {
+			m.eraseEntry(e)
+			n++
+		}
+	}
+	return
+}
+
+// Empty returns true if the map does not contain any element, otherwise it returns false.
+func (m *LinkedOrderedMultiMap[K, V]) Empty() bool {
+	return m.size == 0
+}
+
+// Size returns the number of elements in the map.
+func (m *LinkedOrderedMultiMap[K, V]) Size() int {
+	return m.size
+}
+
+// KeyCount returns the number of distinct keys in the map.
+func (m *LinkedOrderedMultiMap[K, V]) KeyCount() int {
+	return m.keys.Size()
+}
+
+// Keys returns the distinct keys of the map in ascend order.
+func (m *LinkedOrderedMultiMap[K, V]) Keys() []K {
+	return m.keys.Keys()
+}
+
+// Clear removes all elements from the map.
+func (m *LinkedOrderedMultiMap[K, V]) Clear() {
+	m.keys.Clear()
+	m.head = nil
+	m.tail = nil
+	m.size = 0
+}
+
+// Iterator returns an iterator for iterating the LinkedOrderedMultiMap in ascend order of keys.
+// Elements with equivalent keys are iterated in insertion order.
+func (m *LinkedOrderedMultiMap[K, V]) Iterator() *Iterator[K, V] {
+	it := &Iterator[K, V]{keyIt: m.keys.Iterator()}
+	if it.keyIt.IsValid() {
+		it.e = it.keyIt.Value().head
+	}
+	return it
+}
+
+// EqualRange returns an iterator for iterating the elements with the key in insertion order.
+// If the key is not found, RangeIterator.IsValid() returns false.
+func (m *LinkedOrderedMultiMap[K, V]) EqualRange(key K) *RangeIterator[K, V] {
+	if b, found := m.keys.Get(key); found {
+		return &RangeIterator[K, V]{b.head}
+	}
+	return &RangeIterator[K, V]{}
+}
+
+// LinkedIterator returns an iterator for iterating the LinkedOrderedMultiMap in insertion order.
+func (m *LinkedOrderedMultiMap[K, V]) LinkedIterator() *LinkedIterator[K, V] {
+	return &LinkedIterator[K, V]{m.head}
+}
+
+// EraseByLinkedIterator erases the element specified by `iter`, and advances `iter` to the next element in insertion order.
+func (m *LinkedOrderedMultiMap[K, V]) EraseByLinkedIterator(iter *LinkedIterator[K, V]) {
+	e := iter.e
+	if e == nil {
+		return
+	}
+	iter.e = e.next
+	m.eraseEntry(e)
+}
+
+// EraseByRangeIterator erases the element specified by `iter`, and advances `iter` to the next element with the same key.
+func (m *LinkedOrderedMultiMap[K, V]) EraseByRangeIterator(iter *RangeIterator[K, V]) {
+	e := iter.e
+	if e == nil {
+		return
+	}
+	iter.e = e.keyNext
+	m.eraseEntry(e)
+}
+
+// eraseEntry removes `e` from both linked lists, and removes the key from the tree if `e` is its last element
+func (m *LinkedOrderedMultiMap[K, V]) eraseEntry(e *entry[K, V]) {
+	b := e.bucket
+	if e.keyPrev != nil {
+		e.keyPrev.keyNext = e.keyNext
+	} else {
+		b.head = e.keyNext
+	}
+	if e.keyNext != nil {
+		e.keyNext.keyPrev = e.keyPrev
+	} else {
+		b.tail = e.keyPrev
+	}
+	b.size--
+	if b.size == 0 {
+		m.keys.Erase(e.key)
+	}
+	m.unlink(e)
+}
+
+// unlink removes `e` from the linked list in insertion order
+func (m *LinkedOrderedMultiMap[K, V]) unlink(e *entry[K, V]) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		m.head = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		m.tail = e.prev
+	}
+	m.size--
+}
+
+// Iterator is used for iterating the LinkedOrderedMultiMap.
+type Iterator[K constraints.Ordered, V any] struct {
+	keyIt *lomap.Iterator[K, *bucket[K, V]]
+	e     *entry[K, V]
+}
+
+// IsValid returns true if the iterator is valid for use, false otherwise.
+// We must not call Next, Key, or Value if IsValid returns false.
+func (it *Iterator[K, V]) IsValid() bool {
+	return it.e != nil
+}
+
+// Next advances the iterator to the next element of the map
+func (it *Iterator[K, V]) Next() {
+	if it.e = it.e.keyNext; it.e == nil {
+		if it.keyIt.Next(); it.keyIt.IsValid() {
+			it.e = it.keyIt.Value().head
+		}
+	}
+}
+
+// Key returns the key of the underlying element
+func (it *Iterator[K, V]) Key() K {
+	return it.e.key
+}
+
+// Value returns the value of the underlying element
+func (it *Iterator[K, V]) Value() V {
+	return it.e.value
+}
+
+// RangeIterator is used for iterating the elements with the same key in insertion order.
+type RangeIterator[K constraints.Ordered, V any] struct {
+	e *entry[K, V]
+}
+
+// IsValid returns true if the iterator is valid for use, false otherwise.
+// We must not call Next, Key, or Value if IsValid returns false.
+func (it *RangeIterator[K, V]) IsValid() bool {
+	return it.e != nil
+}
+
+// Next advances the iterator to the next element with the same key
+func (it *RangeIterator[K, V]) Next() {
+	it.e = it.e.keyNext
+}
+
+// Key returns the key of the underlying element
+func (it *RangeIterator[K, V]) Key() K {
+	return it.e.key
+}
+
+// Value returns the value of the underlying element
+func (it *RangeIterator[K, V]) Value() V {
+	return it.e.value
+}
+
+// LinkedIterator is used for iterating the LinkedOrderedMultiMap in insertion order.
+type LinkedIterator[K constraints.Ordered, V any] struct {
+	e *entry[K, V]
+}
+
+// IsValid returns true if the iterator is valid for use, false otherwise.
+// We must not call Next, Key, or Value if IsValid returns false.
+func (it *LinkedIterator[K, V]) IsValid() bool {
+	return it.e != nil
+}
+
+// Next advances the iterator to the next element in insertion order
+func (it *LinkedIterator[K, V]) Next() {
+	it.e = it.e.next
+}
+
+// Key returns the key of the underlying element
+func (it *LinkedIterator[K, V]) Key() K {
+	return it.e.key
+}
+
+// Value returns the value of the underlying element
+func (it *LinkedIterator[K, V]) Value() V {
+	return it.e.value
+}
+
+// bucket holds the elements with the same key in insertion order
+type bucket[K constraints.Ordered, V any] struct {
+	head *entry[K, V]
+	tail *entry[K, V]
+	size int
+}
+
+type entry[K constraints.Ordered, V any] struct {
+	key     K
+	value   V
+	bucket  *bucket[K, V]
+	prev    *entry[K, V] // prev and next forms the double linked list in insertion order
+	next    *entry[K, V]
+	keyPrev *entry[K, V] // keyPrev and keyNext forms the double linked list of the elements with the same key
+	keyNext *entry[K, V]
+}
@@ -0,0 +1,156 @@
+/*
+ *
+ * lomultimap - Linked Ordered MultiMap, an ordered map that allows duplicate keys and supports iteration in insertion order.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lomultimap
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestLinkedOrderedMultiMap(tt *testing.T) {
+	lomm := New[string, int]()
+	for i, k := range []string{"b", "a", "c", "a", "b", "a"} {
+		lomm.Insert(k, i)
+	}
+	if lomm.Size() != 6 || lomm.KeyCount() != 3 || lomm.Count("a") != 3 || lomm.Count("x") != 0 {
+		tt.Fatalf("size=%d keys=%d", lomm.Size(), lomm.KeyCount())
+	}
+
+	collect := func(it interface {
+		IsValid() bool
+		Next()
+		Key() string
+		Value() int
+	}) string {
+		s := ""
+		for ; it.IsValid(); it.Next() {
+			s += fmt.Sprintf("%s%d ", it.Key(), it.Value())
+		}
+		return s
+	}
+	if s := collect(lomm.Iterator()); s != "a1 a3 a5 b0 b4 c2 " {
+		tt.Errorf("Iterator: %s", s)
+	}
+	if s := collect(lomm.EqualRange("a")); s != "a1 a3 a5 " {
+		tt.Errorf("EqualRange: %s", s)
+	}
+	if s := collect(lomm.EqualRange("x")); s != "" {
+		tt.Errorf("EqualRange of missing key: %s", s)
+	}
+	if s := collect(lomm.LinkedIterator()); s != "b0 a1 c2 a3 b4 a5 " {
+		tt.Errorf("LinkedIterator: %s", s)
+	}
+	if v := lomm.Get("b"); len(v) != 2 || v[0] != 0 || v[1] != 4 {
+		tt.Errorf("Get: %v", v)
+	}
+	if k := lomm.Keys(); len(k) != 3 || k[0] != "a" || k[2] != "c" {
+		tt.Errorf("Keys: %v", k)
+	}
+
+	if n := lomm.EraseIf("a", func(v int) bool { return v != 3 }); n != 2 {
+		tt.Errorf("EraseIf removed %d elements", n)
+	}
+	if s := collect(lomm.LinkedIterator()); s != "b0 c2 a3 b4 " {
+		tt.Errorf("LinkedIterator after EraseIf: %s", s)
+	}
+	it := lomm.EqualRange("b")
+	lomm.EraseByRangeIterator(it)
+	if !it.IsValid() || it.Value() != 4 || lomm.Count("b") != 1 {
+		tt.Error("EraseByRangeIterator should advance to the next element with the same key")
+	}
+	lomm.EraseByRangeIterator(it)
+	if it.IsValid() || lomm.Count("b") != 0 || lomm.KeyCount() != 2 {
+		tt.Error("Key should be removed with its last element")
+	}
+	if n := lomm.Erase("c"); n != 1 || lomm.Erase("c") != 0 {
+		tt.Errorf("Erase removed %d elements", n)
+	}
+	lit := lomm.LinkedIterator()
+	lomm.EraseByLinkedIterator(lit)
+	if lit.IsValid() || !lomm.Empty() || lomm.KeyCount() != 0 {
+		tt.Errorf("Map should be empty: %s", collect(lomm.LinkedIterator()))
+	}
+
+	lomm.Insert("z", 1)
+	lomm.Clear()
+	if !lomm.Empty() || lomm.LinkedIterator().IsValid() || lomm.Iterator().IsValid() {
+		tt.Error("Map should be empty after Clear")
+	}
+}
+
+func TestRandomOperations(tt *testing.T) {
+	lomm := New[int, int]()
+	expected := map[int][]int{}
+	var inserted [][2]int
+	for i := 0; i < 20000; i++ {
+		k := rand.Intn(500)
+		if rand.Intn(4) == 0 {
+			if n := lomm.Erase(k); n != len(expected[k]) {
+				tt.Fatalf("Erase(%d) = %d, expecting %d", k, n, len(expected[k]))
+			}
+			delete(expected, k)
+			continue
+		}
+		lomm.Insert(k, i)
+		expected[k] = append(expected[k], i)
+		inserted = append(inserted, [2]int{k, i})
+	}
+
+	keys := make([]int, 0, len(expected))
+	size := 0
+	for k, values := range expected {
+		keys = append(keys, k)
+		size += len(values)
+	}
+	sort.Ints(keys)
+	if lomm.Size() != size || lomm.KeyCount() != len(keys) {
+		tt.Fatalf("size=%d keys=%d, expecting %d %d", lomm.Size(), lomm.KeyCount(), size, len(keys))
+	}
+
+	it := lomm.Iterator()
+	for _, k := range keys {
+		for _, v := range expected[k] {
+			if !it.IsValid() || it.Key() != k || it.Value() != v {
+				tt.Fatalf("Iterator: expecting %d %d", k, v)
+			}
+			it.Next()
+		}
+	}
+	if it.IsValid() {
+		tt.Fatal("Iterator should be exhausted")
+	}
+
+	lit := lomm.LinkedIterator()
+	for _, kv := range inserted {
+		if values := expected[kv[0]]; len(values) == 0 || kv[1] < values[0] {
+			continue // Erased
+		}
+		if !lit.IsValid() || lit.Key() != kv[0] || lit.Value() != kv[1] {
+			tt.Fatalf("LinkedIterator: expecting %d %d", kv[0], kv[1])
+		}
+		lit.Next()
+	}
+	if lit.IsValid() {
+		tt.Fatal("LinkedIterator should be exhausted")
+	}
+}
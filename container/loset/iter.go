@@ -0,0 +1,94 @@
+//go:build go1.23
+
+/*
+ *
+ * loset - Linked Ordered Set, an ordered set that supports iteration in insertion order.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loset
+
+import (
+	"iter"
+
+	"golang.org/x/exp/constraints"
+)
+
+// FromSeq creates a new LinkedOrderedSet object and inserts the values yielded by `seq` into it in order.
+//
+// Example:
+//
+//	los := FromSeq(slices.Values([]int{3, 1, 2}))
+func FromSeq[K constraints.Ordered](seq iter.Seq[K]) *LinkedOrderedSet[K] {
+	m := New[K]()
+	m.InsertSeq(seq)
+	return m
+}
+
+// InsertSeq inserts the values yielded by `seq` into the LinkedOrderedSet in order. Values that already exist are skipped.
+//
+// Return value: number of values actually inserted.
+func (m *LinkedOrderedSet[K]) InsertSeq(seq iter.Seq[K]) (n int) {
+	for value := range seq {
+		if m.Insert(value) {
+			n++
+		}
+	}
+	return
+}
+
+// All returns an iterator over elements of the set in ascend order.
+// The set must not be modified during the iteration.
+//
+// Example:
+//
+//	for v := range los.All() {
+//		fmt.Println(v)
+//	}
+func (m *LinkedOrderedSet[K]) All() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for node := m.orderedHead; node != nil; node = node.orderedNext {
+			if !yield(node.k) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over elements of the set in descend order.
+// The set must not be modified during the iteration.
+func (m *LinkedOrderedSet[K]) Backward() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for node := m.orderedTail; node != nil; node = node.orderedPrev {
+			if !yield(node.k) {
+				return
+			}
+		}
+	}
+}
+
+// InsertionOrder returns an iterator over elements of the set in insertion order.
+// The set must not be modified during the iteration.
+func (m *LinkedOrderedSet[K]) InsertionOrder() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for node := m.head; node != nil; node = node.next {
+			if !yield(node.k) {
+				return
+			}
+		}
+	}
+}
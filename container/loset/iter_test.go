@@ -0,0 +1,56 @@
+//go:build go1.23
+
+/*
+ *
+ * loset - Linked Ordered Set, an ordered set that supports iteration in insertion order.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loset
+
+import (
+	"iter"
+	"slices"
+	"testing"
+)
+
+func TestIterSeq(tt *testing.T) {
+	los := FromSeq(slices.Values([]int{3, 1, 2, 1}))
+	if los.Size() != 3 {
+		tt.Fatalf("expecting size 3 but gets %d", los.Size())
+	}
+	if n := los.InsertSeq(slices.Values([]int{2, 4})); n != 1 {
+		tt.Errorf("expecting 1 insertion but gets %d", n)
+	}
+
+	cases := []struct {
+		seq  iter.Seq[int]
+		want []int
+	}{
+		{los.All(), []int{1, 2, 3, 4}},
+		{los.Backward(), []int{4, 3, 2, 1}},
+		{los.InsertionOrder(), []int{3, 1, 2, 4}},
+	}
+	for i, c := range cases {
+		if values := slices.Collect(c.seq); !slices.Equal(values, c.want) {
+			tt.Errorf("case %d: expecting %v but gets %v", i, c.want, values)
+		}
+		for range c.seq {
+			break // iteration should stop early without panicking
+		}
+	}
+}
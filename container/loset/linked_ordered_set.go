@@ -35,6 +35,8 @@ type LinkedOrderedSet[K constraints.Ordered] struct {
 	orderedHead *lrbtNode[K] // orderedHead and orderedTail forms an double linked list in ascend order
 	orderedTail *lrbtNode[K]
 	size        int // size of the set
+	maxSize     int // 0 means unlimited
+	onEvict     func(value K)
 }
 
 // New is the only way to get a new, ready-to-use LinkedOrderedSet object.
@@ -42,8 +44,64 @@ type LinkedOrderedSet[K constraints.Ordered] struct {
 // Example:
 //
 //	lom := New[int]()
-func New[K constraints.Ordered]() *LinkedOrderedSet[K] {
-	return &LinkedOrderedSet[K]{}
+//	window := New[string](WithMaxSize(10000)) // Keeps only the latest 10000 inserted elements
+func New[K constraints.Ordered](opts ...option) *LinkedOrderedSet[K] {
+	var o options
+	o.apply(opts...)
+	return &LinkedOrderedSet[K]{maxSize: o.maxSize}
+}
+
+// WithMaxSize limits the number of elements of the LinkedOrderedSet. Once it's exceeded by an insertion,
+// the front (earliest inserted) element is evicted, and the callback set by SetEvictCallback is called.
+// Combined with MoveToBack, the LinkedOrderedSet works as an LRU tracker, which is handy for deduplication windows:
+//
+//	seen := New[string](WithMaxSize(10000))
+//	if iter := seen.FindLinkedIterator(id); iter.IsValid() {
+//		seen.MoveToBack(iter) // Duplicate, mark it as recently seen
+//	} else {
+//		seen.Insert(id) // The least recently seen id is evicted if the set is full
+//	}
+//
+// `n` <= 0 means unlimited, which is the default.
+func WithMaxSize(n int) option {
+	return func(o *options) {
+		o.maxSize = n
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	maxSize int
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// SetEvictCallback sets a callback which is called with the evicted element whenever an element is evicted due to WithMaxSize.
+// `fn` must not modify the set.
+func (m *LinkedOrderedSet[K]) SetEvictCallback(fn func(value K)) {
+	m.onEvict = fn
+}
+
+// MaxSize returns the max number of elements set by WithMaxSize, 0 means unlimited.
+func (m *LinkedOrderedSet[K]) MaxSize() int {
+	return m.maxSize
+}
+
+// FromSlice creates a new LinkedOrderedSet object and inserts `values` into it in order.
+// Duplicate values are inserted only once.
+//
+// Example:
+//
+//	los := FromSlice([]int{3, 1, 2, 1})
+func FromSlice[K constraints.Ordered](values []K) *LinkedOrderedSet[K] {
+	m := New[K]()
+	m.InsertMany(values...)
+	return m
 }
 
 // Insert inserts a new element into the LinkedOrderedSet if it doesn't already exist.
@@ -53,7 +111,23 @@ func New[K constraints.Ordered]() *LinkedOrderedSet[K] {
 //
 // Return value: true if the insertion takes place and false otherwise.
 func (m *LinkedOrderedSet[K]) Insert(value K) bool {
-	return m.set(value)
+	if !m.set(value) {
+		return false
+	}
+	m.evict()
+	return true
+}
+
+// InsertMany inserts `values` into the LinkedOrderedSet in order. Values that already exist are skipped.
+//
+// Return value: number of values actually inserted.
+func (m *LinkedOrderedSet[K]) InsertMany(values ...K) (n int) {
+	for _, value := range values {
+		if m.Insert(value) {
+			n++
+		}
+	}
+	return
 }
 
 // Erase removes the element with the given value from the set.
@@ -147,6 +221,81 @@ func (m *LinkedOrderedSet[K]) Count(value K) int {
 	return 0
 }
 
+// Floor returns an iterator to the greatest element less than or equal to `value`.
+// If no such element exists, Iterator.IsValid() returns false.
+func (m *LinkedOrderedSet[K]) Floor(value K) *Iterator[K] {
+	var floor *lrbtNode[K]
+	node := m.root
+	for node != nil {
+		if value > node.k {
+			floor = node
+			node = node.right
+		} else if value < node.k {
+			node = node.left
+		} else {
+			return &Iterator[K]{node}
+		}
+	}
+	return &Iterator[K]{floor}
+}
+
+// Ceiling returns an iterator to the least element greater than or equal to `value`.
+// If no such element exists, Iterator.IsValid() returns false.
+func (m *LinkedOrderedSet[K]) Ceiling(value K) *Iterator[K] {
+	var ceiling *lrbtNode[K]
+	node := m.root
+	for node != nil {
+		if value > node.k {
+			node = node.right
+		} else if value < node.k {
+			ceiling = node
+			node = node.left
+		} else {
+			return &Iterator[K]{node}
+		}
+	}
+	return &Iterator[K]{ceiling}
+}
+
+// Range returns an iterator for iterating the elements within [from, to] in ascend order.
+// If `from` is greater than `to`, RangeIterator.IsValid() returns false immediately.
+func (m *LinkedOrderedSet[K]) Range(from, to K) *RangeIterator[K] {
+	it := &RangeIterator[K]{m.Ceiling(from).node, to}
+	if it.node != nil && it.node.k > to {
+		it.node = nil
+	}
+	return it
+}
+
+// ToSlice returns all elements of the set in ascend order.
+func (m *LinkedOrderedSet[K]) ToSlice() []K {
+	values := make([]K, 0, m.size)
+	for node := m.orderedHead; node != nil; node = node.orderedNext {
+		values = append(values, node.k)
+	}
+	return values
+}
+
+// ToLinkedSlice returns all elements of the set in insertion order.
+func (m *LinkedOrderedSet[K]) ToLinkedSlice() []K {
+	values := make([]K, 0, m.size)
+	for node := m.head; node != nil; node = node.next {
+		values = append(values, node.k)
+	}
+	return values
+}
+
+// evict erases front elements until the size limit is no longer exceeded
+func (m *LinkedOrderedSet[K]) evict() {
+	for m.maxSize > 0 && m.size > m.maxSize {
+		value := m.head.k
+		m.erase(m.head)
+		if m.onEvict != nil {
+			m.onEvict(value)
+		}
+	}
+}
+
 // set inserts a new node into the LinkedOrderedSet or updates the existing node with the new value.
 func (m *LinkedOrderedSet[K]) set(key K) bool {
 	newNode := &lrbtNode[K]{k: key}
@@ -561,6 +710,31 @@ func (it *Iterator[K]) Value() K {
 	return it.node.k
 }
 
+// RangeIterator is used for iterating a range of elements of the LinkedOrderedSet in ascend order.
+type RangeIterator[K constraints.Ordered] struct {
+	node *lrbtNode[K]
+	to   K
+}
+
+// IsValid returns true if the iterator is valid for use, false otherwise.
+// We must not call Next, Key, or Value if IsValid returns false.
+func (it *RangeIterator[K]) IsValid() bool {
+	return it.node != nil
+}
+
+// Next advances the iterator to the next element of the range
+func (it *RangeIterator[K]) Next() {
+	it.node = it.node.orderedNext
+	if it.node != nil && it.node.k > it.to {
+		it.node = nil
+	}
+}
+
+// Value returns the value of the underlying element
+func (it *RangeIterator[K]) Value() K {
+	return it.node.k
+}
+
 // ReverseIterator is used for iterating the LinkedOrderedSet in reverse order.
 type ReverseIterator[K constraints.Ordered] struct {
 	node *lrbtNode[K]
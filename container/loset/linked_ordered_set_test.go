@@ -231,3 +231,39 @@ func verifySortedOrder(msg string, rbt *LinkedOrderedSet[int], insertedNums sort
 
 	return true
 }
+
+func TestMaxSize(tt *testing.T) {
+	los := New[int](WithMaxSize(3))
+	var evicted []int
+	los.SetEvictCallback(func(value int) {
+		evicted = append(evicted, value)
+	})
+
+	los.InsertMany(5, 1, 3)
+	if len(evicted) != 0 || los.Size() != 3 || los.MaxSize() != 3 {
+		tt.Fatalf("Nothing should be evicted before the limit is exceeded. evicted=%v size=%d", evicted, los.Size())
+	}
+	los.MoveToBack(los.FindLinkedIterator(5)) // 1, 3, 5
+	if los.Insert(3) || len(evicted) != 0 {
+		tt.Fatal("Inserting an existing element should not evict anything")
+	}
+	los.Insert(4) // 3, 5, 4
+	los.Insert(2) // 5, 4, 2
+	if len(evicted) != 2 || evicted[0] != 1 || evicted[1] != 3 {
+		tt.Errorf("Unexpected evicted elements: %v", evicted)
+	}
+	if s := los.ToLinkedSlice(); len(s) != 3 || s[0] != 5 || s[1] != 4 || s[2] != 2 {
+		tt.Errorf("Unexpected elements: %v", s)
+	}
+	if s := los.ToSlice(); len(s) != 3 || s[0] != 2 || s[2] != 5 {
+		tt.Errorf("Unexpected ordered elements: %v", s)
+	}
+
+	unlimited := New[int]()
+	for i := 0; i < 100; i++ {
+		unlimited.Insert(i)
+	}
+	if unlimited.Size() != 100 {
+		tt.Errorf("Size should be unlimited by default, but is %d", unlimited.Size())
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ *
+ * loset - Linked Ordered Set, an ordered set that supports iteration in insertion order.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loset
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEncodeDecode(tt *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 7, 8, 100, 1000} {
+		src := New[int]()
+		for src.Size() < n {
+			src.Insert(rand.Intn(n * 10))
+		}
+
+		var buf bytes.Buffer
+		if err := src.Encode(&buf); err != nil {
+			tt.Fatalf("n=%d: Encode failed: %v", n, err)
+		}
+		dst := FromSlice([]int{-1})
+		if err := dst.Decode(&buf); err != nil {
+			tt.Fatalf("n=%d: Decode failed: %v", n, err)
+		}
+		verifyDecoded(tt, n, src, dst)
+
+		// The rebuilt tree must keep working
+		for i := 0; i < n; i++ {
+			v := rand.Intn(n * 10)
+			src.Erase(v)
+			dst.Erase(v)
+			src.Insert(v + 1)
+			dst.Insert(v + 1)
+		}
+		verifyDecoded(tt, n, src, dst)
+	}
+
+	var buf bytes.Buffer
+	if err := FromSlice([]string{"b", "a"}).EncodeWith(json.NewEncoder(&buf)); err != nil {
+		tt.Fatal(err)
+	}
+	dst := New[string]()
+	if err := dst.DecodeWith(json.NewDecoder(&buf)); err != nil {
+		tt.Fatal(err)
+	}
+	if values := dst.ToLinkedSlice(); len(values) != 2 || values[0] != "b" || values[1] != "a" {
+		tt.Errorf("unexpected result decoded from json: %v", values)
+	}
+
+	buf.Reset()
+	enc := json.NewEncoder(&buf)
+	for _, v := range []int{kEncodingVersion, 2, 3, 1, 0, 1} { // not in ascend order
+		enc.Encode(v)
+	}
+	if err := dst.DecodeWith(json.NewDecoder(&buf)); err == nil || dst.Size() != 2 {
+		tt.Errorf("corrupted snapshot should be rejected without modifying the set: %v", err)
+	}
+}
+
+func verifyDecoded(tt *testing.T, n int, src, dst *LinkedOrderedSet[int]) {
+	sorted, linked := src.ToSlice(), src.ToLinkedSlice()
+	dstSorted, dstLinked := dst.ToSlice(), dst.ToLinkedSlice()
+	if len(dstSorted) != len(sorted) || len(dstLinked) != len(linked) || dst.Size() != src.Size() {
+		tt.Fatalf("n=%d: size mismatch", n)
+	}
+	for i := range sorted {
+		if sorted[i] != dstSorted[i] || linked[i] != dstLinked[i] {
+			tt.Fatalf("n=%d: order mismatch at %d", n, i)
+		}
+	}
+	if dst.root != nil && (!dst.root.isBlack || dst.root.parent != nil) {
+		tt.Fatalf("n=%d: invalid root", n)
+	}
+	if _, ok := blackHeight(dst.root); !ok {
+		tt.Fatalf("n=%d: red-black tree properties violated", n)
+	}
+}
+
+func blackHeight(node *lrbtNode[int]) (int, bool) {
+	if node == nil {
+		return 1, true
+	}
+	if !node.isBlack && (!node.left.isBlackNode() || !node.right.isBlackNode()) {
+		return 0, false
+	}
+	if (node.left != nil && (node.left.parent != node || !node.left.isLeftChild())) ||
+		(node.right != nil && (node.right.parent != node || !node.right.isRightChild())) {
+		return 0, false
+	}
+	lh, lok := blackHeight(node.left)
+	rh, rok := blackHeight(node.right)
+	if !lok || !rok || lh != rh {
+		return 0, false
+	}
+	if node.isBlack {
+		lh++
+	}
+	return lh, true
+}
+
+func TestDecodeHugeSize(tt *testing.T) {
+	for _, size := range []int{1 << 40, math.MaxInt} {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		enc.Encode(kEncodingVersion)
+		enc.Encode(size)
+		enc.Encode(1) // Truncated after the first element
+
+		m := New[int]()
+		m.Insert(1)
+		if err := m.Decode(&buf); err == nil {
+			tt.Errorf("size=%d: Decode should fail", size)
+		}
+		if m.Size() != 1 {
+			tt.Errorf("size=%d: set should be left unchanged", size)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ *
+ * loset - Linked Ordered Set, an ordered set that supports iteration in insertion order.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loset
+
+import "testing"
+
+func TestFloorCeilingRange(tt *testing.T) {
+	los := New[int]()
+	for _, v := range []int{50, 10, 40, 20, 30} {
+		los.Insert(v)
+	}
+
+	cases := []struct {
+		value          int
+		floor, ceiling int // -1 means not found
+	}{
+		{5, -1, 10},
+		{10, 10, 10},
+		{25, 20, 30},
+		{50, 50, 50},
+		{55, 50, -1},
+	}
+	for _, c := range cases {
+		if it := los.Floor(c.value); (c.floor == -1 && it.IsValid()) || (c.floor != -1 && (!it.IsValid() || it.Value() != c.floor)) {
+			tt.Errorf("Floor(%d): expecting %d", c.value, c.floor)
+		}
+		if it := los.Ceiling(c.value); (c.ceiling == -1 && it.IsValid()) || (c.ceiling != -1 && (!it.IsValid() || it.Value() != c.ceiling)) {
+			tt.Errorf("Ceiling(%d): expecting %d", c.value, c.ceiling)
+		}
+	}
+
+	collect := func(from, to int) (values []int) {
+		for it := los.Range(from, to); it.IsValid(); it.Next() {
+			values = append(values, it.Value())
+		}
+		return
+	}
+	if values := collect(15, 40); len(values) != 3 || values[0] != 20 || values[1] != 30 || values[2] != 40 {
+		tt.Errorf("Range(15, 40): unexpected result %v", values)
+	}
+	if values := collect(0, 100); len(values) != 5 {
+		tt.Errorf("Range(0, 100): unexpected result %v", values)
+	}
+	if values := collect(41, 49); len(values) != 0 {
+		tt.Errorf("Range(41, 49): unexpected result %v", values)
+	}
+	if values := collect(40, 20); len(values) != 0 {
+		tt.Errorf("Range(40, 20): unexpected result %v", values)
+	}
+}
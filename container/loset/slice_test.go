@@ -0,0 +1,39 @@
+/*
+ *
+ * loset - Linked Ordered Set, an ordered set that supports iteration in insertion order.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package loset
+
+import "testing"
+
+func TestSliceConversion(tt *testing.T) {
+	los := FromSlice([]int{3, 1, 2, 1})
+	if n := los.InsertMany(2, 5, 4); n != 2 {
+		tt.Errorf("expecting 2 insertions but gets %d", n)
+	}
+
+	sorted := los.ToSlice()
+	linked := los.ToLinkedSlice()
+	if len(sorted) != 5 || sorted[0] != 1 || sorted[2] != 3 || sorted[4] != 5 {
+		tt.Errorf("unexpected sorted slice %v", sorted)
+	}
+	if len(linked) != 5 || linked[0] != 3 || linked[2] != 2 || linked[4] != 4 {
+		tt.Errorf("unexpected linked slice %v", linked)
+	}
+}
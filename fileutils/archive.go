@@ -0,0 +1,502 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package fileutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveProgress is called by TarGz, UnTarGz, Zip and Unzip after each entry is archived or extracted,
+// with the name of the entry in the archive and the total bytes of file contents processed so far.
+type ArchiveProgress func(name string, bytes int64)
+
+// WithArchiveProgress sets a callback to report progress of archiving and extracting.
+func WithArchiveProgress(fn ArchiveProgress) archiveOption {
+	return func(o *archiveOptions) {
+		o.progress = fn
+	}
+}
+
+// TarGz archives directory `srcDir` recursively into a gzipped tarball `dstFile`. Names of the entries are relative to `srcDir`.
+// Symbolic links are archived as they are. Other files than regular files, directories and symbolic links are not supported.
+func TarGz(srcDir, dstFile string, opts ...archiveOption) (err error) {
+	a := newArchiver(opts)
+	f, err := os.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer closeOnExit(f, &err)
+
+	gw := gzip.NewWriter(f)
+	defer closeOnExit(gw, &err)
+	tw := tar.NewWriter(gw)
+	defer closeOnExit(tw, &err)
+
+	return a.walk(srcDir, func(path, name string, info fs.FileInfo) error {
+		var link string
+		var err error
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			return a.copyFrom(tw, path)
+		}
+		return nil
+	})
+}
+
+// UnTarGz extracts gzipped tarball `srcFile` into directory `dstDir`.
+// Entries that would be extracted out of `dstDir`, including symbolic and hard links pointing out of `dstDir`, are rejected.
+func UnTarGz(srcFile, dstDir string, opts ...archiveOption) error {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	x, err := newExtractor(dstDir, opts)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		path, err := x.target(hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := fs.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(path, hdr.Name, mode)
+		case tar.TypeReg:
+			err = x.writeFile(path, hdr.Name, mode, tr)
+		case tar.TypeSymlink:
+			err = x.addSymlink(path, hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			var oldname string
+			if oldname, err = x.target(hdr.Linkname); err == nil {
+				x.links = append(x.links, link{path: path, name: hdr.Name, target: oldname, hard: true})
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			err = fmt.Errorf("%s: unsupported entry type %c", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.finish()
+}
+
+// Zip archives directory `srcDir` recursively into zip file `dstFile`. Names of the entries are relative to `srcDir`.
+// Symbolic links are archived as they are. Other files than regular files, directories and symbolic links are not supported.
+func Zip(srcDir, dstFile string, opts ...archiveOption) (err error) {
+	a := newArchiver(opts)
+	f, err := os.Create(dstFile)
+	if err != nil {
+		return err
+	}
+	defer closeOnExit(f, &err)
+
+	zw := zip.NewWriter(f)
+	defer closeOnExit(zw, &err)
+
+	return a.walk(srcDir, func(path, name string, info fs.FileInfo) error {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		} else if info.Mode().IsRegular() {
+			hdr.Method = zip.Deflate
+		}
+
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode().IsRegular():
+			return a.copyFrom(w, path)
+		case info.Mode()&fs.ModeSymlink != 0: // Target of the link is stored as the content
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, link)
+			return err
+		}
+		return nil
+	})
+}
+
+// Unzip extracts zip file `srcFile` into directory `dstDir`.
+// Entries that would be extracted out of `dstDir`, including symbolic links pointing out of `dstDir`, are rejected.
+func Unzip(srcFile, dstDir string, opts ...archiveOption) error {
+	zr, err := zip.OpenReader(srcFile)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	x, err := newExtractor(dstDir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		path, err := x.target(f.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(path, f.Name, mode.Perm())
+		case mode.IsRegular():
+			err = x.extractZipFile(f, path)
+		case mode&fs.ModeSymlink != 0:
+			err = x.extractZipLink(f, path)
+		default:
+			err = fmt.Errorf("%s: unsupported entry type %s", f.Name, mode.Type())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.finish()
+}
+
+type archiveOption func(opts *archiveOptions)
+
+type archiveOptions struct {
+	progress ArchiveProgress
+}
+
+func (o *archiveOptions) apply(opts ...archiveOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// archiver walks the source directory and reports progress for TarGz and Zip
+type archiver struct {
+	opts  archiveOptions
+	bytes int64
+}
+
+func newArchiver(opts []archiveOption) *archiver {
+	a := &archiver{}
+	a.opts.apply(opts...)
+	return a
+}
+
+// walk calls `fn` for each entry under `srcDir` in lexical order, with its path, its name in the archive and its FileInfo
+func (a *archiver) walk(srcDir string, fn func(path, name string, info fs.FileInfo) error) error {
+	info, err := os.Stat(srcDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", srcDir)
+	}
+
+	return filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == srcDir {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			return fmt.Errorf("%s: unsupported file type %s", path, info.Mode().Type())
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if err = fn(path, name, info); err != nil {
+			return err
+		}
+		a.report(name)
+		return nil
+	})
+}
+
+func (a *archiver) copyFrom(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(w, f)
+	a.bytes += n
+	return err
+}
+
+func (a *archiver) report(name string) {
+	if a.opts.progress != nil {
+		a.opts.progress(name, a.bytes)
+	}
+}
+
+// link is a symbolic or hard link to be created after all the other entries are extracted
+type link struct {
+	path   string
+	name   string // Name of the entry in the archive
+	target string
+	hard   bool
+}
+
+// extractor writes entries into the destination directory for UnTarGz and Unzip.
+// Links are created after all the other entries, so that nothing is written through the links.
+type extractor struct {
+	archiver
+	dir   string // Absolute path of the destination directory
+	links []link
+}
+
+func newExtractor(dstDir string, opts []archiveOption) (*extractor, error) {
+	err := os.MkdirAll(dstDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := realPath(dstDir)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &extractor{dir: dir}
+	x.opts.apply(opts...)
+	return x, nil
+}
+
+// target returns the path to extract entry `name` to. It's rejected if the path is out of the destination directory.
+func (x *extractor) target(name string) (string, error) {
+	rel := filepath.FromSlash(name)
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", fmt.Errorf("%s: absolute path not allowed", name)
+	}
+
+	path := filepath.Join(x.dir, rel)
+	if !x.contains(path) {
+		return "", fmt.Errorf("%s: path out of the destination directory", name)
+	}
+	return path, nil
+}
+
+// contains checks if `path` is `x.dir` or under it
+func (x *extractor) contains(path string) bool {
+	rel, err := filepath.Rel(x.dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (x *extractor) mkdir(path, name string, mode fs.FileMode) error {
+	err := os.MkdirAll(path, mode|0700)
+	if err == nil {
+		x.report(name)
+	}
+	return err
+}
+
+func (x *extractor) writeFile(path, name string, mode fs.FileMode, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(f, r)
+	x.bytes += n
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		x.report(name)
+	}
+	return err
+}
+
+// addSymlink validates the symbolic link `path` -> `target`, and delays its creation
+func (x *extractor) addSymlink(path, name, target string) error {
+	if filepath.IsAbs(target) || !x.contains(filepath.Join(filepath.Dir(path), target)) {
+		return fmt.Errorf("%s: symbolic link to %s is out of the destination directory", name, target)
+	}
+	x.links = append(x.links, link{path: path, name: name, target: target})
+	return nil
+}
+
+func (x *extractor) extractZipFile(f *zip.File, path string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return x.writeFile(path, f.Name, f.Mode().Perm(), r)
+}
+
+func (x *extractor) extractZipLink(f *zip.File, path string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	target, err := io.ReadAll(io.LimitReader(r, 4096))
+	if err != nil {
+		return err
+	}
+	return x.addSymlink(path, f.Name, string(target))
+}
+
+// finish creates the links in archive order. Hard links are rejected if their targets are reached through symbolic links
+// leading out of the destination directory, and symbolic links are checked right after each link is created, so that
+// a link never leads out of the destination directory through links created before or after it.
+// On error, all the links created are removed.
+func (x *extractor) finish() (err error) {
+	var created []link
+	defer func() {
+		if err != nil {
+			for i := len(created) - 1; i >= 0; i-- {
+				os.Remove(created[i].path)
+			}
+		}
+	}()
+
+	for _, l := range x.links {
+		if err = os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+			return err
+		}
+		if err = x.checkParent(l.path, l.name); err != nil {
+			return err
+		}
+		if fi, e := os.Lstat(l.path); e == nil && !fi.IsDir() {
+			if err = os.Remove(l.path); err != nil {
+				return err
+			}
+		}
+
+		if l.hard {
+			if err = x.checkParent(l.target, l.name); err != nil {
+				return err
+			}
+			err = os.Link(l.target, l.path)
+		} else {
+			err = os.Symlink(l.target, l.path)
+		}
+		if err != nil {
+			return err
+		}
+		created = append(created, l)
+
+		if err = x.checkSymlinks(created); err != nil {
+			return err
+		}
+		x.report(l.name)
+	}
+	return nil
+}
+
+// checkParent checks that the parent directory of `path` doesn't lead out of the destination directory
+func (x *extractor) checkParent(path, name string) error {
+	real, err := realPath(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if !x.contains(real) {
+		return fmt.Errorf("%s: path leads out of the destination directory", name)
+	}
+	return nil
+}
+
+// checkSymlinks checks that none of the symbolic links in `links` leads out of the destination directory.
+// Hard links are checked too, as a hard link to a symbolic link is a symbolic link.
+func (x *extractor) checkSymlinks(links []link) error {
+	for _, l := range links {
+		if fi, err := os.Lstat(l.path); err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if real, err := realPath(l.path); err == nil && !x.contains(real) {
+			return fmt.Errorf("%s: symbolic link leads out of the destination directory", l.name)
+		}
+	}
+	return nil
+}
+
+// closeOnExit closes `c`, and saves the error into `err` if no other error occurred
+func closeOnExit(c io.Closer, err *error) {
+	if e := c.Close(); *err == nil {
+		*err = e
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package fileutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "logs/old"), 0755)
+	os.WriteFile(filepath.Join(src, "app.yaml"), []byte("port: 80"), 0600)
+	os.WriteFile(filepath.Join(src, "logs/old/app.log"), []byte("line1\nline2\n"), 0644)
+	os.Symlink("old/app.log", filepath.Join(src, "logs/latest"))
+
+	for _, fns := range []struct {
+		name    string
+		archive func(srcDir, dstFile string, opts ...archiveOption) error
+		extract func(srcFile, dstDir string, opts ...archiveOption) error
+	}{{"tar.gz", TarGz, UnTarGz}, {"zip", Zip, Unzip}} {
+		var names []string
+		var total int64
+		progress := WithArchiveProgress(func(name string, bytes int64) {
+			names = append(names, name)
+			total = bytes
+		})
+
+		file := filepath.Join(t.TempDir(), "bundle."+fns.name)
+		if err := fns.archive(src, file, progress); err != nil {
+			t.Fatalf("%s: %v", fns.name, err)
+		}
+		if strings.Join(names, ",") != "app.yaml,logs,logs/latest,logs/old,logs/old/app.log" || total != 20 {
+			t.Errorf("%s: unexpected progress: %v %d", fns.name, names, total)
+		}
+
+		names = nil
+		dst := t.TempDir()
+		if err := fns.extract(file, dst, progress); err != nil {
+			t.Fatalf("%s: %v", fns.name, err)
+		}
+		if len(names) != 5 || total != 20 {
+			t.Errorf("%s: unexpected progress: %v %d", fns.name, names, total)
+		}
+		if cont, _ := os.ReadFile(filepath.Join(dst, "logs/latest")); string(cont) != "line1\nline2\n" {
+			t.Errorf("%s: unexpected content of logs/latest: %q", fns.name, cont)
+		}
+		if fi, _ := os.Stat(filepath.Join(dst, "app.yaml")); fi == nil || fi.Mode().Perm() != 0600 {
+			t.Errorf("%s: unexpected app.yaml: %v", fns.name, fi)
+		}
+	}
+}
+
+func TestExtractTraversal(t *testing.T) {
+	type entry struct {
+		name, link string
+	}
+	cases := [][]entry{
+		{{name: "../evil"}},
+		{{name: "/etc/evil"}},
+		{{name: "a/../../evil"}},
+		{{name: "l", link: "../.."}},
+		{{name: "l", link: "/etc"}},
+		{{name: "y", link: "."}, {name: "x", link: "y/.."}},
+		{{name: "x", link: "y/.."}, {name: "y", link: "."}},
+	}
+
+	for i, entries := range cases {
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "dst")
+
+		tgz := filepath.Join(dir, "evil.tar.gz")
+		f, _ := os.Create(tgz)
+		gw := gzip.NewWriter(f)
+		tw := tar.NewWriter(gw)
+		for _, e := range entries {
+			if e.link == "" {
+				tw.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+				tw.Write([]byte("evil"))
+			} else {
+				tw.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeSymlink, Linkname: e.link, Mode: 0777})
+			}
+		}
+		tw.Close()
+		gw.Close()
+		f.Close()
+		if err := UnTarGz(tgz, dst); err == nil {
+			t.Errorf("UnTarGz: case %d should be rejected", i)
+		}
+
+		zf := filepath.Join(dir, "evil.zip")
+		f, _ = os.Create(zf)
+		zw := zip.NewWriter(f)
+		for _, e := range entries {
+			hdr := &zip.FileHeader{Name: e.name}
+			hdr.SetMode(0644)
+			cont := "evil"
+			if e.link != "" {
+				hdr.SetMode(os.ModeSymlink | 0777)
+				cont = e.link
+			}
+			w, _ := zw.CreateHeader(hdr)
+			w.Write([]byte(cont))
+		}
+		zw.Close()
+		f.Close()
+		if err := Unzip(zf, dst); err == nil {
+			t.Errorf("Unzip: case %d should be rejected", i)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+			t.Errorf("case %d: file written out of the destination directory", i)
+		}
+	}
+}
+
+func TestExtractLinkEscape(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+	secret := filepath.Join(dir, "secret.txt")
+	os.WriteFile(secret, []byte("secret"), 0600)
+
+	// d/e is created as dst/e through d, and leads to the parent of dst. h would be a hard link to secret.txt through d/e
+	tgz := filepath.Join(dir, "evil.tar.gz")
+	f, _ := os.Create(tgz)
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "keep", Typeflag: tar.TypeSymlink, Linkname: "d", Mode: 0777})
+	tw.WriteHeader(&tar.Header{Name: "d", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0777})
+	tw.WriteHeader(&tar.Header{Name: "d/e", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777})
+	tw.WriteHeader(&tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "d/e/secret.txt", Mode: 0644})
+	tw.Close()
+	gw.Close()
+	f.Close()
+
+	if err := UnTarGz(tgz, dst); err == nil {
+		t.Fatal("UnTarGz should reject links leading out of the destination directory")
+	}
+	if fi, err := os.Lstat(filepath.Join(dst, "h")); err == nil {
+		if sfi, _ := os.Stat(secret); os.SameFile(fi, sfi) {
+			t.Fatal("h is hard linked to a file out of the destination directory")
+		}
+		t.Error("h should not be created")
+	}
+	for _, name := range []string{"keep", "d", "e"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("Link %s should be removed on error: %v", name, err)
+		}
+	}
+
+	// A hard link whose target is reached through a symbolic link out of the destination directory is rejected
+	// even if the symbolic link itself isn't created by the archive
+	os.Symlink("..", filepath.Join(dst, "up"))
+	f, _ = os.Create(tgz)
+	gw = gzip.NewWriter(f)
+	tw = tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "up/secret.txt", Mode: 0644})
+	tw.Close()
+	gw.Close()
+	f.Close()
+	if err := UnTarGz(tgz, dst); err == nil {
+		t.Error("UnTarGz should reject hard links to files out of the destination directory")
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "h")); !os.IsNotExist(err) {
+		t.Errorf("h should not be created: %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package fileutils
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CopyFilter is called by CopyDirectory for each file or directory under the source directory, with the source path.
+// Entries for which it returns false are not copied, nor are the files under them.
+type CopyFilter func(path string, entry fs.DirEntry) bool
+
+// WithCopySymlinks makes CopyDirectory copy symbolic links as they are, instead of copying the files they point to.
+func WithCopySymlinks() copyOption {
+	return func(o *copyOptions) {
+		o.symlinks = true
+	}
+}
+
+// WithCopyMode makes CopyDirectory preserve the mode of the source files and directories, including setuid, setgid
+// and sticky bits, regardless of umask.
+func WithCopyMode() copyOption {
+	return func(o *copyOptions) {
+		o.mode = true
+	}
+}
+
+// WithCopyModTime makes CopyDirectory preserve the modification time of the source files and directories.
+// Times of symbolic links copied by WithCopySymlinks are not preserved.
+func WithCopyModTime() copyOption {
+	return func(o *copyOptions) {
+		o.modTime = true
+	}
+}
+
+// WithCopyOwner makes CopyDirectory preserve the owner and group of the source files, directories and symbolic links.
+// It usually requires root privilege. It does nothing on Windows.
+func WithCopyOwner() copyOption {
+	return func(o *copyOptions) {
+		o.owner = true
+	}
+}
+
+// WithCopyFilter sets a filter to decide which files and directories to copy.
+func WithCopyFilter(filter CopyFilter) copyOption {
+	return func(o *copyOptions) {
+		o.filter = filter
+	}
+}
+
+// WithCopyDryRun makes CopyDirectory walk the source directory without writing anything.
+// `fn` is called with the source and destination paths of each file or directory that would be copied. It could be nil.
+func WithCopyDryRun(fn func(src, dst string)) copyOption {
+	return func(o *copyOptions) {
+		o.dryRun = true
+		o.report = fn
+	}
+}
+
+type copyOption func(opts *copyOptions)
+
+type copyOptions struct {
+	symlinks bool
+	mode     bool
+	modTime  bool
+	owner    bool
+	filter   CopyFilter
+	dryRun   bool
+	report   func(src, dst string)
+}
+
+func (o *copyOptions) apply(opts ...copyOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+type copier struct {
+	opts copyOptions
+}
+
+// copyDir copies directory `src` to `dst` recursively, `wd` holds the real path of `src`
+func (c *copier) copyDir(src, dst string, info fs.FileInfo, wd *dirNode) error {
+	if c.visit(src, dst) {
+		err := os.MkdirAll(dst, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		srcPath := filepath.Join(src, entry.Name())
+		dstPath := filepath.Join(dst, entry.Name())
+		if c.opts.filter != nil && !c.opts.filter(srcPath, entry) {
+			continue
+		}
+
+		switch {
+		case entry.IsDir():
+			fi, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			err = c.copyDir(srcPath, dstPath, fi, &dirNode{real: filepath.Join(wd.real, entry.Name()), parent: wd})
+			if err != nil {
+				return err
+			}
+		case entry.Type()&fs.ModeSymlink != 0:
+			err = c.copyLink(srcPath, dstPath, entry, wd)
+			if err != nil {
+				return err
+			}
+		case entry.Type().IsRegular():
+			fi, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			err = c.copyFile(srcPath, dstPath, fi)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unsupported file type %s", srcPath, entry.Type())
+		}
+	}
+
+	// Attributes of directories are set after their contents are copied, otherwise the modification time would be changed
+	return c.setAttrs(dst, info)
+}
+
+// copyLink copies the symbolic link `src`, or the file or directory it points to
+func (c *copier) copyLink(src, dst string, entry fs.DirEntry, wd *dirNode) error {
+	if c.opts.symlinks {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if !c.visit(src, dst) {
+			return nil
+		}
+
+		if fi, err := os.Lstat(dst); err == nil && !fi.IsDir() {
+			if err = os.Remove(dst); err != nil {
+				return err
+			}
+		}
+		err = os.Symlink(target, dst)
+		if err != nil {
+			return err
+		}
+
+		if c.opts.owner {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			return lchown(dst, info)
+		}
+		return nil
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return c.copyFile(src, dst, info)
+	}
+
+	sub, ok := subdir(src, wd, entry)
+	if !ok {
+		return fmt.Errorf("%s: symbolic link leads to a cycle", src)
+	}
+	return c.copyDir(src, dst, info, sub)
+}
+
+func (c *copier) copyFile(src, dst string, info fs.FileInfo) error {
+	if !c.visit(src, dst) {
+		return nil
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dstFile, srcFile)
+	if e := dstFile.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.setAttrs(dst, info)
+}
+
+// visit reports `src` and `dst` in dry-run mode. It returns false if nothing should be written
+func (c *copier) visit(src, dst string) bool {
+	if !c.opts.dryRun {
+		return true
+	}
+	if c.opts.report != nil {
+		c.opts.report(src, dst)
+	}
+	return false
+}
+
+// setAttrs sets owner, mode and modification time of `path` according to `info`.
+// Owner is set first, because changing owner may clear setuid and setgid bits
+func (c *copier) setAttrs(path string, info fs.FileInfo) error {
+	if c.opts.dryRun {
+		return nil
+	}
+
+	if c.opts.owner {
+		if err := lchown(path, info); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.mode {
+		err := os.Chmod(path, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.opts.modTime {
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
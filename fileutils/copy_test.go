@@ -0,0 +1,106 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package fileutils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyDirectory(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	os.MkdirAll(filepath.Join(src, "a/b"), 0750)
+	os.MkdirAll(filepath.Join(src, ".git"), 0755)
+	os.WriteFile(filepath.Join(src, "f1"), []byte("f1"), 0600)
+	os.WriteFile(filepath.Join(src, "a/b/f2"), []byte("f2"), 0644)
+	os.WriteFile(filepath.Join(src, ".git/HEAD"), []byte("head"), 0644)
+	os.Symlink("f1", filepath.Join(src, "lf"))
+	os.Symlink("a", filepath.Join(src, "ld"))
+	os.Symlink("..", filepath.Join(src, "a/up")) // cycle
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(filepath.Join(src, "f1"), mtime, mtime)
+	os.Chtimes(filepath.Join(src, "a"), mtime, mtime)
+	skipGit := WithCopyFilter(func(path string, entry fs.DirEntry) bool {
+		return entry.Name() != ".git"
+	})
+
+	// Symbolic links are followed by default
+	dst := filepath.Join(t.TempDir(), "dst")
+	err := CopyDirectory(src, dst, WithCopyFilter(func(path string, entry fs.DirEntry) bool {
+		return entry.Name() != ".git" && entry.Name() != "up"
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cont, _ := os.ReadFile(filepath.Join(dst, "ld/b/f2")); string(cont) != "f2" {
+		t.Errorf("Unexpected content of ld/b/f2: %q", cont)
+	}
+	if fi, _ := os.Lstat(filepath.Join(dst, "lf")); fi == nil || !fi.Mode().IsRegular() || fi.Mode().Perm() != 0600 {
+		t.Errorf("Unexpected lf: %v", fi)
+	}
+	if _, err = os.Stat(filepath.Join(dst, ".git")); !os.IsNotExist(err) {
+		t.Errorf(".git should be filtered: %v", err)
+	}
+	if err = CopyDirectory(src, t.TempDir(), skipGit); err == nil {
+		t.Error("Cycle should be reported")
+	}
+
+	// Preserve symbolic links, mode, modification time and owner
+	dst = filepath.Join(t.TempDir(), "dst")
+	err = CopyDirectory(src, dst, WithCopySymlinks(), WithCopyMode(), WithCopyModTime(), WithCopyOwner(), skipGit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := os.Readlink(filepath.Join(dst, "a/up")); target != ".." {
+		t.Errorf("Unexpected target of a/up: %q", target)
+	}
+	if target, _ := os.Readlink(filepath.Join(dst, "lf")); target != "f1" {
+		t.Errorf("Unexpected target of lf: %q", target)
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "a")); fi == nil || fi.Mode().Perm() != 0750 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("Unexpected a: %v", fi)
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "f1")); fi == nil || fi.Mode().Perm() != 0600 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("Unexpected f1: %v", fi)
+	}
+
+	// Dry run
+	dst = filepath.Join(t.TempDir(), "dst")
+	var paths []string
+	err = CopyDirectory(src, dst, WithCopySymlinks(), skipGit, WithCopyDryRun(func(s, d string) {
+		rel, _ := filepath.Rel(dst, d)
+		paths = append(paths, rel)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != ".,a,a/b,a/b/f2,a/up,f1,ld,lf" {
+		t.Errorf("Unexpected paths: %v", paths)
+	}
+	if _, err = os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("Nothing should be written in dry-run mode: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package fileutils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// DiskUsage returns the free and total bytes of the file system holding `path`. It's not supported on this platform.
+func DiskUsage(path string) (free, total uint64, err error) {
+	return 0, 0, fmt.Errorf("DiskUsage is not supported on %s", runtime.GOOS)
+}
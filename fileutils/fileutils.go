@@ -22,14 +22,27 @@
 package fileutils
 
 import (
+	"bytes"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 )
 
 // CopyDirectory copies a directory from src to dst recursively.
-func CopyDirectory(src, dst string) error {
+//
+// By default, symbolic links are followed, and files are created with the permission bits of the source files subject to umask.
+// Options could be used to copy symbolic links as they are, to preserve mode, modification time and owner of the source files,
+// to filter the files to copy, or to do a dry run.
+//
+// Example:
+//
+//	err := fileutils.CopyDirectory("/data/app", "/backup/app", fileutils.WithCopySymlinks(), fileutils.WithCopyMode(),
+//		fileutils.WithCopyFilter(func(path string, entry fs.DirEntry) bool {
+//			return entry.Name() != ".git"
+//		}))
+func CopyDirectory(src, dst string, opts ...copyOption) error {
 	srcFileInfo, err := os.Stat(src)
 	if err != nil {
 		return err
@@ -39,43 +52,14 @@ func CopyDirectory(src, dst string) error {
 		return fmt.Errorf("%s is not a directory", src)
 	}
 
-	entries, err := os.ReadDir(src)
+	realSrc, err := realPath(src)
 	if err != nil {
 		return err
 	}
 
-	err = os.MkdirAll(dst, srcFileInfo.Mode())
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
-
-		if !entry.IsDir() {
-			srcFile, err := os.Open(srcPath)
-			if err != nil {
-				return err
-			}
-
-			dstFile, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Type())
-			if err != nil {
-				return err
-			}
-
-			_, err = io.Copy(dstFile, srcFile)
-			if err != nil {
-				return err
-			}
-		} else {
-			err = CopyDirectory(srcPath, dstPath)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+	c := &copier{}
+	c.opts.apply(opts...)
+	return c.copyDir(src, dst, srcFileInfo, &dirNode{real: realSrc})
 }
 
 // ClearDirectory removes all files and directories under `dir` recursively.
@@ -94,3 +78,81 @@ func ClearDirectory(dir string) error {
 
 	return nil
 }
+
+// HashFile computes the checksum of the file `path` with `h`, and returns the result of h.Sum.
+// `h` is reset before hashing. For example:
+//
+//	sum, err := fileutils.HashFile("app.tar.gz", sha256.New())
+func HashFile(path string, h hash.Hash) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h.Reset()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// FilesEqual checks if files `a` and `b` have the same content. Sizes are compared first,
+// then the contents are compared chunk by chunk without reading the whole files into memory.
+func FilesEqual(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	ia, err := fa.Stat()
+	if err != nil {
+		return false, err
+	}
+	ib, err := fb.Stat()
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(ia, ib) {
+		return true, nil
+	}
+	if ia.Size() != ib.Size() || !ia.Mode().IsRegular() || !ib.Mode().IsRegular() {
+		return false, nil
+	}
+
+	bufA := make([]byte, kCompareChunkSize)
+	bufB := make([]byte, kCompareChunkSize)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			if errB == io.EOF || errB == io.ErrUnexpectedEOF {
+				return true, nil
+			}
+			return false, nil // b grows while being compared
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			if errB == io.EOF || errB == io.ErrUnexpectedEOF {
+				return false, nil
+			}
+			return false, errB
+		}
+	}
+}
+
+const kCompareChunkSize = 64 * 1024
@@ -0,0 +1,72 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package fileutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	os.WriteFile(path, []byte("hello"), 0644)
+
+	h := sha256.New()
+	h.Write([]byte("garbage"))
+	sum, err := HashFile(path, h)
+	if err != nil || hex.EncodeToString(sum) != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("HashFile() = %x, %v", sum, err)
+	}
+}
+
+func TestFilesEqual(t *testing.T) {
+	dir := t.TempDir()
+	big := make([]byte, kCompareChunkSize*2+10)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	write := func(name string, cont []byte) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, cont, 0644)
+		return path
+	}
+
+	a := write("a", big)
+	b := write("b", big)
+	big[len(big)-1]++
+	c := write("c", big)
+	d := write("d", big[:len(big)-1])
+
+	for _, tc := range []struct {
+		a, b  string
+		equal bool
+	}{{a, a, true}, {a, b, true}, {a, c, false}, {a, d, false}} {
+		equal, err := FilesEqual(tc.a, tc.b)
+		if equal != tc.equal || err != nil {
+			t.Errorf("FilesEqual(%s, %s) = %v, %v", tc.a, tc.b, equal, err)
+		}
+	}
+	if _, err := FilesEqual(a, filepath.Join(dir, "none")); err == nil {
+		t.Error("Error expected")
+	}
+}
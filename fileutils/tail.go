@@ -0,0 +1,258 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package fileutils
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Line is a line read by Tailer.
+type Line struct {
+	Text   string // Content of the line, without the trailing newline.
+	Offset int64  // Offset of the line in the file it's read from. It restarts from 0 after rotation or truncation.
+}
+
+// Tailer follows a file like `tail -F`. It keeps reading the file across truncation and rotation.
+//
+// Rotation is detected by checking whether `path` still refers to the file being read,
+// so both rename-based rotation and the symlinks maintained by the logger package are supported.
+// Remaining lines of the rotated file are read before switching to the new one.
+//
+// Caution: Tailer is not goroutine-safe!
+type Tailer struct {
+	path     string
+	opts     tailOptions
+	file     *os.File
+	fileInfo os.FileInfo
+	reader   *bufio.Reader
+	offset   int64  // offset of the next line
+	partial  []byte // incomplete line read so far
+	opened   bool   // whether any file has ever been opened
+	draining bool   // rotation detected, reading the rest of the old file
+}
+
+// Tail creates a Tailer to follow the file specified by `path`.
+// It's OK if the file doesn't exist yet, Tailer will wait for it to be created.
+//
+// Example:
+//
+//	t, err := Tail("/path/to/logs/app.INFO", WithTailFromEnd())
+//	if err != nil {
+//		return err
+//	}
+//	defer t.Close()
+//	for {
+//		line, err := t.Next(ctx)
+//		if err != nil {
+//			return err
+//		}
+//		forward(line.Text)
+//	}
+func Tail(path string, opts ...tailOption) (*Tailer, error) {
+	t := &Tailer{path: path}
+	t.opts.pollInterval = kDefaultTailPollInterval
+	t.opts.apply(opts...)
+	if err := t.open(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Next blocks until a complete line is available, or `ctx` is done.
+func (t *Tailer) Next(ctx context.Context) (*Line, error) {
+	for {
+		if t.file == nil {
+			if err := t.open(); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+
+		if t.file != nil {
+			data, err := t.reader.ReadSlice('\n')
+			t.partial = append(t.partial, data...)
+			if err == nil {
+				line := &Line{Text: string(t.partial[:len(t.partial)-1]), Offset: t.offset}
+				t.offset += int64(len(t.partial))
+				t.partial = t.partial[:0]
+				return line, nil
+			}
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != io.EOF {
+				return nil, err
+			}
+
+			if t.draining {
+				line := t.closeFile()
+				if line != nil {
+					return line, nil
+				}
+				continue
+			}
+			if err = t.checkFile(); err != nil {
+				return nil, err
+			}
+			if t.draining {
+				continue // read whatever was written to the old file before rotation
+			}
+		}
+
+		timer := time.NewTimer(t.opts.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Close closes the file being read.
+func (t *Tailer) Close() (err error) {
+	if t.file != nil {
+		err = t.file.Close()
+		t.file = nil
+	}
+	return
+}
+
+// open opens `path` and seeks to the starting position
+func (t *Tailer) open() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	var offset int64
+	if !t.opened {
+		if t.opts.fromEnd {
+			offset = fi.Size()
+		} else if t.opts.offset > 0 && t.opts.offset <= fi.Size() {
+			offset = t.opts.offset
+		}
+		if offset > 0 {
+			if _, err = file.Seek(offset, io.SeekStart); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+
+	t.file = file
+	t.fileInfo = fi
+	t.reader = bufio.NewReader(file)
+	t.offset = offset
+	t.partial = t.partial[:0]
+	t.opened = true
+	return nil
+}
+
+// closeFile closes the rotated file, and returns its last line if the line is not terminated by a newline
+func (t *Tailer) closeFile() (line *Line) {
+	if len(t.partial) > 0 {
+		line = &Line{Text: string(t.partial), Offset: t.offset}
+		t.partial = t.partial[:0]
+	}
+	t.file.Close()
+	t.file = nil
+	t.draining = false
+	return
+}
+
+// checkFile checks whether the file has been rotated or truncated
+func (t *Tailer) checkFile() error {
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		if os.IsNotExist(err) { // renamed, but the new file isn't created yet
+			return nil
+		}
+		return err
+	}
+
+	if !os.SameFile(fi, t.fileInfo) {
+		t.draining = true
+		return nil
+	}
+
+	if fi.Size() < t.offset+int64(len(t.partial)) { // truncated
+		if _, err = t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.reader.Reset(t.file)
+		t.offset = 0
+		t.partial = t.partial[:0]
+	}
+	return nil
+}
+
+// WithTailFromEnd makes Tailer start reading from the end of the file, so that only newly written lines are returned.
+// It's only applied to the file opened at the first time, files created by rotation are always read from the beginning.
+func WithTailFromEnd() tailOption {
+	return func(o *tailOptions) {
+		o.fromEnd = true
+	}
+}
+
+// WithTailOffset makes Tailer start reading from `offset`, which is usually the Line.Offset + len(Line.Text) + 1
+// of the last line handled, so that a log-forwarding agent can resume after restart.
+// It's ignored if `offset` exceeds the size of the file.
+// It's only applied to the file opened at the first time, files created by rotation are always read from the beginning.
+func WithTailOffset(offset int64) tailOption {
+	return func(o *tailOptions) {
+		o.offset = offset
+	}
+}
+
+// WithTailPollInterval sets how often Tailer checks for new content, rotation and truncation when it reaches the end of the file.
+// Default is 250ms.
+func WithTailPollInterval(interval time.Duration) tailOption {
+	return func(o *tailOptions) {
+		if interval > 0 {
+			o.pollInterval = interval
+		}
+	}
+}
+
+const kDefaultTailPollInterval = 250 * time.Millisecond
+
+type tailOption func(opts *tailOptions)
+
+type tailOptions struct {
+	fromEnd      bool
+	offset       int64
+	pollInterval time.Duration
+}
+
+func (o *tailOptions) apply(opts ...tailOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
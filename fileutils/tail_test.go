@@ -0,0 +1,100 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package fileutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile := func(name, content string) {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(content)
+		f.Close()
+	}
+
+	appendFile("app.log", "line1\nline2\npart")
+	tailer, err := Tail(path, WithTailPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tailer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	expect := func(text string, offset int64) {
+		line, err := tailer.Next(ctx)
+		if err != nil {
+			t.Fatalf("expecting %q but gets error %v", text, err)
+		}
+		if line.Text != text || line.Offset != offset {
+			t.Fatalf("expecting %q@%d but gets %q@%d", text, offset, line.Text, line.Offset)
+		}
+	}
+
+	expect("line1", 0)
+	expect("line2", 6)
+	appendFile("app.log", "ial\n")
+	expect("partial", 12)
+
+	// rename-based rotation
+	os.Rename(path, filepath.Join(dir, "app.log.1"))
+	appendFile("app.log.1", "tail of old")
+	appendFile("app.log", "new1\n")
+	expect("tail of old", 20)
+	expect("new1", 0)
+
+	// truncation
+	os.Truncate(path, 0)
+	appendFile("app.log", "x\n")
+	expect("x", 0)
+
+	// symlink switched to a new file
+	appendFile("a.log", "a\n")
+	appendFile("b.log", "b\n")
+	link := filepath.Join(dir, "app.INFO")
+	os.Symlink("a.log", link)
+	tailer2, err := Tail(link, WithTailPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tailer2.Close()
+	tailer = tailer2
+	expect("a", 0)
+	os.Remove(link)
+	os.Symlink("b.log", link)
+	expect("b", 0)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = tailer.Next(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expecting DeadlineExceeded but gets %v", err)
+	}
+}
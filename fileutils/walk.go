@@ -0,0 +1,219 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package fileutils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+
+	"github.com/antigloss/go/sync"
+)
+
+// WalkFunc is called by Walk for each file or directory visited. It must be goroutine-safe.
+// If it returns filepath.SkipDir for a directory, the directory is not descended into. Other errors are
+// collected into WalkErrors, and the walk goes on without descending into the entry.
+type WalkFunc func(path string, entry fs.DirEntry) error
+
+// WalkErrors holds all the errors occurred during Walk.
+type WalkErrors []error
+
+func (e WalkErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Walk walks the file tree rooted at `root` with at most `concurrency` goroutines, calling `fn` for each file or directory
+// including `root`. Directories are read concurrently, so `fn` is called concurrently and in no particular order.
+//
+// Symbolic links to directories are followed, `fn` is called with the entry of the link and the files under the target
+// directory are visited with paths under the link. Links pointing to the directory containing them or its ancestors are
+// not followed to avoid cycles.
+//
+// Walk doesn't stop on errors. Errors returned by `fn` and errors of reading directories are collected and returned as WalkErrors.
+//
+// Example:
+//
+//	var n int64
+//	err := fileutils.Walk("/data", 16, func(path string, entry fs.DirEntry) error {
+//		atomic.AddInt64(&n, 1)
+//		return nil
+//	})
+func Walk(root string, concurrency int, fn WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	err = fn(root, fs.FileInfoToDirEntry(info))
+	if err != nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			err = nil
+		}
+		return err
+	}
+
+	realRoot, err := realPath(root)
+	if err != nil {
+		return err
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	w := &walker{fn: fn, sema: sync.NewSemaphore(concurrency - 1)} // The calling goroutine takes one
+	w.walkDir(root, &dirNode{real: realRoot})
+	w.wg.Wait()
+
+	if len(w.errs) == 0 {
+		return nil
+	}
+	return w.errs
+}
+
+// DirSize returns the total size of the regular files under `dir`, read with at most `concurrency` goroutines.
+// Symbolic links are followed as Walk.
+func DirSize(dir string, concurrency int) (int64, error) {
+	size, _, err := DirSizeAndCount(dir, concurrency)
+	return size, err
+}
+
+// DirSizeAndCount returns the total size and the number of the regular files under `dir`, read with at most `concurrency` goroutines.
+// Symbolic links are followed as Walk.
+func DirSizeAndCount(dir string, concurrency int) (size int64, files int64, err error) {
+	var lock gosync.Mutex
+	err = Walk(dir, concurrency, func(path string, entry fs.DirEntry) error {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if info, err = os.Stat(path); err != nil {
+				return nil // Dangling link
+			}
+		}
+		if info.Mode().IsRegular() {
+			lock.Lock()
+			size += info.Size()
+			files++
+			lock.Unlock()
+		}
+		return nil
+	})
+	return
+}
+
+type walker struct {
+	fn   WalkFunc
+	sema *sync.Semaphore // Limits the number of extra goroutines
+	wg   gosync.WaitGroup
+	lock gosync.Mutex
+	errs WalkErrors
+}
+
+// dirNode is a directory being walked
+type dirNode struct {
+	real   string   // Path of the directory with symbolic links resolved
+	parent *dirNode // Directory from which this one is reached, used for detecting cycles
+}
+
+// walkDir visits entries under `dir`, `wd` holds the real path of `dir`.
+// Subdirectories are walked in new goroutines if the concurrency limit is not reached, otherwise in the calling goroutine.
+func (w *walker) walkDir(dir string, wd *dirNode) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.addError(err) // Entries read before the error are still visited
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		err = w.fn(path, entry)
+		if err != nil {
+			if err != filepath.SkipDir {
+				w.addError(err)
+			}
+			continue
+		}
+
+		sub, ok := subdir(path, wd, entry)
+		if !ok {
+			continue
+		}
+
+		if sr := w.sema.TryAcquire(); sr != nil {
+			w.wg.Add(1)
+			go func(path string) {
+				defer w.wg.Done()
+				defer sr.Release()
+				w.walkDir(path, sub)
+			}(path)
+		} else {
+			w.walkDir(path, sub)
+		}
+	}
+}
+
+func (w *walker) addError(err error) {
+	w.lock.Lock()
+	w.errs = append(w.errs, err)
+	w.lock.Unlock()
+}
+
+// subdir checks if `entry` under directory `parent` should be descended into.
+func subdir(path string, parent *dirNode, entry fs.DirEntry) (*dirNode, bool) {
+	if entry.IsDir() {
+		return &dirNode{real: filepath.Join(parent.real, entry.Name()), parent: parent}, true
+	}
+	if entry.Type()&fs.ModeSymlink == 0 {
+		return nil, false
+	}
+
+	real, err := realPath(path)
+	if err != nil { // Dangling link
+		return nil, false
+	}
+	info, err := os.Stat(real)
+	if err != nil || !info.IsDir() {
+		return nil, false
+	}
+
+	// A link to any directory on the way here, or to an ancestor of them, leads to a cycle
+	prefix := strings.TrimSuffix(real, string(filepath.Separator)) + string(filepath.Separator)
+	for d := parent; d != nil; d = d.parent {
+		if d.real == real || strings.HasPrefix(d.real, prefix) {
+			return nil, false
+		}
+	}
+	return &dirNode{real: real, parent: parent}, true
+}
+
+func realPath(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(real)
+}
@@ -0,0 +1,102 @@
+/*
+ *
+ * fileutils - Handy file utilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package fileutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a/b/c", "d", "skip/x"} {
+		os.MkdirAll(filepath.Join(root, d), 0755)
+	}
+	for _, f := range []string{"f1", "a/f2", "a/b/c/f3", "d/f4", "skip/x/f5"} {
+		os.WriteFile(filepath.Join(root, f), []byte("12345"), 0644)
+	}
+	os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "a/b/up"))   // cycle
+	os.Symlink(filepath.Join(root, "d"), filepath.Join(root, "a/b/c/ld")) // d is visited twice
+	os.Symlink(filepath.Join(root, "a/b"), filepath.Join(root, "d/lb"))   // mutual links between a/b and d
+	os.Symlink(filepath.Join(root, "none"), filepath.Join(root, "dangling"))
+
+	errBad := errors.New("bad")
+	for _, concurrency := range []int{1, 4} {
+		var lock sync.Mutex
+		var paths []string
+		err := Walk(root, concurrency, func(path string, entry fs.DirEntry) error {
+			rel, _ := filepath.Rel(root, path)
+			lock.Lock()
+			paths = append(paths, rel)
+			lock.Unlock()
+			if rel == "skip" {
+				return filepath.SkipDir
+			}
+			if rel == "f1" {
+				return errBad
+			}
+			return nil
+		})
+
+		var errs WalkErrors
+		if !errors.As(err, &errs) || len(errs) != 1 || errs[0] != errBad {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		sort.Strings(paths)
+		expected := []string{".", "a", "a/b", "a/b/c", "a/b/c/f3", "a/b/c/ld", "a/b/c/ld/f4", "a/b/c/ld/lb", "a/b/up",
+			"a/f2", "d", "d/f4", "d/lb", "d/lb/c", "d/lb/c/f3", "d/lb/c/ld", "d/lb/up", "dangling", "f1", "skip"}
+		if strings.Join(paths, ",") != strings.Join(expected, ",") {
+			t.Errorf("Unexpected paths with concurrency %d: %v", concurrency, paths)
+		}
+	}
+}
+
+func TestDirSize(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a/b"), 0755)
+	os.WriteFile(filepath.Join(root, "a/f1"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(root, "a/b/f2"), make([]byte, 200), 0644)
+
+	size, err := DirSize(root, 2)
+	if size != 300 || err != nil {
+		t.Errorf("DirSize() = %d, %v", size, err)
+	}
+
+	os.Symlink(filepath.Join(root, "a/f1"), filepath.Join(root, "lf"))
+	size, files, err := DirSizeAndCount(root, 2)
+	if size != 400 || files != 3 || err != nil {
+		t.Errorf("DirSizeAndCount() = %d, %d, %v", size, files, err)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	free, total, err := DiskUsage(t.TempDir())
+	if err != nil || total == 0 || free > total {
+		t.Errorf("DiskUsage() = %d, %d, %v", free, total, err)
+	}
+}
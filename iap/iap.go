@@ -24,49 +24,60 @@ package iap
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 )
 
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
 const (
 	appleSandboxURL    string = "https://sandbox.itunes.apple.com/verifyReceipt"
 	appleProductionURL string = "https://buy.itunes.apple.com/verifyReceipt"
 )
 
 type requestDate struct {
-	RequestDate    string `json:"request_date"`
-	RequestDateMS  string `json:"request_date_ms"`
-	RequestDatePST string `json:"request_date_pst"`
+	RequestDate    string    `json:"request_date"`
+	RequestDateMS  string    `json:"request_date_ms"`
+	RequestDatePST string    `json:"request_date_pst"`
+	RequestTime    time.Time `json:"-"` // Parsed from RequestDateMS
 }
 
 type purchaseDate struct {
-	PurchaseDate    string `json:"purchase_date"`
-	PurchaseDateMS  string `json:"purchase_date_ms"`
-	PurchaseDatePST string `json:"purchase_date_pst"`
+	PurchaseDate    string    `json:"purchase_date"`
+	PurchaseDateMS  string    `json:"purchase_date_ms"`
+	PurchaseDatePST string    `json:"purchase_date_pst"`
+	PurchaseTime    time.Time `json:"-"` // Parsed from PurchaseDateMS
 }
 
 type originalPurchaseDate struct {
-	OriginalPurchaseDate    string `json:"original_purchase_date"`
-	OriginalPurchaseDateMS  string `json:"original_purchase_date_ms"`
-	OriginalPurchaseDatePST string `json:"original_purchase_date_pst"`
+	OriginalPurchaseDate    string    `json:"original_purchase_date"`
+	OriginalPurchaseDateMS  string    `json:"original_purchase_date_ms"`
+	OriginalPurchaseDatePST string    `json:"original_purchase_date_pst"`
+	OriginalPurchaseTime    time.Time `json:"-"` // Parsed from OriginalPurchaseDateMS
 }
 
 type expiresDate struct {
-	ExpiresDate    string `json:"expires_date"`
-	ExpiresDateMS  string `json:"expires_date_ms"`
-	ExpiresDatePST string `json:"expires_date_pst"`
+	ExpiresDate    string    `json:"expires_date"`
+	ExpiresDateMS  string    `json:"expires_date_ms"`
+	ExpiresDatePST string    `json:"expires_date_pst"`
+	ExpiresTime    time.Time `json:"-"` // Parsed from ExpiresDateMS
 }
 
 type cancellationDate struct {
-	CancellationDate    string `json:"cancellation_date"`
-	CancellationDateMS  string `json:"cancellation_date_ms"`
-	CancellationDatePST string `json:"cancellation_date_pst"`
+	CancellationDate    string    `json:"cancellation_date"`
+	CancellationDateMS  string    `json:"cancellation_date_ms"`
+	CancellationDatePST string    `json:"cancellation_date_pst"`
+	CancellationTime    time.Time `json:"-"` // Parsed from CancellationDateMS
 }
 
-type inApp struct {
+// InApp is an in-app purchase transaction of a receipt.
+type InApp struct {
 	Quantity                  string `json:"quantity"`
 	ProductID                 string `json:"product_id"`
 	TransactionID             string `json:"transaction_id"`
@@ -75,12 +86,40 @@ type inApp struct {
 	AppItemID                 string `json:"app_item_id"`
 	VersionExternalIdentifier string `json:"version_external_identifier"`
 	WebOrderLineItemID        string `json:"web_order_line_item_id"`
+	// Fields below are only present for auto-renewable subscriptions
+	IsInIntroOfferPeriod        string `json:"is_in_intro_offer_period"`
+	CancellationReason          string `json:"cancellation_reason"`
+	SubscriptionGroupIdentifier string `json:"subscription_group_identifier"`
+	PromotionalOfferID          string `json:"promotional_offer_id"`
+	OfferCodeRefName            string `json:"offer_code_ref_name"`
+	InAppOwnershipType          string `json:"in_app_ownership_type"`
 	purchaseDate
 	originalPurchaseDate
 	expiresDate
 	cancellationDate
 }
 
+type gracePeriodExpiresDate struct {
+	GracePeriodExpiresDate    string    `json:"grace_period_expires_date"`
+	GracePeriodExpiresDateMS  string    `json:"grace_period_expires_date_ms"`
+	GracePeriodExpiresDatePST string    `json:"grace_period_expires_date_pst"`
+	GracePeriodExpiresTime    time.Time `json:"-"` // Parsed from GracePeriodExpiresDateMS
+}
+
+// PendingRenewalInfo is the renewal information of an auto-renewable subscription.
+type PendingRenewalInfo struct {
+	AutoRenewProductID     string `json:"auto_renew_product_id"`
+	AutoRenewStatus        string `json:"auto_renew_status"`
+	ExpirationIntent       string `json:"expiration_intent"`
+	IsInBillingRetryPeriod string `json:"is_in_billing_retry_period"`
+	OfferCodeRefName       string `json:"offer_code_ref_name"`
+	OriginalTransactionID  string `json:"original_transaction_id"`
+	PriceConsentStatus     string `json:"price_consent_status"`
+	ProductID              string `json:"product_id"`
+	PromotionalOfferID     string `json:"promotional_offer_id"`
+	gracePeriodExpiresDate
+}
+
 type iOS6Receipt struct {
 	AppItemID                  string `json:"app_item_id"`
 	BundleID                   string `json:"bid"`
@@ -108,13 +147,15 @@ type Receipt struct {
 	ApplicationVersion         string  `json:"application_version"`
 	DownloadID                 int64   `json:"download_id"`
 	OriginalApplicationVersion string  `json:"original_application_version"`
-	InApp                      []inApp `json:"in_app"`
+	InApp                      []InApp `json:"in_app"`
 	requestDate
 	originalPurchaseDate
 }
 
 type receiptRequestData struct {
-	ReceiptData string `json:"receipt-data"`
+	ReceiptData            string `json:"receipt-data"`
+	Password               string `json:"password,omitempty"`
+	ExcludeOldTransactions bool   `json:"exclude-old-transactions,omitempty"`
 }
 
 type iOS6ResponseData struct {
@@ -123,29 +164,113 @@ type iOS6ResponseData struct {
 }
 
 type receiptResponseData struct {
-	Status         int     `json:"status"`
-	ReceiptContent Receipt `json:"receipt"`
+	Status             int                  `json:"status"`
+	Environment        string               `json:"environment"`
+	ReceiptContent     Receipt              `json:"receipt"`
+	LatestReceipt      string               `json:"latest_receipt"`
+	LatestReceiptInfo  json.RawMessage      `json:"latest_receipt_info"` // An object in iOS6 style responses
+	PendingRenewalInfo []PendingRenewalInfo `json:"pending_renewal_info"`
+}
+
+// VerifyOptions holds the options for VerifyReceiptWithOptions.
+type VerifyOptions struct {
+	// Sends the receipt to the sandbox if true, or to the production service otherwise.
+	UseSandbox bool
+	// Retries against the other environment automatically if Apple reports that the receipt belongs to it,
+	// i.e. status 21007 from the production service, or status 21008 from the sandbox.
+	// Apple recommends sending receipts to the production service first with AutoFallback on,
+	// so that both App Review (sandbox) and production receipts are validated with the same code.
+	AutoFallback bool
+	// The app's shared secret. Required for receipts containing auto-renewable subscriptions.
+	Password string
+	// Only the latest renewal transaction of each subscription is returned in LatestReceiptInfo if true.
+	// Only used for receipts containing auto-renewable subscriptions.
+	ExcludeOldTransactions bool
+	// Client used to send the receipt, e.g. one with a proxy or instrumentation.
+	// If nil, a client with a timeout of 30 seconds is used.
+	HTTPClient *http.Client
+}
+
+// VerifyResponse is the response of Apple's VerifyReceipt service.
+type VerifyResponse struct {
+	// Environment of the receipt, "Sandbox" or "Production".
+	Environment string
+	// The decoded receipt.
+	Receipt *Receipt
+	// The latest base64-encoded receipt. Only returned for receipts containing auto-renewable subscriptions.
+	LatestReceipt string
+	// All the in-app purchase transactions. Only returned for receipts containing auto-renewable subscriptions.
+	LatestReceiptInfo []InApp
+	// Pending renewal information of each auto-renewable subscription.
+	PendingRenewalInfo []PendingRenewalInfo
 }
 
 // VerifyReceipt tries to connect to either the sandbox (useSandbox true) or
 // Apple's ordinary service (useSandbox false) to validate the base64-encoded receipt (receiptData).
 // Returns either a Receipt struct or an error.
 func VerifyReceipt(receiptData string, useSandbox bool) (*Receipt, error) {
-	if !useSandbox {
-		return sendReceiptToApple(receiptData, appleProductionURL)
+	rsp, err := VerifyReceiptWithOptions(receiptData, &VerifyOptions{UseSandbox: useSandbox})
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Receipt, nil
+}
+
+// VerifyReceiptWithOptions validates the base64-encoded receipt (receiptData) with Apple's VerifyReceipt service.
+// Unlike VerifyReceipt, it supports validating auto-renewable subscriptions with `opts.Password`,
+// and returns the latest receipt info and pending renewal info as well. `opts` could be nil.
+func VerifyReceiptWithOptions(receiptData string, opts *VerifyOptions) (*VerifyResponse, error) {
+	return VerifyReceiptCtx(context.Background(), receiptData, opts)
+}
+
+// VerifyReceiptCtx is like VerifyReceiptWithOptions, but the requests are bound to `ctx`,
+// which can be used to enforce deadlines and cancellation.
+func VerifyReceiptCtx(ctx context.Context, receiptData string, opts *VerifyOptions) (*VerifyResponse, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	req := receiptRequestData{
+		ReceiptData:            receiptData,
+		Password:               opts.Password,
+		ExcludeOldTransactions: opts.ExcludeOldTransactions,
 	}
-	return sendReceiptToApple(receiptData, appleSandboxURL)
+	url, otherURL := appleProductionURL, appleSandboxURL
+	if opts.UseSandbox {
+		url, otherURL = otherURL, url
+	}
+	cli := opts.HTTPClient
+	if cli == nil {
+		cli = defaultClient
+	}
+	rsp, err := sendReceiptToApple(ctx, cli, &req, url)
+	if opts.AutoFallback && wrongEnvironment(err) {
+		rsp, err = sendReceiptToApple(ctx, cli, &req, otherURL)
+	}
+	return rsp, err
 }
 
-// Sends the receipt to Apple, returns the Receipt or an error upon completion.
-func sendReceiptToApple(receiptData, url string) (*Receipt, error) {
-	requestData, err := json.Marshal(receiptRequestData{receiptData})
+// Returns true if `err` tells that the receipt was sent to the wrong environment
+func wrongEnvironment(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.Status == StatusSandboxReceiptSentToProduction || statusErr.Status == StatusProductionReceiptSentToSandbox
+}
+
+// Sends the receipt to Apple, returns the response or an error upon completion.
+func sendReceiptToApple(ctx context.Context, cli *http.Client, req *receiptRequestData, url string) (*VerifyResponse, error) {
+	requestData, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
 
-	toSend := bytes.NewBuffer(requestData)
-	resp, err := http.Post(url, "application/json", toSend)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(requestData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := cli.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
@@ -156,9 +281,14 @@ func sendReceiptToApple(receiptData, url string) (*Receipt, error) {
 		return nil, err
 	}
 
+	return parseResponse(body)
+}
+
+// Parses the response body of Apple's VerifyReceipt service
+func parseResponse(body []byte) (*VerifyResponse, error) {
 	// for iOS7
 	var responseData receiptResponseData
-	err = json.Unmarshal(body, &responseData)
+	err := json.Unmarshal(body, &responseData)
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +296,25 @@ func sendReceiptToApple(receiptData, url string) (*Receipt, error) {
 		return nil, verificationError(responseData.Status)
 	}
 	if len(responseData.ReceiptContent.BundleID) > 0 {
-		return &responseData.ReceiptContent, nil
+		rsp := &VerifyResponse{
+			Environment:        responseData.Environment,
+			Receipt:            &responseData.ReceiptContent,
+			LatestReceipt:      responseData.LatestReceipt,
+			PendingRenewalInfo: responseData.PendingRenewalInfo,
+		}
+		if len(responseData.LatestReceiptInfo) > 0 && responseData.LatestReceiptInfo[0] == '[' {
+			if err = json.Unmarshal(responseData.LatestReceiptInfo, &rsp.LatestReceiptInfo); err != nil {
+				return nil, err
+			}
+		}
+		rsp.Receipt.parseDates()
+		for i := range rsp.LatestReceiptInfo {
+			rsp.LatestReceiptInfo[i].parseDates()
+		}
+		for i := range rsp.PendingRenewalInfo {
+			rsp.PendingRenewalInfo[i].parseDates()
+		}
+		return rsp, nil
 	}
 
 	// for iOS6
@@ -175,7 +323,9 @@ func sendReceiptToApple(receiptData, url string) (*Receipt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ios6ResponseData.ReceiptContent.toReceipt(), nil
+	receipt := ios6ResponseData.ReceiptContent.toReceipt()
+	receipt.parseDates()
+	return &VerifyResponse{Receipt: receipt}, nil
 }
 
 // Turns an iOS6Receipt into a Receipt struct
@@ -188,7 +338,7 @@ func (ios6 *iOS6Receipt) toReceipt() *Receipt {
 		OriginalApplicationVersion: ios6.OriginalApplicationVersion,
 		requestDate:                ios6.requestDate,
 		originalPurchaseDate:       ios6.originalPurchaseDate,
-		InApp: []inApp{{
+		InApp: []InApp{{
 			Quantity:                  ios6.Quantity,
 			ProductID:                 ios6.ProductID,
 			TransactionID:             ios6.TransactionID,
@@ -206,6 +356,108 @@ func (ios6 *iOS6Receipt) toReceipt() *Receipt {
 	}
 }
 
+func (d *requestDate) parseDates() {
+	d.RequestTime = parseMS(d.RequestDateMS)
+}
+
+func (d *purchaseDate) parseDates() {
+	d.PurchaseTime = parseMS(d.PurchaseDateMS)
+}
+
+func (d *originalPurchaseDate) parseDates() {
+	d.OriginalPurchaseTime = parseMS(d.OriginalPurchaseDateMS)
+}
+
+func (d *expiresDate) parseDates() {
+	d.ExpiresTime = parseMS(d.ExpiresDateMS)
+}
+
+func (d *cancellationDate) parseDates() {
+	d.CancellationTime = parseMS(d.CancellationDateMS)
+}
+
+func (d *gracePeriodExpiresDate) parseDates() {
+	d.GracePeriodExpiresTime = parseMS(d.GracePeriodExpiresDateMS)
+}
+
+func (a *InApp) parseDates() {
+	a.purchaseDate.parseDates()
+	a.originalPurchaseDate.parseDates()
+	a.expiresDate.parseDates()
+	a.cancellationDate.parseDates()
+}
+
+func (r *Receipt) parseDates() {
+	r.requestDate.parseDates()
+	r.originalPurchaseDate.parseDates()
+	for i := range r.InApp {
+		r.InApp[i].parseDates()
+	}
+}
+
+// Parses milliseconds since the epoch. Returns zero time if `ms` is empty or malformed.
+func parseMS(ms string) time.Time {
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(n)
+}
+
+// FindTransaction returns the in-app purchase transaction with `transactionID`, or nil if not found.
+func (r *Receipt) FindTransaction(transactionID string) *InApp {
+	for i := range r.InApp {
+		if r.InApp[i].TransactionID == transactionID {
+			return &r.InApp[i]
+		}
+	}
+	return nil
+}
+
+// IsTrial returns true if the transaction with `transactionID` is in a free trial period.
+func (r *Receipt) IsTrial(transactionID string) bool {
+	txn := r.FindTransaction(transactionID)
+	return txn != nil && txn.IsTrialPeriod == "true"
+}
+
+// LatestExpiry returns the latest expiration time of the subscription `productID`, excluding canceled transactions.
+// Returns zero time if there is no such subscription. Note that for auto-renewable subscriptions, the transactions
+// in VerifyResponse.LatestReceiptInfo are more complete than those in the receipt.
+func (r *Receipt) LatestExpiry(productID string) time.Time {
+	return latestExpiry(r.InApp, productID)
+}
+
+// LatestExpiry is like Receipt.LatestExpiry, but checks the transactions in LatestReceiptInfo.
+func (rsp *VerifyResponse) LatestExpiry(productID string) time.Time {
+	return latestExpiry(rsp.LatestReceiptInfo, productID)
+}
+
+func latestExpiry(txns []InApp, productID string) time.Time {
+	var latest time.Time
+	for i := range txns {
+		txn := &txns[i]
+		if txn.ProductID == productID && txn.CancellationTime.IsZero() && txn.ExpiresTime.After(latest) {
+			latest = txn.ExpiresTime
+		}
+	}
+	return latest
+}
+
+// Status codes returned by Apple's VerifyReceipt service.
+const (
+	StatusSandboxReceiptSentToProduction = 21007
+	StatusProductionReceiptSentToSandbox = 21008
+)
+
+// StatusError is returned if Apple's VerifyReceipt service responds with a non-zero status.
+type StatusError struct {
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Status, errMsgs[e.Status])
+}
+
 // Maps error codes to error messages.
 var errMsgs = map[int]string{
 	21000: "The App Store could not read the JSON object you provided.",
@@ -220,5 +472,5 @@ var errMsgs = map[int]string{
 
 // Generates the correct error based on a status error code.
 func verificationError(errCode int) error {
-	return fmt.Errorf("%d: %s", errCode, errMsgs[errCode])
+	return &StatusError{Status: errCode}
 }
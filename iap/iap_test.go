@@ -0,0 +1,148 @@
+/*
+ *
+ * iap - In App Purchase
+ * Copyright (C) 2015 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package iap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseResponse(t *testing.T) {
+	body := `{
+		"status": 0,
+		"environment": "Sandbox",
+		"receipt": {"bundle_id": "com.example.app", "in_app": [{"product_id": "monthly", "transaction_id": "1000"}]},
+		"latest_receipt": "bGF0ZXN0",
+		"latest_receipt_info": [
+			{"product_id": "monthly", "transaction_id": "1001", "original_transaction_id": "1000", "expires_date_ms": "1600000000000"}
+		],
+		"pending_renewal_info": [
+			{"auto_renew_product_id": "monthly", "auto_renew_status": "1", "original_transaction_id": "1000"}
+		]
+	}`
+	rsp, err := parseResponse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Environment != "Sandbox" || rsp.Receipt.BundleID != "com.example.app" || rsp.LatestReceipt != "bGF0ZXN0" {
+		t.Fatalf("unexpected response: %+v", rsp)
+	}
+	if len(rsp.LatestReceiptInfo) != 1 || rsp.LatestReceiptInfo[0].ExpiresDateMS != "1600000000000" {
+		t.Fatalf("unexpected latest_receipt_info: %+v", rsp.LatestReceiptInfo)
+	}
+	if len(rsp.PendingRenewalInfo) != 1 || rsp.PendingRenewalInfo[0].AutoRenewStatus != "1" {
+		t.Fatalf("unexpected pending_renewal_info: %+v", rsp.PendingRenewalInfo)
+	}
+
+	// iOS6 style, latest_receipt_info is an object
+	body = `{"status": 0, "receipt": {"bid": "com.example.app", "product_id": "p1"}, "latest_receipt_info": {"product_id": "p1"}}`
+	if rsp, err = parseResponse([]byte(body)); err != nil || rsp.Receipt.BundleID != "com.example.app" || rsp.Receipt.InApp[0].ProductID != "p1" {
+		t.Fatalf("unexpected response: %+v %v", rsp, err)
+	}
+
+	if _, err = parseResponse([]byte(`{"status": 21004}`)); err == nil || wrongEnvironment(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = parseResponse([]byte(`{"status": 21007}`))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != StatusSandboxReceiptSentToProduction || !wrongEnvironment(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type fakeApple struct {
+	urls []string
+}
+
+func (f *fakeApple) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.urls = append(f.urls, req.URL.String())
+	body := `{"status": 21007}`
+	if req.URL.String() == appleSandboxURL {
+		body = `{"status": 0, "environment": "Sandbox", "receipt": {"bundle_id": "com.example.app"}}`
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+func TestAutoFallback(t *testing.T) {
+	f := &fakeApple{}
+	cli := &http.Client{Transport: f}
+
+	_, err := VerifyReceiptCtx(context.Background(), "receipt", &VerifyOptions{HTTPClient: cli})
+	if !wrongEnvironment(err) || len(f.urls) != 1 {
+		t.Fatalf("unexpected result: %v %v", err, f.urls)
+	}
+
+	f.urls = nil
+	rsp, err := VerifyReceiptCtx(context.Background(), "receipt", &VerifyOptions{HTTPClient: cli, AutoFallback: true})
+	if err != nil || rsp.Environment != "Sandbox" {
+		t.Fatalf("unexpected result: %+v %v", rsp, err)
+	}
+	if len(f.urls) != 2 || f.urls[0] != appleProductionURL || f.urls[1] != appleSandboxURL {
+		t.Fatalf("unexpected urls: %v", f.urls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = VerifyReceiptCtx(ctx, "receipt", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReceiptHelpers(t *testing.T) {
+	body := `{
+		"status": 0,
+		"receipt": {"bundle_id": "com.example.app", "request_date_ms": "1500000000000", "in_app": [
+			{"product_id": "monthly", "transaction_id": "1000", "is_trial_period": "true", "expires_date_ms": "1600000000000"},
+			{"product_id": "monthly", "transaction_id": "1001", "is_trial_period": "false", "expires_date_ms": "1700000000000"},
+			{"product_id": "monthly", "transaction_id": "1002", "expires_date_ms": "1800000000000", "cancellation_date_ms": "1650000000000"}
+		]},
+		"latest_receipt_info": [{"product_id": "monthly", "transaction_id": "1003", "expires_date_ms": "1900000000000"}]
+	}`
+	rsp, err := parseResponse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rsp.Receipt
+	if !r.RequestTime.Equal(time.UnixMilli(1500000000000)) {
+		t.Errorf("RequestTime=%v", r.RequestTime)
+	}
+	if txn := r.FindTransaction("1001"); txn == nil || !txn.ExpiresTime.Equal(time.UnixMilli(1700000000000)) || txn.PurchaseTime != (time.Time{}) {
+		t.Errorf("FindTransaction=%+v", txn)
+	}
+	if r.FindTransaction("2000") != nil || !r.IsTrial("1000") || r.IsTrial("1001") {
+		t.Error("unexpected FindTransaction or IsTrial result")
+	}
+	if expiry := r.LatestExpiry("monthly"); !expiry.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("LatestExpiry=%v", expiry)
+	}
+	if expiry := rsp.LatestExpiry("monthly"); !expiry.Equal(time.UnixMilli(1900000000000)) {
+		t.Errorf("LatestExpiry=%v", expiry)
+	}
+	if !r.LatestExpiry("yearly").IsZero() {
+		t.Error("unexpected LatestExpiry")
+	}
+}
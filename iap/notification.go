@@ -0,0 +1,265 @@
+/*
+ *
+ * iap - In App Purchase
+ * Copyright (C) 2015 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package iap
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Notification types of App Store Server Notifications V2.
+// Documentation: https://developer.apple.com/documentation/appstoreservernotifications/notificationtype
+const (
+	NotificationConsumptionRequest     = "CONSUMPTION_REQUEST"
+	NotificationDidChangeRenewalPref   = "DID_CHANGE_RENEWAL_PREF"
+	NotificationDidChangeRenewalStatus = "DID_CHANGE_RENEWAL_STATUS"
+	NotificationDidFailToRenew         = "DID_FAIL_TO_RENEW"
+	NotificationDidRenew               = "DID_RENEW"
+	NotificationExpired                = "EXPIRED"
+	NotificationGracePeriodExpired     = "GRACE_PERIOD_EXPIRED"
+	NotificationOfferRedeemed          = "OFFER_REDEEMED"
+	NotificationPriceIncrease          = "PRICE_INCREASE"
+	NotificationRefund                 = "REFUND"
+	NotificationRefundDeclined         = "REFUND_DECLINED"
+	NotificationRefundReversed         = "REFUND_REVERSED"
+	NotificationRenewalExtended        = "RENEWAL_EXTENDED"
+	NotificationRevoke                 = "REVOKE"
+	NotificationSubscribed             = "SUBSCRIBED"
+	NotificationTest                   = "TEST"
+)
+
+// Notification is a decoded App Store Server Notification V2.
+type Notification struct {
+	NotificationType string           `json:"notificationType"`
+	Subtype          string           `json:"subtype"`
+	NotificationUUID string           `json:"notificationUUID"`
+	Version          string           `json:"version"`
+	SignedDate       int64            `json:"signedDate"` // Milliseconds since the epoch
+	Data             NotificationData `json:"data"`
+
+	// Decoded from Data.SignedTransactionInfo. Nil if absent.
+	TransactionInfo *TransactionInfo `json:"-"`
+	// Decoded from Data.SignedRenewalInfo. Nil if absent.
+	RenewalInfo *RenewalInfo `json:"-"`
+}
+
+// NotificationData is the app metadata and the signed transaction and renewal information of a Notification.
+type NotificationData struct {
+	AppAppleID            int64  `json:"appAppleId"`
+	BundleID              string `json:"bundleId"`
+	BundleVersion         string `json:"bundleVersion"`
+	Environment           string `json:"environment"`
+	Status                int    `json:"status"`
+	SignedTransactionInfo string `json:"signedTransactionInfo"`
+	SignedRenewalInfo     string `json:"signedRenewalInfo"`
+}
+
+// TransactionInfo is the transaction information signed by the App Store.
+// Dates are milliseconds since the epoch.
+type TransactionInfo struct {
+	AppAccountToken             string `json:"appAccountToken"`
+	BundleID                    string `json:"bundleId"`
+	Environment                 string `json:"environment"`
+	ExpiresDate                 int64  `json:"expiresDate"`
+	InAppOwnershipType          string `json:"inAppOwnershipType"`
+	IsUpgraded                  bool   `json:"isUpgraded"`
+	OfferIdentifier             string `json:"offerIdentifier"`
+	OfferType                   int    `json:"offerType"`
+	OriginalPurchaseDate        int64  `json:"originalPurchaseDate"`
+	OriginalTransactionID       string `json:"originalTransactionId"`
+	ProductID                   string `json:"productId"`
+	PurchaseDate                int64  `json:"purchaseDate"`
+	Quantity                    int    `json:"quantity"`
+	RevocationDate              int64  `json:"revocationDate"`
+	RevocationReason            int    `json:"revocationReason"`
+	SignedDate                  int64  `json:"signedDate"`
+	SubscriptionGroupIdentifier string `json:"subscriptionGroupIdentifier"`
+	TransactionID               string `json:"transactionId"`
+	Type                        string `json:"type"`
+	WebOrderLineItemID          string `json:"webOrderLineItemId"`
+}
+
+// RenewalInfo is the subscription renewal information signed by the App Store.
+// Dates are milliseconds since the epoch.
+type RenewalInfo struct {
+	AutoRenewProductID          string `json:"autoRenewProductId"`
+	AutoRenewStatus             int    `json:"autoRenewStatus"`
+	Environment                 string `json:"environment"`
+	ExpirationIntent            int    `json:"expirationIntent"`
+	GracePeriodExpiresDate      int64  `json:"gracePeriodExpiresDate"`
+	IsInBillingRetryPeriod      bool   `json:"isInBillingRetryPeriod"`
+	OfferIdentifier             string `json:"offerIdentifier"`
+	OfferType                   int    `json:"offerType"`
+	OriginalTransactionID       string `json:"originalTransactionId"`
+	PriceIncreaseStatus         int    `json:"priceIncreaseStatus"`
+	ProductID                   string `json:"productId"`
+	RecentSubscriptionStartDate int64  `json:"recentSubscriptionStartDate"`
+	SignedDate                  int64  `json:"signedDate"`
+}
+
+// NotificationVerifier verifies and decodes the JWS payloads signed by the App Store.
+type NotificationVerifier struct {
+	// Root certificates which the certificate chains in the JWS headers must chain up to.
+	// It should contain Apple Root CA - G3, which can be downloaded from https://www.apple.com/certificateauthority/
+	Roots *x509.CertPool
+	// Returns the time at which the certificate chains are verified. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// ParseNotification verifies the `signedPayload` of an App Store Server Notification V2, and decodes it
+// along with the signed transaction and renewal information inside.
+func (v *NotificationVerifier) ParseNotification(signedPayload string) (*Notification, error) {
+	var n Notification
+	if err := v.Verify(signedPayload, &n); err != nil {
+		return nil, err
+	}
+	if n.Data.SignedTransactionInfo != "" {
+		n.TransactionInfo = &TransactionInfo{}
+		if err := v.Verify(n.Data.SignedTransactionInfo, n.TransactionInfo); err != nil {
+			return nil, fmt.Errorf("signedTransactionInfo: %w", err)
+		}
+	}
+	if n.Data.SignedRenewalInfo != "" {
+		n.RenewalInfo = &RenewalInfo{}
+		if err := v.Verify(n.Data.SignedRenewalInfo, n.RenewalInfo); err != nil {
+			return nil, fmt.Errorf("signedRenewalInfo: %w", err)
+		}
+	}
+	return &n, nil
+}
+
+// Verify verifies the JWS `token` signed by the App Store, and unmarshals its payload into `out`.
+// The certificate chain in the x5c header must chain up to Roots, and the signature must be ES256.
+func (v *NotificationVerifier) Verify(token string, out interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed JWS")
+	}
+
+	hdrJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("malformed JWS header: %w", err)
+	}
+	var hdr jwsHeader
+	if err = json.Unmarshal(hdrJSON, &hdr); err != nil {
+		return fmt.Errorf("malformed JWS header: %w", err)
+	}
+	if hdr.Alg != "ES256" {
+		return fmt.Errorf("unsupported JWS algorithm %q", hdr.Alg)
+	}
+
+	leaf, err := v.verifyChain(hdr.X5C)
+	if err != nil {
+		return err
+	}
+	pub, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("leaf certificate doesn't have an ECDSA public key")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return errors.New("malformed JWS signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		return errors.New("invalid JWS signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed JWS payload: %w", err)
+	}
+	return json.Unmarshal(payload, out)
+}
+
+// Verifies the certificate chain in the x5c header and returns the leaf certificate
+func (v *NotificationVerifier) verifyChain(x5c []string) (*x509.Certificate, error) {
+	if v.Roots == nil {
+		return nil, errors.New("no root certificates")
+	}
+	if len(x5c) < 2 {
+		return nil, errors.New("incomplete certificate chain in JWS header")
+	}
+
+	certs := make([]*x509.Certificate, len(x5c))
+	for i, s := range x5c {
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("malformed certificate in JWS header: %w", err)
+		}
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("malformed certificate in JWS header: %w", err)
+		}
+	}
+	if !hasExtension(certs[0], oidAppStoreReceiptSigning) || !hasExtension(certs[1], oidAppleWWDRIntermediate) {
+		return nil, errors.New("certificate chain in JWS header is not issued for the App Store")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify certificate chain in JWS header: %w", err)
+	}
+	return certs[0], nil
+}
+
+func hasExtension(cert *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+type jwsHeader struct {
+	Alg string   `json:"alg"`
+	X5C []string `json:"x5c"`
+}
+
+// Marker extensions of the certificates used by the App Store to sign JWS
+var (
+	oidAppStoreReceiptSigning = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 11, 1}
+	oidAppleWWDRIntermediate  = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+)
@@ -0,0 +1,138 @@
+/*
+ *
+ * iap - In App Purchase
+ * Copyright (C) 2015 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package iap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSigner struct {
+	key   *ecdsa.PrivateKey
+	chain []string
+	roots *x509.CertPool
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	newCert := func(tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		return cert, key
+	}
+	marker := func(oid asn1.ObjectIdentifier) []pkix.Extension {
+		return []pkix.Extension{{Id: oid, Value: []byte{5, 0}}}
+	}
+
+	root, rootKey := newCert(&x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "root"},
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil)
+	inter, interKey := newCert(&x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "inter"},
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+		ExtraExtensions: marker(oidAppleWWDRIntermediate)}, root, rootKey)
+	leaf, leafKey := newCert(&x509.Certificate{SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "leaf"},
+		KeyUsage: x509.KeyUsageDigitalSignature, ExtraExtensions: marker(oidAppStoreReceiptSigning)}, inter, interKey)
+
+	s := &testSigner{key: leafKey, roots: x509.NewCertPool()}
+	s.roots.AddCert(root)
+	for _, cert := range []*x509.Certificate{leaf, inter, root} {
+		s.chain = append(s.chain, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+	return s
+}
+
+func (s *testSigner) sign(t *testing.T, payload interface{}) string {
+	hdr, _ := json.Marshal(&jwsHeader{Alg: "ES256", X5C: s.chain})
+	body, _ := json.Marshal(payload)
+	signingInput := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	ss.FillBytes(sig[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestParseNotification(t *testing.T) {
+	s := newTestSigner(t)
+	signedPayload := s.sign(t, map[string]interface{}{
+		"notificationType": NotificationRefund,
+		"notificationUUID": "uuid",
+		"data": map[string]interface{}{
+			"bundleId":              "com.example.app",
+			"signedTransactionInfo": s.sign(t, &TransactionInfo{TransactionID: "1001", ProductID: "monthly"}),
+			"signedRenewalInfo":     s.sign(t, &RenewalInfo{AutoRenewStatus: 1}),
+		},
+	})
+
+	v := &NotificationVerifier{Roots: s.roots}
+	n, err := v.ParseNotification(signedPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.NotificationType != NotificationRefund || n.Data.BundleID != "com.example.app" ||
+		n.TransactionInfo.TransactionID != "1001" || n.RenewalInfo.AutoRenewStatus != 1 {
+		t.Fatalf("unexpected notification: %+v", n)
+	}
+
+	// Tampered payload
+	parts := strings.Split(signedPayload, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"notificationType":"REFUND_REVERSED"}`))
+	if _, err = v.ParseNotification(strings.Join(parts, ".")); err == nil {
+		t.Fatal("tampered payload accepted")
+	}
+
+	// Untrusted roots
+	v = &NotificationVerifier{Roots: newTestSigner(t).roots}
+	if _, err = v.ParseNotification(signedPayload); err == nil {
+		t.Fatal("untrusted certificate chain accepted")
+	}
+
+	// Expired certificates
+	v = &NotificationVerifier{Roots: s.roots, Now: func() time.Time { return time.Now().Add(2 * time.Hour) }}
+	if _, err = v.ParseNotification(signedPayload); err == nil {
+		t.Fatal("expired certificate chain accepted")
+	}
+}
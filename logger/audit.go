@@ -0,0 +1,249 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package logger
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"time"
+)
+
+// AuditChainError is returned by VerifyAuditChain if the audit chain is broken.
+type AuditChainError struct {
+	Line   int    // Line number where the chain is broken, starting from 1
+	Reason string // Why the chain is broken
+}
+
+func (e *AuditChainError) Error() string {
+	return "logger: audit chain broken at line " + strconv.Itoa(e.Line) + ": " + e.Reason
+}
+
+// VerifyAuditChain verifies records written with Config.AuditChain. `key` must be the same as Config.AuditChainKey.
+//
+// If Config.AuditChain is true, every record written to a log file ends with a tag holding a truncated hash, which is computed
+// over the tag of the previous record and the content of the current record:
+//
+//	text: `I12:00:00 main.go:10] user 1001 logged in #chain=2f0c6a1e95d7b443`
+//	JSON: `{"time":"...","level":"info","msg":"user 1001 logged in","chain":"2f0c6a1e95d7b443"}`
+//
+// Deleting or modifying a record breaks the chain. The chain continues across
+// rotated log files of the same level, so deleting a whole log file is detected as well if the log files are verified in order.
+//
+// Anchor records are written at the beginning of each log file, and after every Config.AuditAnchorInterval records.
+// Anchor records hold the sequence number of the record and the tag of the previous record, so that a log file can be verified
+// on its own, and records deleted from the end of a log file can be detected by comparing with anchors shipped elsewhere:
+//
+//	text: `@audit-anchor seq=1000 prev=2f0c6a1e95d7b443 time=2020-12-01T12:00:00.000001Z #chain=8e0b3f6a0c5d2e71`
+//	JSON: `{"audit_anchor":{"seq":1000,"prev":"2f0c6a1e95d7b443","time":"2020-12-01T12:00:00.000001Z"},"chain":"8e0b3f6a0c5d2e71"}`
+//
+// Plain SHA-256 only detects naive tampering, because anyone can recompute the chain. Set Config.AuditChainKey to use HMAC-SHA256
+// instead, so that the chain can't be forged without the key.
+//
+// Log files of the same level can be concatenated in order to be verified as a whole.
+// It returns nil if the chain is intact, *AuditChainError if it's broken, or the error occurred while reading `r`.
+func VerifyAuditChain(r io.Reader, key []byte) error {
+	prev := make([]byte, 0, kAuditTagLen) // Tag of the previous record, empty if not known yet
+	var record []byte
+	chain := newAuditChain(key, 0)
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull { // Long line
+			record = append(record, line...)
+			lineNum--
+			continue
+		}
+		if err == io.EOF && len(line) == 0 && len(record) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		record = append(record, line...)
+		content, tag, ok := splitAuditTag(record)
+		if !ok {
+			if err == io.EOF {
+				return &AuditChainError{Line: lineNum, Reason: "chain tag missing"}
+			}
+			continue // Multi-line record
+		}
+
+		if anchorPrev, isAnchor := parseAuditAnchor(content); isAnchor {
+			if len(prev) == 0 {
+				prev = append(prev, anchorPrev...)
+			} else if string(anchorPrev) != string(prev) {
+				return &AuditChainError{Line: lineNum, Reason: "anchor doesn't match the previous record, records might be deleted"}
+			}
+		}
+
+		if len(prev) != 0 {
+			copy(chain.prev[:], prev)
+			if string(chain.next(content)) != string(tag) {
+				return &AuditChainError{Line: lineNum, Reason: "hash mismatch, records might be modified or deleted"}
+			}
+		}
+		prev = append(prev[:0], tag...)
+		record = record[:0]
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+const (
+	kAuditTagLen            = 16 // Number of hex digits of the tag
+	kAuditTextTagPrefix     = " #chain="
+	kAuditJSONTagPrefix     = `,"chain":"`
+	kAuditTextAnchorPrefix  = "@audit-anchor seq="
+	kAuditJSONAnchorPrefix  = `{"audit_anchor":{"seq":`
+	kAuditDefAnchorInterval = 1000
+)
+
+// auditChain holds the state of the audit chain of a log file
+type auditChain struct {
+	mac            hash.Hash
+	prev           [kAuditTagLen]byte // Tag of the previous record
+	sum            []byte
+	seq            uint64 // Number of records chained
+	anchorInterval int
+	sinceAnchor    int  // Number of records since the last anchor record
+	needAnchor     bool // Set when a new log file is created
+	buf            []byte
+}
+
+func newAuditChain(key []byte, anchorInterval int) *auditChain {
+	c := &auditChain{anchorInterval: anchorInterval}
+	if len(key) > 0 {
+		c.mac = hmac.New(sha256.New, key)
+	} else {
+		c.mac = sha256.New()
+	}
+	hex.Encode(c.prev[:], make([]byte, kAuditTagLen/2))
+	return c
+}
+
+// next computes the tag of a record with `content` and advances the chain
+func (c *auditChain) next(content []byte) []byte {
+	c.mac.Reset()
+	c.mac.Write(c.prev[:])
+	c.mac.Write(content)
+	c.sum = c.mac.Sum(c.sum[:0])
+	hex.Encode(c.prev[:], c.sum[:kAuditTagLen/2])
+	c.seq++
+	return c.prev[:]
+}
+
+// chain appends a tag to `record`, and returns the tagged record. The returned slice is only valid until the next call.
+func (c *auditChain) chain(record []byte, json bool) []byte {
+	content := record
+	if n := len(content); n > 0 && content[n-1] == '\n' {
+		content = content[:n-1]
+	}
+
+	c.buf = c.buf[:0]
+	if json && len(content) > 0 && content[len(content)-1] == '}' {
+		tag := c.next(content) // Hash of the record without tag
+		c.buf = append(c.buf, content[:len(content)-1]...)
+		c.buf = append(c.buf, kAuditJSONTagPrefix...)
+		c.buf = append(c.buf, tag...)
+		c.buf = append(c.buf, "\"}\n"...)
+	} else {
+		tag := c.next(content)
+		c.buf = append(c.buf, content...)
+		c.buf = append(c.buf, kAuditTextTagPrefix...)
+		c.buf = append(c.buf, tag...)
+		c.buf = append(c.buf, '\n')
+	}
+	c.sinceAnchor++
+	return c.buf
+}
+
+// anchor returns an anchor record if it's time to write one
+func (c *auditChain) anchor(t time.Time, json bool) []byte {
+	if !c.needAnchor && c.sinceAnchor < c.anchorInterval {
+		return nil
+	}
+	c.needAnchor = false
+	c.sinceAnchor = 0
+
+	ts := t.UTC().Format(time.RFC3339Nano)
+	if json {
+		return []byte(fmt.Sprintf(`%s%d,"prev":"%s","time":"%s"}}`, kAuditJSONAnchorPrefix, c.seq+1, c.prev[:], ts))
+	}
+	return []byte(fmt.Sprintf("%s%d prev=%s time=%s", kAuditTextAnchorPrefix, c.seq+1, c.prev[:], ts))
+}
+
+// splitAuditTag splits a tagged record into content and tag
+func splitAuditTag(record []byte) (content, tag []byte, ok bool) {
+	if n := len(record); n > 0 && record[n-1] == '\n' {
+		record = record[:n-1]
+	}
+
+	n := len(record)
+	if n >= len(kAuditJSONTagPrefix)+kAuditTagLen+2 && record[n-1] == '}' && record[n-2] == '"' {
+		start := n - 2 - kAuditTagLen
+		if string(record[start-len(kAuditJSONTagPrefix):start]) == kAuditJSONTagPrefix {
+			content = append(record[:start-len(kAuditJSONTagPrefix):start-len(kAuditJSONTagPrefix)], '}')
+			return content, record[start : n-2], true
+		}
+	}
+	if n >= len(kAuditTextTagPrefix)+kAuditTagLen {
+		start := n - kAuditTagLen
+		if string(record[start-len(kAuditTextTagPrefix):start]) == kAuditTextTagPrefix {
+			return record[:start-len(kAuditTextTagPrefix)], record[start:], true
+		}
+	}
+	return nil, nil, false
+}
+
+// parseAuditAnchor returns `prev` of an anchor record
+func parseAuditAnchor(content []byte) ([]byte, bool) {
+	var prefix, prevKey string
+	switch {
+	case hasPrefix(content, kAuditTextAnchorPrefix):
+		prefix, prevKey = kAuditTextAnchorPrefix, " prev="
+	case hasPrefix(content, kAuditJSONAnchorPrefix):
+		prefix, prevKey = kAuditJSONAnchorPrefix, `,"prev":"`
+	default:
+		return nil, false
+	}
+
+	rest := content[len(prefix):]
+	for i := 0; i+len(prevKey)+kAuditTagLen <= len(rest); i++ {
+		if string(rest[i:i+len(prevKey)]) == prevKey {
+			start := i + len(prevKey)
+			return rest[start : start+kAuditTagLen], true
+		}
+	}
+	return nil, false
+}
+
+func hasPrefix(b []byte, prefix string) bool {
+	return len(b) >= len(prefix) && string(b[:len(prefix)]) == prefix
+}
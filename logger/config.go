@@ -0,0 +1,121 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package logger
+
+import (
+	"os"
+	"sync"
+)
+
+// ConfigError is returned by Init and New if the Config is invalid.
+type ConfigError struct {
+	Field  string // Name of the Config field which is invalid
+	Reason string // Why the field is invalid
+	Err    error  // Underlying error, might be nil
+}
+
+func (e *ConfigError) Error() string {
+	if e.Err != nil {
+		return "logger: invalid Config." + e.Field + ": " + e.Reason + ": " + e.Err.Error()
+	}
+	return "logger: invalid Config." + e.Field + ": " + e.Reason
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// validateConfig checks fields of `cfg` which don't depend on the file system
+func validateConfig(cfg *Config) error {
+	if cfg.LogFileMaxNum > 0 && cfg.LogFileNumToDel <= 0 {
+		return &ConfigError{Field: "LogFileNumToDel", Reason: "must be greater than 0 if LogFileMaxNum is set, otherwise logfiles will never be purged"}
+	}
+	if cfg.LogFileNumToDel > cfg.LogFileMaxNum && cfg.LogFileMaxNum > 0 {
+		return &ConfigError{Field: "LogFileNumToDel", Reason: "must not be greater than LogFileMaxNum"}
+	}
+	if cfg.LogLevel < LogLevelTrace || cfg.LogLevel >= LogLevelCount {
+		return &ConfigError{Field: "LogLevel", Reason: "unknown level"}
+	}
+	if cfg.LogDest&^LogDestBoth != 0 {
+		return &ConfigError{Field: "LogDest", Reason: "unknown destination"}
+	}
+	if cfg.LogThroughMode != LogThroughFull && cfg.LogThroughMode != LogThroughReference {
+		return &ConfigError{Field: "LogThroughMode", Reason: "unknown mode"}
+	}
+	if cfg.LogThroughMaxSpan < 0 {
+		return &ConfigError{Field: "LogThroughMaxSpan", Reason: "must not be negative"}
+	}
+	if cfg.DiskFullAction != DiskFullConsole && cfg.DiskFullAction != DiskFullDrop {
+		return &ConfigError{Field: "DiskFullAction", Reason: "unknown action"}
+	}
+	return nil
+}
+
+// checkLogDir creates `dir` if it doesn't exist, and checks if it's writable
+func checkLogDir(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return &ConfigError{Field: "LogDir", Reason: "failed to create directory", Err: err}
+	}
+
+	f, err := os.CreateTemp(dir, ".logger-write-check-*")
+	if err != nil {
+		return &ConfigError{Field: "LogDir", Reason: "directory is not writable", Err: err}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+var (
+	activePrefixesLock sync.Mutex
+	activePrefixes     = map[string]*Logger{} // path prefixes of logfiles and symlinks used by living Logger objects
+)
+
+// registerPrefixes makes sure that no other living Logger object uses the same logfile or symlink path prefix
+func (l *Logger) registerPrefixes(logPathPrefix, symlinkPathPrefix string) error {
+	keys := []string{"f:" + logPathPrefix, "s:" + symlinkPathPrefix}
+
+	activePrefixesLock.Lock()
+	defer activePrefixesLock.Unlock()
+
+	if activePrefixes[keys[0]] != nil {
+		return &ConfigError{Field: "LogFilenamePrefix", Reason: "already used by another Logger object in the same LogDir"}
+	}
+	if activePrefixes[keys[1]] != nil {
+		return &ConfigError{Field: "LogSymlinkPrefix", Reason: "already used by another Logger object in the same LogDir"}
+	}
+	for _, key := range keys {
+		activePrefixes[key] = l
+	}
+	l.prefixKeys = keys
+	return nil
+}
+
+func (l *Logger) unregisterPrefixes() {
+	activePrefixesLock.Lock()
+	for _, key := range l.prefixKeys {
+		if activePrefixes[key] == l {
+			delete(activePrefixes, key)
+		}
+	}
+	activePrefixesLock.Unlock()
+}
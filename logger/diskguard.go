@@ -0,0 +1,70 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/antigloss/go/fileutils"
+)
+
+type DiskFullAction int // DiskFullAction controls what to do with the logs destined for files while disk space is low.
+
+const (
+	DiskFullConsole DiskFullAction = iota // Write the logs to console instead.
+	DiskFullDrop                          // Drop the logs.
+)
+
+// checkDiskFull checks free space of the file system holding `logDir` at most once per kDiskCheckInterval,
+// and reports whether it's below `minFreeDisk`. Warnings are written to stderr when the state changes.
+func (l *Logger) checkDiskFull(t time.Time) bool {
+	if l.minFreeDisk == 0 {
+		return false
+	}
+
+	now := t.UnixNano()
+	last := atomic.LoadInt64(&l.diskCheckedAt)
+	if (last == 0 || now-last >= int64(kDiskCheckInterval)) && atomic.CompareAndSwapInt64(&l.diskCheckedAt, last, now) {
+		free, _, err := diskUsage(l.logDir)
+		if err == nil { // LogDir might not be created yet if LazyDirCreation is set
+			if free < l.minFreeDisk {
+				if atomic.SwapInt32(&l.diskFull, 1) == 0 {
+					action := "written to console"
+					if l.diskFullAction == DiskFullDrop {
+						action = "dropped"
+					}
+					fmt.Fprintf(os.Stderr, "logger: free disk space of %s is %d MB, below MinFreeDiskMB %d MB. Logs are %s until enough space is freed\n",
+						l.logDir, free/1024/1024, l.minFreeDisk/1024/1024, action)
+				}
+			} else if atomic.SwapInt32(&l.diskFull, 0) == 1 {
+				fmt.Fprintf(os.Stderr, "logger: free disk space of %s is %d MB, logs are written to files again\n", l.logDir, free/1024/1024)
+			}
+		}
+	}
+
+	return atomic.LoadInt32(&l.diskFull) == 1
+}
+
+const kDiskCheckInterval = time.Second
+
+var diskUsage = fileutils.DiskUsage // Replaced by tests
@@ -0,0 +1,86 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package logger
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LevelName returns the name of `level`, which is used in the names of log files and symlinks.
+// It returns an empty string if `level` is unknown to the Logger object.
+func (l *Logger) LevelName(level LogLevel) string {
+	if level < LogLevelTrace || int(level) >= len(l.levelNames) {
+		return ""
+	}
+	return l.levelNames[level]
+}
+
+// Log writes a log with `level`, which could be a built-in level or one of the user-defined levels set by Config.ExtraLevels.
+// Unlike Panic and Fatal, it never panics or exits. Logs with unknown levels are dropped.
+func (l *Logger) Log(level LogLevel, args ...interface{}) {
+	if l.knownLevel(level) {
+		l.log(int32(level), args)
+	}
+}
+
+// Logf writes a log with `level`, which could be a built-in level or one of the user-defined levels set by Config.ExtraLevels.
+// Unlike Panicf and Fatalf, it never panics or exits. Logs with unknown levels are dropped.
+func (l *Logger) Logf(level LogLevel, format string, args ...interface{}) {
+	if l.knownLevel(level) {
+		l.logf(int32(level), format, args)
+	}
+}
+
+func (l *Logger) knownLevel(level LogLevel) bool {
+	return level >= LogLevelTrace && int(level) < len(l.levelNames)
+}
+
+// buildLevelNames returns names of the built-in levels (overridden by `cfg.LevelNames`) followed by `cfg.ExtraLevels`
+func buildLevelNames(cfg *Config) ([]string, error) {
+	names := make([]string, 0, len(kLogLevelNames)+len(cfg.ExtraLevels))
+	names = append(names, kLogLevelNames[:]...)
+	for level, name := range cfg.LevelNames {
+		if level < LogLevelTrace || level >= LogLevelCount {
+			return nil, &ConfigError{Field: "LevelNames", Reason: fmt.Sprintf("unknown level %d", level)}
+		}
+		names[level] = name
+	}
+	names = append(names, cfg.ExtraLevels...)
+
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		field := "LevelNames"
+		if i >= kLogLevelCount {
+			field = "ExtraLevels"
+		}
+		if !kLevelNameRegex.MatchString(name) {
+			return nil, &ConfigError{Field: field, Reason: fmt.Sprintf("invalid name %q, only letters, digits and underscores are allowed", name)}
+		}
+		if seen[name] {
+			return nil, &ConfigError{Field: field, Reason: fmt.Sprintf("duplicate name %q", name)}
+		}
+		seen[name] = true
+	}
+	return names, nil
+}
+
+var kLevelNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
@@ -21,17 +21,23 @@
 package logger
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"os/user"
 	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
+
+	"github.com/antigloss/go/utils/clock"
 )
 
 type LogLevel int // LogLevel is used to exclude logs with lower level.
@@ -74,11 +80,13 @@ const (
 type ControlFlag int // ControlFlag controls how the logs are written. Use `|`(Or operator) to mix multiple flags.
 
 const (
-	ControlFlagLogThrough  ControlFlag = 1 << iota // Controls if logs with higher level are written to lower level log files.
-	ControlFlagLogFuncName                         // Controls if function name is prepended to the logs.
-	ControlFlagLogLineNum                          // Controls if filename and line number are prepended to the logs.
-	ControlFlagLogDate                             // Controls if a date string formatted as '20201201' is prepended to the logs.
-	ControlFlagNone        = 0
+	ControlFlagLogThrough     ControlFlag = 1 << iota // Controls if logs with higher level are written to lower level log files.
+	ControlFlagLogFuncName                            // Controls if function name is prepended to the logs.
+	ControlFlagLogLineNum                             // Controls if filename and line number are prepended to the logs.
+	ControlFlagLogDate                                // Controls if a date string formatted as '20201201' is prepended to the logs.
+	ControlFlagLogPID                                 // Controls if the process ID is prepended to the logs.
+	ControlFlagLogGoroutineID                         // Controls if goroutine ID formatted as 'g123' is prepended to the logs. It costs a call to runtime.Stack per log.
+	ControlFlagNone           = 0
 )
 
 // Config contains options for creating a new Logger object.
@@ -86,7 +94,8 @@ type Config struct {
 	// Directory to hold the log files. If left empty, current working directory is used.
 	// Should you need to create multiple Logger objects, better to associate them with different directories.
 	LogDir string
-	// Name of a log file is formatted as `LogFilenamePrefix.LogLevel.DateTime.log`.
+	// Name of a log file is formatted as `LogFilenamePrefix.LogLevel.DateTime.Seq.log`, where Seq is a rotation sequence number
+	// which keeps the names unique even if rotation happens more than once within the same microsecond.
 	// 3 placeholders are pre-defined: %P, %H and %U. When used in the prefix,
 	// %P will be replaced with the program's name, %H will be replaced with hostname,
 	// and %U will be replaced with username.
@@ -99,6 +108,9 @@ type Config struct {
 	LogSymlinkPrefix string
 	// Limit the maximum size in MB for a single log file. 0 means unlimited.
 	LogFileMaxSize uint32
+	// Limit the maximum size in bytes for a single log record (prefix included). 0 means unlimited.
+	// Records exceeding the limit are truncated, and a suffix `...[truncated N bytes]` is appended to them.
+	MaxRecordBytes uint32
 	// Limit the maximum number of log files under `LogDir`. `LogFileNumToDel` log files will be deleted if reached. <=0 means unlimited.
 	LogFileMaxNum int
 	// Number of log files to be deleted when `LogFileMaxNum` reached. <=0 means don't delete.
@@ -109,6 +121,56 @@ type Config struct {
 	LogDest LogDest
 	// How the logs are written.
 	Flag ControlFlag
+	// Custom names of the built-in levels, such as `{LogLevelTrace: "DEBUG"}`. Levels not in the map keep their default names.
+	// Names are used in the names of log files and symlinks, and their first letters are used in the prefixes of text records.
+	// Only letters, digits and underscores are allowed, and names must be unique, user-defined levels included.
+	// Names of the JSON records are controlled by FieldMapping instead.
+	LevelNames map[LogLevel]string
+	// Names of additional user-defined levels, which are numbered from LogLevelCount in order. For example, with `[]string{"AUDIT"}`,
+	// records written by `Log(LogLevelCount, ...)` go to log files named after AUDIT. User-defined levels are never filtered out by LogLevel,
+	// never copied to or from other levels by log-through, and never panic or exit.
+	// In JSON records, they are named as is, with the numeric level of LogLevelInfo.
+	ExtraLevels []string
+	// How records are copied to lower level log files if ControlFlagLogThrough is set. Default is LogThroughFull.
+	// With LogThroughReference, copies of text records longer than 64 bytes only keep the prefix and the leading 64 bytes
+	// of the message, followed by the level of the log file holding the full record, which saves disk space for error-heavy workloads.
+	// JSON records are always copied in full.
+	LogThroughMode LogThroughMode
+	// If greater than 0, records are copied to at most `LogThroughMaxSpan` lower levels if ControlFlagLogThrough is set.
+	// For example, with LogThroughMaxSpan 1, error records are copied to the WARN log file, but not the INFO one.
+	LogThroughMaxSpan int
+	// Format of the log records. Default is LogFormatText.
+	Format LogFormat
+	// Keys and values used for the fields of the JSON records. Only used if Format is LogFormatJSON.
+	// If left nil, FieldMappingDefault is used. FieldMappingECS, FieldMappingGCP and FieldMappingOTel are also provided.
+	FieldMapping *FieldMapping
+	// Size in bytes of the write buffer of each log file. 0 means logs are not buffered and are written to files immediately.
+	// Buffered logs are flushed every `FlushInterval` or whenever the buffer is full. Besides, records with error level or higher
+	// force an immediate flush of all the buffered logs, so that they are as durable as in unbuffered mode.
+	WriteBufferSize uint32
+	// Interval for flushing the buffered logs. If left 0, it'll be defaulted to 1 second. Only used if WriteBufferSize > 0.
+	FlushInterval time.Duration
+	// If true, `LogDir` is created when the first logfile is created rather than in New,
+	// and it's not validated whether `LogDir` is writable.
+	LazyDirCreation bool
+	// If true, each record written to log files is chained to the previous one with a truncated hash,
+	// so that deleted or modified records can be detected by VerifyAuditChain. Please refer to VerifyAuditChain for details.
+	AuditChain bool
+	// Key for computing the audit chain with HMAC-SHA256. If left empty, plain SHA-256 is used. Only used if AuditChain is true.
+	AuditChainKey []byte
+	// Number of records between two anchor records. If left 0, it'll be defaulted to 1000. Only used if AuditChain is true.
+	AuditAnchorInterval int
+	// If greater than 0, free space of the file system holding `LogDir` is checked (at most once per second) before writing to log files.
+	// Once it drops below MinFreeDiskMB, logs are no longer written to files but handled according to DiskFullAction,
+	// and a single warning is written to stderr. Writing to files resumes after enough space is freed.
+	MinFreeDiskMB uint32
+	// What to do with the logs destined for files while free disk space is below MinFreeDiskMB. Default is DiskFullConsole.
+	DiskFullAction DiskFullAction
+	// If not nil, every record not filtered out by LogLevel is also passed to Sink, even if LogDest is LogDestNone.
+	Sink Sink
+	// Source of the time used for timestamps, rotation by day and periodic flushing. If left nil, clock.Real is used.
+	// Set it to a clock.Fake to test time-dependent behaviors without sleeping.
+	Clock clock.Clock
 }
 
 // Init is used to create the global Logger object with cfg. It must be called once and only once
@@ -169,6 +231,20 @@ func Errorf(format string, args ...interface{}) {
 	defLogger.logf(kLogLevelError, format, args)
 }
 
+// Log uses the global Logger object created by Init to write a log with `level`, which could be a user-defined level.
+func Log(level LogLevel, args ...interface{}) {
+	if defLogger.knownLevel(level) {
+		defLogger.log(int32(level), args)
+	}
+}
+
+// Logf uses the global Logger object created by Init to write a log with `level`, which could be a user-defined level.
+func Logf(level LogLevel, format string, args ...interface{}) {
+	if defLogger.knownLevel(level) {
+		defLogger.logf(int32(level), format, args)
+	}
+}
+
 // Panic uses the global Logger object created by Init to write a log with panic level followed by a call to panic("Panicf").
 func Panic(args ...interface{}) {
 	defLogger.log(kLogLevelPanic, args)
@@ -198,18 +274,39 @@ func Fatalf(format string, args ...interface{}) {
 //
 //  1. Auto rotation: It'll create a new logfile whenever day changes or size of the current logfile exceeds the configured size limit.
 //  2. Auto purging: It'll delete some oldest logfiles whenever the number of logfiles exceeds the configured limit.
-//  3. Log-through: Logs with higher severity level will be written to all the logfiles with lower severity level.
+//  3. Log-through: Logs with higher severity level will be written to all the logfiles with lower severity level, in full or as compact references.
 //  4. Log levels: 6 different levels are supported. Logs with different levels are written to different logfiles. By setting the Logger object to a higher log level, lower level logs will be filtered out.
-//  5. Logs are not buffered, they are written to logfiles immediately with os.(*File).Write().
+//  5. Logs are not buffered by default, they are written to logfiles immediately with os.(*File).Write().
+//     If buffered, logs with error level or higher still force all buffered logs to be written to logfiles immediately.
 //  6. It'll create symlinks that link to the most current logfiles.
 type Logger struct {
 	// Variables not allowed to be changed at runtime go here
 	logDir         string
 	logPathPrefix  string
 	logFileMaxSize int64
+	maxRecordBytes int
 	logFileMaxNum  int
 	logFilesToDel  int
 	flag           ControlFlag
+	throughMode    LogThroughMode
+	throughMaxSpan int
+	format         LogFormat
+	fieldMapping   *FieldMapping
+	writeBufSize   int
+	lazyDirCreate  bool
+	prefixKeys     []string // keys registered in `activePrefixes`
+	auditChain     bool
+	auditChainKey  []byte
+	anchorInterval int
+	clock          clock.Clock
+	minFreeDisk    uint64 // in bytes, 0 means free disk space is not checked
+	diskFullAction DiskFullAction
+	sink           Sink
+	levelNames     []string // Names of the built-in levels followed by the user-defined ones
+
+	// Variables used by the disk space guard go here
+	diskCheckedAt int64 // Unix nanoseconds of the last check
+	diskFull      int32 // 1 if free disk space is below `minFreeDisk`
 
 	// Variables allowed to be changed at runtime go here
 	logLevel int32
@@ -220,20 +317,40 @@ type Logger struct {
 	logFilenameRegex *regexp.Regexp
 	logFilePurgeCh   chan bool
 
+	// Variables used by the log-flushing goroutine go here
+	flushStopCh chan struct{}
+
 	// Logger implementation
 	bufPool bufferPool
-	loggers [kLogLevelCount]logger
+	loggers []logger // One for each level, user-defined levels included
 }
 
 // New can be used to create as many Logger objects as desired, while the global Logger object created by Init should be enough for most cases.
 // Should you need to create multiple Logger objects, better to associate them with different directories, at least with different filename prefixes(including symlink prefixes),
 // otherwise they will not work properly.
+//
+// Misconfigurations are reported as *ConfigError.
 func New(cfg *Config) (logger *Logger, err error) {
+	err = validateConfig(cfg)
+	if err != nil {
+		return
+	}
+	levelNames, err := buildLevelNames(cfg)
+	if err != nil {
+		return
+	}
+
 	logDir := cfg.LogDir
 	if len(logDir) > 0 {
-		err = os.MkdirAll(logDir, 0755)
+		logDir, err = filepath.Abs(logDir)
 		if err != nil {
-			return
+			return nil, &ConfigError{Field: "LogDir", Reason: "invalid path", Err: err}
+		}
+		if !cfg.LazyDirCreation {
+			err = checkLogDir(logDir)
+			if err != nil {
+				return
+			}
 		}
 		if logDir[len(logDir)-1] != os.PathSeparator {
 			logDir += string(os.PathSeparator)
@@ -247,13 +364,34 @@ func New(cfg *Config) (logger *Logger, err error) {
 	}
 
 	logger = &Logger{
-		logDir:        logDir,
-		logFileMaxNum: cfg.LogFileMaxNum,
-		logFileCurNum: cfg.LogFileMaxNum, // Force to check if purging needed at startup
-		logFilesToDel: cfg.LogFileNumToDel,
-		logLevel:      int32(cfg.LogLevel),
-		logDest:       uint32(cfg.LogDest),
-		flag:          cfg.Flag,
+		logDir:         logDir,
+		maxRecordBytes: int(cfg.MaxRecordBytes),
+		logFileMaxNum:  cfg.LogFileMaxNum,
+		logFileCurNum:  cfg.LogFileMaxNum, // Force to check if purging needed at startup
+		logFilesToDel:  cfg.LogFileNumToDel,
+		logLevel:       int32(cfg.LogLevel),
+		logDest:        uint32(cfg.LogDest),
+		flag:           cfg.Flag,
+		throughMode:    cfg.LogThroughMode,
+		throughMaxSpan: cfg.LogThroughMaxSpan,
+		format:         cfg.Format,
+		fieldMapping:   cfg.FieldMapping,
+		writeBufSize:   int(cfg.WriteBufferSize),
+		lazyDirCreate:  cfg.LazyDirCreation,
+		auditChain:     cfg.AuditChain,
+		auditChainKey:  cfg.AuditChainKey,
+		anchorInterval: cfg.AuditAnchorInterval,
+		clock:          clock.OrReal(cfg.Clock),
+		minFreeDisk:    uint64(cfg.MinFreeDiskMB) * 1024 * 1024,
+		diskFullAction: cfg.DiskFullAction,
+		sink:           cfg.Sink,
+		levelNames:     levelNames,
+	}
+	if logger.anchorInterval <= 0 {
+		logger.anchorInterval = kAuditDefAnchorInterval
+	}
+	if logger.fieldMapping == nil {
+		logger.fieldMapping = FieldMappingDefault
 	}
 
 	if cfg.LogFileMaxSize > 0 {
@@ -265,6 +403,16 @@ func New(cfg *Config) (logger *Logger, err error) {
 	err = logger.initLoggerImpl(cfg.LogFilenamePrefix, cfg.LogSymlinkPrefix)
 	if err != nil {
 		logger = nil
+		return
+	}
+
+	if logger.writeBufSize > 0 {
+		flushInterval := cfg.FlushInterval
+		if flushInterval <= 0 {
+			flushInterval = time.Second
+		}
+		logger.flushStopCh = make(chan struct{})
+		go logger.flushPeriodically(flushInterval) // Flush buffered logs in another goroutine
 	}
 	return
 }
@@ -272,14 +420,29 @@ func New(cfg *Config) (logger *Logger, err error) {
 // Close should be call once and only once to destroy the Logger object.
 func (l *Logger) Close() error {
 	atomic.StoreUint32(&l.logDest, kLogDestNone)
-	for i := kLogLevelTrace; i != kLogLevelCount; i++ {
+	if l.flushStopCh != nil {
+		close(l.flushStopCh)
+	}
+	for i := range l.loggers {
 		l.loggers[i].close()
 	}
-	l.logFilePurgeCh <- false
+	if l.logFilePurgeCh != nil {
+		l.logFilePurgeCh <- false
+	}
+	l.unregisterPrefixes()
 
 	return nil
 }
 
+// Flush writes all the buffered logs to logfiles. It's a no-op if WriteBufferSize is 0.
+func (l *Logger) Flush() {
+	if l.writeBufSize > 0 {
+		for i := range l.loggers {
+			l.loggers[i].flush()
+		}
+	}
+}
+
 // SetLogLevel tells the Logger object not to write logs below `logLevel`.
 func (l *Logger) SetLogLevel(logLevel LogLevel) {
 	atomic.StoreInt32(&l.logLevel, int32(logLevel))
@@ -366,10 +529,19 @@ func (l *Logger) initLoggerImpl(filenamePrefix, symlinkPrefix string) (err error
 	symlinkPrefix = strings.Replace(symlinkPrefix, "%U", kUsername, -1)
 	symlinkPrefix += "."
 
-	for i := int32(kLogLevelTrace); i != kLogLevelCount; i++ {
-		l.loggers[i].level = i
+	err = l.registerPrefixes(l.logPathPrefix, l.logDir+symlinkPrefix)
+	if err != nil {
+		return
+	}
+
+	l.loggers = make([]logger, len(l.levelNames))
+	for i := range l.loggers {
+		l.loggers[i].level = int32(i)
 		l.loggers[i].parent = l
-		l.loggers[i].symlinkFullPath = l.logDir + symlinkPrefix + kLogLevelNames[i]
+		l.loggers[i].symlinkFullPath = l.logDir + symlinkPrefix + l.levelNames[i]
+		if l.auditChain {
+			l.loggers[i].chain = newAuditChain(l.auditChainKey, l.anchorInterval)
+		}
 	}
 
 	if l.logFileMaxNum > 0 && l.logFilesToDel > 0 {
@@ -377,13 +549,8 @@ func (l *Logger) initLoggerImpl(filenamePrefix, symlinkPrefix string) (err error
 		sb.WriteByte('^')
 		sb.WriteString(regexp.QuoteMeta(filenamePrefix))
 		sb.WriteString(`\.(`)
-		lastLevelNameIdx := len(kLogLevelNames) - 1
-		for i := 0; i < lastLevelNameIdx; i++ {
-			sb.WriteString(kLogLevelNames[i])
-			sb.WriteByte('|')
-		}
-		sb.WriteString(kLogLevelNames[lastLevelNameIdx])
-		sb.WriteString(`)\.\d{20}\.log$`)
+		sb.WriteString(strings.Join(l.levelNames, "|"))
+		sb.WriteString(`)\.\d{20}(\.\d{6})?\.log$`) // Seq is absent in log files created by older versions
 
 		l.logFilenameRegex, err = regexp.Compile(sb.String())
 		if err == nil {
@@ -408,6 +575,20 @@ func (l *Logger) purgeLogFiles() {
 	}
 }
 
+func (l *Logger) flushPeriodically(interval time.Duration) {
+	ticker := l.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			l.Flush()
+		case <-l.flushStopCh:
+			return
+		}
+	}
+}
+
 func (l *Logger) tryPurgeOldLogFiles() {
 	if l.logFileCurNum < l.logFileMaxNum {
 		return
@@ -415,6 +596,9 @@ func (l *Logger) tryPurgeOldLogFiles() {
 
 	files, err := l.getLogFilenames()
 	if err != nil {
+		if l.lazyDirCreate && os.IsNotExist(err) { // Nothing to purge
+			return
+		}
 		l.Errorf("Failed to purge old log files: %s", err)
 		return
 	}
@@ -462,28 +646,30 @@ func (l *Logger) getLogFilenames() ([]string, error) {
 func (l *Logger) log(logLevel int32, args []interface{}) {
 	lowestLogLevel := atomic.LoadInt32(&l.logLevel)
 	logDest := atomic.LoadUint32(&l.logDest)
-	if lowestLogLevel > logLevel || logDest == kLogDestNone {
+	if lowestLogLevel > logLevel || (logDest == kLogDestNone && l.sink == nil) {
 		return
 	}
 
-	buf := l.bufPool.getBuffer()
-
-	t := time.Now()
-	l.genLogPrefix(buf, logLevel, 3, t)
-	fmt.Fprintln(buf, args...)
-	output := buf.Bytes()
-	if logDest&kLogDestFile != kLogDestNone {
-		if l.flag&ControlFlagLogThrough != ControlFlagNone {
-			for i := logLevel; i >= lowestLogLevel; i-- {
-				l.loggers[i].log(t, output)
-			}
-		} else {
-			l.loggers[logLevel].log(t, output)
+	t := l.clock.Now()
+	if l.sink != nil {
+		msg := fmt.Sprintln(args...)
+		l.sink.Write(&Entry{Time: t, Level: LogLevel(logLevel), Message: msg[:len(msg)-1]})
+		if logDest == kLogDestNone {
+			return
 		}
 	}
-	if logDest&kLogDestConsole != kLogDestNone {
-		os.Stdout.Write(output)
+
+	buf := l.bufPool.getBuffer()
+
+	if l.format == LogFormatJSON {
+		msg := fmt.Sprintln(args...)
+		l.genJSONRecord(buf, logLevel, 3, t, msg[:len(msg)-1])
+	} else {
+		l.genLogPrefix(buf, logLevel, 3, t)
+		fmt.Fprintln(buf, args...)
+		l.truncateRecord(buf)
 	}
+	l.output(logLevel, lowestLogLevel, logDest, t, buf.Bytes())
 
 	l.bufPool.putBuffer(buf)
 }
@@ -491,38 +677,73 @@ func (l *Logger) log(logLevel int32, args []interface{}) {
 func (l *Logger) logf(logLevel int32, format string, args []interface{}) {
 	lowestLogLevel := atomic.LoadInt32(&l.logLevel)
 	logDest := atomic.LoadUint32(&l.logDest)
-	if lowestLogLevel > logLevel || logDest == kLogDestNone {
+	if lowestLogLevel > logLevel || (logDest == kLogDestNone && l.sink == nil) {
 		return
 	}
 
+	t := l.clock.Now()
+	if l.sink != nil {
+		l.sink.Write(&Entry{Time: t, Level: LogLevel(logLevel), Message: fmt.Sprintf(format, args...)})
+		if logDest == kLogDestNone {
+			return
+		}
+	}
+
 	buf := l.bufPool.getBuffer()
 
-	t := time.Now()
-	l.genLogPrefix(buf, logLevel, 3, t)
-	fmt.Fprintf(buf, format, args...)
-	buf.WriteByte('\n')
-	output := buf.Bytes()
-	if logDest&kLogDestFile != kLogDestNone {
-		if l.flag&ControlFlagLogThrough != ControlFlagNone {
-			for i := logLevel; i >= lowestLogLevel; i-- {
-				l.loggers[i].log(t, output)
-			}
+	if l.format == LogFormatJSON {
+		l.genJSONRecord(buf, logLevel, 3, t, fmt.Sprintf(format, args...))
+	} else {
+		l.genLogPrefix(buf, logLevel, 3, t)
+		fmt.Fprintf(buf, format, args...)
+		buf.WriteByte('\n')
+		l.truncateRecord(buf)
+	}
+	l.output(logLevel, lowestLogLevel, logDest, t, buf.Bytes())
+
+	l.bufPool.putBuffer(buf)
+}
+
+// output writes a formatted log record to the destinations
+func (l *Logger) output(logLevel, lowestLogLevel int32, logDest uint32, t time.Time, output []byte) {
+	if logDest&kLogDestFile != kLogDestNone && !l.checkDiskFull(t) {
+		if l.flag&ControlFlagLogThrough != ControlFlagNone && logLevel < kLogLevelCount {
+			l.logThrough(logLevel, lowestLogLevel, t, output)
 		} else {
 			l.loggers[logLevel].log(t, output)
 		}
+		if logLevel >= kLogLevelError && logLevel < kLogLevelCount {
+			l.Flush() // Important records must not stay in the buffer
+		}
+	} else if logDest&kLogDestFile != kLogDestNone && l.diskFullAction == DiskFullConsole {
+		logDest |= kLogDestConsole
 	}
 	if logDest&kLogDestConsole != kLogDestNone {
 		os.Stdout.Write(output)
 	}
+}
 
-	l.bufPool.putBuffer(buf)
+// truncateRecord truncates the record held by `buf` if its size exceeds `maxRecordBytes`
+func (l *Logger) truncateRecord(buf *buffer) {
+	if l.maxRecordBytes <= 0 || buf.Len() <= l.maxRecordBytes {
+		return
+	}
+
+	n := l.maxRecordBytes
+	b := buf.Bytes()
+	for n > 0 && !utf8.RuneStart(b[n]) { // don't break a multibyte character
+		n--
+	}
+	truncated := len(b) - 1 - n // newline excluded
+	buf.Truncate(n)
+	fmt.Fprintf(buf, "...[truncated %d bytes]\n", truncated)
 }
 
 func (l *Logger) genLogPrefix(buf *buffer, logLevel int32, skip int, t time.Time) {
 	h, m, s := t.Clock()
 
 	// time
-	buf.tmp[0] = kLogLevelChar[logLevel]
+	buf.tmp[0] = l.levelNames[logLevel][0]
 	surplus := 0
 	if l.flag&ControlFlagLogDate != ControlFlagNone {
 		year, mon, day := t.Date()
@@ -539,6 +760,15 @@ func (l *Logger) genLogPrefix(buf *buffer, logLevel int32, skip int, t time.Time
 	buf.twoDigits(7+surplus, s)
 	buf.Write(buf.tmp[:9+surplus])
 
+	if l.flag&ControlFlagLogPID != ControlFlagNone {
+		buf.WriteByte(' ')
+		buf.WriteString(kPID)
+	}
+	if l.flag&ControlFlagLogGoroutineID != ControlFlagNone {
+		buf.WriteString(" g")
+		buf.Write(strconv.AppendUint(buf.tmp[:0], goroutineID(), 10))
+	}
+
 	var pc uintptr
 	var ok bool
 	if l.flag&ControlFlagLogLineNum != ControlFlagNone {
@@ -568,8 +798,11 @@ func (l *Logger) genLogPrefix(buf *buffer, logLevel int32, skip int, t time.Time
 
 type logger struct {
 	file   *os.File
+	writer *bufio.Writer // nil if logs are not buffered
 	day    int
 	size   int64
+	seq    int         // Rotation sequence number
+	chain  *auditChain // nil if Config.AuditChain is false
 	closed bool
 	lock   sync.Mutex // Protects variables above
 
@@ -583,32 +816,46 @@ func (l *logger) close() {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
+	if l.writer != nil {
+		l.writer.Flush()
+	}
 	l.file.Close()
 	l.file = nil
 	l.closed = true
 }
 
 func (l *logger) log(t time.Time, data []byte) {
-	y, m, d := t.Date()
+	_, _, d := t.Date()
 
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
 	if !l.closed {
 		if l.size >= l.parent.logFileMaxSize || l.day != d || l.file == nil {
-			hour, min, sec := t.Clock()
-			filename := fmt.Sprintf("%s%s.%d%02d%02d%02d%02d%02d%06d.log", l.parent.logPathPrefix, kLogLevelNames[l.level],
-				y, m, d, hour, min, sec, t.Nanosecond()/1000)
-			newFile, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if l.parent.lazyDirCreate {
+				os.MkdirAll(l.parent.logDir, 0755) // Error is reported by OpenFile
+			}
+			filename, newFile, err := l.createFile(t)
 			if err != nil {
 				l.errLog(t, data, err)
 				return
 			}
 
+			if l.parent.writeBufSize > 0 {
+				if l.writer == nil {
+					l.writer = bufio.NewWriterSize(newFile, l.parent.writeBufSize)
+				} else {
+					l.writer.Flush() // Flush into the old file
+					l.writer.Reset(newFile)
+				}
+			}
 			l.file.Close()
 			l.file = newFile
 			l.day = d
 			l.size = 0
+			if l.chain != nil {
+				l.chain.needAnchor = true
+			}
 
 			err = os.RemoveAll(l.symlinkFullPath)
 			if err != nil {
@@ -624,9 +871,56 @@ func (l *logger) log(t time.Time, data []byte) {
 			}
 		}
 
-		n, _ := l.file.Write(data)
-		l.size += int64(n)
+		l.write(data)
+	}
+}
+
+// createFile creates a new log file with a unique name. It should only be called within (*logger).log()
+func (l *logger) createFile(t time.Time) (filename string, file *os.File, err error) {
+	y, m, d := t.Date()
+	hour, min, sec := t.Clock()
+	for i := 0; i < kMaxCreateFileRetries; i++ {
+		l.seq = (l.seq + 1) % kMaxRotationSeq
+		filename = fmt.Sprintf("%s%s.%d%02d%02d%02d%02d%02d%06d.%06d.log", l.parent.logPathPrefix, l.parent.levelNames[l.level],
+			y, m, d, hour, min, sec, t.Nanosecond()/1000, l.seq)
+		// O_EXCL guarantees that an existing log file, probably created by another process with the same prefix, is never reused
+		file, err = os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+		if !os.IsExist(err) {
+			return
+		}
 	}
+	return
+}
+
+func (l *logger) flush() {
+	l.lock.Lock()
+	if l.writer != nil && !l.closed {
+		l.writer.Flush()
+	}
+	l.lock.Unlock()
+}
+
+// write should only be called within (*logger).log()
+func (l *logger) write(data []byte) {
+	if l.chain != nil {
+		json := l.parent.format == LogFormatJSON
+		if anchor := l.chain.anchor(l.parent.clock.Now(), json); anchor != nil {
+			l.writeRaw(l.chain.chain(anchor, json))
+		}
+		data = l.chain.chain(data, json)
+	}
+	l.writeRaw(data)
+}
+
+// writeRaw should only be called within (*logger).write()
+func (l *logger) writeRaw(data []byte) {
+	var n int
+	if l.writer != nil {
+		n, _ = l.writer.Write(data)
+	} else {
+		n, _ = l.file.Write(data)
+	}
+	l.size += int64(n)
 }
 
 // errLog should only be called within (*logger).log()
@@ -637,11 +931,9 @@ func (l *logger) errLog(t time.Time, originLog []byte, err error) {
 	buf.WriteString(err.Error())
 	buf.WriteByte('\n')
 	if l.file != nil {
-		n, _ := l.file.Write(buf.Bytes())
-		l.size += int64(n)
+		l.write(buf.Bytes())
 		if len(originLog) > 0 {
-			n, _ = l.file.Write(originLog)
-			l.size += int64(n)
+			l.write(originLog)
 		}
 	} else {
 		os.Stderr.Write(buf.Bytes())
@@ -661,15 +953,22 @@ func (a byCreatedTime) Len() int {
 }
 
 func (a byCreatedTime) Less(i, j int) bool {
-	s1, s2 := a[i], a[j]
-	l1, l2 := len(s1), len(s2)
-	return s1[l1-24:l1-4] < s2[l2-24:l2-4]
+	return createdTimeKey(a[i]) < createdTimeKey(a[j])
 }
 
 func (a byCreatedTime) Swap(i, j int) {
 	a[i], a[j] = a[j], a[i]
 }
 
+// createdTimeKey returns DateTime and Seq (if any) embedded in the filename
+func createdTimeKey(filename string) string {
+	name := filename[:len(filename)-4]              // Strip ".log"
+	if n := len(name); n > 27 && name[n-7] == '.' { // DateTime.Seq
+		return name[n-27:n-7] + name[n-6:]
+	}
+	return name[len(name)-20:]
+}
+
 // init is called after all the variable declarations in the package have evaluated their initializers,
 // and those are evaluated only after all the imported packages have been initialized.
 // Besides initializations that cannot be expressed as declarations, a common use of init functions is to verify
@@ -677,6 +976,7 @@ func (a byCreatedTime) Swap(i, j int) {
 func init() {
 	tmpStrArr := strings.Split(path.Base(os.Args[0]), "\\") // for compatible with `go run` under Windows
 	kProgramName = tmpStrArr[len(tmpStrArr)-1]
+	kPID = strconv.Itoa(os.Getpid())
 
 	var err error
 	kHostname, err = os.Hostname()
@@ -694,14 +994,16 @@ func init() {
 }
 
 const (
-	kMaxInt64     = int64(^uint64(0) >> 1)
-	kLogLevelChar = "TIWEPF"
+	kMaxInt64             = int64(^uint64(0) >> 1)
+	kMaxRotationSeq       = 1000000 // Seq in the filename has 6 digits
+	kMaxCreateFileRetries = 100
 )
 
 var (
 	kLogLevelNames = [kLogLevelCount]string{"TRACE", "INFO", "WARN", "ERROR", "PANIC", "FATAL"}
 
 	kProgramName string
+	kPID         string
 	kHostname    string
 	kUsername    string
 
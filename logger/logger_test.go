@@ -21,7 +21,18 @@
 package logger
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/antigloss/go/fileutils"
+	"github.com/antigloss/go/utils/clock"
 )
 
 func init() {
@@ -48,3 +59,537 @@ func BenchmarkLogger(b *testing.B) {
 		}
 	})
 }
+
+func TestTruncateRecord(t *testing.T) {
+	l := &Logger{maxRecordBytes: 10}
+	buf := l.bufPool.getBuffer()
+	buf.WriteString("0123456789abcdef\n")
+	l.truncateRecord(buf)
+	if buf.String() != "0123456789...[truncated 6 bytes]\n" {
+		t.Errorf("Unexpected truncated record: %q", buf.String())
+	}
+
+	buf.Reset()
+	buf.WriteString("012345678\u4e2d\n")
+	l.truncateRecord(buf)
+	if !strings.HasPrefix(buf.String(), "012345678...[truncated 3 bytes]") {
+		t.Errorf("Multibyte character should not be broken: %q", buf.String())
+	}
+}
+
+func TestGenJSONRecord(t *testing.T) {
+	l := &Logger{fieldMapping: FieldMappingECS}
+	buf := l.bufPool.getBuffer()
+	l.genJSONRecord(buf, kLogLevelWarn, 1, time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC), "a \"quoted\"\tmsg")
+	expected := `{"@timestamp":"2020-01-02T03:04:05.000006Z","log.level":"warn","message":"a \"quoted\"\tmsg"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected JSON record: %q", buf.String())
+	}
+
+	buf.Reset()
+	l.fieldMapping = FieldMappingOTel
+	l.flag = ControlFlagLogLineNum
+	l.genJSONRecord(buf, kLogLevelInfo, 1, time.Unix(0, 1), "msg")
+	if !strings.HasPrefix(buf.String(), `{"Timestamp":1,"SeverityText":"INFO","SeverityNumber":9,"Body":"msg","Attributes":{"code.filepath":"logger_test.go","code.lineno":`) {
+		t.Errorf("Unexpected JSON record: %q", buf.String())
+	}
+}
+
+func TestAdaptiveFlush(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(&Config{
+		LogDir:            dir,
+		LogFilenamePrefix: "flush",
+		LogSymlinkPrefix:  "flush",
+		LogFileMaxNum:     100,
+		LogFileNumToDel:   10,
+		LogLevel:          LogLevelInfo,
+		LogDest:           LogDestFile,
+		WriteBufferSize:   4096,
+		FlushInterval:     time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	readInfo := func() string {
+		data, _ := os.ReadFile(filepath.Join(dir, "flush.INFO"))
+		return string(data)
+	}
+
+	l.Info("buffered")
+	if content := readInfo(); content != "" {
+		t.Errorf("Info record should be buffered: %q", content)
+	}
+	l.Error("important")
+	if content := readInfo(); !strings.Contains(content, "buffered") {
+		t.Errorf("Error record should flush the buffered records: %q", content)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	newConfig := func() *Config {
+		return &Config{
+			LogDir:            dir,
+			LogFilenamePrefix: "validation",
+			LogSymlinkPrefix:  "validation",
+			LogFileMaxNum:     100,
+			LogFileNumToDel:   10,
+			LogDest:           LogDestFile,
+		}
+	}
+	expectError := func(cfg *Config, field string) {
+		l, err := New(cfg)
+		var cfgErr *ConfigError
+		if !errors.As(err, &cfgErr) || cfgErr.Field != field {
+			t.Errorf("Expecting ConfigError of %s but gets %v", field, err)
+		}
+		if l != nil {
+			l.Close()
+		}
+	}
+
+	cfg := newConfig()
+	cfg.LogFileNumToDel = 0
+	expectError(cfg, "LogFileNumToDel")
+
+	cfg = newConfig()
+	cfg.LogThroughMode = LogThroughReference + 1
+	expectError(cfg, "LogThroughMode")
+
+	cfg = newConfig()
+	cfg.LogThroughMaxSpan = -1
+	expectError(cfg, "LogThroughMaxSpan")
+
+	l, err := New(newConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectError(newConfig(), "LogFilenamePrefix")
+	cfg = newConfig()
+	cfg.LogFilenamePrefix = "other"
+	expectError(cfg, "LogSymlinkPrefix")
+	l.Close()
+	if l, err = New(newConfig()); err != nil {
+		t.Errorf("Prefixes should be released after Close: %v", err)
+	} else {
+		l.Close()
+	}
+
+	cfg = newConfig()
+	cfg.LogDir = filepath.Join(dir, "lazy")
+	cfg.LazyDirCreation = true
+	if l, err = New(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(cfg.LogDir); !os.IsNotExist(err) {
+		t.Errorf("LogDir should not be created yet: %v", err)
+	}
+	l.Info("created")
+	if _, err = os.Stat(cfg.LogDir); err != nil {
+		t.Errorf("LogDir should be created: %v", err)
+	}
+	l.Close()
+}
+
+func TestCapturePanics(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(&Config{
+		LogDir:            dir,
+		LogFilenamePrefix: "panic",
+		LogSymlinkPrefix:  "panic",
+		LogLevel:          LogLevelInfo,
+		LogDest:           LogDestFile,
+		WriteBufferSize:   4096,
+		FlushInterval:     time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.Info("buffered")
+	r := func() (r interface{}) {
+		defer func() { r = recover() }()
+		defer l.CapturePanics()
+		panic("boom")
+	}()
+	if r != "boom" {
+		t.Errorf("Should re-panic with the same value: %v", r)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "panic.PANIC"))
+	content := string(data)
+	if !strings.Contains(content, "Unhandled panic: boom") || !strings.Contains(content, "TestCapturePanics") {
+		t.Errorf("Panic should be logged with stack trace: %q", content)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "panic.INFO"))
+	if !strings.Contains(string(data), "buffered") {
+		t.Errorf("Buffered logs should be flushed: %q", data)
+	}
+}
+
+func TestRotationCollision(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(&Config{
+		LogDir:            dir,
+		LogFilenamePrefix: "rotate",
+		LogSymlinkPrefix:  "rotate",
+		LogFileMaxNum:     100,
+		LogFileNumToDel:   10,
+		LogLevel:          LogLevelInfo,
+		LogDest:           LogDestFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Now()
+	lg := &l.loggers[kLogLevelInfo]
+	for i := 0; i < 3; i++ {
+		lg.log(now, []byte("record\n"))
+		lg.size = kMaxInt64 // Force rotation within the same microsecond
+	}
+
+	files, err := l.getLogFilenames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expecting 3 unique log files: %v", files)
+	}
+
+	files = append(files, "rotate.INFO.20000101000000000000.log") // Created by older versions
+	sort.Sort(byCreatedTime(files))
+	if files[0] != "rotate.INFO.20000101000000000000.log" || !strings.HasSuffix(files[1], ".000001.log") || !strings.HasSuffix(files[3], ".000003.log") {
+		t.Errorf("Unexpected order: %v", files)
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	for _, format := range []LogFormat{LogFormatText, LogFormatJSON} {
+		dir := t.TempDir()
+		l, err := New(&Config{
+			LogDir:              dir,
+			LogFilenamePrefix:   "audit",
+			LogSymlinkPrefix:    "audit",
+			LogFileMaxNum:       100,
+			LogFileNumToDel:     10,
+			LogLevel:            LogLevelInfo,
+			LogDest:             LogDestFile,
+			Format:              format,
+			AuditChain:          true,
+			AuditChainKey:       []byte("secret"),
+			AuditAnchorInterval: 3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lg := &l.loggers[kLogLevelInfo]
+		for i := 0; i < 10; i++ {
+			l.Infof("record %d", i)
+			if i == 5 {
+				l.Info("multi\nline")
+				lg.size = kMaxInt64 // Force rotation
+			}
+		}
+		l.Close()
+
+		files, _ := l.getLogFilenames()
+		sort.Sort(byCreatedTime(files))
+		var all []byte
+		for _, f := range files {
+			data, _ := os.ReadFile(filepath.Join(dir, f))
+			if err = VerifyAuditChain(bytes.NewReader(data), []byte("secret")); err != nil {
+				t.Errorf("Log file should be verified on its own: %v", err)
+			}
+			all = append(all, data...)
+		}
+		if len(files) != 2 {
+			t.Fatalf("Expecting 2 log files: %v", files)
+		}
+		if err = VerifyAuditChain(bytes.NewReader(all), []byte("secret")); err != nil {
+			t.Errorf("Unexpected error of format %d: %v\n%s", format, err, all)
+		}
+		if err = VerifyAuditChain(bytes.NewReader(all), []byte("other")); err == nil {
+			t.Error("Verification should fail with a wrong key")
+		}
+
+		lines := strings.SplitAfter(string(all), "\n")
+		modified := strings.Join(lines[:2], "") + strings.Replace(lines[2], "record", "recorD", 1) + strings.Join(lines[3:], "")
+		var chainErr *AuditChainError
+		if err = VerifyAuditChain(strings.NewReader(modified), []byte("secret")); !errors.As(err, &chainErr) || chainErr.Line != 3 {
+			t.Errorf("Modification should be detected at line 3: %v", err)
+		}
+		deleted := strings.Join(lines[:2], "") + strings.Join(lines[3:], "")
+		if err = VerifyAuditChain(strings.NewReader(deleted), []byte("secret")); !errors.As(err, &chainErr) || chainErr.Line != 3 {
+			t.Errorf("Deletion should be detected at line 3: %v", err)
+		}
+	}
+}
+
+func TestRotationByDay(t *testing.T) {
+	dir := t.TempDir()
+	fc := clock.NewFake(time.Date(2020, 12, 1, 23, 59, 59, 0, time.Local))
+	l, err := New(&Config{
+		LogDir:            dir,
+		LogFilenamePrefix: "day",
+		LogSymlinkPrefix:  "day",
+		LogFileMaxNum:     100,
+		LogFileNumToDel:   10,
+		LogLevel:          LogLevelInfo,
+		LogDest:           LogDestFile,
+		Clock:             fc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.Info("before midnight")
+	l.Info("before midnight again")
+	fc.Advance(time.Second)
+	l.Info("after midnight")
+
+	files, _ := l.getLogFilenames()
+	sort.Sort(byCreatedTime(files))
+	if len(files) != 2 || !strings.Contains(files[0], ".20201201") || !strings.Contains(files[1], ".20201202") {
+		t.Errorf("Expecting a new log file after midnight: %v", files)
+	}
+}
+
+func TestDiskFull(t *testing.T) {
+	dir := t.TempDir()
+	fc := clock.NewFake(time.Date(2020, 12, 1, 10, 0, 0, 0, time.Local))
+	var free uint64 = 200 * 1024 * 1024
+	diskUsage = func(path string) (uint64, uint64, error) {
+		return free, 1024 * 1024 * 1024, nil
+	}
+	defer func() { diskUsage = fileutils.DiskUsage }()
+
+	l, err := New(&Config{
+		LogDir:            dir,
+		LogFilenamePrefix: "disk",
+		LogSymlinkPrefix:  "disk",
+		LogLevel:          LogLevelInfo,
+		LogDest:           LogDestFile,
+		MinFreeDiskMB:     100,
+		DiskFullAction:    DiskFullDrop,
+		Clock:             fc,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.Info("written")
+	free = 50 * 1024 * 1024
+	l.Info("written before the next check")
+	fc.Advance(time.Second)
+	l.Info("dropped")
+	free = 500 * 1024 * 1024
+	fc.Advance(time.Second)
+	l.Info("written again")
+
+	cont, _ := os.ReadFile(filepath.Join(dir, "disk.INFO"))
+	if !bytes.Contains(cont, []byte("] written\n")) || !bytes.Contains(cont, []byte("written before the next check")) ||
+		bytes.Contains(cont, []byte("dropped")) || !bytes.Contains(cont, []byte("written again")) {
+		t.Errorf("Unexpected logs: %s", cont)
+	}
+}
+
+func TestLogThrough(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(&Config{
+		LogDir:            dir,
+		LogFilenamePrefix: "through",
+		LogSymlinkPrefix:  "through",
+		LogLevel:          LogLevelTrace,
+		LogDest:           LogDestFile,
+		Flag:              ControlFlagLogThrough,
+		LogThroughMode:    LogThroughReference,
+		LogThroughMaxSpan: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	long := strings.Repeat("x", 100)
+	l.Error("short")
+	l.Error(long)
+
+	read := func(level string) string {
+		cont, _ := os.ReadFile(filepath.Join(dir, "through."+level))
+		return string(cont)
+	}
+	if s := read("ERROR"); !strings.Contains(s, "] short\n") || !strings.Contains(s, "] "+long+"\n") {
+		t.Errorf("Full records expected: %s", s)
+	}
+	for _, level := range []string{"WARN", "INFO"} {
+		if s := read(level); !strings.Contains(s, "] short\n") || !strings.Contains(s, "] [-> ERROR] "+long[:64]+"...\n") || strings.Contains(s, long) {
+			t.Errorf("References expected in %s: %s", level, s)
+		}
+	}
+	if s := read("TRACE"); s != "" {
+		t.Errorf("Records should not be copied beyond LogThroughMaxSpan: %s", s)
+	}
+}
+
+func TestCustomLevels(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		LogDir:            dir,
+		LogFilenamePrefix: "custom",
+		LogSymlinkPrefix:  "custom",
+		LogFileMaxNum:     100,
+		LogFileNumToDel:   10,
+		LogLevel:          LogLevelTrace,
+		LogDest:           LogDestFile,
+		Flag:              ControlFlagLogThrough,
+		LevelNames:        map[LogLevel]string{LogLevelTrace: "DEBUG"},
+		ExtraLevels:       []string{"AUDIT"},
+	}
+	for _, tc := range []struct {
+		levelNames  map[LogLevel]string
+		extraLevels []string
+		field       string
+	}{
+		{map[LogLevel]string{LogLevelCount: "X"}, nil, "LevelNames"},
+		{map[LogLevel]string{LogLevelInfo: "WARN"}, nil, "LevelNames"},
+		{nil, []string{"AUDIT", "AUDIT"}, "ExtraLevels"},
+		{nil, []string{"a/b"}, "ExtraLevels"},
+		{nil, []string{""}, "ExtraLevels"},
+	} {
+		bad := *cfg
+		bad.LevelNames, bad.ExtraLevels = tc.levelNames, tc.extraLevels
+		var cfgErr *ConfigError
+		if _, err := New(&bad); !errors.As(err, &cfgErr) || cfgErr.Field != tc.field {
+			t.Errorf("Expecting ConfigError of %s but gets %v", tc.field, err)
+		}
+	}
+
+	l, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	const levelAudit = LogLevelCount
+	if l.LevelName(LogLevelTrace) != "DEBUG" || l.LevelName(levelAudit) != "AUDIT" || l.LevelName(levelAudit+1) != "" {
+		t.Errorf("Unexpected level names: %s %s", l.LevelName(LogLevelTrace), l.LevelName(levelAudit))
+	}
+	l.Trace("debugging")
+	l.Logf(levelAudit, "user %d logged in", 1)
+	l.Error("failed")
+	l.Log(levelAudit+1, "dropped")
+
+	read := func(level string) string {
+		cont, _ := os.ReadFile(filepath.Join(dir, "custom."+level))
+		return string(cont)
+	}
+	if s := read("DEBUG"); !strings.HasPrefix(s, "D") || !strings.Contains(s, "] debugging\n") || !strings.Contains(s, "] failed\n") || strings.Contains(s, "logged in") {
+		t.Errorf("Unexpected DEBUG logs: %s", s)
+	}
+	if s := read("AUDIT"); !strings.HasPrefix(s, "A") || !strings.Contains(s, "] user 1 logged in\n") || strings.Contains(s, "failed") {
+		t.Errorf("Unexpected AUDIT logs: %s", s)
+	}
+	if s := read("ERROR"); strings.Contains(s, "logged in") {
+		t.Errorf("User-defined levels should not be copied by log-through: %s", s)
+	}
+	if !l.logFilenameRegex.MatchString("custom.AUDIT.20201201000000000000.000001.log") {
+		t.Error("Log files of user-defined levels should be purged as well")
+	}
+}
+
+func TestMultiLogger(t *testing.T) {
+	dir := t.TempDir()
+	newLogger := func(prefix string, level LogLevel, extraLevels ...string) *Logger {
+		l, err := New(&Config{
+			LogDir:            dir,
+			LogFilenamePrefix: prefix,
+			LogSymlinkPrefix:  prefix,
+			LogLevel:          level,
+			LogDest:           LogDestFile,
+			Flag:              ControlFlagLogLineNum,
+			ExtraLevels:       extraLevels,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	ml := NewMultiLogger(newLogger("local", LogLevelInfo), nil, newLogger("audit", LogLevelWarn, "AUDIT"))
+	defer ml.Close()
+	if len(ml.Loggers()) != 2 {
+		t.Fatalf("Nil loggers should be ignored: %d", len(ml.Loggers()))
+	}
+
+	ml.Info("info")
+	ml.Warnf("warn %d", 1)
+	ml.Log(LogLevelCount, "audit")
+	ml.Flush()
+
+	read := func(name string) string {
+		cont, _ := os.ReadFile(filepath.Join(dir, name))
+		return string(cont)
+	}
+	if s := read("local.INFO"); !strings.Contains(s, " logger_test.go:") || !strings.Contains(s, "] info\n") {
+		t.Errorf("Info should be written to local with the caller's line number: %s", s)
+	}
+	if s := read("audit.INFO"); s != "" {
+		t.Errorf("Info should be filtered by audit: %s", s)
+	}
+	for _, name := range []string{"local.WARN", "audit.WARN"} {
+		if s := read(name); !strings.Contains(s, "] warn 1\n") {
+			t.Errorf("Warn should be written to %s: %s", name, s)
+		}
+	}
+	if s := read("audit.AUDIT"); !strings.Contains(s, "] audit\n") {
+		t.Errorf("User-defined level should be written to audit: %s", s)
+	}
+}
+
+func TestPIDAndGoroutineID(t *testing.T) {
+	id := goroutineID()
+	if id == 0 {
+		t.Fatal("goroutineID should not be 0")
+	}
+	ch := make(chan uint64)
+	go func() { ch <- goroutineID() }()
+	if id == <-ch {
+		t.Error("Different goroutines should have different IDs")
+	}
+
+	dir := t.TempDir()
+	for _, format := range []LogFormat{LogFormatText, LogFormatJSON} {
+		prefix := fmt.Sprint("pid", format)
+		l, err := New(&Config{
+			LogDir:            dir,
+			LogFilenamePrefix: prefix,
+			LogSymlinkPrefix:  prefix,
+			LogLevel:          LogLevelTrace,
+			LogDest:           LogDestFile,
+			Flag:              ControlFlagLogPID | ControlFlagLogGoroutineID,
+			Format:            format,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Info("hello")
+		l.Close()
+
+		cont, _ := os.ReadFile(filepath.Join(dir, prefix+".INFO"))
+		expected := fmt.Sprintf(" %d g%d] hello\n", os.Getpid(), id)
+		if format == LogFormatJSON {
+			expected = fmt.Sprintf(`"pid":%d,"goid":%d`, os.Getpid(), id)
+		}
+		if !strings.Contains(string(cont), expected) {
+			t.Errorf("Expecting %q in %s", expected, cont)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+// Package logtest provides an in-memory logger.Sink and assertion helpers for unit-testing logging behaviors.
+//
+// Example:
+//
+//	func TestLogin(t *testing.T) {
+//		l, sink := logtest.NewLogger(t)
+//		login(l, "bad password")
+//		sink.AssertLogged(t, logger.LogLevelWarn, "login failed")
+//	}
+package logtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/antigloss/go/logger"
+)
+
+// Sink captures log entries in memory. It's goroutine-safe.
+type Sink struct {
+	lock    sync.Mutex
+	entries []logger.Entry
+}
+
+// NewSink creates a Sink. It could be used as logger.Config.Sink.
+func NewSink() *Sink {
+	return &Sink{}
+}
+
+// NewLogger creates a Logger writing logs to nowhere but the returned Sink. All levels of logs are captured.
+// The Logger is closed when the test finishes.
+func NewLogger(t testing.TB) (*logger.Logger, *Sink) {
+	t.Helper()
+
+	sink := NewSink()
+	l, err := logger.New(&logger.Config{
+		LogDir:          t.TempDir(),
+		LogLevel:        logger.LogLevelTrace,
+		LogDest:         logger.LogDestNone,
+		LazyDirCreation: true,
+		Sink:            sink,
+	})
+	if err != nil {
+		t.Fatalf("logtest: failed to create Logger: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, sink
+}
+
+// Write implements logger.Sink.
+func (s *Sink) Write(e *logger.Entry) {
+	s.lock.Lock()
+	s.entries = append(s.entries, *e)
+	s.lock.Unlock()
+}
+
+// Entries returns a copy of the captured entries.
+func (s *Sink) Entries() []logger.Entry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]logger.Entry(nil), s.entries...)
+}
+
+// Reset discards all the captured entries.
+func (s *Sink) Reset() {
+	s.lock.Lock()
+	s.entries = nil
+	s.lock.Unlock()
+}
+
+// Count returns the number of captured entries with `level` whose messages contain `substr`.
+func (s *Sink) Count(level logger.LogLevel, substr string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n := 0
+	for i := range s.entries {
+		if s.entries[i].Level == level && strings.Contains(s.entries[i].Message, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+// AssertLogged reports an error to `t` if no entry with `level` whose message contains `substr` is captured.
+func (s *Sink) AssertLogged(t testing.TB, level logger.LogLevel, substr string) bool {
+	t.Helper()
+	if s.Count(level, substr) == 0 {
+		t.Errorf("logtest: no %s log containing %q. Captured logs:\n%s", levelName(level), substr, s.dump())
+		return false
+	}
+	return true
+}
+
+// AssertNotLogged reports an error to `t` if any entry with `level` whose message contains `substr` is captured.
+func (s *Sink) AssertNotLogged(t testing.TB, level logger.LogLevel, substr string) bool {
+	t.Helper()
+	if s.Count(level, substr) != 0 {
+		t.Errorf("logtest: unexpected %s log containing %q. Captured logs:\n%s", levelName(level), substr, s.dump())
+		return false
+	}
+	return true
+}
+
+// dump formats the captured entries for error messages
+func (s *Sink) dump() string {
+	var sb strings.Builder
+	for _, e := range s.Entries() {
+		sb.WriteString("  [")
+		sb.WriteString(levelName(e.Level))
+		sb.WriteString("] ")
+		sb.WriteString(e.Message)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func levelName(level logger.LogLevel) string {
+	if level >= logger.LogLevelTrace && level < logger.LogLevelCount {
+		return logger.FieldMappingDefault.LevelNames[level]
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,61 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package logtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/antigloss/go/logger"
+)
+
+func TestSink(t *testing.T) {
+	l, sink := NewLogger(t)
+	l.Infof("user %d logged in", 1001)
+	l.Warn("login failed:", "bad password")
+	l.Error("disk full")
+
+	sink.AssertLogged(t, logger.LogLevelInfo, "user 1001 logged in")
+	sink.AssertLogged(t, logger.LogLevelWarn, "login failed: bad password")
+	sink.AssertNotLogged(t, logger.LogLevelInfo, "disk full")
+	if entries := sink.Entries(); len(entries) != 3 || entries[2].Level != logger.LogLevelError {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+
+	ft := &fakeT{TB: t}
+	if sink.AssertLogged(ft, logger.LogLevelError, "nothing") || !strings.Contains(ft.msg, "[WARN] login failed: bad password") {
+		t.Errorf("Unexpected failure message: %s", ft.msg)
+	}
+
+	sink.Reset()
+	if len(sink.Entries()) != 0 {
+		t.Error("Entries should be discarded")
+	}
+}
+
+type fakeT struct {
+	testing.TB
+	msg string
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.msg = fmt.Sprintf(format, args...)
+}
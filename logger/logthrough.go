@@ -0,0 +1,89 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package logger
+
+import (
+	"bytes"
+	"time"
+	"unicode/utf8"
+)
+
+type LogThroughMode int // LogThroughMode controls how records are copied to lower level log files if ControlFlagLogThrough is set.
+
+const (
+	LogThroughFull      LogThroughMode = iota // Copy records in full.
+	LogThroughReference                       // Copy records as compact references to the records in their own level log files.
+)
+
+// logThrough writes `output` to the log file of `logLevel`, and copies it to the log files of lower levels
+// as specified by `throughMode` and `throughMaxSpan`
+func (l *Logger) logThrough(logLevel, lowestLogLevel int32, t time.Time, output []byte) {
+	l.loggers[logLevel].log(t, output)
+
+	if l.throughMaxSpan > 0 && logLevel-int32(l.throughMaxSpan) > lowestLogLevel {
+		lowestLogLevel = logLevel - int32(l.throughMaxSpan)
+	}
+	if lowestLogLevel >= logLevel {
+		return
+	}
+
+	if l.throughMode == LogThroughReference {
+		buf := l.bufPool.getBuffer()
+		if l.genReference(buf, logLevel, output) {
+			output = buf.Bytes()
+		}
+		defer l.bufPool.putBuffer(buf)
+	}
+	for i := logLevel - 1; i >= lowestLogLevel; i-- {
+		l.loggers[i].log(t, output)
+	}
+}
+
+// genReference writes a compact reference to the text record `output` into `buf`, which is formatted as
+// `<prefix>[-> LEVEL] <leading bytes of the message>...`. It returns false if the record is too short to be referenced,
+// or it's not a text record
+func (l *Logger) genReference(buf *buffer, logLevel int32, output []byte) bool {
+	if l.format != LogFormatText {
+		return false
+	}
+	i := bytes.Index(output, []byte("] "))
+	if i == -1 {
+		return false
+	}
+	prefix, msg := output[:i+1], output[i+2:len(output)-1] // newline excluded
+	if len(msg) <= kLogThroughRefMsgLen {
+		return false
+	}
+
+	n := kLogThroughRefMsgLen
+	for n > 0 && !utf8.RuneStart(msg[n]) { // don't break a multibyte character
+		n--
+	}
+	buf.Write(prefix)
+	buf.WriteString(" [-> ")
+	buf.WriteString(l.levelNames[logLevel])
+	buf.WriteString("] ")
+	buf.Write(msg[:n])
+	buf.WriteString("...\n")
+	return true
+}
+
+const kLogThroughRefMsgLen = 64 // Max bytes of the message kept in a reference
@@ -0,0 +1,187 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package logger
+
+import "os"
+
+// MultiLogger writes each log to several Logger objects, so that applications can write logs to different destinations
+// (for example, a local logger and an audit logger with different retention) without duplicating every call.
+// Each Logger object filters logs with its own log level. MultiLogger is goroutine-safe.
+type MultiLogger struct {
+	loggers []*Logger
+}
+
+// NewMultiLogger creates a MultiLogger which writes logs to `loggers`. Nil loggers are ignored.
+//
+// Example:
+//
+//	local, _ := logger.New(&localCfg)
+//	audit, _ := logger.New(&auditCfg)
+//	ml := logger.NewMultiLogger(local, audit)
+//	ml.Info("written to both local and audit")
+//	ml.Close()
+func NewMultiLogger(loggers ...*Logger) *MultiLogger {
+	ml := &MultiLogger{loggers: make([]*Logger, 0, len(loggers))}
+	for _, l := range loggers {
+		if l != nil {
+			ml.loggers = append(ml.loggers, l)
+		}
+	}
+	return ml
+}
+
+// Loggers returns the Logger objects which the MultiLogger writes logs to.
+func (ml *MultiLogger) Loggers() []*Logger {
+	return append([]*Logger(nil), ml.loggers...)
+}
+
+// Close closes all the Logger objects. It should be called once and only once.
+func (ml *MultiLogger) Close() error {
+	var err error
+	for _, l := range ml.loggers {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Flush writes all the buffered logs of all the Logger objects to logfiles.
+func (ml *MultiLogger) Flush() {
+	for _, l := range ml.loggers {
+		l.Flush()
+	}
+}
+
+// SetLogLevel tells all the Logger objects not to write logs below `logLevel`.
+func (ml *MultiLogger) SetLogLevel(logLevel LogLevel) {
+	for _, l := range ml.loggers {
+		l.SetLogLevel(logLevel)
+	}
+}
+
+// Trace writes a log with trace level.
+func (ml *MultiLogger) Trace(args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.log(kLogLevelTrace, args)
+	}
+}
+
+// Tracef writes a log with trace level.
+func (ml *MultiLogger) Tracef(format string, args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.logf(kLogLevelTrace, format, args)
+	}
+}
+
+// Info writes a log with info level.
+func (ml *MultiLogger) Info(args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.log(kLogLevelInfo, args)
+	}
+}
+
+// Infof writes a log with info level.
+func (ml *MultiLogger) Infof(format string, args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.logf(kLogLevelInfo, format, args)
+	}
+}
+
+// Warn writes a log with warning level.
+func (ml *MultiLogger) Warn(args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.log(kLogLevelWarn, args)
+	}
+}
+
+// Warnf writes a log with warning level.
+func (ml *MultiLogger) Warnf(format string, args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.logf(kLogLevelWarn, format, args)
+	}
+}
+
+// Error writes a log with error level.
+func (ml *MultiLogger) Error(args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.log(kLogLevelError, args)
+	}
+}
+
+// Errorf writes a log with error level.
+func (ml *MultiLogger) Errorf(format string, args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.logf(kLogLevelError, format, args)
+	}
+}
+
+// Log writes a log with `level`, which could be a user-defined level.
+// Logger objects to which `level` is unknown drop the log.
+func (ml *MultiLogger) Log(level LogLevel, args ...interface{}) {
+	for _, l := range ml.loggers {
+		if l.knownLevel(level) {
+			l.log(int32(level), args)
+		}
+	}
+}
+
+// Logf writes a log with `level`, which could be a user-defined level.
+// Logger objects to which `level` is unknown drop the log.
+func (ml *MultiLogger) Logf(level LogLevel, format string, args ...interface{}) {
+	for _, l := range ml.loggers {
+		if l.knownLevel(level) {
+			l.logf(int32(level), format, args)
+		}
+	}
+}
+
+// Panic writes a log with panic level to all the Logger objects followed by a call to panic("Panic").
+func (ml *MultiLogger) Panic(args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.log(kLogLevelPanic, args)
+	}
+	panic("Panic")
+}
+
+// Panicf writes a log with panic level to all the Logger objects followed by a call to panic("Panicf").
+func (ml *MultiLogger) Panicf(format string, args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.logf(kLogLevelPanic, format, args)
+	}
+	panic("Panicf")
+}
+
+// Fatal writes a log with fatal level to all the Logger objects followed by a call to os.Exit(-1).
+func (ml *MultiLogger) Fatal(args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.log(kLogLevelFatal, args)
+	}
+	os.Exit(-1)
+}
+
+// Fatalf writes a log with fatal level to all the Logger objects followed by a call to os.Exit(-1).
+func (ml *MultiLogger) Fatalf(format string, args ...interface{}) {
+	for _, l := range ml.loggers {
+		l.logf(kLogLevelFatal, format, args)
+	}
+	os.Exit(-1)
+}
@@ -0,0 +1,74 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package logger
+
+import (
+	"runtime/debug"
+)
+
+// CapturePanics uses the global Logger object created by Init to log an unhandled panic with its stack trace at panic level,
+// flushes all the buffered logs, and then re-panics with the same value. It must be deferred directly, for example:
+//
+//	func main() {
+//		logger.Init(cfg)
+//		defer logger.CapturePanics()
+//		...
+//	}
+func CapturePanics() {
+	if r := recover(); r != nil {
+		if defLogger != nil {
+			defLogger.logPanic(r, debug.Stack())
+		}
+		panic(r)
+	}
+}
+
+// Go starts a new goroutine to run `fn`, unhandled panics from `fn` are captured by CapturePanics.
+func Go(fn func()) {
+	go func() {
+		defer CapturePanics()
+		fn()
+	}()
+}
+
+// CapturePanics logs an unhandled panic with its stack trace at panic level, flushes all the buffered logs,
+// and then re-panics with the same value. It must be deferred directly, for example:
+//
+//	defer l.CapturePanics()
+func (l *Logger) CapturePanics() {
+	if r := recover(); r != nil {
+		l.logPanic(r, debug.Stack())
+		panic(r)
+	}
+}
+
+// Go starts a new goroutine to run `fn`, unhandled panics from `fn` are captured by l.CapturePanics.
+func (l *Logger) Go(fn func()) {
+	go func() {
+		defer l.CapturePanics()
+		fn()
+	}()
+}
+
+func (l *Logger) logPanic(r interface{}, stack []byte) {
+	l.logf(kLogLevelPanic, "Unhandled panic: %v\n%s", []interface{}{r, stack})
+	l.Flush()
+}
@@ -0,0 +1,38 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package logger
+
+import (
+	"time"
+)
+
+// Entry is a log record passed to Sink.
+type Entry struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string // Message without prefix and the trailing newline, not truncated by MaxRecordBytes.
+}
+
+// Sink receives every log record not filtered out by the log level, regardless of LogDest.
+// It's called synchronously by the goroutine writing the log, so it must be fast and goroutine-safe.
+// Package logtest provides a Sink capturing the records in memory for unit tests.
+type Sink interface {
+	Write(e *Entry)
+}
@@ -0,0 +1,261 @@
+/*
+ *
+ * logger - A package for writing logs
+ * Copyright (C) 2020 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package logger
+
+import (
+	"path"
+	"runtime"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+type LogFormat int // LogFormat controls the format of the log records.
+
+const (
+	LogFormatText LogFormat = iota // Plain text records prefixed with level, time, etc.
+	LogFormatJSON                  // One JSON object per line, with keys defined by FieldMapping.
+)
+
+// FieldMapping defines keys and values of the fields of the JSON records, so that they match the target backend.
+// Fields whose keys are empty are omitted.
+type FieldMapping struct {
+	Time         string                // Key of the timestamp.
+	TimeLayout   string                // Layout of the timestamp. If left empty, the timestamp is written as a number of Unix nanoseconds.
+	Level        string                // Key of the level name.
+	LevelNames   [LogLevelCount]string // Level names for LogLevelTrace to LogLevelFatal.
+	LevelNumber  string                // Key of the numeric level.
+	LevelNumbers [LogLevelCount]int    // Numeric levels for LogLevelTrace to LogLevelFatal.
+	Message      string                // Key of the message.
+	Source       string                // If not empty, File, Line and Function are nested in an object with this key.
+	File         string                // Key of the filename. Written only if ControlFlagLogLineNum is set.
+	Line         string                // Key of the line number. Written only if ControlFlagLogLineNum is set.
+	Function     string                // Key of the function name. Written only if ControlFlagLogFuncName is set.
+	PID          string                // Key of the process ID. Written only if ControlFlagLogPID is set.
+	GoroutineID  string                // Key of the goroutine ID. Written only if ControlFlagLogGoroutineID is set.
+}
+
+var (
+	// FieldMappingDefault is the default field mapping.
+	FieldMappingDefault = &FieldMapping{
+		Time:        "time",
+		TimeLayout:  time.RFC3339Nano,
+		Level:       "level",
+		LevelNames:  kLogLevelNames,
+		Message:     "msg",
+		File:        "file",
+		Line:        "line",
+		Function:    "func",
+		PID:         "pid",
+		GoroutineID: "goid",
+	}
+	// FieldMappingECS maps the fields to Elastic Common Schema.
+	FieldMappingECS = &FieldMapping{
+		Time:        "@timestamp",
+		TimeLayout:  "2006-01-02T15:04:05.000000Z07:00",
+		Level:       "log.level",
+		LevelNames:  [LogLevelCount]string{"trace", "info", "warn", "error", "critical", "fatal"},
+		Message:     "message",
+		File:        "log.origin.file.name",
+		Line:        "log.origin.file.line",
+		Function:    "log.origin.function",
+		PID:         "process.pid",
+		GoroutineID: "process.thread.id",
+	}
+	// FieldMappingGCP maps the fields to the structured logging format of GCP Cloud Logging.
+	FieldMappingGCP = &FieldMapping{
+		Time:        "time",
+		TimeLayout:  time.RFC3339Nano,
+		Level:       "severity",
+		LevelNames:  [LogLevelCount]string{"DEBUG", "INFO", "WARNING", "ERROR", "CRITICAL", "EMERGENCY"},
+		Message:     "message",
+		Source:      "logging.googleapis.com/sourceLocation",
+		File:        "file",
+		Line:        "line",
+		Function:    "function",
+		PID:         "pid",
+		GoroutineID: "goid",
+	}
+	// FieldMappingOTel maps the fields to the OpenTelemetry log data model.
+	FieldMappingOTel = &FieldMapping{
+		Time:         "Timestamp",
+		Level:        "SeverityText",
+		LevelNames:   [LogLevelCount]string{"TRACE", "INFO", "WARN", "ERROR", "FATAL", "FATAL"},
+		LevelNumber:  "SeverityNumber",
+		LevelNumbers: [LogLevelCount]int{1, 9, 13, 17, 21, 24},
+		Message:      "Body",
+		Source:       "Attributes",
+		File:         "code.filepath",
+		Line:         "code.lineno",
+		Function:     "code.function",
+		PID:          "process.pid",
+		GoroutineID:  "thread.id",
+	}
+)
+
+// genJSONRecord writes a JSON record terminated by a newline to `buf`
+func (l *Logger) genJSONRecord(buf *buffer, logLevel int32, skip int, t time.Time, msg string) {
+	fm := l.fieldMapping
+
+	buf.WriteByte('{')
+	sep := false
+	if fm.Time != "" {
+		writeJSONKey(buf, fm.Time, &sep)
+		if fm.TimeLayout != "" {
+			buf.WriteByte('"')
+			buf.Write(t.AppendFormat(buf.tmp[:0], fm.TimeLayout))
+			buf.WriteByte('"')
+		} else {
+			buf.Write(strconv.AppendInt(buf.tmp[:0], t.UnixNano(), 10))
+		}
+	}
+	if fm.Level != "" {
+		writeJSONKey(buf, fm.Level, &sep)
+		if logLevel < kLogLevelCount {
+			writeJSONString(buf, fm.LevelNames[logLevel])
+		} else {
+			writeJSONString(buf, l.levelNames[logLevel])
+		}
+	}
+	if fm.LevelNumber != "" {
+		writeJSONKey(buf, fm.LevelNumber, &sep)
+		level := logLevel
+		if level >= kLogLevelCount {
+			level = kLogLevelInfo
+		}
+		buf.Write(strconv.AppendInt(buf.tmp[:0], int64(fm.LevelNumbers[level]), 10))
+	}
+	if fm.Message != "" {
+		writeJSONKey(buf, fm.Message, &sep)
+		writeJSONString(buf, l.truncateMessage(msg))
+	}
+
+	if fm.PID != "" && l.flag&ControlFlagLogPID != ControlFlagNone {
+		writeJSONKey(buf, fm.PID, &sep)
+		buf.WriteString(kPID)
+	}
+	if fm.GoroutineID != "" && l.flag&ControlFlagLogGoroutineID != ControlFlagNone {
+		writeJSONKey(buf, fm.GoroutineID, &sep)
+		buf.Write(strconv.AppendUint(buf.tmp[:0], goroutineID(), 10))
+	}
+
+	withLine := l.flag&ControlFlagLogLineNum != ControlFlagNone
+	withFunc := l.flag&ControlFlagLogFuncName != ControlFlagNone
+	if withLine || withFunc {
+		if pc, file, line, ok := runtime.Caller(skip); ok {
+			if fm.Source != "" {
+				writeJSONKey(buf, fm.Source, &sep)
+				buf.WriteByte('{')
+				sep = false
+			}
+			if withLine {
+				if fm.File != "" {
+					writeJSONKey(buf, fm.File, &sep)
+					writeJSONString(buf, path.Base(file))
+				}
+				if fm.Line != "" {
+					writeJSONKey(buf, fm.Line, &sep)
+					buf.Write(strconv.AppendInt(buf.tmp[:0], int64(line), 10))
+				}
+			}
+			if withFunc && fm.Function != "" {
+				writeJSONKey(buf, fm.Function, &sep)
+				writeJSONString(buf, runtime.FuncForPC(pc).Name())
+			}
+			if fm.Source != "" {
+				buf.WriteByte('}')
+				sep = true
+			}
+		}
+	}
+
+	buf.WriteString("}\n")
+}
+
+// truncateMessage truncates `msg` if its size exceeds `maxRecordBytes`
+func (l *Logger) truncateMessage(msg string) string {
+	if l.maxRecordBytes <= 0 || len(msg) <= l.maxRecordBytes {
+		return msg
+	}
+
+	n := l.maxRecordBytes
+	for n > 0 && !utf8.RuneStart(msg[n]) {
+		n--
+	}
+	return msg[:n] + "...[truncated " + strconv.Itoa(len(msg)-n) + " bytes]"
+}
+
+func writeJSONKey(buf *buffer, key string, sep *bool) {
+	if *sep {
+		buf.WriteByte(',')
+	}
+	*sep = true
+	writeJSONString(buf, key)
+	buf.WriteByte(':')
+}
+
+// writeJSONString writes `s` as a quoted JSON string to `buf`
+func writeJSONString(buf *buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.WriteString(s[start:i])
+				buf.WriteString(`�`)
+				i += size
+				start = i
+				continue
+			}
+			i += size
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			i++
+			continue
+		}
+
+		buf.WriteString(s[start:i])
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xF])
+		}
+		i++
+		start = i
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
@@ -23,24 +23,41 @@ package ftp_pool
 
 import (
 	"container/list"
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jlaffaye/ftp"
+
+	"github.com/antigloss/go/utils"
+	"github.com/antigloss/go/utils/clock"
 )
 
+// ErrPoolClosed is returned by Get after the pool is closed.
+var ErrPoolClosed = errors.New("ftp_pool: pool is closed")
+
 // FTPPool is an ftp pool.
 type FTPPool struct {
-	cond       *sync.Cond
-	freeList   list.List
-	curConnNum int // Current ftp connection number
-	waitingNum int // Number of goroutines waiting for ftp connection currently
+	dialFailures uint64 // Accessed atomically, keep it 64-bit aligned
+	stats        waitStats
+	cond         *sync.Cond
+	freeList     list.List
+	curConnNum   int                           // Current ftp connection number
+	waitingNum   int                           // Number of goroutines waiting for ftp connection currently
+	createTime   map[*ftp.ServerConn]time.Time // Creation time of the connections, used for max lifetime
+	closed       bool
+	quit         chan struct{} // Closed by Close to stop keepalive
 	// readonly variables
 	maxCachedNum int    // Max pooled ftp connections
 	connLimit    int    // Max ftp connections
 	addr         string // ftp address
 	user         string // ftp username
 	passwd       string // ftp password
+	opts         options
+	dialOpts     []ftp.DialOption
+	clock        clock.Clock
 }
 
 // NewFTPPool is the only way to get a new, ready-to-use FTPPool object.
@@ -50,13 +67,21 @@ type FTPPool struct {
 //	passwd: ftp password
 //	maxCachedConn: Max pooled ftp connections
 //	connLimit: Max ftp connections
+//	opts: Optional settings such as WithTLS, WithDialTimeout, WithKeepaliveInterval, WithIdleTimeout and WithMaxLifetime
 //
 // Example:
 //
 //	ftpPool := NewFTPPool(Addr, User, Passwd, 10, 100)
 //	ftpConn, _ := ftpPool.Get() // Gets an ftp connection from the pool, or creates a new one if the pool is empty
 //	ftpPool.Put(ftpConn, false) // Puts an ftp connection back to the pool
-func NewFTPPool(addr, user, passwd string, maxCachedConn, connLimit int) *FTPPool {
+//	ftpPool.Close()             // Closes all pooled connections when the pool is no longer needed
+func NewFTPPool(addr, user, passwd string, maxCachedConn, connLimit int, opts ...option) *FTPPool {
+	o := options{
+		dialTimeout:       kDefaultDialTimeout,
+		keepaliveInterval: kDefaultKeepaliveInterval,
+	}
+	o.apply(opts...)
+
 	pool := &FTPPool{
 		cond:         sync.NewCond(new(sync.Mutex)),
 		maxCachedNum: maxCachedConn,
@@ -64,7 +89,20 @@ func NewFTPPool(addr, user, passwd string, maxCachedConn, connLimit int) *FTPPoo
 		addr:         addr,
 		user:         user,
 		passwd:       passwd,
+		opts:         o,
+		clock:        clock.OrReal(o.clock),
+		createTime:   make(map[*ftp.ServerConn]time.Time),
+		quit:         make(chan struct{}),
 	}
+	pool.dialOpts = append(pool.dialOpts, ftp.DialWithTimeout(o.dialTimeout))
+	if o.tlsConfig != nil {
+		if o.explicitTLS {
+			pool.dialOpts = append(pool.dialOpts, ftp.DialWithExplicitTLS(o.tlsConfig))
+		} else {
+			pool.dialOpts = append(pool.dialOpts, ftp.DialWithTLS(o.tlsConfig))
+		}
+	}
+	pool.dialOpts = append(pool.dialOpts, o.dialOpts...)
 	pool.freeList.Init()
 	go pool.keepalive()
 
@@ -73,52 +111,74 @@ func NewFTPPool(addr, user, passwd string, maxCachedConn, connLimit int) *FTPPoo
 
 // Get gets an ftp connection from the pool. If no free connection is available and MaxConnLimit not reached,
 // a new connection will be created. If MaxConnLimit is reached, Get blocks waiting to get/create a connection.
+// It returns ErrPoolClosed if the pool is closed.
 func (pool *FTPPool) Get() (conn *ftp.ServerConn, err error) {
+	var expired []*ftp.ServerConn
+	start := pool.clock.Now()
+	waited := false
 	pool.cond.L.Lock()
 	for {
 		elem := pool.freeList.Front()
-		if elem != nil { // Get a connection from the pool
+		if pool.closed {
+			err = ErrPoolClosed
+			break
+		} else if elem != nil { // Get a connection from the pool
 			conn = elem.Value.(*ftpConnNode).conn
 			pool.freeList.Remove(elem)
+			if pool.exceedsLifetime(conn, pool.clock.Now()) {
+				pool.discard(conn)
+				expired = append(expired, conn)
+				conn = nil
+				continue
+			}
 			break
 		} else if pool.curConnNum < pool.connLimit { // Can still create more connection
 			pool.curConnNum++ // Increase it anyway and decrease it later
 			break
 		} else { // waiting for permission to get/create a connection
+			waited = true
 			pool.waitingNum++
 			pool.cond.Wait()
 			pool.waitingNum--
 		}
 	}
+	if err == nil {
+		pool.stats.observeWait(pool.clock.Now().Sub(start), waited)
+	}
 	pool.cond.L.Unlock()
 
-	if conn != nil {
+	for _, c := range expired {
+		c.Quit()
+	}
+	if conn != nil || err != nil {
 		return
 	}
 
-	for i := 0; i < 2; i++ { // Try again one more time if failed
-		conn, err = ftp.DialTimeout(pool.addr, 5*time.Second)
-		if err != nil {
-			time.Sleep(5 * time.Second)
-			continue
+	// Try again one more time if failed
+	err = utils.Retry(context.Background(), &utils.RetryPolicy{MaxAttempts: 2, InitialDelay: 5 * time.Second, Clock: pool.clock}, func() error {
+		c, e := ftp.Dial(pool.addr, pool.dialOpts...)
+		if e != nil {
+			atomic.AddUint64(&pool.dialFailures, 1)
+			return e
 		}
-
-		err = conn.Login(pool.user, pool.passwd)
-		if err == nil {
-			break
+		if e = c.Login(pool.user, pool.passwd); e != nil {
+			atomic.AddUint64(&pool.dialFailures, 1)
+			c.Quit()
+			return e
 		}
-
-		conn.Quit()
-		conn = nil
-	}
+		conn = c
+		return nil
+	})
+	pool.cond.L.Lock()
 	if conn == nil {
-		pool.cond.L.Lock()
 		pool.curConnNum--
 		if pool.waitingNum > 0 {
 			pool.cond.Signal()
 		}
-		pool.cond.L.Unlock()
+	} else {
+		pool.createTime[conn] = pool.clock.Now()
 	}
+	pool.cond.L.Unlock()
 
 	return
 }
@@ -127,13 +187,45 @@ func (pool *FTPPool) Get() (conn *ftp.ServerConn, err error) {
 //
 //	conn: ftp connection to be returned
 //	forceFree: the connection will be discarded anyway if true is passed
+//
+// The connection is discarded as well if the pool is closed, or it exceeds the max lifetime set by WithMaxLifetime.
 func (pool *FTPPool) Put(conn *ftp.ServerConn, forceFree bool) {
+	now := pool.clock.Now()
+	pool.put(&ftpConnNode{conn: conn, lastActTime: now, idleSince: now}, forceFree)
+}
+
+// Close closes the pool. It stops keepalive, quits all pooled connections, and wakes up goroutines waiting in Get,
+// which return ErrPoolClosed then. Connections in use are quit when they are put back. It's safe to call Close more than once.
+func (pool *FTPPool) Close() {
+	var conns []*ftp.ServerConn
 	pool.cond.L.Lock()
-	if !forceFree && pool.freeList.Len() < pool.maxCachedNum {
-		pool.freeList.PushBack(&ftpConnNode{conn, time.Now()})
+	if pool.closed {
+		pool.cond.L.Unlock()
+		return
+	}
+	pool.closed = true
+	for elem := pool.freeList.Front(); elem != nil; elem = elem.Next() {
+		conn := elem.Value.(*ftpConnNode).conn
+		pool.discard(conn)
+		conns = append(conns, conn)
+	}
+	pool.freeList.Init()
+	pool.cond.Broadcast()
+	pool.cond.L.Unlock()
+
+	close(pool.quit)
+	for _, conn := range conns {
+		conn.Quit()
+	}
+}
+
+func (pool *FTPPool) put(node *ftpConnNode, forceFree bool) {
+	pool.cond.L.Lock()
+	if !forceFree && !pool.closed && pool.freeList.Len() < pool.maxCachedNum && !pool.exceedsLifetime(node.conn, node.lastActTime) {
+		pool.freeList.PushBack(node)
 	} else {
 		forceFree = true
-		pool.curConnNum--
+		pool.discard(node.conn)
 	}
 	if pool.waitingNum > 0 {
 		pool.cond.Signal()
@@ -141,10 +233,21 @@ func (pool *FTPPool) Put(conn *ftp.ServerConn, forceFree bool) {
 	pool.cond.L.Unlock()
 
 	if forceFree {
-		conn.Quit()
+		node.conn.Quit()
 	}
 }
 
+// discard forgets about `conn`. Must be called with the lock held
+func (pool *FTPPool) discard(conn *ftp.ServerConn) {
+	pool.curConnNum--
+	delete(pool.createTime, conn)
+}
+
+// exceedsLifetime returns true if `conn` has been created for longer than the max lifetime. Must be called with the lock held
+func (pool *FTPPool) exceedsLifetime(conn *ftp.ServerConn, now time.Time) bool {
+	return pool.opts.maxLifetime > 0 && now.Sub(pool.createTime[conn]) >= pool.opts.maxLifetime
+}
+
 func (pool *FTPPool) Addr() string {
 	return pool.addr
 }
@@ -161,31 +264,61 @@ func (pool *FTPPool) MaxCachedConnNum() int {
 	return pool.maxCachedNum
 }
 
+const (
+	kDefaultDialTimeout       = 5 * time.Second
+	kDefaultKeepaliveInterval = 10 * time.Second
+)
+
 type ftpConnNode struct {
 	conn        *ftp.ServerConn
-	lastActTime time.Time
+	lastActTime time.Time // Last time the connection is used or kept alive
+	idleSince   time.Time // Last time the connection is put back by the user
 }
 
 // Keepalive with the ftp server
 func (pool *FTPPool) keepalive() {
+	ticker := pool.clock.NewTicker(pool.opts.keepaliveInterval / 2)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(5 * time.Second)
-		tNow := time.Now()
+		var tNow time.Time
+		select {
+		case tNow = <-ticker.C():
+		case <-pool.quit:
+			return
+		}
+
+		var expired []*ftp.ServerConn
 		pool.cond.L.Lock()
 		for nextElem := pool.freeList.Front(); nextElem != nil; {
 			node := nextElem.Value.(*ftpConnNode)
-			if tNow.Sub(node.lastActTime).Seconds() < 10 {
-				break
-			}
-
 			curElem := nextElem
 			nextElem = nextElem.Next()
+
+			if (pool.opts.idleTimeout > 0 && tNow.Sub(node.idleSince) >= pool.opts.idleTimeout) || pool.exceedsLifetime(node.conn, tNow) {
+				pool.freeList.Remove(curElem)
+				pool.discard(node.conn)
+				expired = append(expired, node.conn)
+				continue
+			}
+			if tNow.Sub(node.lastActTime) < pool.opts.keepaliveInterval {
+				continue
+			}
+
 			pool.freeList.Remove(curElem)
-			go func(conn *ftp.ServerConn, pool *FTPPool) {
-				err := conn.NoOp()
-				pool.Put(conn, err != nil)
-			}(node.conn, pool)
+			go func(node *ftpConnNode, pool *FTPPool) {
+				err := node.conn.NoOp()
+				node.lastActTime = pool.clock.Now()
+				pool.put(node, err != nil)
+			}(node, pool)
+		}
+		if len(expired) > 0 && pool.waitingNum > 0 {
+			pool.cond.Broadcast()
 		}
 		pool.cond.L.Unlock()
+
+		for _, conn := range expired {
+			conn.Quit()
+		}
 	}
 }
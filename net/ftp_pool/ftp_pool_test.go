@@ -0,0 +1,251 @@
+/*
+ *
+ * ftp_pool - FTP client connection pool.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ftp_pool
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+// fakeFTPServer speaks just enough FTP for the pool to login, keepalive and quit
+type fakeFTPServer struct {
+	ln     net.Listener
+	active int32 // Number of connections not quit yet
+	noops  int32
+}
+
+func newFakeFTPServer(t *testing.T) *fakeFTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startFakeFTPServer(ln)
+}
+
+func startFakeFTPServer(ln net.Listener) *fakeFTPServer {
+	srv := &fakeFTPServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&srv.active, 1)
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (srv *fakeFTPServer) serve(conn net.Conn) {
+	defer atomic.AddInt32(&srv.active, -1)
+	defer conn.Close()
+
+	conn.Write([]byte("220 Ready\r\n"))
+	rd := bufio.NewReader(conn)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.Fields(line)[0]; cmd {
+		case "USER":
+			conn.Write([]byte("230 Logged in\r\n"))
+		case "NOOP":
+			atomic.AddInt32(&srv.noops, 1)
+			conn.Write([]byte("200 OK\r\n"))
+		case "TYPE", "PBSZ", "PROT":
+			conn.Write([]byte("200 OK\r\n"))
+		case "QUIT":
+			conn.Write([]byte("221 Bye\r\n"))
+			return
+		default:
+			conn.Write([]byte("502 Not implemented\r\n"))
+		}
+	}
+}
+
+func (srv *fakeFTPServer) waitActive(t *testing.T, n int32, advance func()) {
+	for i := 0; i < 200; i++ {
+		if atomic.LoadInt32(&srv.active) == n {
+			return
+		}
+		if advance != nil {
+			advance()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Active connections should be %d, but is %d", n, atomic.LoadInt32(&srv.active))
+}
+
+func TestIdleTimeoutAndMaxLifetime(t *testing.T) {
+	srv := newFakeFTPServer(t)
+	defer srv.ln.Close()
+	fc := clock.NewFake(time.Now())
+	pool := NewFTPPool(srv.ln.Addr().String(), "user", "passwd", 10, 10,
+		WithIdleTimeout(30*time.Second), WithMaxLifetime(time.Hour), WithClock(fc))
+	defer pool.Close()
+
+	conn1, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn2, _ := pool.Get()
+	pool.Put(conn1, false)
+	pool.Put(conn2, false)
+	srv.waitActive(t, 2, nil)
+
+	// Idle connections are kept alive, then quit after the idle timeout
+	fc.BlockUntil(1)
+	srv.waitActive(t, 0, func() { fc.Advance(5 * time.Second) })
+	if atomic.LoadInt32(&srv.noops) == 0 {
+		t.Error("Idle connections should be kept alive before timeout")
+	}
+
+	// Connections exceeding the max lifetime are quit when put back
+	conn1, _ = pool.Get()
+	srv.waitActive(t, 1, nil)
+	fc.Advance(time.Hour)
+	pool.Put(conn1, false)
+	srv.waitActive(t, 0, nil)
+}
+
+func TestClose(t *testing.T) {
+	srv := newFakeFTPServer(t)
+	defer srv.ln.Close()
+
+	// Pooled connections are quit by Close
+	pool := NewFTPPool(srv.ln.Addr().String(), "user", "passwd", 10, 10)
+	conn, _ := pool.Get()
+	pool.Put(conn, false)
+	srv.waitActive(t, 1, nil)
+	pool.Close()
+	srv.waitActive(t, 0, nil)
+	if _, err := pool.Get(); err != ErrPoolClosed {
+		t.Errorf("Get should fail after Close: %v", err)
+	}
+	pool.Close()
+
+	// Blocked Get is woken up, and connections in use are quit when put back
+	pool = NewFTPPool(srv.ln.Addr().String(), "user", "passwd", 10, 1)
+	conn, _ = pool.Get()
+	errCh := make(chan error)
+	go func() {
+		_, err := pool.Get() // Blocked because connLimit is reached
+		errCh <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pool.Close()
+	if err := <-errCh; err != ErrPoolClosed {
+		t.Errorf("Blocked Get should fail after Close: %v", err)
+	}
+	srv.waitActive(t, 1, nil)
+	pool.Put(conn, false)
+	srv.waitActive(t, 0, nil)
+}
+
+func TestImplicitTLS(t *testing.T) {
+	certSrv := httptest.NewTLSServer(nil)
+	defer certSrv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", certSrv.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startFakeFTPServer(ln)
+	defer ln.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certSrv.Certificate())
+	pool := NewFTPPool(ln.Addr().String(), "user", "passwd", 10, 10,
+		WithTLS(&tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}), WithDialTimeout(time.Second), WithKeepaliveInterval(time.Minute))
+	defer pool.Close()
+
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if err = conn.NoOp(); err != nil {
+		t.Errorf("NoOp failed: %v", err)
+	}
+	pool.Put(conn, true)
+	srv.waitActive(t, 0, nil)
+}
+
+func TestStats(t *testing.T) {
+	srv := newFakeFTPServer(t)
+	defer srv.ln.Close()
+	fc := clock.NewFake(time.Now())
+	pool := NewFTPPool(srv.ln.Addr().String(), "user", "passwd", 10, 1, WithClock(fc))
+	defer pool.Close()
+
+	conn, _ := pool.Get()
+	connCh := make(chan bool)
+	go func() {
+		conn, _ := pool.Get() // Waits for the first connection
+		pool.Put(conn, false)
+		close(connCh)
+	}()
+	for pool.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := pool.Stats(); stats.InUse != 1 || stats.Idle != 0 || stats.Waiters != 1 || stats.Gets != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	fc.Advance(50 * time.Millisecond)
+	pool.Put(conn, false)
+	<-connCh
+
+	stats := pool.Stats()
+	if stats.InUse != 0 || stats.Idle != 1 || stats.Waiters != 0 || stats.Gets != 2 || stats.Waits != 1 || stats.WaitDuration != 50*time.Millisecond {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	for _, bucket := range stats.WaitBuckets {
+		expected := uint64(1)
+		if bucket.UpperBound >= 50*time.Millisecond {
+			expected = 2
+		}
+		if bucket.Count != expected {
+			t.Errorf("Bucket %v should be %d, but is %d", bucket.UpperBound, expected, bucket.Count)
+		}
+	}
+
+	var buf strings.Builder
+	pool.WritePrometheus(&buf)
+	for _, line := range []string{
+		`ftp_pool_idle_connections{addr="` + srv.ln.Addr().String() + `"} 1`,
+		`ftp_pool_wait_seconds_bucket{addr="` + srv.ln.Addr().String() + `",le="0.05"} 2`,
+		`ftp_pool_wait_seconds_bucket{addr="` + srv.ln.Addr().String() + `",le="+Inf"} 2`,
+		`ftp_pool_wait_seconds_count{addr="` + srv.ln.Addr().String() + `"} 2`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("%q not found in:\n%s", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ *
+ * ftp_pool - FTP client connection pool.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ftp_pool
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+// WithTLS makes the pool connect to the ftp server with implicit FTPS, i.e. TLS is established right after connecting.
+// Use WithExplicitTLS instead if the server expects explicit FTPS (AUTH TLS).
+func WithTLS(config *tls.Config) option {
+	return func(o *options) {
+		o.tlsConfig = config
+		o.explicitTLS = false
+	}
+}
+
+// WithExplicitTLS makes the pool connect to the ftp server with explicit FTPS, i.e. upgrading a plain connection
+// to TLS with the AUTH TLS command.
+func WithExplicitTLS(config *tls.Config) option {
+	return func(o *options) {
+		o.tlsConfig = config
+		o.explicitTLS = true
+	}
+}
+
+// WithDialTimeout sets the timeout of connecting to the ftp server. Default is 5s.
+func WithDialTimeout(timeout time.Duration) option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.dialTimeout = timeout
+		}
+	}
+}
+
+// WithKeepaliveInterval sets the interval of sending NOOP to keep the pooled connections alive. Default is 10s.
+func WithKeepaliveInterval(interval time.Duration) option {
+	return func(o *options) {
+		if interval > 0 {
+			o.keepaliveInterval = interval
+		}
+	}
+}
+
+// WithDialOptions passes additional options to ftp.Dial, such as ftp.DialWithDisabledEPSV.
+// They take precedence over the options set by WithDialTimeout, WithTLS and WithExplicitTLS.
+func WithDialOptions(opts ...ftp.DialOption) option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+// WithIdleTimeout makes the pool quit connections which have been idle in the pool for longer than `timeout`,
+// instead of keeping them alive forever. Default is 0, which means no timeout.
+func WithIdleTimeout(timeout time.Duration) option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithMaxLifetime makes the pool quit connections which have been created for longer than `lifetime` once they are idle,
+// so that connections are renewed periodically. Default is 0, which means no limit.
+func WithMaxLifetime(lifetime time.Duration) option {
+	return func(o *options) {
+		o.maxLifetime = lifetime
+	}
+}
+
+// WithClock sets the source of the time used for keepalive and retry intervals. Default is clock.Real.
+// Set it to a clock.Fake to test time-dependent behaviors without sleeping.
+func WithClock(c clock.Clock) option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	tlsConfig         *tls.Config
+	explicitTLS       bool
+	dialTimeout       time.Duration
+	keepaliveInterval time.Duration
+	dialOpts          []ftp.DialOption
+
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	clock       clock.Clock
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
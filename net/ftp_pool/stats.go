@@ -0,0 +1,141 @@
+/*
+ *
+ * ftp_pool - FTP client connection pool.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ftp_pool
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the statistics of an FTPPool, which helps to tell whether the pool is sized properly.
+// If Waiters is often non-zero or waits are long, connLimit might be too small.
+type Stats struct {
+	InUse        int           // Connections taken out by Get and not put back yet, including those being dialed
+	Idle         int           // Connections pooled
+	Waiters      int           // Goroutines blocked in Get
+	ConnLimit    int           // Max ftp connections
+	Gets         uint64        // Number of successful calls to Get, dialing excluded
+	Waits        uint64        // Number of calls to Get which had to wait for a connection
+	WaitDuration time.Duration // Total time Get waited for a connection, dialing excluded
+	WaitBuckets  []WaitBucket  // Cumulative histogram of the wait time of Get
+	DialFailures uint64        // Number of failed attempts to connect or login
+}
+
+// WaitBucket is a bucket of the wait time histogram.
+type WaitBucket struct {
+	UpperBound time.Duration // Upper bound of the bucket, math.MaxInt64 for the +Inf bucket
+	Count      uint64        // Number of waits less than or equal to UpperBound
+}
+
+// Stats returns the statistics of the pool.
+func (pool *FTPPool) Stats() Stats {
+	pool.cond.L.Lock()
+	defer pool.cond.L.Unlock()
+
+	stats := Stats{
+		InUse:        pool.curConnNum - pool.freeList.Len(),
+		Idle:         pool.freeList.Len(),
+		Waiters:      pool.waitingNum,
+		ConnLimit:    pool.connLimit,
+		Gets:         pool.stats.gets,
+		Waits:        pool.stats.waits,
+		WaitDuration: pool.stats.total,
+		WaitBuckets:  make([]WaitBucket, len(kWaitBucketBounds)),
+		DialFailures: atomic.LoadUint64(&pool.dialFailures),
+	}
+	var cumulative uint64
+	for i, bound := range kWaitBucketBounds {
+		cumulative += pool.stats.buckets[i]
+		stats.WaitBuckets[i] = WaitBucket{UpperBound: bound, Count: cumulative}
+	}
+	return stats
+}
+
+// WritePrometheus writes the statistics of the pool to `w` in the Prometheus text exposition format,
+// so that they can be exposed via an HTTP handler without depending on the Prometheus client library.
+// Metrics are named with the prefix "ftp_pool_", and labeled with the ftp address.
+//
+//	Example:
+//	    http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+//	        ftpPool.WritePrometheus(w)
+//	    })
+func (pool *FTPPool) WritePrometheus(w io.Writer) error {
+	stats := pool.Stats()
+	label := fmt.Sprintf("addr=%q", pool.addr)
+
+	var err error
+	write := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	gauge := func(name, help string, value int) {
+		write("# HELP ftp_pool_%s %s\n# TYPE ftp_pool_%s gauge\nftp_pool_%s{%s} %d\n", name, help, name, name, label, value)
+	}
+	gauge("in_use_connections", "Connections in use.", stats.InUse)
+	gauge("idle_connections", "Connections pooled.", stats.Idle)
+	gauge("waiters", "Goroutines waiting for a connection.", stats.Waiters)
+	gauge("max_connections", "Max connections.", stats.ConnLimit)
+	write("# HELP ftp_pool_dial_failures_total Failed attempts to connect or login.\n# TYPE ftp_pool_dial_failures_total counter\n")
+	write("ftp_pool_dial_failures_total{%s} %d\n", label, stats.DialFailures)
+
+	write("# HELP ftp_pool_wait_seconds Time waited for a connection.\n# TYPE ftp_pool_wait_seconds histogram\n")
+	for _, bucket := range stats.WaitBuckets {
+		le := "+Inf"
+		if bucket.UpperBound != math.MaxInt64 {
+			le = fmt.Sprint(bucket.UpperBound.Seconds())
+		}
+		write("ftp_pool_wait_seconds_bucket{%s,le=%q} %d\n", label, le, bucket.Count)
+	}
+	write("ftp_pool_wait_seconds_sum{%s} %v\n", label, stats.WaitDuration.Seconds())
+	write("ftp_pool_wait_seconds_count{%s} %d\n", label, stats.Gets)
+	return err
+}
+
+var kWaitBucketBounds = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 5 * time.Second, 10 * time.Second, math.MaxInt64,
+}
+
+// waitStats records the wait time of Get. Must be accessed with the lock of the pool held
+type waitStats struct {
+	gets    uint64
+	waits   uint64
+	total   time.Duration
+	buckets [10]uint64 // Same length as kWaitBucketBounds, not cumulative
+}
+
+func (s *waitStats) observeWait(d time.Duration, waited bool) {
+	s.gets++
+	if waited {
+		s.waits++
+	}
+	s.total += d
+	for i, bound := range kWaitBucketBounds {
+		if d <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+}
@@ -0,0 +1,322 @@
+/*
+ *
+ * http_utils - Handy HTTP utilities.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http_utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DownloadOption configures Download and DownloadCtx.
+type DownloadOption func(opts *downloadOptions)
+
+// WithResume makes Download keep the temporary file on failure, and resume from its end with an HTTP Range request
+// next time. The ETag or Last-Modified of the file is saved along with the temporary file and sent in If-Range,
+// so that the download restarts from zero if the file has been changed since then. It also restarts from zero
+// if the server doesn't support Range requests, or doesn't provide a strong ETag or Last-Modified.
+func WithResume() DownloadOption {
+	return func(o *downloadOptions) {
+		o.resume = true
+	}
+}
+
+// WithSHA256 makes Download verify the SHA-256 checksum of the downloaded file before renaming it to the destination.
+// `checksum` is hex encoded. On mismatch, the temporary file is removed and an error is returned.
+func WithSHA256(checksum string) DownloadOption {
+	return func(o *downloadOptions) {
+		o.sha256 = strings.ToLower(checksum)
+	}
+}
+
+// WithProgress sets a callback which is called each time a chunk of data is written to the file.
+// `written` counts the resumed bytes as well. `total` is -1 if the server doesn't report the file size.
+func WithProgress(fn func(written, total int64)) DownloadOption {
+	return func(o *downloadOptions) {
+		o.progress = fn
+	}
+}
+
+// WithDownloadMaxBytes makes the download fail with ErrBodyTooLarge once the file exceeds `n` bytes, resumed bytes included.
+// Default is 0, which means no limit.
+func WithDownloadMaxBytes(n int64) DownloadOption {
+	return func(o *downloadOptions) {
+		o.maxBytes = n
+	}
+}
+
+type downloadOptions struct {
+	resume   bool
+	sha256   string
+	progress func(written, total int64)
+	maxBytes int64
+}
+
+func (o *downloadOptions) apply(opts ...DownloadOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+func download(ctx context.Context, cli *http.Client, url, dstFilepath string, o *downloadOptions) (err error) {
+	tmpFile := dstFilepath + "-_v.~v~tmp^_^"
+	validatorFile := tmpFile + "validator" // Holds the ETag or Last-Modified of the file being downloaded
+	var offset int64
+	var validator string
+	if o.resume {
+		if fi, e := os.Stat(tmpFile); e == nil && fi.Mode().IsRegular() {
+			if v, e := os.ReadFile(validatorFile); e == nil && len(v) > 0 {
+				offset = fi.Size()
+				validator = string(v)
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+	rsp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	total := rsp.ContentLength
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	switch {
+	case offset > 0 && rsp.StatusCode == http.StatusPartialContent:
+		if v := rangeValidator(rsp.Header); v != "" && v != validator { // The server ignored If-Range
+			os.Remove(tmpFile)
+			os.Remove(validatorFile)
+			rsp.Body.Close()
+			return download(ctx, cli, url, dstFilepath, o)
+		}
+		start, size, ok := parseContentRange(rsp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			os.Remove(tmpFile)
+			os.Remove(validatorFile)
+			return fmt.Errorf("unexpected Content-Range %q for offset %d", rsp.Header.Get("Content-Range"), offset)
+		}
+		total = size
+		flag = os.O_WRONLY | os.O_APPEND
+	case offset > 0 && rsp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The temporary file may have been completely downloaded last time
+		if _, size, ok := parseContentRange(rsp.Header.Get("Content-Range")); !ok || size != offset {
+			os.Remove(tmpFile)
+			os.Remove(validatorFile)
+			return fmt.Errorf("failed to resume from offset %d: %s", offset, rsp.Status)
+		}
+		total = offset
+		flag = os.O_WRONLY | os.O_APPEND
+		rsp.Body = http.NoBody
+	case offset > 0 && (rsp.StatusCode < 200 || rsp.StatusCode > 299):
+		return fmt.Errorf("failed to resume from offset %d: %s", offset, rsp.Status) // Keeps the temporary file for the next try
+	default: // Restarts from zero, which is also the case if the file has been changed since the temporary file was written
+		if err = checkStatus(rsp); err != nil {
+			return err
+		}
+		offset = 0
+		if o.resume {
+			// Without a validator, the next try restarts from zero, as a changed file can't be detected
+			if err = os.WriteFile(validatorFile, []byte(rangeValidator(rsp.Header)), 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.maxBytes > 0 && total > o.maxBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the limit %d", ErrBodyTooLarge, total, o.maxBytes)
+	}
+
+	file, err := os.OpenFile(tmpFile, flag, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create temporal file")
+	}
+	defer func() {
+		file.Close()
+		if err != nil && !o.resume {
+			os.Remove(tmpFile)
+		}
+	}()
+	if o.resume {
+		defer func() {
+			if err == nil {
+				os.Remove(validatorFile)
+			}
+		}()
+	}
+
+	var h hash.Hash
+	if o.sha256 != "" {
+		h = sha256.New()
+		if offset > 0 {
+			if err = hashFile(h, tmpFile, offset); err != nil {
+				return err
+			}
+		}
+	}
+
+	w := &progressWriter{w: file, h: h, written: offset, total: total, progress: o.progress, max: o.maxBytes}
+	if _, err = io.Copy(w, rsp.Body); err != nil {
+		return err
+	}
+
+	if err = verifySHA256(h, o.sha256); err != nil {
+		os.Remove(tmpFile)
+		os.Remove(validatorFile)
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpFile, dstFilepath); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
+
+func downloadToWriter(ctx context.Context, cli *http.Client, url string, w io.Writer, o *downloadOptions) (int64, error) {
+	rsp, err := get(ctx, cli, url)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+
+	if err = checkStatus(rsp); err != nil {
+		return 0, err
+	}
+	if o.maxBytes > 0 && rsp.ContentLength > o.maxBytes {
+		return 0, fmt.Errorf("%w: %d bytes exceeds the limit %d", ErrBodyTooLarge, rsp.ContentLength, o.maxBytes)
+	}
+
+	var h hash.Hash
+	if o.sha256 != "" {
+		h = sha256.New()
+	}
+	pw := &progressWriter{w: w, h: h, total: rsp.ContentLength, progress: o.progress, max: o.maxBytes}
+	if _, err = io.Copy(pw, rsp.Body); err != nil {
+		return pw.written, err
+	}
+	return pw.written, verifySHA256(h, o.sha256)
+}
+
+// verifySHA256 returns an error if `h` is not nil and its sum mismatches with `checksum`
+func verifySHA256(h hash.Hash, checksum string) error {
+	if h == nil {
+		return nil
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != checksum {
+		return fmt.Errorf("SHA-256 mismatch: expected %s, got %s", checksum, sum)
+	}
+	return nil
+}
+
+// progressWriter writes to the file, updates the hash and reports the progress
+type progressWriter struct {
+	w        io.Writer
+	h        hash.Hash
+	written  int64
+	total    int64
+	progress func(written, total int64)
+	max      int64 // Max bytes allowed to be written, 0 means no limit
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	if pw.max > 0 && pw.written+int64(len(p)) > pw.max {
+		return 0, fmt.Errorf("%w: exceeds the limit %d", ErrBodyTooLarge, pw.max)
+	}
+	n, err := pw.w.Write(p)
+	if pw.h != nil {
+		pw.h.Write(p[:n])
+	}
+	pw.written += int64(n)
+	if pw.progress != nil {
+		pw.progress(pw.written, pw.total)
+	}
+	return n, err
+}
+
+// hashFile feeds the first `n` bytes of `filepath` to `h`
+func hashFile(h hash.Hash, filepath string, n int64) error {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.CopyN(h, f, n)
+	return err
+}
+
+// rangeValidator returns the strong ETag or Last-Modified in `h` for the If-Range header, or empty if there isn't any.
+// Weak ETags are not allowed in If-Range.
+func rangeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+// parseContentRange parses `bytes start-end/size` or `bytes */size`. `size` is -1 if it's `*`.
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	rng, sz, found := strings.Cut(value[len("bytes "):], "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	size = -1
+	if sz != "*" {
+		var err error
+		if size, err = strconv.ParseInt(sz, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if rng == "*" {
+		return -1, size, true
+	}
+	first, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
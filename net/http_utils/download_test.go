@@ -0,0 +1,204 @@
+/*
+ *
+ * http_utils - Handy HTTP utilities.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http_utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResumableDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "f", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "f")
+	tmpFile := dst + "-_v.~v~tmp^_^"
+	if err := os.WriteFile(tmpFile, content[:4000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tmpFile+"validator", []byte(`"v1"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var written, total int64
+	err := Download(http.DefaultClient, srv.URL, dst, WithResume(), WithSHA256(strings.ToUpper(checksum)),
+		WithProgress(func(w, t int64) { written, total = w, t }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cont, _ := os.ReadFile(dst); !bytes.Equal(cont, content) {
+		t.Fatal("content mismatch")
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=4000-" {
+		t.Fatalf("ranges=%v", ranges)
+	}
+	if written != int64(len(content)) || total != int64(len(content)) {
+		t.Fatalf("written=%d total=%d", written, total)
+	}
+
+	if _, err = os.Stat(tmpFile + "validator"); !os.IsNotExist(err) {
+		t.Fatalf("validator file not removed: %v", err)
+	}
+
+	// Already completely downloaded last time
+	os.WriteFile(tmpFile, content, 0644)
+	os.WriteFile(tmpFile+"validator", []byte(`"v1"`), 0644)
+	if err = Download(http.DefaultClient, srv.URL, dst, WithResume(), WithSHA256(checksum)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checksum mismatch
+	err = Download(http.DefaultClient, srv.URL, dst+"2", WithSHA256(strings.Repeat("0", 64)))
+	if err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err = os.Stat(dst + "2-_v.~v~tmp^_^"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file not removed: %v", err)
+	}
+}
+
+func TestResumeChangedFile(t *testing.T) {
+	var lock sync.Mutex
+	var content []byte
+	var etag string
+	var modTime time.Time
+	var ignoreIfRange, broken bool
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, r.Header.Get("Range")+"|"+r.Header.Get("If-Range"))
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if broken { // Breaks the download in the middle
+			if !modTime.IsZero() {
+				w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			return
+		}
+		if ignoreIfRange {
+			r.Header.Del("If-Range")
+		}
+		http.ServeContent(w, r, "f", modTime, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	serve := func(cont, tag string, mod time.Time, ignore, brk bool) {
+		lock.Lock()
+		content, etag, modTime, ignoreIfRange, broken, requests = []byte(cont), tag, mod, ignore, brk, nil
+		lock.Unlock()
+	}
+
+	dst := filepath.Join(t.TempDir(), "f")
+	tmpFile := dst + "-_v.~v~tmp^_^"
+	oldContent := strings.Repeat("old content ", 1000)
+	newContent := strings.Repeat("new content ", 1200)
+	t1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name             string
+		oldETag, newETag string
+		oldMod, newMod   time.Time
+		newContent       string
+		ignoreIfRange    bool
+		expected         []string // requests for resuming
+	}{
+		{"unchanged", `"v1"`, `"v1"`, t1, t1, oldContent, false, []string{`bytes=6000-|"v1"`}},
+		{"ETag changed", `"v1"`, `"v2"`, t1, t1, newContent, false, []string{`bytes=6000-|"v1"`}},
+		{"Last-Modified changed", "", "", t1, t2, newContent, false, []string{"bytes=6000-|" + t1.Format(http.TimeFormat)}},
+		{"If-Range ignored by the server", `"v1"`, `"v2"`, t1, t1, newContent, true, []string{`bytes=6000-|"v1"`, "|"}},
+	} {
+		os.Remove(dst)
+		serve(oldContent, tc.oldETag, tc.oldMod, false, true)
+		if err := Download(http.DefaultClient, srv.URL, dst, WithResume()); err == nil {
+			t.Fatalf("%s: the first download should be broken", tc.name)
+		}
+		if fi, err := os.Stat(tmpFile); err != nil || fi.Size() != 6000 {
+			t.Fatalf("%s: temporary file should be kept: %v", tc.name, err)
+		}
+
+		serve(tc.newContent, tc.newETag, tc.newMod, tc.ignoreIfRange, false)
+		if err := Download(http.DefaultClient, srv.URL, dst, WithResume()); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if cont, _ := os.ReadFile(dst); string(cont) != tc.newContent {
+			t.Errorf("%s: unexpected content", tc.name)
+		}
+		lock.Lock()
+		if fmt.Sprintf("%q", requests) != fmt.Sprintf("%q", tc.expected) {
+			t.Errorf("%s: unexpected requests %q, expecting %q", tc.name, requests, tc.expected)
+		}
+		lock.Unlock()
+	}
+
+	// Temporary files without validators are downloaded again from zero
+	os.WriteFile(tmpFile, []byte("stale"), 0644)
+	serve("fresh", "", time.Time{}, false, false)
+	if err := Download(http.DefaultClient, srv.URL, dst, WithResume()); err != nil {
+		t.Fatal(err)
+	}
+	if cont, _ := os.ReadFile(dst); string(cont) != "fresh" || fmt.Sprint(requests) != "[|]" {
+		t.Errorf("Unexpected result %q, requests %q", cont, requests)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	cases := []struct {
+		value       string
+		start, size int64
+		ok          bool
+	}{
+		{"bytes 100-199/1000", 100, 1000, true},
+		{"bytes 100-199/*", 100, -1, true},
+		{"bytes */1000", -1, 1000, true},
+		{"bytes 100/1000", 0, 0, false},
+		{"items 1-2/3", 0, 0, false},
+	}
+	for _, c := range cases {
+		start, size, ok := parseContentRange(c.value)
+		if start != c.start || size != c.size || ok != c.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", c.value, start, size, ok)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ *
+ * http_utils - Handy HTTP utilities.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http_utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MaxJSONBodySize limits the size of the response bodies read by GetJSON and PostJSON. Larger responses fail with ErrBodyTooLarge.
+var MaxJSONBodySize int64 = 16 << 20
+
+// GetJSON sends an http GET request and unmarshals the JSON response body into `out`.
+// Non-2xx responses are returned as *HTTPError.
+func GetJSON(cli *http.Client, url string, out any) error {
+	return GetJSONCtx(context.Background(), cli, url, out)
+}
+
+// GetJSONCtx is like GetJSON, but the request is bound to `ctx`.
+func GetJSONCtx(ctx context.Context, cli *http.Client, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(cli, req, out)
+}
+
+// PostJSON sends `in` marshaled as JSON with an http POST request, and unmarshals the JSON response body into `out`.
+// `out` could be nil if the response body is not needed. Non-2xx responses are returned as *HTTPError.
+func PostJSON(cli *http.Client, url string, in, out any) error {
+	return PostJSONCtx(context.Background(), cli, url, in, out)
+}
+
+// PostJSONCtx is like PostJSON, but the request is bound to `ctx`.
+func PostJSONCtx(ctx context.Context, cli *http.Client, url string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(cli, req, out)
+}
+
+func doJSON(cli *http.Client, req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+	rsp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if err = checkStatus(rsp); err != nil {
+		return err
+	}
+
+	cont, err := readBody(rsp, MaxJSONBodySize)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.Unmarshal(cont, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+ *
+ * http_utils - Handy HTTP utilities.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	type msg struct {
+		Name string `json:"name"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			var m msg
+			json.NewDecoder(r.Body).Decode(&m)
+			m.Name += "!"
+			json.NewEncoder(w).Encode(&m)
+		case "/large":
+			w.Write([]byte(`{"name":"` + strings.Repeat("x", 100) + `"}`))
+		default:
+			http.Error(w, "<html>oops</html>", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	var out msg
+	if err := PostJSON(http.DefaultClient, srv.URL+"/echo", &msg{Name: "hi"}, &out); err != nil || out.Name != "hi!" {
+		t.Fatalf("PostJSON: %+v %v", out, err)
+	}
+
+	err := GetJSON(http.DefaultClient, srv.URL+"/fail", &out)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError || !strings.Contains(string(httpErr.Body), "oops") {
+		t.Fatalf("GetJSON: %v", err)
+	}
+
+	defer func(n int64) { MaxJSONBodySize = n }(MaxJSONBodySize)
+	MaxJSONBodySize = 50
+	if err = GetJSON(http.DefaultClient, srv.URL+"/large", &out); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Fatalf("GetJSON: %v", err)
+	}
+}
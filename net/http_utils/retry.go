@@ -0,0 +1,170 @@
+/*
+ *
+ * http_utils - Handy HTTP utilities.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http_utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/antigloss/go/utils"
+)
+
+// RetryTransport is an http.RoundTripper which retries failed requests with exponential backoff and jitter.
+// A request is retried if it fails with an error (e.g. connection refused), or the response status is classified
+// as retryable by RetryOnStatus. Retry-After headers of the responses are honored.
+//
+// Only idempotent requests are retried by default, i.e. GET, HEAD, OPTIONS, TRACE, PUT and DELETE requests,
+// and requests with an Idempotency-Key or X-Idempotency-Key header. Requests with a body are retried only if
+// the body can be rewound via Request.GetBody, which is the case for requests created by http.NewRequest with
+// a *bytes.Buffer, *bytes.Reader or *strings.Reader body.
+//
+// If all the attempts are used up, the last response is returned as is, so that callers can inspect it.
+type RetryTransport struct {
+	// Underlying RoundTripper. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Policy of attempts and backoff. If nil, utils.DefaultRetryPolicy is used. Its `Retryable` field is ignored.
+	// A Retry-After longer than MaxDelay (if set) is not waited, the response is returned immediately.
+	Policy *utils.RetryPolicy
+	// Classifies whether a response status is worth retrying. If nil, DefaultRetryOnStatus is used.
+	RetryOnStatus func(status int) bool
+	// Retries non-idempotent requests (e.g. POST) as well if true.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryOnStatus returns true for 429 Too Many Requests, 502 Bad Gateway, 503 Service Unavailable and 504 Gateway Timeout.
+func DefaultRetryOnStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !t.retryable(req) {
+		return base.RoundTrip(req)
+	}
+
+	policy := utils.DefaultRetryPolicy
+	if t.Policy != nil {
+		policy = *t.Policy
+	}
+	policy.Retryable = nil
+	retryOnStatus := t.RetryOnStatus
+	if retryOnStatus == nil {
+		retryOnStatus = DefaultRetryOnStatus
+	}
+
+	var rsp *http.Response
+	attempt := 0
+	err := utils.Retry(req.Context(), &policy, func() error {
+		attempt++
+		if rsp != nil { // Discard the response of the previous attempt
+			io.Copy(io.Discard, io.LimitReader(rsp.Body, kMaxDrainBytes))
+			rsp.Body.Close()
+			rsp = nil
+		}
+
+		r := req
+		if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return utils.Permanent(err)
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		var err error
+		rsp, err = base.RoundTrip(r)
+		if err != nil {
+			return err
+		}
+		if !retryOnStatus(rsp.StatusCode) {
+			return nil
+		}
+
+		statusErr := fmt.Errorf("retryable status %s", rsp.Status)
+		if delay, ok := parseRetryAfter(rsp.Header.Get("Retry-After"), time.Now()); ok {
+			if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+				return utils.Permanent(statusErr)
+			}
+			return utils.RetryAfter(statusErr, delay)
+		}
+		return statusErr
+	})
+	if rsp != nil {
+		if err != nil && req.Context().Err() != nil { // Canceled while waiting for the next attempt
+			rsp.Body.Close()
+			return nil, err
+		}
+		return rsp, nil // Succeeded, or the last response has a retryable status
+	}
+	return nil, err
+}
+
+// retryable returns true if `req` can be retried safely
+func (t *RetryTransport) retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if t.RetryNonIdempotent {
+		return true
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either delay seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// kMaxDrainBytes limits the bytes read from a discarded response, so that the connection can be reused
+const kMaxDrainBytes = 64 << 10
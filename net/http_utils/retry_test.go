@@ -0,0 +1,111 @@
+/*
+ *
+ * http_utils - Handy HTTP utilities.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http_utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/utils"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	policy := &utils.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Second}
+	cli, err := NewClient(WithRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PUT is idempotent, and the body is rewound for each attempt
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("hello"))
+	rsp, err := cli.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || string(body) != "hello" || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("status=%d body=%q calls=%d", rsp.StatusCode, body, calls)
+	}
+
+	// POST is not retried
+	atomic.StoreInt32(&calls, 0)
+	rsp, err = cli.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("status=%d calls=%d", rsp.StatusCode, calls)
+	}
+
+	// POST with an Idempotency-Key is retried, and the last response is returned after all attempts failed
+	atomic.StoreInt32(&calls, -10)
+	req, _ = http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("hello"))
+	req.Header.Set("Idempotency-Key", "k1")
+	rsp, err = cli.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != -7 {
+		t.Fatalf("status=%d calls=%d", rsp.StatusCode, calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"Wed, 01 Jan 2020 00:00:30 GMT", 30 * time.Second, true},
+		{"Tue, 31 Dec 2019 00:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		delay, ok := parseRetryAfter(c.value, now)
+		if delay != c.delay || ok != c.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v", c.value, delay, ok)
+		}
+	}
+}
@@ -22,21 +22,77 @@
 package http_utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 )
 
-// Get sends an http GET request and returns the response body as string
-func Get(cli *http.Client, url string) (string, error) {
-	rsp, err := cli.Get(url)
+// ErrBodyTooLarge is returned (possibly wrapped) if the response body exceeds the limit set by WithMaxBytes or WithDownloadMaxBytes.
+var ErrBodyTooLarge = errors.New("http_utils: response body too large")
+
+// GetOption configures Get, GetBytes and GetResponse.
+type GetOption func(opts *getOptions)
+
+// WithMaxBytes makes the request fail with ErrBodyTooLarge if the response body exceeds `n` bytes, instead of buffering
+// it into memory. Default is 0, which means no limit.
+func WithMaxBytes(n int64) GetOption {
+	return func(o *getOptions) {
+		o.maxBytes = n
+	}
+}
+
+type getOptions struct {
+	maxBytes int64
+}
+
+func (o *getOptions) apply(opts ...GetOption) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// Response is an http response with the body read.
+type Response struct {
+	StatusCode int         // e.g. 200
+	Header     http.Header // Response headers
+	Body       []byte      // Response body
+}
+
+// GetResponse sends an http GET request and returns the response, including its status code, headers and body.
+// Unlike Get and GetBytes, non-2xx responses are not treated as errors, it's up to the caller to check StatusCode.
+func GetResponse(cli *http.Client, url string, opts ...GetOption) (*Response, error) {
+	return GetResponseCtx(context.Background(), cli, url, opts...)
+}
+
+// GetResponseCtx is like GetResponse, but the request is bound to `ctx`, which can be used to enforce deadlines and cancellation
+func GetResponseCtx(ctx context.Context, cli *http.Client, url string, opts ...GetOption) (*Response, error) {
+	var o getOptions
+	o.apply(opts...)
+
+	rsp, err := get(ctx, cli, url)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer rsp.Body.Close()
 
-	cont, err := io.ReadAll(rsp.Body)
+	cont, err := readBody(rsp, o.maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{StatusCode: rsp.StatusCode, Header: rsp.Header, Body: cont}, nil
+}
+
+// Get sends an http GET request and returns the response body as string. Non-2xx responses are returned as *HTTPError.
+func Get(cli *http.Client, url string, opts ...GetOption) (string, error) {
+	return GetCtx(context.Background(), cli, url, opts...)
+}
+
+// GetCtx is like Get, but the request is bound to `ctx`, which can be used to enforce deadlines and cancellation
+func GetCtx(ctx context.Context, cli *http.Client, url string, opts ...GetOption) (string, error) {
+	cont, err := GetBytesCtx(ctx, cli, url, opts...)
 	if err != nil {
 		return "", err
 	}
@@ -44,15 +100,27 @@ func Get(cli *http.Client, url string) (string, error) {
 	return string(cont), nil
 }
 
-// GetBytes sends an http GET request and returns the response body as []byte
-func GetBytes(cli *http.Client, url string) ([]byte, error) {
-	rsp, err := cli.Get(url)
+// GetBytes sends an http GET request and returns the response body as []byte. Non-2xx responses are returned as *HTTPError.
+func GetBytes(cli *http.Client, url string, opts ...GetOption) ([]byte, error) {
+	return GetBytesCtx(context.Background(), cli, url, opts...)
+}
+
+// GetBytesCtx is like GetBytes, but the request is bound to `ctx`, which can be used to enforce deadlines and cancellation
+func GetBytesCtx(ctx context.Context, cli *http.Client, url string, opts ...GetOption) ([]byte, error) {
+	var o getOptions
+	o.apply(opts...)
+
+	rsp, err := get(ctx, cli, url)
 	if err != nil {
 		return nil, err
 	}
 	defer rsp.Body.Close()
 
-	cont, err := io.ReadAll(rsp.Body)
+	if err = checkStatus(rsp); err != nil {
+		return nil, err
+	}
+
+	cont, err := readBody(rsp, o.maxBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -60,32 +128,85 @@ func GetBytes(cli *http.Client, url string) ([]byte, error) {
 	return cont, nil
 }
 
-// Download downloads the file from `url` and saves it to `dstFilepath`
-func Download(cli *http.Client, url, dstFilepath string) error {
-	rsp, err := cli.Get(url)
-	if err != nil {
-		return err
-	}
-	defer rsp.Body.Close()
+// Download downloads the file from `url` and saves it to `dstFilepath`. The file is written to a temporary file first,
+// which is renamed to `dstFilepath` after the download succeeded.
+// Non-2xx responses are returned as *HTTPError, and nothing is saved. See WithResume, WithSHA256, WithProgress and WithDownloadMaxBytes for `opts`.
+func Download(cli *http.Client, url, dstFilepath string, opts ...DownloadOption) error {
+	return DownloadCtx(context.Background(), cli, url, dstFilepath, opts...)
+}
 
-	tmpFile := dstFilepath + "-_v.~v~tmp^_^"
-	file, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to create temporal file")
+// DownloadCtx is like Download, but the request is bound to `ctx`, which can be used to enforce deadlines and cancellation.
+// `dstFilepath` is left untouched if the download is canceled.
+func DownloadCtx(ctx context.Context, cli *http.Client, url, dstFilepath string, opts ...DownloadOption) error {
+	var o downloadOptions
+	o.apply(opts...)
+	return download(ctx, cli, url, dstFilepath, &o)
+}
+
+// DownloadToWriter downloads from `url` and writes the response body to `w`, without buffering it into memory.
+// It returns the number of bytes written. Non-2xx responses are returned as *HTTPError, and nothing is written.
+// WithSHA256, WithProgress and WithDownloadMaxBytes are supported for `opts`, while WithResume is ignored.
+// Note that `w` might have been written partially if an error is returned.
+func DownloadToWriter(cli *http.Client, url string, w io.Writer, opts ...DownloadOption) (int64, error) {
+	return DownloadToWriterCtx(context.Background(), cli, url, w, opts...)
+}
+
+// DownloadToWriterCtx is like DownloadToWriter, but the request is bound to `ctx`, which can be used to enforce deadlines and cancellation
+func DownloadToWriterCtx(ctx context.Context, cli *http.Client, url string, w io.Writer, opts ...DownloadOption) (int64, error) {
+	var o downloadOptions
+	o.apply(opts...)
+	return downloadToWriter(ctx, cli, url, w, &o)
+}
+
+// HTTPError is returned for non-2xx responses.
+type HTTPError struct {
+	StatusCode int         // e.g. 500
+	Status     string      // e.g. "500 Internal Server Error"
+	Header     http.Header // Response headers
+	Body       []byte      // Leading bytes of the response body, at most 512 bytes
+}
+
+func (e *HTTPError) Error() string {
+	if len(e.Body) == 0 {
+		return "http status " + e.Status
 	}
-	defer file.Close()
+	return fmt.Sprintf("http status %s: %s", e.Status, e.Body)
+}
 
-	_, err = io.Copy(file, rsp.Body)
+func get(ctx context.Context, cli *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		os.Remove(tmpFile)
-		return err
+		return nil, err
 	}
+	return cli.Do(req)
+}
 
-	err = os.Rename(tmpFile, dstFilepath)
-	if err == nil {
+// checkStatus returns *HTTPError if the status of `rsp` is not 2xx
+func checkStatus(rsp *http.Response) error {
+	if rsp.StatusCode >= 200 && rsp.StatusCode <= 299 {
 		return nil
 	}
+	snippet, _ := io.ReadAll(io.LimitReader(rsp.Body, kHTTPErrorBodySnippetLen))
+	return &HTTPError{StatusCode: rsp.StatusCode, Status: rsp.Status, Header: rsp.Header, Body: snippet}
+}
+
+// readBody reads the body of `rsp`. It returns ErrBodyTooLarge if the body exceeds `maxBytes` bytes (0 means no limit)
+func readBody(rsp *http.Response, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		return io.ReadAll(rsp.Body)
+	}
+	if rsp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the limit %d", ErrBodyTooLarge, rsp.ContentLength, maxBytes)
+	}
 
-	os.Remove(tmpFile)
-	return err
+	cont, err := io.ReadAll(io.LimitReader(rsp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(cont)) > maxBytes {
+		return nil, fmt.Errorf("%w: exceeds the limit %d", ErrBodyTooLarge, maxBytes)
+	}
+	return cont, nil
 }
+
+const kHTTPErrorBodySnippetLen = 512
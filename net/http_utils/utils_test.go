@@ -0,0 +1,129 @@
+/*
+ *
+ * http_utils - Handy HTTP utilities.
+ * Copyright (C) 2022 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http_utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCtxVariants(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		if r.URL.Path == "/fail" {
+			w.Header().Set("X-Reason", "maintenance")
+			http.Error(w, "<html>oops</html>", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	s, err := GetCtx(context.Background(), http.DefaultClient, srv.URL)
+	if err != nil || s != "hello" {
+		t.Fatalf("GetCtx: %q %v", s, err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "f")
+	if err := DownloadCtx(context.Background(), http.DefaultClient, srv.URL, dst); err != nil {
+		t.Fatal(err)
+	}
+	if cont, _ := os.ReadFile(dst); string(cont) != "hello" {
+		t.Fatalf("downloaded %q", cont)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = GetBytesCtx(ctx, http.DefaultClient, srv.URL+"/slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetBytesCtx: %v", err)
+	}
+
+	rsp, err := GetResponse(http.DefaultClient, srv.URL+"/fail")
+	if err != nil || rsp.StatusCode != http.StatusInternalServerError || rsp.Header.Get("X-Reason") != "maintenance" {
+		t.Fatalf("GetResponse: %+v %v", rsp, err)
+	}
+	_, err = Get(http.DefaultClient, srv.URL+"/fail")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError || httpErr.Header.Get("X-Reason") != "maintenance" {
+		t.Fatalf("Get: %v", err)
+	}
+	if err = Download(http.DefaultClient, srv.URL+"/fail", dst); !errors.As(err, &httpErr) {
+		t.Fatalf("Download: %v", err)
+	}
+	if cont, _ := os.ReadFile(dst); string(cont) != "hello" {
+		t.Fatalf("overwritten by error page: %q", cont)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.Write(body[:500])
+			w.(http.Flusher).Flush() // No Content-Length
+			w.Write(body[500:])
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/", "/chunked"} {
+		if _, err := GetBytes(http.DefaultClient, srv.URL+path, WithMaxBytes(999)); !errors.Is(err, ErrBodyTooLarge) {
+			t.Errorf("GetBytes(%s): %v", path, err)
+		}
+		if s, err := Get(http.DefaultClient, srv.URL+path, WithMaxBytes(1000)); err != nil || len(s) != 1000 {
+			t.Errorf("Get(%s): %d %v", path, len(s), err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := DownloadToWriter(http.DefaultClient, srv.URL+"/chunked", &buf, WithDownloadMaxBytes(1000))
+	if err != nil || n != 1000 || !bytes.Equal(buf.Bytes(), body) {
+		t.Fatalf("DownloadToWriter: %d %v", n, err)
+	}
+	buf.Reset()
+	if _, err = DownloadToWriter(http.DefaultClient, srv.URL+"/chunked", &buf, WithDownloadMaxBytes(600)); !errors.Is(err, ErrBodyTooLarge) || buf.Len() > 600 {
+		t.Fatalf("DownloadToWriter: %d %v", buf.Len(), err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "f")
+	if err = Download(http.DefaultClient, srv.URL, dst, WithDownloadMaxBytes(999)); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Download: %v", err)
+	}
+	if _, err = os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("Nothing should be saved: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// QueuePolicy determines what to do when a packet arrives at a session whose receive queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock blocks the reading goroutine until the session consumes a packet.
+	// Note that packets of all the other sessions sharing the same connection are blocked as well.
+	QueueBlock QueuePolicy = iota
+	// QueueDropOldest drops the oldest packet in the queue to make room for the new one.
+	QueueDropOldest
+	// QueueCloseSession detaches the session from SimpleMux. Packets already queued can still be received,
+	// after that, Recv returns ErrSessionQueueFull. The session should be closed then.
+	QueueCloseSession
+)
+
+// ErrSessionQueueFull is returned by Recv if the session has been detached because its receive queue is full.
+// Only happens under the QueueCloseSession policy.
+var ErrSessionQueueFull = fmt.Errorf("receive queue of this session is full")
+
+// QueueStats is a snapshot of the receive queues of the sessions.
+type QueueStats struct {
+	Sessions       int    // Number of active sessions
+	Queued         int    // Total number of packets queued in all sessions
+	MaxQueued      int    // Maximum number of packets queued in a single session
+	Dropped        uint64 // Number of packets dropped under the QueueDropOldest policy
+	ClosedSessions uint64 // Number of sessions detached under the QueueCloseSession policy
+	DroppedDefault uint64 // Number of packets without an associated session dropped because the queue of WithDefaultHandlerPool is full
+}
+
+// QueueStats returns the current depth of the receive queues and the number of packets/sessions dropped for backpressure.
+func (mux *SimpleMux) QueueStats() (stats QueueStats) {
+	mux.sessLock.RLock()
+	stats.Sessions = len(mux.allSess)
+	for _, sess := range mux.allSess {
+		n := sess.packets.Len()
+		stats.Queued += n
+		if n > stats.MaxQueued {
+			stats.MaxQueued = n
+		}
+	}
+	mux.sessLock.RUnlock()
+
+	stats.Dropped = atomic.LoadUint64(&mux.droppedPackets)
+	stats.ClosedSessions = atomic.LoadUint64(&mux.closedSessions)
+	stats.DroppedDefault = atomic.LoadUint64(&mux.droppedDefault)
+	return
+}
+
+// QueueLen returns the number of packets received but not yet consumed by Recv.
+func (sess *Session) QueueLen() int {
+	return sess.packets.Len()
+}
+
+// enqueue pushes `packet` to the receive queue of `sess`, applying the queue limit
+func (mux *SimpleMux) enqueue(sess *Session, packet *Packet) {
+	if limit := mux.opts.queueLimit; limit > 0 {
+		switch mux.opts.queuePolicy {
+		case QueueBlock:
+			for sess.packets.Len() >= limit {
+				select {
+				case <-sess.popNoti:
+				case <-sess.quit:
+					return
+				case <-mux.quit:
+					return
+				}
+			}
+		case QueueDropOldest:
+			for sess.packets.Len() >= limit {
+				if _, ok := sess.packets.Pop(); !ok {
+					break
+				}
+				atomic.AddUint64(&mux.droppedPackets, 1)
+			}
+		case QueueCloseSession:
+			if sess.packets.Len() >= limit {
+				mux.closeSession(sess.id)
+				atomic.AddUint64(&mux.closedSessions, 1)
+				asyncNotifyError(sess.err, ErrSessionQueueFull)
+				return
+			}
+		}
+	}
+
+	sess.packets.Push(packet)
+	asyncNotify(sess.packetNoti)
+}
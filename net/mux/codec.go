@@ -0,0 +1,277 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Codec splits the byte stream received from the connection into packets, and frames bodies into packets to be sent.
+// It makes SimpleMux usable with protocols whose headers are not fixed-size. Use NewSimpleMuxWithCodec to apply a Codec.
+//
+// Built-in codecs are FixedHeaderCodec, LengthPrefixCodec and VarintCodec.
+type Codec interface {
+	// Decode reads exactly one packet from `r`. `hdr` is the raw header of the packet, which is recorded by WithTrace.
+	// The SimpleMux is closed if an error is returned.
+	Decode(r io.Reader) (packet *Packet, hdr []byte, err error)
+	// Encode builds a packet carrying `body` for the session `sessID`. It's used by Session.SendBody.
+	Encode(sessID uint64, body []byte) ([]byte, error)
+}
+
+// FrameHeader is the header of the packets decoded by LengthPrefixCodec and VarintCodec.
+type FrameHeader struct {
+	ID  uint64 // Session ID
+	Len int64  // Body length
+}
+
+// SessionID returns the session ID.
+func (h *FrameHeader) SessionID() uint64 {
+	return h.ID
+}
+
+// BodyLen returns the body length.
+func (h *FrameHeader) BodyLen() int64 {
+	return h.Len
+}
+
+//------------------------------------------------------------------
+// FixedHeaderCodec
+//------------------------------------------------------------------
+
+// FixedHeaderCodec is the codec for protocols with fixed-size headers, which is what NewSimpleMux uses.
+// WithMaxBodyLen and WithResync only take effect with this codec.
+type FixedHeaderCodec struct {
+	hdrSz       int
+	hdrParser   func(hdr []byte) (SimpleMuxHeader, error)
+	buildHeader func(sessID uint64, bodyLen int) []byte
+}
+
+// NewFixedHeaderCodec creates a FixedHeaderCodec.
+//
+//	hdrSz: Size (in bytes) of the protocol header.
+//	hdrParser: Function to parser the header. Returns (hdr, nil) on success, or (nil, err) on error.
+//	buildHeader: Function to build a header for Encode. Could be nil, Encode fails then.
+func NewFixedHeaderCodec(hdrSz int, hdrParser func(hdr []byte) (SimpleMuxHeader, error),
+	buildHeader func(sessID uint64, bodyLen int) []byte) (*FixedHeaderCodec, error) {
+	if hdrSz < kSimpleMuxMinHeaderSz || hdrSz > kSimpleMuxMaxHeaderSz {
+		return nil, fmt.Errorf("`hdrSz` should be [%d, %d]", kSimpleMuxMinHeaderSz, kSimpleMuxMaxHeaderSz)
+	}
+	if hdrParser == nil {
+		return nil, fmt.Errorf("`hdrParser` must not be nil")
+	}
+	return &FixedHeaderCodec{hdrSz: hdrSz, hdrParser: hdrParser, buildHeader: buildHeader}, nil
+}
+
+// Decode reads a header of `hdrSz` bytes and the body following it.
+func (c *FixedHeaderCodec) Decode(r io.Reader) (*Packet, []byte, error) {
+	hdr := make([]byte, c.hdrSz)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, nil, err
+	}
+	muxHdr, err := c.hdrParser(hdr)
+	if err != nil {
+		return nil, hdr, &HeaderError{Header: hdr, Reason: err.Error()}
+	}
+	if muxHdr.BodyLen() < 0 {
+		return nil, hdr, &HeaderError{Header: hdr, BodyLen: muxHdr.BodyLen(), Reason: "negative body length"}
+	}
+
+	packet := &Packet{Header: muxHdr}
+	if muxHdr.BodyLen() > 0 {
+		packet.Body = make([]byte, muxHdr.BodyLen())
+		if _, err = io.ReadFull(r, packet.Body); err != nil {
+			return nil, hdr, err
+		}
+	}
+	return packet, hdr, nil
+}
+
+// Encode prepends the header built by `buildHeader` to `body`.
+func (c *FixedHeaderCodec) Encode(sessID uint64, body []byte) ([]byte, error) {
+	if c.buildHeader == nil {
+		return nil, fmt.Errorf("`buildHeader` of FixedHeaderCodec is nil")
+	}
+	return append(c.buildHeader(sessID, len(body)), body...), nil
+}
+
+//------------------------------------------------------------------
+// LengthPrefixCodec
+//------------------------------------------------------------------
+
+// LengthPrefixCodec frames packets as a 4-byte big-endian length, followed by an 8-byte big-endian session ID and the body.
+// The length counts the session ID and the body.
+type LengthPrefixCodec struct {
+	maxBodyLen int64
+}
+
+// NewLengthPrefixCodec creates a LengthPrefixCodec. Packets with bodies longer than `maxBodyLen` are rejected
+// with *HeaderError. `maxBodyLen` <= 0 means no limit other than the 4-byte length itself.
+func NewLengthPrefixCodec(maxBodyLen int64) *LengthPrefixCodec {
+	return &LengthPrefixCodec{maxBodyLen: maxBodyLen}
+}
+
+// Decode reads a length-prefixed packet.
+func (c *LengthPrefixCodec) Decode(r io.Reader) (*Packet, []byte, error) {
+	hdr := make([]byte, kLengthPrefixHeaderSz)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, nil, err
+	}
+
+	length := int64(binary.BigEndian.Uint32(hdr))
+	frameHdr := &FrameHeader{ID: binary.BigEndian.Uint64(hdr[4:]), Len: length - 8}
+	if err := checkFrameHeader(hdr, frameHdr, c.maxBodyLen); err != nil {
+		return nil, hdr, err
+	}
+	return readBody(r, frameHdr, hdr)
+}
+
+// Encode builds a length-prefixed packet.
+func (c *LengthPrefixCodec) Encode(sessID uint64, body []byte) ([]byte, error) {
+	if int64(len(body)) > kLengthPrefixMaxBodyLen {
+		return nil, fmt.Errorf("body length %d exceeds the limit %d", len(body), kLengthPrefixMaxBodyLen)
+	}
+	b := make([]byte, kLengthPrefixHeaderSz, kLengthPrefixHeaderSz+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	binary.BigEndian.PutUint64(b[4:], sessID)
+	return append(b, body...), nil
+}
+
+//------------------------------------------------------------------
+// VarintCodec
+//------------------------------------------------------------------
+
+// VarintCodec frames packets like protobuf's length-delimited messages: a varint length, followed by a varint session ID
+// and the body. The length counts the session ID and the body.
+type VarintCodec struct {
+	maxBodyLen int64
+}
+
+// NewVarintCodec creates a VarintCodec. Packets with bodies longer than `maxBodyLen` are rejected with *HeaderError.
+// `maxBodyLen` <= 0 means no limit.
+func NewVarintCodec(maxBodyLen int64) *VarintCodec {
+	return &VarintCodec{maxBodyLen: maxBodyLen}
+}
+
+// Decode reads a varint-framed packet. `r` is read byte by byte until the header is decoded,
+// so it's better to be an io.ByteReader, which SimpleMux ensures.
+func (c *VarintCodec) Decode(r io.Reader) (*Packet, []byte, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	hdr := make([]byte, 0, 2*binary.MaxVarintLen64)
+	rd := &recordingByteReader{br: br, buf: hdr}
+
+	length, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, rd.buf, headerErrorOrEOF(err, rd.buf)
+	}
+	lenSz := len(rd.buf)
+	id, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, rd.buf, headerErrorOrEOF(err, rd.buf)
+	}
+
+	hdr = rd.buf
+	frameHdr := &FrameHeader{ID: id, Len: int64(length) - int64(len(hdr)-lenSz)}
+	if length > 1<<62 {
+		frameHdr.Len = -1
+	}
+	if err = checkFrameHeader(hdr, frameHdr, c.maxBodyLen); err != nil {
+		return nil, hdr, err
+	}
+	return readBody(r, frameHdr, hdr)
+}
+
+// Encode builds a varint-framed packet.
+func (c *VarintCodec) Encode(sessID uint64, body []byte) ([]byte, error) {
+	var hdr [2 * binary.MaxVarintLen64]byte
+	idSz := binary.PutUvarint(hdr[binary.MaxVarintLen64:], sessID)
+	lenSz := binary.PutUvarint(hdr[:], uint64(idSz+len(body)))
+	copy(hdr[lenSz:], hdr[binary.MaxVarintLen64:binary.MaxVarintLen64+idSz])
+
+	b := make([]byte, 0, lenSz+idSz+len(body))
+	b = append(b, hdr[:lenSz+idSz]...)
+	return append(b, body...), nil
+}
+
+const (
+	kLengthPrefixHeaderSz   = 12
+	kLengthPrefixMaxBodyLen = 1<<32 - 1 - 8
+)
+
+func checkFrameHeader(hdr []byte, frameHdr *FrameHeader, maxBodyLen int64) error {
+	if frameHdr.Len < 0 {
+		return &HeaderError{Header: hdr, BodyLen: frameHdr.Len, Reason: "length too small"}
+	}
+	if maxBodyLen > 0 && frameHdr.Len > maxBodyLen {
+		return &HeaderError{Header: hdr, BodyLen: frameHdr.Len, Reason: fmt.Sprintf("body length exceeds the limit %d", maxBodyLen)}
+	}
+	return nil
+}
+
+func readBody(r io.Reader, frameHdr *FrameHeader, hdr []byte) (*Packet, []byte, error) {
+	packet := &Packet{Header: frameHdr}
+	if frameHdr.Len > 0 {
+		packet.Body = make([]byte, frameHdr.Len)
+		if _, err := io.ReadFull(r, packet.Body); err != nil {
+			return nil, hdr, err
+		}
+	}
+	return packet, hdr, nil
+}
+
+func headerErrorOrEOF(err error, hdr []byte) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return err
+	}
+	if _, ok := err.(interface{ Timeout() bool }); ok { // net.Error
+		return err
+	}
+	return &HeaderError{Header: hdr, Reason: err.Error()}
+}
+
+// byteReader reads from an io.Reader byte by byte
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(br.r, br.buf[:])
+	return br.buf[0], err
+}
+
+// recordingByteReader records the bytes read
+type recordingByteReader struct {
+	br  io.ByteReader
+	buf []byte
+}
+
+func (rd *recordingByteReader) ReadByte() (byte, error) {
+	b, err := rd.br.ReadByte()
+	if err == nil {
+		rd.buf = append(rd.buf, b)
+	}
+	return b, err
+}
@@ -0,0 +1,190 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// SessionConn adapts a Session to net.Conn, so that existing net.Conn-based client libraries (e.g. database drivers, RPC stacks)
+// can run transparently over a multiplexed session. Bytes written to it are framed into packets by `buildPacket`,
+// and bodies of the received packets are reassembled into a byte stream for reading.
+//
+// Like net.Conn, Read and Write can be called concurrently, but not Read with Read or Write with Write.
+type SessionConn struct {
+	sess        *Session
+	mux         *SimpleMux
+	buildPacket func(sessID uint64, body []byte) []byte
+	maxBodyLen  int
+	rdBuf       []byte // Unread bytes of the last received packet
+	rdErr       error  // Sticky error which makes all subsequent calls to Read fail
+
+	lock       sync.Mutex // Protects variables below
+	rdDeadline time.Time
+	wrDeadline time.Time
+	closed     bool
+	rdWakeup   chan bool // Wakes up the blocked Read when the read deadline is changed or the conn is closed
+}
+
+var _ net.Conn = (*SessionConn)(nil)
+
+// NewSessionConn creates a SessionConn from `sess`. `sess` should no longer be used directly after that.
+//
+//	buildPacket: Builds a packet with the protocol header (carrying `sessID`) and `body`, which is sent to the remote server as is.
+//	maxBodyLen: Maximum body length of a packet. Bytes passed to Write are split into multiple packets if exceeded. 0 means unlimited.
+//
+// Example:
+//
+//	sess, _ := simpleMux.NewSession()
+//	conn := mux.NewSessionConn(sess, func(sessID uint64, body []byte) []byte {
+//		var buf bytes.Buffer
+//		binary.Write(&buf, binary.BigEndian, Header{Len: int32(len(body)), ID: sessID})
+//		buf.Write(body)
+//		return buf.Bytes()
+//	}, 0)
+//	client := rpc.NewClient(conn) // any net.Conn-based client
+func NewSessionConn(sess *Session, buildPacket func(sessID uint64, body []byte) []byte, maxBodyLen int) *SessionConn {
+	return &SessionConn{
+		sess:        sess,
+		mux:         sess.mux,
+		buildPacket: buildPacket,
+		maxBodyLen:  maxBodyLen,
+		rdWakeup:    make(chan bool, 1),
+	}
+}
+
+// Read reads bodies of the packets received by the session as a byte stream.
+// It returns os.ErrDeadlineExceeded if the read deadline is exceeded.
+func (c *SessionConn) Read(b []byte) (int, error) {
+	for len(c.rdBuf) == 0 {
+		if c.rdErr != nil {
+			return 0, c.rdErr
+		}
+
+		c.lock.Lock()
+		closed, deadline := c.closed, c.rdDeadline
+		c.lock.Unlock()
+		if closed {
+			return 0, net.ErrClosed
+		}
+		if !deadline.IsZero() && !c.sess.mux.opts.clock.Now().Before(deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		packet, err := c.sess.recv(deadline, c.rdWakeup, nil)
+		if err != nil {
+			if err == kSessionRdTimeout {
+				return 0, os.ErrDeadlineExceeded
+			}
+			if err == kSessionClosed {
+				return 0, net.ErrClosed
+			}
+			c.rdErr = err // The underlying SimpleMux is closed
+			return 0, err
+		}
+		if packet != nil {
+			c.rdBuf = packet.Body
+		}
+	}
+
+	n := copy(b, c.rdBuf)
+	c.rdBuf = c.rdBuf[n:]
+	return n, nil
+}
+
+// Write frames `b` into packets and sends them to the remote server.
+// The write deadline is only checked before sending, because packets of all sessions share the same connection,
+// a partially sent packet would corrupt the stream.
+func (c *SessionConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	closed, deadline := c.closed, c.wrDeadline
+	c.lock.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+
+	n := 0
+	for n < len(b) {
+		if !deadline.IsZero() && !c.sess.mux.opts.clock.Now().Before(deadline) {
+			return n, os.ErrDeadlineExceeded
+		}
+
+		body := b[n:]
+		if c.maxBodyLen > 0 && len(body) > c.maxBodyLen {
+			body = body[:c.maxBodyLen]
+		}
+		if _, err := c.sess.Send(c.buildPacket(c.sess.ID(), body)); err != nil {
+			return n, err
+		}
+		n += len(body)
+	}
+	return n, nil
+}
+
+// Close closes the underlying session. Blocked Read is unblocked and returns net.ErrClosed.
+func (c *SessionConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.closed = true
+	c.sess.Close()
+	asyncNotify(c.rdWakeup)
+	return nil
+}
+
+// LocalAddr returns the local address of the underlying connection.
+func (c *SessionConn) LocalAddr() net.Addr {
+	return c.mux.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the underlying connection.
+func (c *SessionConn) RemoteAddr() net.Addr {
+	return c.mux.RemoteAddr()
+}
+
+// SetDeadline sets both the read and write deadlines. A zero value for `t` means Read and Write will not time out.
+func (c *SessionConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls and any currently-blocked Read call.
+func (c *SessionConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.rdDeadline = t
+	c.lock.Unlock()
+	asyncNotify(c.rdWakeup)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+func (c *SessionConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.wrDeadline = t
+	c.lock.Unlock()
+	return nil
+}
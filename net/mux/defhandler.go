@@ -0,0 +1,77 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package mux
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/antigloss/go/container/concurrent/pool"
+)
+
+// HandlerPanicError is reported to the handler set by WithErrorHandler when the default handler panics.
+// The panic is recovered, and packets without an associated session are handled as usual afterwards.
+type HandlerPanicError struct {
+	Value interface{} // Value passed to panic
+	Stack []byte      // Stack trace of the panicking goroutine
+}
+
+func (e *HandlerPanicError) Error() string {
+	return fmt.Sprintf("default handler panicked: %v", e.Value)
+}
+
+func (mux *SimpleMux) startDefaultHandlerPool() {
+	queueSize := mux.opts.defPoolQueueSize
+	if queueSize <= 0 {
+		queueSize = mux.opts.defPoolWorkers
+	}
+	mux.defSess = newSession(0, mux)
+	mux.defPool = pool.NewGoRoutinePool(mux.opts.defPoolWorkers, pool.WithQueueSize(queueSize), pool.WithPanicHandler(mux.reportHandlerPanic))
+}
+
+// submitNonSessionPacket runs the default handler for `packet` on the pool, or drops `packet` if the pool is full
+func (mux *SimpleMux) submitNonSessionPacket(packet *Packet) {
+	err := mux.defPool.Submit(func() {
+		mux.defHandler(mux.defSess, packet)
+	})
+	if err == pool.ErrPoolFull {
+		atomic.AddUint64(&mux.droppedDefault, 1)
+	}
+}
+
+// handleNonSessionPacket runs the default handler for `packet`, and recovers from its panic
+func (mux *SimpleMux) handleNonSessionPacket(defSess *Session, packet *Packet) {
+	defer func() {
+		if r := recover(); r != nil {
+			mux.reportHandlerPanic(r, debug.Stack())
+		}
+	}()
+	mux.defHandler(defSess, packet)
+}
+
+func (mux *SimpleMux) reportHandlerPanic(r interface{}, stack []byte) {
+	if mux.opts.errHandler != nil {
+		mux.opts.errHandler(mux, &HandlerPanicError{Value: r, Stack: stack})
+	} else {
+		fmt.Fprintf(os.Stderr, "mux: default handler panicked: %v\n%s", r, stack)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// DialSimpleMux connects to `addr` on the named `network` and creates a SimpleMux over the connection.
+// The connection is established with the dialer set by WithDialer and WithDialTimeout, and is secured with TLS if WithTLS is set.
+// Refer to NewSimpleMux for the other parameters.
+//
+//	Example:
+//	    simpleMux, err := mux.DialSimpleMux("tcp", "example.com:443", hdrSz, hdrParser, nil,
+//	        mux.WithTLS(&tls.Config{}), mux.WithDialTimeout(5*time.Second))
+func DialSimpleMux(network, addr string, hdrSz int,
+	hdrParser func(hdr []byte) (SimpleMuxHeader, error),
+	defHandler func(defSess *Session, packet *Packet), opts ...option) (*SimpleMux, error) {
+	codec, err := NewFixedHeaderCodec(hdrSz, hdrParser, nil)
+	if err != nil {
+		return nil, err
+	}
+	return DialSimpleMuxWithCodec(network, addr, codec, defHandler, opts...)
+}
+
+// DialSimpleMuxWithCodec is like DialSimpleMux, but packets are decoded and encoded by `codec`.
+func DialSimpleMuxWithCodec(network, addr string, codec Codec,
+	defHandler func(defSess *Session, packet *Packet), opts ...option) (*SimpleMux, error) {
+	var o options
+	o.apply(opts...)
+
+	dialer := &net.Dialer{}
+	if o.dialer != nil {
+		*dialer = *o.dialer
+	}
+	if o.dialTimeout > 0 {
+		dialer.Timeout = o.dialTimeout
+	}
+	conn, err := dialer.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.tlsConfig != nil && o.tlsConfig.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			cfg := o.tlsConfig.Clone()
+			cfg.ServerName = host
+			opts = append(opts, WithTLS(cfg))
+		}
+	}
+	mux, err := NewSimpleMuxWithCodec(conn, codec, defHandler, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return mux, nil
+}
+
+// TLSConnectionState returns the state of the negotiated TLS connection, and false if TLS is not enabled by WithTLS.
+func (mux *SimpleMux) TLSConnectionState() (tls.ConnectionState, bool) {
+	if tlsConn, ok := mux.conn.(*tls.Conn); ok {
+		return tlsConn.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
+// startTLS wraps `conn` with TLS and performs the handshake within the dial timeout
+func startTLS(conn net.Conn, o *options) (net.Conn, error) {
+	tlsConn := tls.Client(conn, o.tlsConfig)
+	ctx := context.Background()
+	if o.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.dialTimeout)
+		defer cancel()
+	}
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,72 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package mux
+
+// Interceptor intercepts packets sent and received by all the sessions of a SimpleMux, so that cross-cutting concerns
+// such as compression, encryption, metrics and logging can be added without wrapping Session. Either of the callbacks could be nil.
+//
+// Interceptors set by WithInterceptors form a chain. OnSend callbacks are called in the order they are set,
+// and OnRecv callbacks in the reverse order, so that an interceptor compressing packets on send and another one
+// encrypting them can be paired naturally on receive.
+type Interceptor struct {
+	// OnSend is called before a packet is written to the connection. It can modify Body of the packet.
+	// For SendBody, Header is a *FrameHeader holding the session ID and the original body length, and Body is the body
+	// to be framed by the Codec. For Send, SendBuffers and SendCtx, Header is nil, and Body holds the whole frame.
+	// If an error is returned, the packet is not sent, and the error is returned by the Send method.
+	OnSend func(packet *Packet) error
+	// OnRecv is called in the reading goroutine after a packet is decoded, before it's dispatched to its session or
+	// the default handler. It can modify the packet. If an error is returned, the packet is dropped and the error is
+	// reported to the handler set by WithErrorHandler.
+	OnRecv func(packet *Packet) error
+}
+
+// interceptSend passes `packet` through the OnSend chain
+func (mux *SimpleMux) interceptSend(packet *Packet) error {
+	for _, it := range mux.opts.interceptors {
+		if it.OnSend != nil {
+			if err := it.OnSend(packet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// interceptFrame passes a whole frame to be sent through the OnSend chain
+func (mux *SimpleMux) interceptFrame(b []byte) ([]byte, error) {
+	if len(mux.opts.interceptors) == 0 {
+		return b, nil
+	}
+	packet := &Packet{Body: b}
+	err := mux.interceptSend(packet)
+	return packet.Body, err
+}
+
+// interceptRecv passes `packet` through the OnRecv chain in the reverse order
+func (mux *SimpleMux) interceptRecv(packet *Packet) error {
+	for i := len(mux.opts.interceptors) - 1; i >= 0; i-- {
+		if it := mux.opts.interceptors[i]; it.OnRecv != nil {
+			if err := it.OnRecv(packet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrKeepaliveTimeout is passed to the sessions when SimpleMux is closed because nothing is received from the remote server
+// within the idle timeout set by WithKeepalive.
+var ErrKeepaliveTimeout = fmt.Errorf("no data received from the remote server within the keepalive idle timeout")
+
+// keepalive sends heartbeats periodically and closes the mux when the connection has been idle for too long
+func (mux *SimpleMux) keepalive() {
+	interval, idleTimeout := mux.opts.keepaliveInterval, mux.opts.keepaliveIdleTimeout
+	period := interval
+	if period <= 0 {
+		period = idleTimeout
+	}
+
+	ticker := mux.opts.clock.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			if idleTimeout > 0 && now.Sub(time.Unix(0, atomic.LoadInt64(&mux.lastRecv))) >= idleTimeout {
+				mux.reportError(ErrKeepaliveTimeout)
+				mux.close(ErrKeepaliveTimeout)
+				return
+			}
+			if interval > 0 && mux.opts.heartbeat != nil {
+				mux.sendHeartbeat()
+			}
+		case <-mux.quit:
+			return
+		}
+	}
+}
+
+// sendHeartbeat writes a heartbeat in a separate goroutine, so that a blocked write can't delay the idle check.
+// It's skipped if the previous heartbeat is still being written.
+func (mux *SimpleMux) sendHeartbeat() {
+	if !atomic.CompareAndSwapInt32(&mux.heartbeating, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&mux.heartbeating, 0)
+		n, err := mux.write(mux.opts.heartbeat())
+		if n > 0 {
+			mux.stats.add(false, n, mux.opts.clock.Now())
+		}
+		if err != nil {
+			mux.reportError(err)
+			mux.close(err)
+		}
+	}()
+}
@@ -0,0 +1,189 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/antigloss/go/logger"
+	"github.com/antigloss/go/utils/clock"
+)
+
+// WithTrace records all inbound/outbound frames with timestamps to `lg` at info level, for debugging protocol mismatches.
+// Rotation of the trace files is handled by `lg`. Use ReadTrace/ReplayTrace to read the recorded frames back.
+//
+//	lg: Logger object to write the trace records to. Better to create a dedicated Logger object for tracing.
+//	maxBodyLen: Maximum bytes of a body to be recorded. Bodies are not recorded if 0 is passed, and are not capped if -1 is passed.
+func WithTrace(lg *logger.Logger, maxBodyLen int) option {
+	return func(o *options) {
+		o.tracer = &tracer{lg: lg, maxBodyLen: maxBodyLen}
+	}
+}
+
+// WithMaxBodyLen limits the body length advertised by a header to `maxBodyLen` bytes, so that a corrupted or malicious header
+// can't make SimpleMux allocate unbounded memory. Headers exceeding the limit are reported as *HeaderError.
+// By default, the body length is not limited.
+func WithMaxBodyLen(maxBodyLen int64) option {
+	return func(o *options) {
+		o.maxBodyLen = maxBodyLen
+	}
+}
+
+// WithErrorHandler sets a callback function to be executed when SimpleMux encounters an error while reading from the connection,
+// such as a *HeaderError, or when the default handler panics (reported as *HandlerPanicError).
+// It's called within the reading goroutine or the goroutines running the default handler, so it should return as soon as possible.
+func WithErrorHandler(handler func(mux *SimpleMux, err error)) option {
+	return func(o *options) {
+		o.errHandler = handler
+	}
+}
+
+// WithResync makes SimpleMux try to resynchronize with the stream instead of closing the connection when a header fails
+// the sanity checks. It discards the stream byte by byte until a valid header is found. If no valid header is found after
+// discarding `maxSkipBytes` bytes, the connection is closed.
+func WithResync(maxSkipBytes int) option {
+	return func(o *options) {
+		o.resyncMaxSkip = maxSkipBytes
+	}
+}
+
+// WithClock sets the source of the time used for Session receive timeouts and SessionConn deadlines. Default is clock.Real.
+// Set it to a clock.Fake to test timeouts without sleeping.
+func WithClock(c clock.Clock) option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithKeepalive enables keepalive, so that a dead connection (e.g. silently dropped by a NAT) can be detected and closed,
+// instead of leaving the sessions hanging in Recv forever.
+//
+//	interval: Interval of sending heartbeats. No heartbeat is sent if <=0.
+//	heartbeat: Builds a complete heartbeat frame (header included) to be sent to the remote server. Responses to the heartbeats,
+//	           if any, are handled like other packets without an associated session.
+//	idleTimeout: SimpleMux is closed with ErrKeepaliveTimeout if nothing is received from the remote server within `idleTimeout`.
+//	             It's checked every `interval` (or every `idleTimeout` if `interval` <=0), so the closing might be delayed
+//	             by up to one interval. Idle connections are never closed if <=0.
+func WithKeepalive(interval time.Duration, heartbeat func() []byte, idleTimeout time.Duration) option {
+	return func(o *options) {
+		o.keepaliveInterval = interval
+		o.heartbeat = heartbeat
+		o.keepaliveIdleTimeout = idleTimeout
+	}
+}
+
+// WithSessionQueueLimit limits the number of packets queued in each session to `limit`, so that a slow consumer can't make
+// the receive queue consume unbounded memory. `policy` determines what to do when a queue is full. Use QueueStats and
+// Session.QueueLen to monitor the depth of the queues. By default, the queues are not limited.
+func WithSessionQueueLimit(limit int, policy QueuePolicy) option {
+	return func(o *options) {
+		o.queueLimit = limit
+		o.queuePolicy = policy
+	}
+}
+
+// WithTLS secures the connection with TLS. The TLS handshake is performed by NewSimpleMux (bounded by WithDialTimeout),
+// so `conn` passed to NewSimpleMux should be a plain connection. `config` must either specify ServerName or set
+// InsecureSkipVerify, unless the SimpleMux is created by DialSimpleMux, which fills ServerName with the dialed host.
+// Use SimpleMux.TLSConnectionState to get the negotiated state.
+func WithTLS(config *tls.Config) option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithDialer sets the dialer used by DialSimpleMux. Default is a zero net.Dialer.
+func WithDialer(dialer *net.Dialer) option {
+	return func(o *options) {
+		o.dialer = dialer
+	}
+}
+
+// WithDialTimeout limits the time to establish the connection by DialSimpleMux and to perform the TLS handshake.
+// By default, there is no timeout other than that of the OS.
+func WithDialTimeout(timeout time.Duration) option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithSessionEventHandler sets a callback function to be executed when a session is created or closed.
+// It's called synchronously by NewSession and Session.Close, so it should return as soon as possible.
+func WithSessionEventHandler(handler func(sess *Session, event SessionEvent)) option {
+	return func(o *options) {
+		o.sessEventHandler = handler
+	}
+}
+
+// WithDefaultHandlerPool runs the default handler for packets without an associated session on at most `workers` goroutines,
+// instead of a single goroutine, so that one slow packet doesn't stall all the others. At most `queueSize` packets wait
+// for a free goroutine, further packets are dropped and counted in QueueStats.DroppedDefault.
+// Note that packets are no longer handled in the order they are received.
+func WithDefaultHandlerPool(workers, queueSize int) option {
+	return func(o *options) {
+		o.defPoolWorkers = workers
+		o.defPoolQueueSize = queueSize
+	}
+}
+
+// WithInterceptors appends `interceptors` to the interceptor chain, which intercepts packets sent and received by all the sessions.
+// Please refer to Interceptor for details.
+func WithInterceptors(interceptors ...Interceptor) option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	tracer        *tracer
+	maxBodyLen    int64
+	errHandler    func(mux *SimpleMux, err error)
+	resyncMaxSkip int
+	clock         clock.Clock
+
+	keepaliveInterval    time.Duration
+	keepaliveIdleTimeout time.Duration
+	heartbeat            func() []byte
+
+	queueLimit  int
+	queuePolicy QueuePolicy
+
+	tlsConfig   *tls.Config
+	dialer      *net.Dialer
+	dialTimeout time.Duration
+
+	sessEventHandler func(sess *Session, event SessionEvent)
+
+	defPoolWorkers   int
+	defPoolQueueSize int
+
+	interceptors []Interceptor
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
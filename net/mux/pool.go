@@ -0,0 +1,110 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// DispatchPolicy determines which underlying connection a new session of MuxPool is assigned to.
+type DispatchPolicy int
+
+const (
+	// DispatchRoundRobin assigns new sessions to the connections in turn.
+	DispatchRoundRobin DispatchPolicy = iota
+	// DispatchLeastLoaded assigns a new session to the connection with the fewest active sessions.
+	DispatchLeastLoaded
+)
+
+// MuxPool is a connection multiplexer spanning multiple physical connections to the same remote server.
+// Each session is bound to one of the connections when it's created, and is dispatched according to the DispatchPolicy.
+// Connections which have been closed (e.g. broken or timed out by keepalive) are skipped.
+//
+// All methods of MuxPool are goroutine-safe.
+type MuxPool struct {
+	muxes  []*SimpleMux
+	policy DispatchPolicy
+	next   uint32
+}
+
+// NewMuxPool creates a MuxPool over `conns`. A SimpleMux is created for each of the connections with the same
+// `hdrSz`, `hdrParser`, `defHandler` and `opts`. Refer to NewSimpleMux for details about the parameters.
+func NewMuxPool(conns []net.Conn, policy DispatchPolicy, hdrSz int,
+	hdrParser func(hdr []byte) (SimpleMuxHeader, error),
+	defHandler func(defSess *Session, packet *Packet), opts ...option) (*MuxPool, error) {
+	if len(conns) == 0 {
+		return nil, fmt.Errorf("`conns` must not be empty")
+	}
+	if policy != DispatchRoundRobin && policy != DispatchLeastLoaded {
+		return nil, fmt.Errorf("invalid dispatch policy %d", policy)
+	}
+
+	pool := &MuxPool{policy: policy}
+	for _, conn := range conns {
+		mux, err := NewSimpleMux(conn, hdrSz, hdrParser, defHandler, opts...)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.muxes = append(pool.muxes, mux)
+	}
+	return pool, nil
+}
+
+// NewSession creates a new session on one of the underlying connections chosen by the DispatchPolicy.
+// It fails only if all the connections have been closed.
+func (pool *MuxPool) NewSession() (*Session, error) {
+	for tries := 0; tries < len(pool.muxes); tries++ {
+		var mux *SimpleMux
+		if pool.policy == DispatchLeastLoaded {
+			mux = pool.leastLoaded()
+		} else {
+			mux = pool.muxes[int(atomic.AddUint32(&pool.next, 1)-1)%len(pool.muxes)]
+		}
+		if mux == nil {
+			break
+		}
+		if sess, err := mux.NewSession(); err == nil {
+			return sess, nil
+		}
+	}
+	return nil, kSimpleMuxClosed
+}
+
+// Close closes all the underlying connections and sessions.
+func (pool *MuxPool) Close() {
+	for _, mux := range pool.muxes {
+		mux.Close()
+	}
+}
+
+// leastLoaded returns the open SimpleMux with the fewest sessions, or nil if all of them have been closed
+func (pool *MuxPool) leastLoaded() (least *SimpleMux) {
+	minNum := -1
+	for _, mux := range pool.muxes {
+		if n, closed := mux.sessionNum(); !closed && (minNum < 0 || n < minNum) {
+			least, minNum = mux, n
+		}
+	}
+	return
+}
@@ -0,0 +1,218 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ServerHandler handles packets received by SimpleMuxServer. `conn` is the connection the packet is received from,
+// use it to send responses back.
+type ServerHandler func(conn *ServerConn, packet *Packet)
+
+// SimpleMuxServer is the server-side counterpart of SimpleMux. It accepts connections from the clients,
+// decodes the packets with the same Codec as the clients, and dispatches them to the handlers registered
+// by session ID on each connection. Packets of the sessions without a registered handler go to the default handler,
+// which usually registers a handler for the new session.
+//
+// Handlers of a connection are called one by one within the reading goroutine of the connection, in the order
+// the packets are received. Start a goroutine in the handler if it's slow.
+//
+// All methods of SimpleMuxServer are goroutine-safe.
+type SimpleMuxServer struct {
+	codec      Codec
+	defHandler ServerHandler
+	errHandler func(conn *ServerConn, err error)
+
+	lock      sync.Mutex
+	closed    bool
+	listeners map[net.Listener]bool
+	conns     map[*ServerConn]bool
+}
+
+// NewSimpleMuxServer creates a SimpleMuxServer.
+//
+//	codec: Codec for decoding the packets and encoding the responses.
+//	defHandler: Handler for the packets without a registered session handler. Must not be nil.
+//	errHandler: Called when a connection is closed because a packet fails to be decoded (*HeaderError). Could be nil.
+func NewSimpleMuxServer(codec Codec, defHandler ServerHandler, errHandler func(conn *ServerConn, err error)) (*SimpleMuxServer, error) {
+	if codec == nil {
+		return nil, fmt.Errorf("`codec` must not be nil")
+	}
+	if defHandler == nil {
+		return nil, fmt.Errorf("`defHandler` must not be nil")
+	}
+
+	return &SimpleMuxServer{
+		codec:      codec,
+		defHandler: defHandler,
+		errHandler: errHandler,
+		listeners:  make(map[net.Listener]bool),
+		conns:      make(map[*ServerConn]bool),
+	}, nil
+}
+
+// Serve accepts connections on `ln` and serves each of them in a new goroutine. It blocks until `ln` fails to accept,
+// and returns the error. After Close is called, the returned error is net.ErrClosed.
+func (srv *SimpleMuxServer) Serve(ln net.Listener) error {
+	srv.lock.Lock()
+	if srv.closed {
+		srv.lock.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	srv.listeners[ln] = true
+	srv.lock.Unlock()
+
+	defer func() {
+		srv.lock.Lock()
+		delete(srv.listeners, ln)
+		srv.lock.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.ServeConn(conn)
+	}
+}
+
+// ServeConn serves an already accepted connection. It blocks until the connection is closed.
+func (srv *SimpleMuxServer) ServeConn(conn net.Conn) {
+	c := &ServerConn{
+		conn:     conn,
+		srv:      srv,
+		handlers: make(map[uint64]ServerHandler),
+	}
+	srv.lock.Lock()
+	if srv.closed {
+		srv.lock.Unlock()
+		conn.Close()
+		return
+	}
+	srv.conns[c] = true
+	srv.lock.Unlock()
+
+	c.serve()
+
+	srv.lock.Lock()
+	delete(srv.conns, c)
+	srv.lock.Unlock()
+}
+
+// Close stops all the listeners passed to Serve and closes all the connections.
+func (srv *SimpleMuxServer) Close() {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.closed {
+		return
+	}
+	srv.closed = true
+	for ln := range srv.listeners {
+		ln.Close()
+	}
+	for c := range srv.conns {
+		c.Close()
+	}
+}
+
+// ServerConn is a connection accepted by SimpleMuxServer. All methods of ServerConn are goroutine-safe.
+type ServerConn struct {
+	conn     net.Conn
+	srv      *SimpleMuxServer
+	wrLock   sync.Mutex
+	hLock    sync.RWMutex
+	handlers map[uint64]ServerHandler
+}
+
+// Handle registers `handler` for the session `sessID` on this connection, replacing the previous one if any.
+func (c *ServerConn) Handle(sessID uint64, handler ServerHandler) {
+	c.hLock.Lock()
+	c.handlers[sessID] = handler
+	c.hLock.Unlock()
+}
+
+// Unhandle unregisters the handler for the session `sessID`. Packets of the session go to the default handler afterwards.
+func (c *ServerConn) Unhandle(sessID uint64) {
+	c.hLock.Lock()
+	delete(c.handlers, sessID)
+	c.hLock.Unlock()
+}
+
+// Send writes `b`, which should be one or more complete packets, to the client without being interleaved by other writes.
+func (c *ServerConn) Send(b []byte) (int, error) {
+	c.wrLock.Lock()
+	defer c.wrLock.Unlock()
+	return c.conn.Write(b)
+}
+
+// SendBody frames `body` into a packet for the session `sessID` with the Codec of the server and sends it.
+func (c *ServerConn) SendBody(sessID uint64, body []byte) (int, error) {
+	b, err := c.srv.codec.Encode(sessID, body)
+	if err != nil {
+		return 0, err
+	}
+	return c.Send(b)
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *ServerConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (c *ServerConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the connection.
+func (c *ServerConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *ServerConn) serve() {
+	defer c.conn.Close()
+
+	rd := bufio.NewReader(c.conn)
+	for {
+		packet, _, err := c.srv.codec.Decode(rd)
+		if err != nil {
+			if _, ok := err.(*HeaderError); ok && c.srv.errHandler != nil {
+				c.srv.errHandler(c, err)
+			}
+			return
+		}
+
+		c.hLock.RLock()
+		handler := c.handlers[packet.Header.SessionID()]
+		c.hLock.RUnlock()
+		if handler == nil {
+			handler = c.srv.defHandler
+		}
+		handler(c, packet)
+	}
+}
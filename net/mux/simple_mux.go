@@ -26,6 +26,9 @@
 package mux
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net"
@@ -33,7 +36,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/antigloss/go/container/concurrent/pool"
 	"github.com/antigloss/go/container/concurrent/queue"
+	"github.com/antigloss/go/utils/clock"
 )
 
 const (
@@ -63,28 +68,63 @@ type Packet struct {
 //	            `defSess` is the default session for sending information back to the remote server if necessary.
 //	                     Do not close this `defSess`, otherwise you can't use it later.
 //	            `packet` is the current packet received whose associated session could not be found.
+//	opts: Optional settings such as WithTrace, WithMaxBodyLen, WithResync, WithKeepalive and WithTLS.
 func NewSimpleMux(conn net.Conn, hdrSz int,
 	hdrParser func(hdr []byte) (SimpleMuxHeader, error),
-	defHandler func(defSess *Session, packet *Packet)) (*SimpleMux, error) {
-	if hdrSz < kSimpleMuxMinHeaderSz || hdrSz > kSimpleMuxMaxHeaderSz {
-		return nil, fmt.Errorf("`hdrSz` should be [%d, %d]", kSimpleMuxMinHeaderSz, kSimpleMuxMaxHeaderSz)
+	defHandler func(defSess *Session, packet *Packet), opts ...option) (*SimpleMux, error) {
+	codec, err := NewFixedHeaderCodec(hdrSz, hdrParser, nil)
+	if err != nil {
+		return nil, err
 	}
-	if hdrParser == nil {
-		return nil, fmt.Errorf("`hdrParser` must not be nil")
+	return NewSimpleMuxWithCodec(conn, codec, defHandler, opts...)
+}
+
+// NewSimpleMuxWithCodec is like NewSimpleMux, but packets are decoded and encoded by `codec`,
+// so that protocols with variable-length headers can be multiplexed as well.
+//
+//	Example:
+//	    simpleMux, err := mux.NewSimpleMuxWithCodec(conn, mux.NewVarintCodec(1<<20), nil)
+//	    sess, _ := simpleMux.NewSession()
+//	    sess.SendBody(body)
+func NewSimpleMuxWithCodec(conn net.Conn, codec Codec,
+	defHandler func(defSess *Session, packet *Packet), opts ...option) (*SimpleMux, error) {
+	if codec == nil {
+		return nil, fmt.Errorf("`codec` must not be nil")
 	}
 
 	mux := &SimpleMux{
-		conn:      conn,
-		hdrSz:     hdrSz,
-		hdrParser: hdrParser,
-		allSess:   make(map[uint64]*Session),
+		conn:    conn,
+		codec:   codec,
+		allSess: make(map[uint64]*Session),
+		quit:    make(chan struct{}),
+	}
+	if fixed, ok := codec.(*FixedHeaderCodec); ok {
+		mux.hdrSz = fixed.hdrSz
+		mux.hdrParser = fixed.hdrParser
 	}
+	mux.opts.apply(opts...)
+	if mux.opts.tlsConfig != nil {
+		tlsConn, err := startTLS(conn, &mux.opts)
+		if err != nil {
+			return nil, err
+		}
+		mux.conn = tlsConn
+	}
+	mux.opts.clock = clock.OrReal(mux.opts.clock)
+	mux.lastRecv = mux.opts.clock.Now().UnixNano()
 	if defHandler != nil {
 		mux.defHandler = defHandler
-		mux.defPacketQ = queue.NewLockfreeQueue[*Packet]()
-		mux.defNotiChnl = make(chan bool, 1)
-		mux.defQuitChnl = make(chan bool, 1)
-		go mux.procNonSessionPackets()
+		if mux.opts.defPoolWorkers > 0 {
+			mux.startDefaultHandlerPool()
+		} else {
+			mux.defPacketQ = queue.NewLockfreeQueue[*Packet]()
+			mux.defNotiChnl = make(chan bool, 1)
+			mux.defQuitChnl = make(chan bool, 1)
+			go mux.procNonSessionPackets()
+		}
+	}
+	if mux.opts.keepaliveInterval > 0 || mux.opts.keepaliveIdleTimeout > 0 {
+		go mux.keepalive()
 	}
 	go mux.loop()
 
@@ -103,26 +143,38 @@ func NewSimpleMux(conn net.Conn, hdrSz int,
 //
 // Seek to simple_mux_test.go for detailed usage.
 type SimpleMux struct {
-	closed      bool // Determine if this `SimpleMux` has been closed
-	conn        net.Conn
-	hdrSz       int
-	hdrParser   func(hdr []byte) (SimpleMuxHeader, error)
-	nextSessID  uint32
-	sessLock    sync.RWMutex
-	allSess     map[uint64]*Session
-	defHandler  func(*Session, *Packet)       // defHandler will be invoke if session not found
-	defPacketQ  *queue.LockfreeQueue[*Packet] // Non-session-packets will be pushed into it for defHandler
-	defNotiChnl chan bool                     // Notify defHandler that there is incoming non-session-packet
-	defQuitChnl chan bool                     // Notify defHandler to quit
+	lastRecv       int64  // UnixNano of the last time a header is received. 64-bit fields go first to be aligned for atomic operations
+	droppedPackets uint64 // Packets dropped for backpressure
+	droppedDefault uint64 // Packets without an associated session dropped because the default handler pool is full
+	closedSessions uint64 // Sessions detached for backpressure
+	parseErrors    uint64 // Headers failed to be parsed
+	stats          trafficStats
+	heartbeating   int32 // 1 if a heartbeat is being written
+	opts           options
+	closed         bool // Determine if this `SimpleMux` has been closed
+	conn           net.Conn
+	codec          Codec
+	hdrSz          int
+	hdrParser      func(hdr []byte) (SimpleMuxHeader, error) // nil if the codec is not a FixedHeaderCodec
+	hdrBuf         []byte                                    // Header buffer of the reading goroutine
+	rd             *bufio.Reader                             // Buffered reader of the reading goroutine, used by codecs
+	nextSessID     uint32
+	sessLock       sync.RWMutex
+	wrLock         sync.Mutex // Serializes writes, so that a write deadline only applies to the current write
+	allSess        map[uint64]*Session
+	defHandler     func(*Session, *Packet)       // defHandler will be invoke if session not found
+	defPacketQ     *queue.LockfreeQueue[*Packet] // Non-session-packets will be pushed into it for defHandler
+	defNotiChnl    chan bool                     // Notify defHandler that there is incoming non-session-packet
+	defQuitChnl    chan bool                     // Notify defHandler to quit
+	defPool        *pool.GoRoutinePool           // Runs defHandler if WithDefaultHandlerPool is set
+	defSess        *Session                      // Default session passed to defHandler run by `defPool`
+	quit           chan struct{}                 // Closed when the SimpleMux is closed
 }
 
 // NewSession is used to create a new session.
 // You can create as many sessions as you want.
 // All sessions are base on the single connection of the SimpleMux,
 // but they act like they are separate connections.
-//
-//	Note: Methods of Session are not goroutine-safe.
-//	      One session is intended to be used within one goroutine.
 func (mux *SimpleMux) NewSession() (sess *Session, err error) {
 	id := mux.getNextSessID()
 	sess = newSession(id, mux)
@@ -134,6 +186,9 @@ func (mux *SimpleMux) NewSession() (sess *Session, err error) {
 		err = kSimpleMuxClosed
 	}
 	mux.sessLock.Unlock()
+	if sess != nil {
+		mux.fireSessionEvent(sess, SessionCreated)
+	}
 	return
 }
 
@@ -156,41 +211,42 @@ func (mux *SimpleMux) Close() {
 }
 
 func (mux *SimpleMux) loop() {
-	var muxHdr SimpleMuxHeader
+	var packet *Packet
+	var hdr []byte
 	var err error
-	hdr := make([]byte, mux.hdrSz)
+	readPacket := mux.readFixedHeaderPacket
+	if mux.hdrParser == nil {
+		readPacket = mux.readCodecPacket
+	}
 	for {
-		_, err = io.ReadFull(mux.conn, hdr)
+		packet, hdr, err = readPacket()
 		if err != nil {
 			break
 		}
-
-		muxHdr, err = mux.hdrParser(hdr)
-		if err != nil {
-			break
+		if mux.opts.tracer != nil {
+			mux.opts.tracer.record(true, hdr, packet.Body)
 		}
-
-		packet := &Packet{Header: muxHdr}
-		bodyLen := muxHdr.BodyLen()
-		if bodyLen > 0 {
-			packet.Body = make([]byte, bodyLen)
-			_, err = io.ReadFull(mux.conn, packet.Body)
-			if err != nil {
-				break
-			}
+		now := mux.opts.clock.Now()
+		mux.stats.add(true, len(hdr)+len(packet.Body), now)
+		if e := mux.interceptRecv(packet); e != nil {
+			mux.reportError(e)
+			continue
 		}
 
 		mux.sessLock.RLock()
 		if mux.closed {
+			mux.sessLock.RUnlock()
 			break
 		}
-		sess := mux.allSess[muxHdr.SessionID()]
+		sess := mux.allSess[packet.Header.SessionID()]
 		mux.sessLock.RUnlock()
 		if sess != nil {
-			sess.packets.Push(packet)
-			asyncNotify(sess.packetNoti)
+			sess.stats.add(true, len(hdr)+len(packet.Body), now)
+			mux.enqueue(sess, packet)
 		} else {
-			if mux.defHandler != nil {
+			if mux.defPool != nil {
+				mux.submitNonSessionPacket(packet)
+			} else if mux.defHandler != nil {
 				mux.defPacketQ.Push(packet)
 				asyncNotify(mux.defNotiChnl)
 			}
@@ -200,6 +256,108 @@ func (mux *SimpleMux) loop() {
 	mux.close(err)
 }
 
+// readFixedHeaderPacket reads a packet with a fixed-size header, applying WithMaxBodyLen and WithResync
+func (mux *SimpleMux) readFixedHeaderPacket() (*Packet, []byte, error) {
+	if mux.hdrBuf == nil {
+		mux.hdrBuf = make([]byte, mux.hdrSz)
+	}
+	hdr := mux.hdrBuf
+	_, err := io.ReadFull(mux.conn, hdr)
+	if err != nil {
+		return nil, nil, err
+	}
+	mux.touch()
+
+	muxHdr, err := mux.parseHeader(hdr)
+	if err != nil {
+		mux.reportError(err)
+		if mux.opts.resyncMaxSkip <= 0 {
+			return nil, nil, err
+		}
+		muxHdr, err = mux.resync(hdr)
+		if err != nil {
+			mux.reportError(err)
+			return nil, nil, err
+		}
+	}
+
+	packet := &Packet{Header: muxHdr}
+	bodyLen := muxHdr.BodyLen()
+	if bodyLen > 0 {
+		packet.Body = make([]byte, bodyLen)
+		_, err = io.ReadFull(mux.conn, packet.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return packet, hdr, nil
+}
+
+// readCodecPacket reads a packet with the codec
+func (mux *SimpleMux) readCodecPacket() (*Packet, []byte, error) {
+	if mux.rd == nil {
+		mux.rd = bufio.NewReader(mux.conn)
+	}
+	packet, hdr, err := mux.codec.Decode(mux.rd)
+	if err != nil {
+		if _, ok := err.(*HeaderError); ok {
+			mux.reportError(err)
+		}
+		return nil, nil, err
+	}
+	mux.touch()
+	return packet, hdr, nil
+}
+
+// touch records the time when data is received for keepalive
+func (mux *SimpleMux) touch() {
+	if mux.opts.keepaliveIdleTimeout > 0 {
+		atomic.StoreInt64(&mux.lastRecv, mux.opts.clock.Now().UnixNano())
+	}
+}
+
+// parseHeader parses `hdr` and checks if it's sane
+func (mux *SimpleMux) parseHeader(hdr []byte) (SimpleMuxHeader, error) {
+	muxHdr, err := mux.hdrParser(hdr)
+	if err != nil {
+		return nil, &HeaderError{Header: append([]byte(nil), hdr...), Reason: err.Error()}
+	}
+
+	bodyLen := muxHdr.BodyLen()
+	if bodyLen < 0 {
+		return nil, &HeaderError{Header: append([]byte(nil), hdr...), BodyLen: bodyLen, Reason: "negative body length"}
+	}
+	if mux.opts.maxBodyLen > 0 && bodyLen > mux.opts.maxBodyLen {
+		return nil, &HeaderError{Header: append([]byte(nil), hdr...), BodyLen: bodyLen,
+			Reason: fmt.Sprintf("body length exceeds the limit %d", mux.opts.maxBodyLen)}
+	}
+	return muxHdr, nil
+}
+
+// resync discards the stream byte by byte until a sane header is found
+func (mux *SimpleMux) resync(hdr []byte) (SimpleMuxHeader, error) {
+	for skipped := 1; skipped <= mux.opts.resyncMaxSkip; skipped++ {
+		copy(hdr, hdr[1:])
+		_, err := io.ReadFull(mux.conn, hdr[len(hdr)-1:])
+		if err != nil {
+			return nil, err
+		}
+		if muxHdr, err := mux.parseHeader(hdr); err == nil {
+			return muxHdr, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to resync after skipping %d bytes", mux.opts.resyncMaxSkip)
+}
+
+func (mux *SimpleMux) reportError(err error) {
+	if _, ok := err.(*HeaderError); ok {
+		atomic.AddUint64(&mux.parseErrors, 1)
+	}
+	if mux.opts.errHandler != nil {
+		mux.opts.errHandler(mux, err)
+	}
+}
+
 func (mux *SimpleMux) procNonSessionPackets() {
 	defSess := newSession(0, mux)
 	var closed bool
@@ -207,7 +365,7 @@ func (mux *SimpleMux) procNonSessionPackets() {
 	for {
 		packet, _ = mux.defPacketQ.Pop()
 		if packet != nil {
-			mux.defHandler(defSess, packet)
+			mux.handleNonSessionPacket(defSess, packet)
 		} else {
 			select {
 			case <-mux.defNotiChnl:
@@ -227,16 +385,107 @@ func (mux *SimpleMux) close(err error) {
 		for _, sess := range mux.allSess {
 			asyncNotifyError(sess.err, err)
 		}
-		if mux.defHandler != nil {
+		if mux.defPool != nil {
+			go mux.defPool.Shutdown(context.Background()) // Handlers might be waiting for `sessLock`
+		} else if mux.defHandler != nil {
 			mux.defQuitChnl <- true
 		}
 		mux.allSess = nil
 		mux.closed = true
+		close(mux.quit)
 		mux.conn.Close()
 	}
 	mux.sessLock.Unlock()
 }
 
+// write writes `b` to the connection, recording it if tracing is enabled
+func (mux *SimpleMux) write(b []byte) (int, error) {
+	mux.wrLock.Lock()
+	defer mux.wrLock.Unlock()
+	return mux.writeLocked(b)
+}
+
+// writeCtx is like write, but the write is aborted via the write deadline of the connection if `ctx` is done.
+// Since a partially written packet corrupts the stream, the SimpleMux is closed in that case.
+func (mux *SimpleMux) writeCtx(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	mux.wrLock.Lock()
+	defer mux.wrLock.Unlock()
+
+	if ctx.Done() == nil { // Never canceled
+		return mux.writeLocked(b)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		mux.conn.SetWriteDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			mux.conn.SetWriteDeadline(time.Unix(1, 0)) // Unblock the write immediately
+		case <-stop:
+		}
+	}()
+
+	n, err := mux.writeLocked(b)
+	close(stop)
+	<-stopped
+	mux.conn.SetWriteDeadline(time.Time{})
+
+	if err != nil && (ctx.Err() != nil || isTimeout(err)) {
+		if n > 0 {
+			mux.close(err)
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			err = context.DeadlineExceeded // The connection might time out slightly earlier than `ctx`
+		}
+	}
+	return n, err
+}
+
+// writeBuffers writes all the `bufs` to the connection without being interleaved by other writes
+func (mux *SimpleMux) writeBuffers(bufs [][]byte) (n int, err error) {
+	mux.wrLock.Lock()
+	defer mux.wrLock.Unlock()
+
+	for _, b := range bufs {
+		nn, err := mux.writeLocked(b)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+	return
+}
+
+func (mux *SimpleMux) writeLocked(b []byte) (int, error) {
+	if t := mux.opts.tracer; t != nil {
+		if mux.hdrSz == 0 { // Header size is unknown with codecs
+			t.record(false, nil, b)
+		} else if len(b) > mux.hdrSz {
+			t.record(false, b[:mux.hdrSz], b[mux.hdrSz:])
+		} else {
+			t.record(false, b, nil)
+		}
+	}
+	return mux.conn.Write(b)
+}
+
+// sessionNum returns the number of active sessions and whether the SimpleMux has been closed
+func (mux *SimpleMux) sessionNum() (n int, closed bool) {
+	mux.sessLock.RLock()
+	n, closed = len(mux.allSess), mux.closed
+	mux.sessLock.RUnlock()
+	return
+}
+
 func (mux *SimpleMux) closeSession(sessID uint64) {
 	mux.sessLock.Lock()
 	if !mux.closed {
@@ -253,6 +502,11 @@ func (mux *SimpleMux) getNextSessID() uint64 {
 	return (uint64(time.Now().Unix()) << 32) | uint64(baseID)
 }
 
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
 func asyncNotify(ch chan bool) {
 	select {
 	case ch <- true:
@@ -269,6 +523,17 @@ func asyncNotifyError(ch chan error, err error) {
 
 var kSimpleMuxClosed = fmt.Errorf("this SimpleMux object has already been closed")
 
+// HeaderError is reported when a header fails to be parsed or fails the sanity checks.
+type HeaderError struct {
+	Header  []byte // The raw header
+	BodyLen int64  // Body length advertised by the header, 0 if the header fails to be parsed
+	Reason  string // Why the header is invalid
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("invalid header %x: %s", e.Header, e.Reason)
+}
+
 //------------------------------------------------------------------
 // Session
 //------------------------------------------------------------------
@@ -279,7 +544,9 @@ func newSession(id uint64, mux *SimpleMux) *Session {
 		mux:        mux,
 		packets:    queue.NewLockfreeQueue[*Packet](),
 		packetNoti: make(chan bool, 1),
+		popNoti:    make(chan bool, 1),
 		err:        make(chan error, 1),
+		quit:       make(chan struct{}),
 	}
 }
 
@@ -289,15 +556,19 @@ func newSession(id uint64, mux *SimpleMux) *Session {
 //
 // Session supports bidirectional communication and server-side push.
 //
-//	Note: Methods of Session are not goroutine-safe.
-//	      One session is intended to be used within one goroutine.
+// All methods of Session are goroutine-safe. Each call to Send/SendCtx/SendBuffers writes its data to the connection
+// atomically, so concurrent writers never interleave. A packet is received by only one of the concurrent Recv calls.
 type Session struct {
+	rdTimeout  int64 // time.Duration, accessed atomically
+	stats      trafficStats
+	closed     int32 // 1 if the session has been closed
 	id         uint64
 	mux        *SimpleMux
 	packets    *queue.LockfreeQueue[*Packet]
-	rdTimeout  time.Duration
 	packetNoti chan bool
+	popNoti    chan bool // Notify SimpleMux that a packet is consumed, used by the QueueBlock policy
 	err        chan error
+	quit       chan struct{} // Closed when the session is closed
 }
 
 // ID returns the ID of this session.
@@ -308,39 +579,129 @@ func (sess *Session) ID() uint64 {
 // Send is used to write to the session.
 // For some good reasons, Send doesn't support timeout.
 func (sess *Session) Send(b []byte) (int, error) {
-	if sess.mux != nil {
-		return sess.mux.conn.Write(b)
+	if sess.isClosed() {
+		return 0, kSessionClosed
+	}
+	b, err := sess.mux.interceptFrame(b)
+	if err != nil {
+		return 0, err
+	}
+	return sess.sent(sess.mux.write(b))
+}
+
+// SendBody frames `body` into a packet with the Codec of the SimpleMux and sends it.
+// It fails if the SimpleMux is created by NewSimpleMux, because the FixedHeaderCodec created by it can't build headers.
+func (sess *Session) SendBody(body []byte) (int, error) {
+	if sess.isClosed() {
+		return 0, kSessionClosed
+	}
+	if len(sess.mux.opts.interceptors) > 0 {
+		packet := &Packet{Header: &FrameHeader{ID: sess.id, Len: int64(len(body))}, Body: body}
+		if err := sess.mux.interceptSend(packet); err != nil {
+			return 0, err
+		}
+		body = packet.Body
 	}
-	return 0, kSessionClosed
+	b, err := sess.mux.codec.Encode(sess.id, body)
+	if err != nil {
+		return 0, err
+	}
+	return sess.sent(sess.mux.write(b))
+}
+
+// SendBuffers writes all the `bufs` to the session as a whole, e.g. a header and a body built separately,
+// without being interleaved by the writes from other goroutines.
+func (sess *Session) SendBuffers(bufs ...[]byte) (int, error) {
+	if sess.isClosed() {
+		return 0, kSessionClosed
+	}
+	if len(sess.mux.opts.interceptors) > 0 { // Interceptors work on the whole frame
+		b, err := sess.mux.interceptFrame(bytes.Join(bufs, nil))
+		if err != nil {
+			return 0, err
+		}
+		bufs = [][]byte{b}
+	}
+	return sess.sent(sess.mux.writeBuffers(bufs))
+}
+
+// SendCtx is like Send, but gives up writing when `ctx` is done, and returns ctx.Err().
+// The deadline of `ctx` is applied to the underlying connection via SetWriteDeadline.
+//
+//	Note: If `ctx` is done after part of `b` has been written, the SimpleMux is closed,
+//	      because packets of all sessions share the same connection and the stream is corrupted.
+func (sess *Session) SendCtx(ctx context.Context, b []byte) (int, error) {
+	if sess.isClosed() {
+		return 0, kSessionClosed
+	}
+	b, err := sess.mux.interceptFrame(b)
+	if err != nil {
+		return 0, err
+	}
+	return sess.sent(sess.mux.writeCtx(ctx, b))
 }
 
 // Recv reads data from the session.
 // Returns net.Error at timeout, use err.(net.Error).Timeout()
 // to determine if timeout occurs.
 func (sess *Session) Recv() (packet *Packet, err error) {
+	var deadline time.Time
+	if rdTimeout := time.Duration(atomic.LoadInt64(&sess.rdTimeout)); rdTimeout > 0 {
+		deadline = sess.mux.opts.clock.Now().Add(rdTimeout)
+	}
+	return sess.recv(deadline, nil, nil)
+}
+
+// RecvCtx is like Recv, but waits until `ctx` is done instead of the timeout set by SetRecvTimeout,
+// and returns ctx.Err() in that case.
+func (sess *Session) RecvCtx(ctx context.Context) (*Packet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	packet, err := sess.recv(time.Time{}, nil, ctx.Done())
+	if packet == nil && err == nil {
+		err = ctx.Err()
+	}
+	return packet, err
+}
+
+// recv waits for a packet until `deadline` (zero means no deadline).
+// It returns (nil, nil) if it's woken up by `wakeup` or `cancel` before a packet is received.
+func (sess *Session) recv(deadline time.Time, wakeup <-chan bool, cancel <-chan struct{}) (packet *Packet, err error) {
+	if sess.isClosed() {
+		return nil, kSessionClosed
+	}
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		clk := sess.mux.opts.clock
+		timer := clk.NewTimer(deadline.Sub(clk.Now()))
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+
 	for {
 		packet, _ = sess.packets.Pop()
 		if packet != nil {
+			asyncNotify(sess.popNoti)
+			if sess.packets.Len() > 0 {
+				asyncNotify(sess.packetNoti) // Pass the notification on to other concurrent Recv calls
+			}
 			return
 		}
 
-		var flag bool
-		var timeout <-chan time.Time
-		if sess.rdTimeout > 0 {
-			timeout = time.After(sess.rdTimeout)
-		}
 		select {
-		case flag = <-sess.packetNoti:
+		case <-sess.packetNoti:
+			continue
 		case err = <-sess.err:
+			asyncNotifyError(sess.err, err) // The error is permanent, pass it on to other concurrent and subsequent Recv calls
+		case <-sess.quit:
+			err = kSessionClosed
 		case <-timeout:
-		}
-
-		if flag {
-			continue
-		}
-
-		if err == nil {
 			err = kSessionRdTimeout
+		case <-wakeup:
+		case <-cancel:
 		}
 		return
 	}
@@ -355,7 +716,11 @@ func (sess *Session) Recv() (packet *Packet, err error) {
 //	Example:
 //	    sess.SetRecvTimeout(5 * time.Millisecond)
 func (sess *Session) SetRecvTimeout(timeout time.Duration) {
-	sess.rdTimeout = timeout
+	atomic.StoreInt64(&sess.rdTimeout, int64(timeout))
+}
+
+func (sess *Session) isClosed() bool {
+	return atomic.LoadInt32(&sess.closed) == 1
 }
 
 // LocalAddr returns the local address of the underlying connection.
@@ -368,12 +733,13 @@ func (sess *Session) RemoteAddr() net.Addr {
 	return sess.mux.RemoteAddr()
 }
 
-// Close is used to close the session.
+// Close is used to close the session. Recv calls blocked on the session are unblocked.
 // After finish using a Session, Close() must be called to release resources.
 func (sess *Session) Close() {
-	if sess.mux != nil {
+	if atomic.CompareAndSwapInt32(&sess.closed, 0, 1) {
 		sess.mux.closeSession(sess.ID())
-		sess.mux = nil
+		close(sess.quit)
+		sess.mux.fireSessionEvent(sess, SessionClosed)
 	}
 }
 
@@ -22,13 +22,22 @@ package mux
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
+	"errors"
 	"io"
 	"net"
+	"net/http/httptest"
+	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/antigloss/go/utils/clock"
 )
 
 var wg sync.WaitGroup
@@ -145,3 +154,786 @@ var gHdlrCallTimes int
 func defHandler(*Session, *Packet) {
 	gHdlrCallTimes++
 }
+
+func TestHeaderSanityCheck(t *testing.T) {
+	var valid bytes.Buffer
+	binary.Write(&valid, binary.BigEndian, Header{Len: 4, ID: 7})
+	valid.WriteString("body")
+	corrupted := bytes.Repeat([]byte{0x7f}, 12) // advertises a body of 2139062143 bytes
+
+	// Resync
+	client, server := net.Pipe()
+	errCh := make(chan error, 1)
+	packetCh := make(chan *Packet, 1)
+	mux, _ := NewSimpleMux(client, 12, hdrParser, func(_ *Session, packet *Packet) {
+		packetCh <- packet
+	}, WithMaxBodyLen(1024), WithResync(64), WithErrorHandler(func(_ *SimpleMux, err error) {
+		errCh <- err
+	}))
+	go server.Write(append(corrupted, valid.Bytes()...))
+
+	hdrErr, ok := (<-errCh).(*HeaderError)
+	if !ok || hdrErr.BodyLen != 0x7f7f7f7f {
+		t.Errorf("Expecting HeaderError but gets %v", hdrErr)
+	}
+	select {
+	case packet := <-packetCh:
+		if packet.Header.SessionID() != 7 || string(packet.Body) != "body" {
+			t.Errorf("Unexpected packet after resync: %v %q", packet.Header, packet.Body)
+		}
+	case <-time.After(time.Second):
+		t.Error("Failed to resync")
+	}
+	mux.Close()
+
+	// Close on violation
+	client, server = net.Pipe()
+	mux, _ = NewSimpleMux(client, 12, hdrParser, nil, WithMaxBodyLen(1024))
+	sess, _ := mux.NewSession()
+	go server.Write(corrupted)
+	if _, err := sess.Recv(); err == nil {
+		t.Error("Session should be notified of the HeaderError")
+	} else if _, ok := err.(*HeaderError); !ok {
+		t.Errorf("Expecting HeaderError but gets %v", err)
+	}
+	sess.Close()
+	mux.Close()
+}
+
+func TestSessionConn(t *testing.T) {
+	client, server := net.Pipe()
+	simpleMux, _ := NewSimpleMux(client, 12, hdrParser, nil)
+	defer simpleMux.Close()
+
+	sess, _ := simpleMux.NewSession()
+	conn := NewSessionConn(sess, func(sessID uint64, body []byte) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, Header{Len: int32(len(body)), ID: sessID})
+		buf.Write(body)
+		return buf.Bytes()
+	}, 4)
+
+	// Echo server
+	go func() {
+		hdr := make([]byte, 12)
+		for {
+			if _, err := io.ReadFull(server, hdr); err != nil {
+				return
+			}
+			h, _ := hdrParser(hdr)
+			body := make([]byte, h.BodyLen())
+			io.ReadFull(server, body)
+			server.Write(append(hdr, body...))
+		}
+	}()
+
+	if n, err := conn.Write([]byte("hello world")); n != 11 || err != nil { // Split into 3 packets
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	buf := make([]byte, 11)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello world" {
+		t.Fatalf("ReadFull() = %q, %v", buf, err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := conn.Read(buf); err != os.ErrDeadlineExceeded {
+		t.Errorf("Read should time out: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		conn.Close()
+	}()
+	if _, err := conn.Read(buf); err != net.ErrClosed {
+		t.Errorf("Read should be unblocked by Close: %v", err)
+	}
+	if _, err := conn.Write(buf); err != net.ErrClosed {
+		t.Errorf("Write should fail after Close: %v", err)
+	}
+}
+
+func TestRecvTimeoutWithFakeClock(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	fc := clock.NewFake(time.Now())
+	simpleMux, _ := NewSimpleMux(client, 12, hdrParser, nil, WithClock(fc))
+	defer simpleMux.Close()
+
+	sess, _ := simpleMux.NewSession()
+	sess.SetRecvTimeout(time.Hour)
+	errCh := make(chan error)
+	go func() {
+		_, err := sess.Recv()
+		errCh <- err
+	}()
+
+	fc.BlockUntil(1) // Recv is waiting
+	fc.Advance(time.Hour)
+	if err := <-errCh; err != kSessionRdTimeout {
+		t.Errorf("Recv should time out: %v", err)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	fc := clock.NewFake(time.Now())
+	var heartbeat bytes.Buffer
+	binary.Write(&heartbeat, binary.BigEndian, Header{})
+	simpleMux, _ := NewSimpleMux(client, 12, hdrParser, nil, WithClock(fc),
+		WithKeepalive(time.Second, func() []byte { return heartbeat.Bytes() }, 3*time.Second))
+	defer simpleMux.Close()
+
+	heartbeats := make(chan bool, 10)
+	go func() {
+		buf := make([]byte, 12)
+		for i := 0; ; i++ {
+			if _, err := io.ReadFull(server, buf); err != nil {
+				return
+			}
+			if i == 0 {
+				server.Write(buf) // Only respond to the first heartbeat
+			}
+			heartbeats <- true
+		}
+	}()
+
+	sess, _ := simpleMux.NewSession()
+	errCh := make(chan error)
+	go func() {
+		_, err := sess.Recv()
+		errCh <- err
+	}()
+
+	fc.BlockUntil(1) // keepalive ticker is running
+	fc.Advance(time.Second)
+	<-heartbeats
+	for i := 0; i < 10; i++ {
+		fc.Advance(time.Second)
+		select {
+		case err := <-errCh:
+			if err != ErrKeepaliveTimeout {
+				t.Errorf("Recv should fail with ErrKeepaliveTimeout: %v", err)
+			}
+			if elapsed := time.Duration(i+2) * time.Second; elapsed < 4*time.Second {
+				t.Errorf("Closed too early: %v", elapsed)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Error("SimpleMux should be closed after idle timeout")
+}
+
+func TestMuxPool(t *testing.T) {
+	const connNum = 3
+	var conns []net.Conn
+	for i := 0; i < connNum; i++ {
+		client, server := net.Pipe()
+		defer server.Close()
+		go io.Copy(server, server) // echo
+		conns = append(conns, client)
+	}
+
+	// Round-robin
+	pool, _ := NewMuxPool(conns, DispatchRoundRobin, 12, hdrParser, nil)
+	var sessions []*Session
+	for i := 0; i < connNum*2; i++ {
+		sess, _ := pool.NewSession()
+		if i >= connNum && sess.mux != sessions[i-connNum].mux {
+			t.Errorf("Session %d should be dispatched to connection %d", i, i%connNum)
+		}
+		sessions = append(sessions, sess)
+
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, Header{Len: 4, ID: sess.ID()})
+		buf.WriteString("ping")
+		sess.Send(buf.Bytes())
+		if packet, err := sess.Recv(); err != nil || string(packet.Body) != "ping" {
+			t.Errorf("Unexpected packet: %v %v", packet, err)
+		}
+	}
+	if sessions[0].mux == sessions[1].mux || sessions[1].mux == sessions[2].mux {
+		t.Error("Sessions should be dispatched to different connections")
+	}
+
+	// Closed connections are skipped
+	sessions[0].mux.Close()
+	for i := 0; i < connNum; i++ {
+		if sess, err := pool.NewSession(); err != nil || sess.mux == sessions[0].mux {
+			t.Errorf("Closed connection should be skipped: %v", err)
+		}
+	}
+	pool.Close()
+	if _, err := pool.NewSession(); err == nil {
+		t.Error("NewSession should fail after Close")
+	}
+
+	// Least-loaded
+	conns = conns[:0]
+	for i := 0; i < connNum; i++ {
+		client, server := net.Pipe()
+		defer server.Close()
+		conns = append(conns, client)
+	}
+	pool, _ = NewMuxPool(conns, DispatchLeastLoaded, 12, hdrParser, nil)
+	defer pool.Close()
+	sessions = sessions[:0]
+	for i := 0; i < connNum; i++ {
+		sess, _ := pool.NewSession()
+		sessions = append(sessions, sess)
+	}
+	busy := sessions[0].mux
+	for i := 0; i < connNum; i++ {
+		if sessions[i].mux == sessions[(i+1)%connNum].mux {
+			t.Error("Sessions should be spread over all connections")
+		}
+		if i > 0 {
+			sessions[i].Close()
+		}
+	}
+	for i := 0; i < connNum-1; i++ {
+		if sess, _ := pool.NewSession(); sess.mux == busy {
+			t.Error("Session should be dispatched to the least loaded connection")
+		}
+	}
+}
+
+func TestSessionCtx(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	simpleMux, _ := NewSimpleMux(client, 12, hdrParser, nil)
+	defer simpleMux.Close()
+	sess, _ := simpleMux.NewSession()
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, Header{Len: 4, ID: sess.ID()})
+	buf.WriteString("ping")
+
+	// Nobody reads from `server`, the write blocks until timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if n, err := sess.SendCtx(ctx, buf.Bytes()); n != 0 || err != context.DeadlineExceeded {
+		t.Errorf("SendCtx should time out: %d %v", n, err)
+	}
+	if _, err := sess.RecvCtx(ctx); err != context.DeadlineExceeded {
+		t.Errorf("RecvCtx should fail with the context error: %v", err)
+	}
+
+	// Nothing written, so the SimpleMux is still usable
+	go io.Copy(server, server)
+	if _, err := sess.SendCtx(context.Background(), buf.Bytes()); err != nil {
+		t.Fatalf("SendCtx failed: %v", err)
+	}
+	if packet, err := sess.RecvCtx(context.Background()); err != nil || string(packet.Body) != "ping" {
+		t.Errorf("Unexpected packet: %v %v", packet, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := sess.RecvCtx(ctx); err != context.Canceled {
+		t.Errorf("RecvCtx should be canceled: %v", err)
+	}
+}
+
+func TestSessionQueueLimit(t *testing.T) {
+	packetTo := func(sess *Session, n int32) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, Header{Len: 4, ID: sess.ID()})
+		binary.Write(&buf, binary.BigEndian, n)
+		return buf.Bytes()
+	}
+	bodyOf := func(packet *Packet) (n int32) {
+		binary.Read(bytes.NewReader(packet.Body), binary.BigEndian, &n)
+		return
+	}
+
+	// Drop oldest
+	client, server := net.Pipe()
+	simpleMux, _ := NewSimpleMux(client, 12, hdrParser, nil, WithSessionQueueLimit(2, QueueDropOldest))
+	sess, _ := simpleMux.NewSession()
+	for i := int32(0); i < 5; i++ {
+		server.Write(packetTo(sess, i))
+	}
+	server.Write(packetTo(&Session{}, 0)) // Packets are processed in order, so the previous ones have been queued after this one is read
+	if stats := simpleMux.QueueStats(); stats.Dropped != 3 || stats.Queued != 2 || sess.QueueLen() != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	for i := int32(3); i < 5; i++ {
+		if packet, _ := sess.Recv(); bodyOf(packet) != i {
+			t.Errorf("Should receive %d but gets %d", i, bodyOf(packet))
+		}
+	}
+	simpleMux.Close()
+	server.Close()
+
+	// Close session
+	client, server = net.Pipe()
+	simpleMux, _ = NewSimpleMux(client, 12, hdrParser, nil, WithSessionQueueLimit(2, QueueCloseSession))
+	sess, _ = simpleMux.NewSession()
+	other, _ := simpleMux.NewSession()
+	for i := int32(0); i < 3; i++ {
+		server.Write(packetTo(sess, i))
+	}
+	server.Write(packetTo(other, 0))
+	for i := int32(0); i < 2; i++ {
+		if packet, err := sess.Recv(); err != nil || bodyOf(packet) != i {
+			t.Errorf("Queued packets should be received: %v", err)
+		}
+	}
+	if _, err := sess.Recv(); err != ErrSessionQueueFull {
+		t.Errorf("Should fail with ErrSessionQueueFull: %v", err)
+	}
+	if _, err := other.Recv(); err != nil {
+		t.Errorf("Other sessions should not be affected: %v", err)
+	}
+	if stats := simpleMux.QueueStats(); stats.ClosedSessions != 1 || stats.Sessions != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	simpleMux.Close()
+	server.Close()
+
+	// Block
+	client, server = net.Pipe()
+	defer server.Close()
+	simpleMux, _ = NewSimpleMux(client, 12, hdrParser, nil, WithSessionQueueLimit(1, QueueBlock))
+	defer simpleMux.Close()
+	sess, _ = simpleMux.NewSession()
+	server.Write(packetTo(sess, 0))
+	written := make(chan bool)
+	go func() {
+		server.Write(packetTo(sess, 1))
+		server.Write(packetTo(sess, 2)) // Blocked until packet 0 is consumed
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Error("Reading should be blocked while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for i := int32(0); i < 3; i++ {
+		if packet, _ := sess.Recv(); bodyOf(packet) != i {
+			t.Errorf("Should receive %d but gets %d", i, bodyOf(packet))
+		}
+	}
+	<-written
+}
+
+func TestConcurrentSession(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(server, server)
+	simpleMux, _ := NewSimpleMux(client, 12, hdrParser, nil)
+	defer simpleMux.Close()
+	sess, _ := simpleMux.NewSession()
+
+	const writers, times = 8, 200
+	var senders sync.WaitGroup
+	senders.Add(writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			defer senders.Done()
+			var hdr bytes.Buffer
+			binary.Write(&hdr, binary.BigEndian, Header{Len: 4, ID: sess.ID()})
+			body := []byte{byte(i), byte(i), byte(i), byte(i)}
+			for j := 0; j < times; j++ {
+				sess.SendBuffers(hdr.Bytes(), body) // header and body must not be interleaved
+			}
+		}(i)
+	}
+
+	var received int32
+	var receivers sync.WaitGroup
+	receivers.Add(writers)
+	for i := 0; i < writers; i++ {
+		go func() {
+			defer receivers.Done()
+			for {
+				packet, err := sess.Recv()
+				if err != nil {
+					return
+				}
+				if b := packet.Body; b[0] != b[1] || b[0] != b[2] || b[0] != b[3] {
+					t.Errorf("Corrupted body: %v", b)
+				}
+				atomic.AddInt32(&received, 1)
+			}
+		}()
+	}
+
+	senders.Wait()
+	for atomic.LoadInt32(&received) < writers*times {
+		time.Sleep(time.Millisecond)
+	}
+	sess.Close() // unblocks all the receivers
+	receivers.Wait()
+}
+
+func TestCodec(t *testing.T) {
+	fixed, _ := NewFixedHeaderCodec(12, hdrParser, func(sessID uint64, bodyLen int) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, Header{Len: int32(bodyLen), ID: sessID})
+		return buf.Bytes()
+	})
+	codecs := map[string]Codec{"fixed": fixed, "length": NewLengthPrefixCodec(1024), "varint": NewVarintCodec(1024)}
+	for name, codec := range codecs {
+		for _, id := range []uint64{0, 1, 300, 1<<64 - 1} {
+			for _, body := range [][]byte{nil, []byte("hello"), bytes.Repeat([]byte{'x'}, 1024)} {
+				b, err := codec.Encode(id, body)
+				if err != nil {
+					t.Fatalf("%s: Encode failed: %v", name, err)
+				}
+				r := bytes.NewReader(b)
+				packet, _, err := codec.Decode(r)
+				if err != nil || packet.Header.SessionID() != id || !bytes.Equal(packet.Body, body) || r.Len() != 0 {
+					t.Errorf("%s: Decode mismatch: %v %v", name, packet, err)
+				}
+			}
+		}
+
+		if name == "fixed" {
+			continue
+		}
+		b, _ := codec.Encode(1, make([]byte, 1025))
+		if _, _, err := codec.Decode(bytes.NewReader(b)); err == nil {
+			t.Errorf("%s: Body exceeding the limit should be rejected", name)
+		} else if _, ok := err.(*HeaderError); !ok {
+			t.Errorf("%s: Should be *HeaderError: %v", name, err)
+		}
+
+		client, server := net.Pipe()
+		go io.Copy(server, server)
+		simpleMux, _ := NewSimpleMuxWithCodec(client, codec, nil)
+		sess, _ := simpleMux.NewSession()
+		for _, body := range []string{"ping", "", "pong"} {
+			if _, err := sess.SendBody([]byte(body)); err != nil {
+				t.Fatalf("%s: SendBody failed: %v", name, err)
+			}
+			if packet, err := sess.Recv(); err != nil || string(packet.Body) != body {
+				t.Errorf("%s: Unexpected packet: %v %v", name, packet, err)
+			}
+		}
+		simpleMux.Close()
+		server.Close()
+	}
+
+	simpleMux, _ := NewSimpleMux(&net.TCPConn{}, 12, hdrParser, nil)
+	sess, _ := simpleMux.NewSession()
+	if _, err := sess.SendBody(nil); err == nil {
+		t.Error("SendBody should fail without buildHeader")
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	defer srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	simpleMux, err := DialSimpleMux("tcp", ln.Addr().String(), 12, hdrParser, nil,
+		WithTLS(&tls.Config{RootCAs: roots}), WithDialTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("DialSimpleMux failed: %v", err)
+	}
+	defer simpleMux.Close()
+	if state, ok := simpleMux.TLSConnectionState(); !ok || !state.HandshakeComplete {
+		t.Error("TLS handshake should be completed")
+	}
+
+	sess, _ := simpleMux.NewSession()
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, Header{Len: 4, ID: sess.ID()})
+	buf.WriteString("ping")
+	sess.Send(buf.Bytes())
+	if packet, err := sess.Recv(); err != nil || string(packet.Body) != "ping" {
+		t.Errorf("Unexpected packet: %v %v", packet, err)
+	}
+
+	// Untrusted certificate
+	if _, err = DialSimpleMux("tcp", ln.Addr().String(), 12, hdrParser, nil, WithTLS(&tls.Config{}), WithDialTimeout(5*time.Second)); err == nil {
+		t.Error("Handshake should fail with an untrusted certificate")
+	}
+}
+
+func TestSimpleMuxServer(t *testing.T) {
+	codec := NewLengthPrefixCodec(1024)
+	var newSessions int32
+	srv, _ := NewSimpleMuxServer(codec, func(conn *ServerConn, packet *Packet) {
+		atomic.AddInt32(&newSessions, 1)
+		sessID := packet.Header.SessionID()
+		handler := func(conn *ServerConn, packet *Packet) {
+			conn.SendBody(sessID, append([]byte("echo:"), packet.Body...))
+		}
+		conn.Handle(sessID, handler)
+		handler(conn, packet)
+	}, nil)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	served := make(chan error)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+
+	simpleMux, err := DialSimpleMuxWithCodec("tcp", ln.Addr().String(), codec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simpleMux.Close()
+	for i := 0; i < 3; i++ {
+		sess, _ := simpleMux.NewSession()
+		for _, body := range []string{"a", "b"} {
+			sess.SendBody([]byte(body))
+			if packet, err := sess.Recv(); err != nil || string(packet.Body) != "echo:"+body {
+				t.Errorf("Unexpected packet: %v %v", packet, err)
+			}
+		}
+		sess.Close()
+	}
+	if n := atomic.LoadInt32(&newSessions); n != 3 {
+		t.Errorf("Default handler should be called once per session: %d", n)
+	}
+
+	sess, _ := simpleMux.NewSession()
+	sess.SetRecvTimeout(5 * time.Second)
+	srv.Close()
+	if err = <-served; err == nil {
+		t.Error("Serve should return error after Close")
+	}
+	if _, err = sess.Recv(); err == nil || err == kSessionRdTimeout {
+		t.Errorf("Connection should be closed by the server: %v", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(server, server)
+	var events []SessionEvent
+	simpleMux, _ := NewSimpleMux(client, 12, hdrParser, nil, WithSessionEventHandler(func(sess *Session, event SessionEvent) {
+		events = append(events, event)
+	}))
+	defer simpleMux.Close()
+
+	sess, _ := simpleMux.NewSession()
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, Header{Len: 4, ID: sess.ID()})
+	buf.WriteString("ping")
+	for i := 0; i < 3; i++ {
+		sess.Send(buf.Bytes())
+		sess.Recv()
+	}
+	if stats := simpleMux.Stats(); stats.ActiveSessions != 1 || stats.PacketsOut != 3 {
+		t.Errorf("Unexpected mux stats: %+v", stats)
+	}
+	server.Write(bytes.Repeat([]byte{0xff}, 12)) // Negative body length
+
+	expected := Stats{BytesIn: 48, BytesOut: 48, PacketsIn: 3, PacketsOut: 3}
+	stats := sess.Stats()
+	if stats.LastActivity.IsZero() {
+		t.Error("LastActivity should be set")
+	}
+	stats.LastActivity = time.Time{}
+	if stats != expected {
+		t.Errorf("Unexpected session stats: %+v", stats)
+	}
+
+	if _, err := sess.Recv(); err == nil {
+		t.Error("SimpleMux should be closed by the invalid header")
+	}
+	stats = simpleMux.Stats()
+	stats.LastActivity = time.Time{}
+	expected.ParseErrors = 1
+	if stats != expected {
+		t.Errorf("Unexpected mux stats: %+v", stats)
+	}
+
+	sess.Close()
+	if len(events) != 2 || events[0] != SessionCreated || events[1] != SessionClosed {
+		t.Errorf("Unexpected session events: %v", events)
+	}
+}
+
+func TestDefaultHandlerPool(t *testing.T) {
+	packet := func(id uint64, body string) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, Header{Len: int32(len(body)), ID: id})
+		buf.WriteString(body)
+		return buf.Bytes()
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+	started := make(chan bool, 2)
+	release := make(chan bool)
+	handled := make(chan string, 10)
+	errCh := make(chan error, 1)
+	mux, _ := NewSimpleMux(client, 12, hdrParser, func(_ *Session, p *Packet) {
+		switch string(p.Body) {
+		case "block":
+			started <- true
+			<-release
+		case "panic":
+			panic("bad packet")
+		}
+		handled <- string(p.Body)
+	}, WithDefaultHandlerPool(2, 1), WithErrorHandler(func(_ *SimpleMux, err error) {
+		errCh <- err
+	}))
+	defer mux.Close()
+	sess, _ := mux.NewSession()
+
+	// A slow or panicking handler doesn't stall the other packets
+	server.Write(packet(1000, "block"))
+	<-started
+	server.Write(packet(1000, "panic"))
+	if err, ok := (<-errCh).(*HandlerPanicError); !ok || err.Value != "bad packet" || len(err.Stack) == 0 {
+		t.Errorf("Expecting HandlerPanicError but gets %v", err)
+	}
+	server.Write(packet(1000, "ok1"))
+	if body := <-handled; body != "ok1" {
+		t.Errorf("Unexpected packet handled: %s", body)
+	}
+
+	// Packets are dropped if the queue is full
+	server.Write(packet(1000, "block"))
+	<-started
+	server.Write(packet(1000, "ok2"))
+	server.Write(packet(1000, "ok3"))
+	server.Write(packet(sess.ID(), "sync")) // Packets are processed in order, so the previous ones have been submitted after this one is read
+	if stats := mux.QueueStats(); stats.DroppedDefault != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	close(release)
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		got[<-handled] = true
+	}
+	if !got["block"] || !got["ok2"] || got["ok3"] {
+		t.Errorf("Unexpected packets handled: %v", got)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	xor := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = b[i] ^ 0x5a
+		}
+		return out
+	}
+	suffix := Interceptor{
+		OnSend: func(p *Packet) error {
+			p.Body = append(append([]byte(nil), p.Body...), '!')
+			return nil
+		},
+		OnRecv: func(p *Packet) error {
+			if len(p.Body) == 0 || p.Body[len(p.Body)-1] != '!' {
+				return errors.New("missing suffix")
+			}
+			p.Body = p.Body[:len(p.Body)-1]
+			return nil
+		},
+	}
+	cipher := Interceptor{
+		OnSend: func(p *Packet) error {
+			p.Body = xor(p.Body)
+			return nil
+		},
+		OnRecv: func(p *Packet) error {
+			p.Body = xor(p.Body)
+			return nil
+		},
+	}
+	var sent, recved int32
+	metrics := Interceptor{
+		OnSend: func(p *Packet) error {
+			if string(p.Body) == "reject" {
+				return errors.New("rejected")
+			}
+			atomic.AddInt32(&sent, 1)
+			return nil
+		},
+		OnRecv: func(p *Packet) error {
+			atomic.AddInt32(&recved, 1)
+			return nil
+		},
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+	errCh := make(chan error, 1)
+	go io.Copy(server, server)
+	simpleMux, _ := NewSimpleMuxWithCodec(client, NewLengthPrefixCodec(1024), nil, WithInterceptors(metrics, suffix, cipher))
+	defer simpleMux.Close()
+	sess, _ := simpleMux.NewSession()
+
+	for _, body := range []string{"ping", "pong"} {
+		if _, err := sess.SendBody([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		if packet, err := sess.Recv(); err != nil || string(packet.Body) != body {
+			t.Errorf("Unexpected packet: %v %v", packet, err)
+		}
+	}
+	if _, err := sess.SendBody([]byte("reject")); err == nil || err.Error() != "rejected" {
+		t.Errorf("Expecting error from OnSend but gets %v", err)
+	}
+
+	if atomic.LoadInt32(&sent) != 2 || atomic.LoadInt32(&recved) != 2 {
+		t.Errorf("Unexpected metrics: sent=%d recved=%d", sent, recved)
+	}
+
+	// Raw frames are intercepted as a whole, and packets failing OnRecv are dropped
+	client, server = net.Pipe()
+	defer server.Close()
+	go io.Copy(server, server)
+	codec := NewLengthPrefixCodec(1024)
+	rawMux, _ := NewSimpleMuxWithCodec(client, codec, nil, WithInterceptors(Interceptor{
+		OnSend: func(p *Packet) error {
+			if p.Header != nil {
+				return errors.New("header should be nil")
+			}
+			return nil
+		},
+		OnRecv: func(p *Packet) error {
+			if p.Header.SessionID() == 0 {
+				return errors.New("bad session")
+			}
+			return nil
+		},
+	}), WithErrorHandler(func(_ *SimpleMux, err error) {
+		errCh <- err
+	}))
+	defer rawMux.Close()
+	sess, _ = rawMux.NewSession()
+	frame, _ := codec.Encode(0, []byte("raw"))
+	if _, err := sess.Send(frame); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; err == nil || err.Error() != "bad session" {
+		t.Errorf("Expecting error from OnRecv but gets %v", err)
+	}
+	frame, _ = codec.Encode(sess.ID(), []byte("raw"))
+	sess.SendBuffers(frame[:4], frame[4:])
+	if packet, err := sess.Recv(); err != nil || string(packet.Body) != "raw" {
+		t.Errorf("Unexpected packet: %v %v", packet, err)
+	}
+}
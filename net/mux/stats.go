@@ -0,0 +1,111 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SessionEvent is passed to the handler set by WithSessionEventHandler.
+type SessionEvent int
+
+const (
+	// SessionCreated is fired when a session is created by NewSession.
+	SessionCreated SessionEvent = iota
+	// SessionClosed is fired when a session is closed by Session.Close.
+	SessionClosed
+)
+
+// Stats is a snapshot of the traffic statistics of a SimpleMux or a Session.
+type Stats struct {
+	BytesIn      uint64    // Bytes received, headers included
+	BytesOut     uint64    // Bytes sent, headers included
+	PacketsIn    uint64    // Packets received
+	PacketsOut   uint64    // Packets sent. Each call to the Send methods counts as one packet
+	LastActivity time.Time // Last time when a packet is sent or received. Zero if there is no traffic yet
+
+	// The following fields are only available for SimpleMux.
+	ActiveSessions int    // Number of sessions not closed yet
+	ParseErrors    uint64 // Number of headers failed to be parsed or failed the sanity checks
+}
+
+// Stats returns the traffic statistics of the SimpleMux, heartbeats and packets without an associated session included.
+func (mux *SimpleMux) Stats() Stats {
+	stats := mux.stats.snapshot()
+	mux.sessLock.RLock()
+	stats.ActiveSessions = len(mux.allSess)
+	mux.sessLock.RUnlock()
+	stats.ParseErrors = atomic.LoadUint64(&mux.parseErrors)
+	return stats
+}
+
+// Stats returns the traffic statistics of the session.
+func (sess *Session) Stats() Stats {
+	return sess.stats.snapshot()
+}
+
+// sent records the outcome of a Send method and passes it through
+func (sess *Session) sent(n int, err error) (int, error) {
+	if n > 0 {
+		now := sess.mux.opts.clock.Now()
+		sess.stats.add(false, n, now)
+		sess.mux.stats.add(false, n, now)
+	}
+	return n, err
+}
+
+func (mux *SimpleMux) fireSessionEvent(sess *Session, event SessionEvent) {
+	if mux.opts.sessEventHandler != nil {
+		mux.opts.sessEventHandler(sess, event)
+	}
+}
+
+// trafficStats holds the traffic counters. All fields are 64-bit for atomic operations.
+type trafficStats struct {
+	bytesIn      uint64
+	bytesOut     uint64
+	packetsIn    uint64
+	packetsOut   uint64
+	lastActivity int64 // UnixNano
+}
+
+func (s *trafficStats) add(inbound bool, n int, now time.Time) {
+	if inbound {
+		atomic.AddUint64(&s.bytesIn, uint64(n))
+		atomic.AddUint64(&s.packetsIn, 1)
+	} else {
+		atomic.AddUint64(&s.bytesOut, uint64(n))
+		atomic.AddUint64(&s.packetsOut, 1)
+	}
+	atomic.StoreInt64(&s.lastActivity, now.UnixNano())
+}
+
+func (s *trafficStats) snapshot() (stats Stats) {
+	stats.BytesIn = atomic.LoadUint64(&s.bytesIn)
+	stats.BytesOut = atomic.LoadUint64(&s.bytesOut)
+	stats.PacketsIn = atomic.LoadUint64(&s.packetsIn)
+	stats.PacketsOut = atomic.LoadUint64(&s.packetsOut)
+	if t := atomic.LoadInt64(&s.lastActivity); t != 0 {
+		stats.LastActivity = time.Unix(0, t)
+	}
+	return
+}
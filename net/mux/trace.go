@@ -0,0 +1,155 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antigloss/go/logger"
+)
+
+// TraceFrame is a frame recorded by WithTrace.
+type TraceFrame struct {
+	Time    time.Time // when the frame was sent or received
+	Inbound bool      // true for frames received from the remote server, false for frames sent to it
+	Header  []byte    // raw header. For outbound frames, it's the first `hdrSz` bytes passed to Session.Send, or empty with codecs other than FixedHeaderCodec
+	Body    []byte    // raw body, might be truncated or empty due to `maxBodyLen` passed to WithTrace
+	BodyLen int64     // original length of the body
+}
+
+// Truncated returns true if the body is not completely recorded.
+func (f *TraceFrame) Truncated() bool {
+	return int64(len(f.Body)) < f.BodyLen
+}
+
+// ReadTrace reads all frames recorded by WithTrace from `r`, which is usually a trace file written by the Logger.
+func ReadTrace(r io.Reader) ([]*TraceFrame, error) {
+	var frames []*TraceFrame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+	for scanner.Scan() {
+		line := scanner.Text()
+		pos := strings.Index(line, kTraceMagic)
+		if pos < 0 { // not a trace record
+			continue
+		}
+
+		frame, err := parseTraceRecord(line[pos+len(kTraceMagic):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid trace record: %s: %q", err, line)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, scanner.Err()
+}
+
+// ReplayTrace reads frames recorded by WithTrace from `r`, replays the inbound frames against `hdrParser`,
+// and calls `handler` with every frame and the packet parsed from it.
+// It stops and returns error if reading fails, `hdrParser` fails, BodyLen of the parsed header mismatches with the recorded one,
+// or `handler` returns an error.
+func ReplayTrace(r io.Reader, hdrParser func(hdr []byte) (SimpleMuxHeader, error), handler func(frame *TraceFrame, packet *Packet) error) error {
+	frames, err := ReadTrace(r)
+	if err != nil {
+		return err
+	}
+
+	for i, frame := range frames {
+		if !frame.Inbound {
+			continue
+		}
+
+		hdr, err := hdrParser(frame.Header)
+		if err != nil {
+			return fmt.Errorf("frame %d: %s", i, err)
+		}
+		if hdr.BodyLen() != frame.BodyLen {
+			return fmt.Errorf("frame %d: body length mismatch. parsed=%d recorded=%d", i, hdr.BodyLen(), frame.BodyLen)
+		}
+
+		if err = handler(frame, &Packet{Header: hdr, Body: frame.Body}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tracer writes trace records with format: `#MUXTRACE# IN|OUT UnixNano HeaderHex BodyHex BodyLen`
+type tracer struct {
+	lg         *logger.Logger
+	maxBodyLen int
+}
+
+func (t *tracer) record(inbound bool, hdr, body []byte) {
+	direction := "OUT"
+	if inbound {
+		direction = "IN"
+	}
+
+	bodyLen := len(body)
+	if t.maxBodyLen >= 0 && len(body) > t.maxBodyLen {
+		body = body[:t.maxBodyLen]
+	}
+	t.lg.Infof("%s%s %d %s %s %d", kTraceMagic, direction, time.Now().UnixNano(), hexOrDash(hdr), hexOrDash(body), bodyLen)
+}
+
+func hexOrDash(b []byte) string {
+	if len(b) == 0 {
+		return "-"
+	}
+	return hex.EncodeToString(b)
+}
+
+func parseTraceRecord(rec string) (frame *TraceFrame, err error) {
+	fields := strings.Fields(rec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%d fields", len(fields))
+	}
+
+	frame = &TraceFrame{Inbound: fields[0] == "IN"}
+	ts, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	frame.Time = time.Unix(0, ts)
+	if frame.Header, err = unhexOrDash(fields[2]); err != nil {
+		return nil, err
+	}
+	if frame.Body, err = unhexOrDash(fields[3]); err != nil {
+		return nil, err
+	}
+	frame.BodyLen, err = strconv.ParseInt(fields[4], 10, 64)
+	return
+}
+
+func unhexOrDash(s string) ([]byte, error) {
+	if s == "-" {
+		return nil, nil
+	}
+	return hex.DecodeString(s)
+}
+
+const kTraceMagic = "#MUXTRACE# "
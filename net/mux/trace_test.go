@@ -0,0 +1,74 @@
+/*
+ *
+ * mux - Connection multiplexer.
+ * Copyright (C) 2016 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antigloss/go/logger"
+)
+
+func TestTrace(t *testing.T) {
+	dir := t.TempDir()
+	lg, err := logger.New(&logger.Config{
+		LogDir:           dir,
+		LogSymlinkPrefix: "trace",
+		LogFileMaxNum:    10,
+		LogFileNumToDel:  1,
+		LogLevel:         logger.LogLevelInfo,
+		LogDest:          logger.LogDestFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.BigEndian, Header{Len: 4, ID: 99})
+	tr := &tracer{lg: lg, maxBodyLen: 2}
+	tr.record(false, hdr.Bytes(), []byte{1, 2, 3, 4})
+	tr.record(true, hdr.Bytes(), []byte{1, 2, 3, 4})
+	lg.Close()
+
+	f, err := os.Open(filepath.Join(dir, "trace.INFO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var frames []*TraceFrame
+	err = ReplayTrace(f, hdrParser, func(frame *TraceFrame, packet *Packet) error {
+		frames = append(frames, frame)
+		if packet.Header.SessionID() != 99 {
+			t.Errorf("Unexpected session ID: %d", packet.Header.SessionID())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || !frames[0].Inbound || !frames[0].Truncated() || !bytes.Equal(frames[0].Body, []byte{1, 2}) {
+		t.Errorf("Unexpected frames: %+v", frames)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ *
+ * tcppool - TCP client connection pool.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tcppool
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+// Dialer connects to `addr` on the named `network`, such as net.Dialer.DialContext.
+type Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// PingFunc checks whether an idle connection is still healthy. It returns an error if the connection should be closed.
+type PingFunc func(conn net.Conn) error
+
+// WithDialTimeout sets the timeout of connecting to the server, TLS handshake included. Default is 5s.
+func WithDialTimeout(timeout time.Duration) option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.dialTimeout = timeout
+		}
+	}
+}
+
+// WithDialer sets the function used to connect to the server. Default is net.Dialer.DialContext.
+func WithDialer(dialer Dialer) option {
+	return func(o *options) {
+		o.dialer = dialer
+	}
+}
+
+// WithTLS makes the pool establish TLS over the connections right after connecting.
+// If config.ServerName is empty, the host part of the address is used.
+func WithTLS(config *tls.Config) option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithPing sets the function used to check the health of idle connections. By default, a connection is considered unhealthy
+// if it's closed by the server or has unexpected data to read, which is detected by a read with a tiny timeout.
+func WithPing(ping PingFunc) option {
+	return func(o *options) {
+		o.ping = ping
+	}
+}
+
+// WithHealthCheckInterval sets the interval of checking the health of idle connections. Default is 10s.
+func WithHealthCheckInterval(interval time.Duration) option {
+	return func(o *options) {
+		if interval > 0 {
+			o.healthCheckInterval = interval
+		}
+	}
+}
+
+// WithIdleTimeout makes the pool close connections which have been idle in the pool for longer than `timeout`.
+// Default is 0, which means no timeout.
+func WithIdleTimeout(timeout time.Duration) option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithMaxLifetime makes the pool close connections which have been created for longer than `lifetime` once they are idle,
+// so that connections are renewed periodically. Default is 0, which means no limit.
+func WithMaxLifetime(lifetime time.Duration) option {
+	return func(o *options) {
+		o.maxLifetime = lifetime
+	}
+}
+
+// WithClock sets the source of the time used for health checks, idle timeouts and lifetimes. Default is clock.Real.
+// Set it to a clock.Fake to test time-dependent behaviors without sleeping.
+func WithClock(c clock.Clock) option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	dialTimeout         time.Duration
+	dialer              Dialer
+	tlsConfig           *tls.Config
+	ping                PingFunc
+	healthCheckInterval time.Duration
+	idleTimeout         time.Duration
+	maxLifetime         time.Duration
+	clock               clock.Clock
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
@@ -0,0 +1,426 @@
+/*
+ *
+ * tcppool - TCP client connection pool.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package tcppool implements a pool of TCP client connections, for clients of raw protocols built directly on net.Conn.
+package tcppool
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+// ErrPoolClosed is returned by Get after the pool is closed.
+var ErrPoolClosed = errors.New("tcppool: pool is closed")
+
+var errUnexpectedData = errors.New("tcppool: unexpected data on idle connection")
+
+// Pool is a pool of connections to a TCP address. It's goroutine-safe.
+type Pool struct {
+	dialFailures uint64 // Accessed atomically, keep it 64-bit aligned
+	lock         sync.Mutex
+	idleList     list.List              // Idle connections, *idleConn
+	waiters      list.List              // Goroutines blocked in Get, chan connRequest
+	createTime   map[net.Conn]time.Time // Creation time of the connections taken from the pool
+	numOpen      int                    // Connections opened, including those being dialed
+	closed       bool
+	quit         chan struct{} // Closed by Close to stop health checks
+	// readonly variables
+	addr     string
+	maxIdle  int
+	maxConns int
+	opts     options
+	clock    clock.Clock
+}
+
+// Stats is a snapshot of the statistics of a Pool.
+type Stats struct {
+	InUse        int    // Connections taken out by Get and not put back yet, including those being dialed or checked
+	Idle         int    // Connections pooled
+	Waiters      int    // Goroutines blocked in Get
+	MaxConns     int    // Max connections
+	DialFailures uint64 // Number of failed attempts to connect
+}
+
+// New creates a ready-to-use Pool.
+//
+//	addr: TCP address of the server
+//	maxIdle: Max pooled idle connections
+//	maxConns: Max connections. <=0 means unlimited
+//	opts: Optional settings such as WithDialTimeout, WithTLS, WithPing, WithIdleTimeout and WithMaxLifetime
+//
+// Example:
+//
+//	pool := tcppool.New("127.0.0.1:6379", 10, 100, tcppool.WithIdleTimeout(time.Minute))
+//	conn, err := pool.Get(ctx) // Gets a connection from the pool, or creates a new one if the pool is empty
+//	...
+//	pool.Put(conn, err != nil) // Puts the connection back to the pool, or closes it if it's broken
+//	pool.Close()               // Closes all pooled connections when the pool is no longer needed
+func New(addr string, maxIdle, maxConns int, opts ...option) *Pool {
+	o := options{
+		dialTimeout:         kDefaultDialTimeout,
+		healthCheckInterval: kDefaultHealthCheckInterval,
+	}
+	o.apply(opts...)
+	if o.dialer == nil {
+		o.dialer = (&net.Dialer{}).DialContext
+	}
+	if o.ping == nil {
+		o.ping = checkAlive
+	}
+
+	pool := &Pool{
+		createTime: make(map[net.Conn]time.Time),
+		quit:       make(chan struct{}),
+		addr:       addr,
+		maxIdle:    maxIdle,
+		maxConns:   maxConns,
+		opts:       o,
+		clock:      clock.OrReal(o.clock),
+	}
+	pool.idleList.Init()
+	pool.waiters.Init()
+	go pool.healthCheck()
+
+	return pool
+}
+
+// Get gets a connection from the pool. If no idle connection is available and the max connections is not reached,
+// a new connection is created. Otherwise, Get blocks until a connection is put back, or `ctx` is done.
+// It returns ErrPoolClosed if the pool is closed, or ctx.Err() if `ctx` is done before a connection is available.
+func (pool *Pool) Get(ctx context.Context) (net.Conn, error) {
+	var expired []net.Conn
+	defer func() {
+		closeAll(expired)
+	}()
+
+	pool.lock.Lock()
+	for {
+		if pool.closed {
+			pool.lock.Unlock()
+			return nil, ErrPoolClosed
+		}
+
+		elem := pool.idleList.Front()
+		if elem == nil {
+			break
+		}
+		ic := pool.idleList.Remove(elem).(*idleConn)
+		if pool.expired(ic, pool.clock.Now()) {
+			pool.discard(ic.conn)
+			expired = append(expired, ic.conn)
+			continue
+		}
+		pool.lock.Unlock()
+		return ic.conn, nil
+	}
+
+	if pool.maxConns <= 0 || pool.numOpen < pool.maxConns {
+		pool.numOpen++ // Increase it anyway and decrease it later if dialing fails
+		pool.lock.Unlock()
+		return pool.dial(ctx)
+	}
+
+	req := make(chan connRequest, 1)
+	elem := pool.waiters.PushBack(req)
+	pool.lock.Unlock()
+
+	select {
+	case r := <-req:
+		return pool.fulfill(ctx, r)
+	case <-ctx.Done():
+		pool.lock.Lock()
+		select {
+		case r := <-req: // Granted right before giving up, hand it over to others
+			if r.conn != nil {
+				pool.lock.Unlock()
+				pool.Put(r.conn, false)
+				return nil, ctx.Err()
+			}
+			if r.err == nil {
+				pool.release()
+			}
+		default:
+			pool.waiters.Remove(elem)
+		}
+		pool.lock.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Put returns a connection got from Get to the pool. If the max idle connections is reached, the connection is closed.
+//
+//	conn: connection to be returned
+//	forceClose: the connection will be closed anyway if true is passed, e.g. when an error occurred on it
+//
+// The connection is closed as well if the pool is closed, or it exceeds the max lifetime set by WithMaxLifetime.
+func (pool *Pool) Put(conn net.Conn, forceClose bool) {
+	pool.put(&idleConn{conn: conn, idleSince: pool.clock.Now()}, forceClose)
+}
+
+// Close closes the pool. It stops health checks, closes all idle connections, and wakes up goroutines waiting in Get,
+// which return ErrPoolClosed then. Connections in use are closed when they are put back. It's safe to call Close more than once.
+func (pool *Pool) Close() {
+	var conns []net.Conn
+	pool.lock.Lock()
+	if pool.closed {
+		pool.lock.Unlock()
+		return
+	}
+	pool.closed = true
+	for elem := pool.waiters.Front(); elem != nil; elem = elem.Next() {
+		elem.Value.(chan connRequest) <- connRequest{err: ErrPoolClosed}
+	}
+	pool.waiters.Init()
+	for elem := pool.idleList.Front(); elem != nil; elem = elem.Next() {
+		conn := elem.Value.(*idleConn).conn
+		pool.discard(conn)
+		conns = append(conns, conn)
+	}
+	pool.idleList.Init()
+	pool.lock.Unlock()
+
+	close(pool.quit)
+	closeAll(conns)
+}
+
+// Stats returns the statistics of the pool.
+func (pool *Pool) Stats() Stats {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	return Stats{
+		InUse:        pool.numOpen - pool.idleList.Len(),
+		Idle:         pool.idleList.Len(),
+		Waiters:      pool.waiters.Len(),
+		MaxConns:     pool.maxConns,
+		DialFailures: atomic.LoadUint64(&pool.dialFailures),
+	}
+}
+
+// Addr returns the address of the server.
+func (pool *Pool) Addr() string {
+	return pool.addr
+}
+
+const (
+	kDefaultDialTimeout         = 5 * time.Second
+	kDefaultHealthCheckInterval = 10 * time.Second
+	kPingReadTimeout            = time.Millisecond
+)
+
+type idleConn struct {
+	conn      net.Conn
+	idleSince time.Time // Last time the connection is put back by the user
+	checkedAt time.Time // Last time the connection is checked healthy
+}
+
+// connRequest is sent to a goroutine waiting in Get. If both conn and err are nil, the goroutine is permitted to dial
+type connRequest struct {
+	conn net.Conn
+	err  error
+}
+
+func (pool *Pool) fulfill(ctx context.Context, r connRequest) (net.Conn, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.conn != nil {
+		return r.conn, nil
+	}
+	return pool.dial(ctx)
+}
+
+// dial creates a new connection. pool.numOpen must have been increased for it
+func (pool *Pool) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, pool.opts.dialTimeout)
+	defer cancel()
+
+	conn, err := pool.opts.dialer(ctx, "tcp", pool.addr)
+	if err == nil && pool.opts.tlsConfig != nil {
+		conn, err = pool.handshake(ctx, conn)
+	}
+	if err != nil {
+		atomic.AddUint64(&pool.dialFailures, 1)
+		pool.lock.Lock()
+		pool.release()
+		pool.lock.Unlock()
+		return nil, err
+	}
+
+	pool.lock.Lock()
+	if pool.closed {
+		pool.release()
+		pool.lock.Unlock()
+		conn.Close()
+		return nil, ErrPoolClosed
+	}
+	pool.createTime[conn] = pool.clock.Now()
+	pool.lock.Unlock()
+	return conn, nil
+}
+
+func (pool *Pool) handshake(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	config := pool.opts.tlsConfig
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(pool.addr)
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (pool *Pool) put(ic *idleConn, forceClose bool) {
+	pool.lock.Lock()
+	if _, ok := pool.createTime[ic.conn]; !ok { // Not from this pool, or already discarded
+		pool.lock.Unlock()
+		ic.conn.Close()
+		return
+	}
+
+	if !forceClose && !pool.closed && !pool.exceedsLifetime(ic.conn, pool.clock.Now()) {
+		if elem := pool.waiters.Front(); elem != nil {
+			pool.waiters.Remove(elem).(chan connRequest) <- connRequest{conn: ic.conn}
+			pool.lock.Unlock()
+			return
+		}
+		if pool.idleList.Len() < pool.maxIdle {
+			pool.idleList.PushBack(ic)
+			pool.lock.Unlock()
+			return
+		}
+	}
+	pool.discard(ic.conn)
+	pool.lock.Unlock()
+
+	ic.conn.Close()
+}
+
+// discard forgets about `conn`. Must be called with the lock held
+func (pool *Pool) discard(conn net.Conn) {
+	delete(pool.createTime, conn)
+	pool.release()
+}
+
+// release decreases the number of opened connections, and permits a waiting goroutine to dial if any. Must be called with the lock held
+func (pool *Pool) release() {
+	pool.numOpen--
+	if elem := pool.waiters.Front(); elem != nil && !pool.closed {
+		pool.numOpen++
+		pool.waiters.Remove(elem).(chan connRequest) <- connRequest{}
+	}
+}
+
+// expired returns true if `ic` has been idle for too long or exceeds the max lifetime. Must be called with the lock held
+func (pool *Pool) expired(ic *idleConn, now time.Time) bool {
+	return (pool.opts.idleTimeout > 0 && now.Sub(ic.idleSince) >= pool.opts.idleTimeout) || pool.exceedsLifetime(ic.conn, now)
+}
+
+// exceedsLifetime returns true if `conn` has been created for longer than the max lifetime. Must be called with the lock held
+func (pool *Pool) exceedsLifetime(conn net.Conn, now time.Time) bool {
+	return pool.opts.maxLifetime > 0 && now.Sub(pool.createTime[conn]) >= pool.opts.maxLifetime
+}
+
+// healthCheck closes expired idle connections, and pings idle connections which haven't been checked for an interval
+func (pool *Pool) healthCheck() {
+	tick := pool.opts.healthCheckInterval / 2
+	if tick <= 0 {
+		tick = 1 // time.NewTicker panics on a non-positive period
+	}
+	ticker := pool.clock.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		var tNow time.Time
+		select {
+		case tNow = <-ticker.C():
+		case <-pool.quit:
+			return
+		}
+
+		var expired []net.Conn
+		pool.lock.Lock()
+		for nextElem := pool.idleList.Front(); nextElem != nil; {
+			ic := nextElem.Value.(*idleConn)
+			curElem := nextElem
+			nextElem = nextElem.Next()
+
+			if pool.expired(ic, tNow) {
+				pool.idleList.Remove(curElem)
+				pool.discard(ic.conn)
+				expired = append(expired, ic.conn)
+				continue
+			}
+			if tNow.Sub(ic.checkedAt) < pool.opts.healthCheckInterval || tNow.Sub(ic.idleSince) < pool.opts.healthCheckInterval {
+				continue
+			}
+
+			pool.idleList.Remove(curElem)
+			go func(ic *idleConn) {
+				err := pool.opts.ping(ic.conn)
+				ic.checkedAt = pool.clock.Now()
+				pool.put(ic, err != nil)
+			}(ic)
+		}
+		pool.lock.Unlock()
+
+		closeAll(expired)
+	}
+}
+
+// checkAlive is the default PingFunc. It reads `conn` with a tiny timeout, and treats EOF or unexpected data as unhealthy.
+// A deadline in the past doesn't work, because Read fails with timeout before checking the socket then
+func checkAlive(conn net.Conn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(kPingReadTimeout)); err != nil {
+		return err
+	}
+
+	var b [1]byte
+	n, err := conn.Read(b[:])
+	if n > 0 {
+		return errUnexpectedData
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return conn.SetReadDeadline(time.Time{})
+	}
+	if err == nil {
+		return errUnexpectedData
+	}
+	return err
+}
+
+func closeAll(conns []net.Conn) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ *
+ * tcppool - TCP client connection pool.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tcppool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+// echoServer accepts connections and echoes whatever it reads
+type echoServer struct {
+	ln     net.Listener
+	active int32
+	conns  chan net.Conn // Server side of the accepted connections
+}
+
+func newEchoServer(t *testing.T) *echoServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &echoServer{ln: ln, conns: make(chan net.Conn, 100)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&srv.active, 1)
+			srv.conns <- conn
+			go func() {
+				defer atomic.AddInt32(&srv.active, -1)
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					conn.Write(buf[:n])
+				}
+			}()
+		}
+	}()
+	return srv
+}
+
+func (srv *echoServer) waitActive(t *testing.T, n int32, advance func()) {
+	for i := 0; i < 200; i++ {
+		if atomic.LoadInt32(&srv.active) == n {
+			return
+		}
+		if advance != nil {
+			advance()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Active connections should be %d, but is %d", n, atomic.LoadInt32(&srv.active))
+}
+
+func TestGetPut(t *testing.T) {
+	srv := newEchoServer(t)
+	defer srv.ln.Close()
+	pool := New(srv.ln.Addr().String(), 1, 2)
+	defer pool.Close()
+
+	conn1, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn1.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err = conn1.Read(buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("Read() = %q, %v", buf, err)
+	}
+	conn2, _ := pool.Get(context.Background())
+
+	// Max connections reached
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = pool.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Get() = %v, expecting %v", err, context.DeadlineExceeded)
+	}
+
+	// Waiters get connections put back
+	done := make(chan net.Conn)
+	go func() {
+		conn, _ := pool.Get(context.Background())
+		done <- conn
+	}()
+	for pool.Stats().Waiters != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	pool.Put(conn1, false)
+	if conn := <-done; conn != conn1 {
+		t.Error("Waiter should get the connection put back")
+	}
+
+	// Broken connections are closed, and waiters may dial instead
+	go func() {
+		conn, _ := pool.Get(context.Background())
+		done <- conn
+	}()
+	for pool.Stats().Waiters != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	pool.Put(conn2, true)
+	if conn := <-done; conn == nil || conn == conn2 {
+		t.Error("Waiter should dial a new connection")
+	}
+	pool.Put(conn1, false)
+	if s := pool.Stats(); s.InUse != 1 || s.Idle != 1 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+	if conn, _ := pool.Get(context.Background()); conn != conn1 {
+		t.Error("Idle connection should be reused")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	srv := newEchoServer(t)
+	defer srv.ln.Close()
+	fc := clock.NewFake(time.Now())
+	pool := New(srv.ln.Addr().String(), 10, 10, WithHealthCheckInterval(10*time.Second), WithIdleTimeout(time.Minute),
+		WithMaxLifetime(time.Hour), WithClock(fc))
+	defer pool.Close()
+
+	conn1, _ := pool.Get(context.Background())
+	conn2, _ := pool.Get(context.Background())
+	pool.Put(conn1, false)
+	pool.Put(conn2, false)
+	srv.waitActive(t, 2, nil)
+
+	// Connections closed by the server are detected by the default ping
+	(<-srv.conns).Close()
+	fc.BlockUntil(1)
+	srv.waitActive(t, 1, nil)
+	for i := 0; ; i++ {
+		if s := pool.Stats(); s.Idle == 1 && s.InUse == 0 {
+			break
+		} else if i == 10 {
+			t.Fatalf("Unexpected stats: %+v", s)
+		}
+		fc.Advance(5 * time.Second)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Idle connections are closed after the idle timeout
+	srv.waitActive(t, 0, func() { fc.Advance(5 * time.Second) })
+
+	// Connections exceeding the max lifetime are closed when put back
+	conn1, _ = pool.Get(context.Background())
+	srv.waitActive(t, 1, nil)
+	fc.Advance(time.Hour)
+	pool.Put(conn1, false)
+	srv.waitActive(t, 0, nil)
+}
+
+func TestTinyHealthCheckInterval(t *testing.T) {
+	srv := newEchoServer(t)
+	defer srv.ln.Close()
+	// Halving a 1ns interval gives a zero tick, which must not crash the health check goroutine
+	pool := New(srv.ln.Addr().String(), 1, 1, WithHealthCheckInterval(1))
+	defer pool.Close()
+
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(conn, false)
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestPing(t *testing.T) {
+	srv := newEchoServer(t)
+	defer srv.ln.Close()
+	fc := clock.NewFake(time.Now())
+	var pings int32
+	pool := New(srv.ln.Addr().String(), 10, 10, WithClock(fc), WithPing(func(conn net.Conn) error {
+		if atomic.AddInt32(&pings, 1) > 1 {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}))
+	defer pool.Close()
+
+	conn, _ := pool.Get(context.Background())
+	pool.Put(conn, false)
+	fc.BlockUntil(1)
+	srv.waitActive(t, 0, func() { fc.Advance(5 * time.Second) })
+	if atomic.LoadInt32(&pings) != 2 {
+		t.Errorf("Ping should be called twice, but is called %d times", atomic.LoadInt32(&pings))
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv := newEchoServer(t)
+	defer srv.ln.Close()
+	pool := New(srv.ln.Addr().String(), 10, 1)
+
+	conn, _ := pool.Get(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := pool.Get(context.Background())
+		done <- err
+	}()
+	for pool.Stats().Waiters != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	pool.Close()
+	pool.Close()
+	if err := <-done; err != ErrPoolClosed {
+		t.Errorf("Get() = %v, expecting %v", err, ErrPoolClosed)
+	}
+	if _, err := pool.Get(context.Background()); err != ErrPoolClosed {
+		t.Errorf("Get() = %v, expecting %v", err, ErrPoolClosed)
+	}
+
+	pool.Put(conn, false)
+	srv.waitActive(t, 0, nil)
+	if s := pool.Stats(); s.InUse != 0 || s.Idle != 0 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
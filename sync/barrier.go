@@ -0,0 +1,100 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2019 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"context"
+	"sync"
+)
+
+// Barrier is a reusable cyclic barrier. It lets a fixed number of goroutines wait for each other
+// at a common point, and resets itself automatically after all of them arrive, so that it could be
+// used again for the next phase of the computation.
+// Basic example:
+//
+//	barrier := sync.NewBarrier(3)
+//	// In each of the 3 goroutines
+//	for phase := 0; phase < N; phase++ {
+//		doPhase(phase)
+//		// Blocks until all the 3 goroutines finish the current phase
+//		if err := barrier.Await(ctx); err != nil {
+//			return err
+//		}
+//	}
+type Barrier struct {
+	lock    sync.Mutex
+	parties int
+	arrived int
+	ready   chan struct{} // closed when all parties of the current generation arrive
+}
+
+// NewBarrier creates a ready-to-use Barrier.
+//
+//	parties: Number of goroutines that must call Await before they are released. Must be greater than 0.
+func NewBarrier(parties int) *Barrier {
+	if parties <= 0 {
+		panic("sync: parties of Barrier must be greater than 0")
+	}
+	return &Barrier{parties: parties, ready: make(chan struct{})}
+}
+
+// Await blocks until all parties have called Await on this Barrier, then releases all of them and resets the Barrier.
+// If `ctx` is done before that, the caller withdraws its arrival and ctx.Err() is returned.
+func (b *Barrier) Await(ctx context.Context) error {
+	b.lock.Lock()
+	b.arrived++
+	ready := b.ready
+	if b.arrived == b.parties {
+		b.arrived = 0
+		b.ready = make(chan struct{})
+		b.lock.Unlock()
+		close(ready)
+		return nil
+	}
+	b.lock.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		select {
+		case <-ready: // all parties arrived while we were waiting for the lock
+			return nil
+		default:
+			b.arrived--
+			return ctx.Err()
+		}
+	}
+}
+
+// Parties returns the number of goroutines required to trip the Barrier.
+func (b *Barrier) Parties() int {
+	return b.parties
+}
+
+// Waiting returns the number of goroutines currently waiting at the Barrier.
+func (b *Barrier) Waiting() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.arrived
+}
@@ -0,0 +1,117 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2019 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitArrived blocks until `n` goroutines are waiting at `b`
+func waitArrived(t *testing.T, b *Barrier, n int) {
+	for i := 0; i < 1000; i++ {
+		if b.Waiting() == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Barrier should have %d waiters, got %d", n, b.Waiting())
+}
+
+// await calls b.Await in a new goroutine and reports its result to the returned channel
+func await(ctx context.Context, b *Barrier) chan error {
+	result := make(chan error, 1)
+	go func() { result <- b.Await(ctx) }()
+	return result
+}
+
+func TestBarrierCancel(t *testing.T) {
+	b := NewBarrier(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := await(context.Background(), b)
+	waitArrived(t, b, 1)
+	cancelled := await(ctx, b)
+	waitArrived(t, b, 2)
+
+	// The cancelled party withdraws its arrival, and the others keep waiting
+	cancel()
+	if err := <-cancelled; err != context.Canceled {
+		t.Fatalf("Await() = %v, expected context.Canceled", err)
+	}
+	waitArrived(t, b, 1)
+	select {
+	case err := <-first:
+		t.Fatalf("Await() = %v before all parties arrived", err)
+	default:
+	}
+
+	// The current cycle still needs 2 more parties
+	second := await(context.Background(), b)
+	waitArrived(t, b, 2)
+	if err := b.Await(context.Background()); err != nil {
+		t.Fatalf("Await() = %v, expected nil", err)
+	}
+	for _, ch := range []chan error{first, second} {
+		if err := <-ch; err != nil {
+			t.Fatalf("Await() = %v, expected nil", err)
+		}
+	}
+	if n := b.Waiting(); n != 0 {
+		t.Errorf("Waiting() = %d after the barrier tripped", n)
+	}
+}
+
+func TestBarrierReuse(t *testing.T) {
+	b := NewBarrier(2)
+
+	// All parties of a cycle time out
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Await(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Await() = %v, expected context.DeadlineExceeded", err)
+	}
+	if n := b.Waiting(); n != 0 {
+		t.Fatalf("Waiting() = %d after the only party timed out", n)
+	}
+
+	// The barrier is usable for the following cycles
+	for cycle := 0; cycle < 3; cycle++ {
+		other := await(context.Background(), b)
+		waitArrived(t, b, 1)
+		if err := b.Await(context.Background()); err != nil {
+			t.Fatalf("cycle %d: Await() = %v, expected nil", cycle, err)
+		}
+		if err := <-other; err != nil {
+			t.Fatalf("cycle %d: Await() = %v, expected nil", cycle, err)
+		}
+	}
+
+	// A caller with an already cancelled context isn't left counted as arrived
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := b.Await(ctx); err != context.Canceled {
+		t.Fatalf("Await() = %v, expected context.Canceled", err)
+	}
+	if n := b.Waiting(); n != 0 {
+		t.Errorf("Waiting() = %d after a cancelled Await()", n)
+	}
+}
@@ -21,8 +21,12 @@
 package sync_test
 
 import (
-	"github.com/antigloss/go/sync"
+	"context"
+	"fmt"
+	gosync "sync"
 	"time"
+
+	"github.com/antigloss/go/sync"
 )
 
 // This example shows the basic usage of Semaphore.
@@ -46,3 +50,82 @@ func ExampleNewSemaphore() {
 		semaResource.Release()
 	}
 }
+
+// This example shows the basic usage of RWLock.
+func ExampleNewRWLock() {
+	// Create a ready-to-use RWLock which grants waiting goroutines in FIFO order
+	l := sync.NewRWLock(true)
+	// Acquire the shared lock, any number of goroutines can hold it at the same time
+	l.RLock()
+	// The exclusive lock cannot be acquired while the shared lock is held
+	fmt.Println(l.TryLock())
+	l.RUnlock()
+	// Wait at most 1 second to acquire the exclusive lock
+	if l.TimedLock(time.Second) {
+		fmt.Println(l.TryRLock())
+		l.Unlock()
+	}
+	// Output:
+	// false
+	// false
+}
+
+// This example shows the basic usage of Barrier.
+func ExampleNewBarrier() {
+	const kWorkers = 3
+	barrier := sync.NewBarrier(kWorkers)
+	results := make([]int, kWorkers)
+
+	var wg gosync.WaitGroup
+	for i := 0; i < kWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for phase := 1; phase <= 2; phase++ {
+				results[i] += phase
+				// Block until all workers finish the current phase
+				if err := barrier.Await(context.Background()); err != nil {
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	fmt.Println(results)
+	// Output: [3 3 3]
+}
+
+// This example shows the basic usage of Singleflight.
+func ExampleSingleflight() {
+	var group sync.Singleflight[string, string]
+	var wg gosync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Concurrent calls with the same key share the result of a single execution
+			// `shared` tells whether the result is given to multiple callers
+			value, err, _ := group.Do("key", func() (string, error) {
+				return "value", nil // Load the value from database, for example
+			})
+			fmt.Println(value, err)
+		}()
+	}
+	wg.Wait()
+	// Output:
+	// value <nil>
+	// value <nil>
+	// value <nil>
+}
+
+// This example shows the basic usage of OncePerKey.
+func ExampleOncePerKey() {
+	var once sync.OncePerKey[string]
+	for _, key := range []string{"a", "b", "a"} {
+		once.Do(key, func() { fmt.Println("initializing", key) })
+	}
+	// Output:
+	// initializing a
+	// initializing b
+}
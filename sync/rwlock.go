@@ -0,0 +1,193 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2019 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// RWLock is a shared/exclusive lock like sync.RWMutex, which supports try and timed acquisition as well.
+// Any number of goroutines can hold the shared lock at the same time, while the exclusive lock is held by only one goroutine
+// and excludes all the shared holders.
+//
+// In FIFO mode, waiting goroutines are granted strictly in the order they arrive (consecutive shared waiters are granted together),
+// so no goroutine would be starved under heavy contention. Otherwise, shared acquisitions succeed immediately as long as
+// the exclusive lock is not held, which gives better throughput for read-mostly workloads but might starve exclusive waiters.
+// Basic example:
+//
+//	l := sync.NewRWLock(true)
+//	l.RLock()   // shared
+//	l.RUnlock()
+//	if l.TimedLock(time.Second) { // exclusive, wait at most 1 second
+//		l.Unlock()
+//	}
+type RWLock struct {
+	lock    sync.Mutex
+	readers int  // Number of shared holders
+	writer  bool // Whether the exclusive lock is held
+	fifo    bool
+	waiters list.List // *rwWaiter
+}
+
+type rwWaiter struct {
+	exclusive bool
+	ready     chan struct{} // Closed when the lock is granted
+}
+
+// NewRWLock creates a ready-to-use RWLock.
+//
+//	fifo: true for granting waiting goroutines in FIFO order, false for preferring shared acquisitions.
+func NewRWLock(fifo bool) *RWLock {
+	return &RWLock{fifo: fifo}
+}
+
+// Lock acquires the exclusive lock, blocks until it's available.
+func (l *RWLock) Lock() {
+	l.acquire(true, -1)
+}
+
+// TryLock tries to acquire the exclusive lock. It returns false if the lock cannot be acquired immediately.
+func (l *RWLock) TryLock() bool {
+	return l.acquire(true, 0)
+}
+
+// TimedLock waits at most `duration` to acquire the exclusive lock. It returns false if the lock cannot be acquired after the timeout.
+func (l *RWLock) TimedLock(duration time.Duration) bool {
+	return l.acquire(true, duration)
+}
+
+// Unlock releases the exclusive lock. It panics if the exclusive lock is not held.
+func (l *RWLock) Unlock() {
+	l.lock.Lock()
+	if !l.writer {
+		l.lock.Unlock()
+		panic("sync: Unlock of unlocked RWLock")
+	}
+	l.writer = false
+	l.wake()
+	l.lock.Unlock()
+}
+
+// RLock acquires the shared lock, blocks until it's available.
+func (l *RWLock) RLock() {
+	l.acquire(false, -1)
+}
+
+// TryRLock tries to acquire the shared lock. It returns false if the lock cannot be acquired immediately.
+func (l *RWLock) TryRLock() bool {
+	return l.acquire(false, 0)
+}
+
+// TimedRLock waits at most `duration` to acquire the shared lock. It returns false if the lock cannot be acquired after the timeout.
+func (l *RWLock) TimedRLock(duration time.Duration) bool {
+	return l.acquire(false, duration)
+}
+
+// RUnlock releases the shared lock. It panics if the shared lock is not held.
+func (l *RWLock) RUnlock() {
+	l.lock.Lock()
+	if l.readers <= 0 {
+		l.lock.Unlock()
+		panic("sync: RUnlock of unlocked RWLock")
+	}
+	l.readers--
+	l.wake()
+	l.lock.Unlock()
+}
+
+// acquire acquires the lock. It waits forever if `timeout` < 0.
+func (l *RWLock) acquire(exclusive bool, timeout time.Duration) bool {
+	l.lock.Lock()
+	if l.grantable(exclusive) {
+		l.grant(exclusive)
+		l.lock.Unlock()
+		return true
+	}
+	if timeout == 0 {
+		l.lock.Unlock()
+		return false
+	}
+
+	w := &rwWaiter{exclusive: exclusive, ready: make(chan struct{})}
+	elem := l.waiters.PushBack(w)
+	l.lock.Unlock()
+
+	if timeout < 0 {
+		<-w.ready
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	select {
+	case <-timer.C:
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		select {
+		case <-w.ready:
+			return true
+		default:
+			l.waiters.Remove(elem)
+			l.wake() // Waiters behind might be grantable now
+			return false
+		}
+	case <-w.ready:
+		timer.Stop()
+		return true
+	}
+}
+
+// grantable checks if the lock can be granted immediately to a newcomer
+func (l *RWLock) grantable(exclusive bool) bool {
+	if exclusive {
+		return !l.writer && l.readers == 0 && l.waiters.Len() == 0
+	}
+	return !l.writer && (!l.fifo || l.waiters.Len() == 0)
+}
+
+func (l *RWLock) grant(exclusive bool) {
+	if exclusive {
+		l.writer = true
+	} else {
+		l.readers++
+	}
+}
+
+// wake grants the lock to the waiters as many as possible
+func (l *RWLock) wake() {
+	for e := l.waiters.Front(); e != nil && !l.writer; {
+		w := e.Value.(*rwWaiter)
+		if w.exclusive && l.readers > 0 {
+			if l.fifo {
+				return
+			}
+			e = e.Next() // Shared waiters behind are preferred
+			continue
+		}
+
+		next := e.Next()
+		l.waiters.Remove(e)
+		l.grant(w.exclusive)
+		close(w.ready)
+		e = next
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2019 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	gosync "sync"
+	"testing"
+	"time"
+)
+
+// waitRWWaiters blocks until `n` goroutines are queued on `l`
+func waitRWWaiters(t *testing.T, l *RWLock, n int) {
+	for i := 0; i < 1000; i++ {
+		l.lock.Lock()
+		w := l.waiters.Len()
+		l.lock.Unlock()
+		if w == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("RWLock should have %d waiters", n)
+}
+
+func TestRWLockWriterPreference(t *testing.T) {
+	for _, fifo := range []bool{true, false} {
+		l := NewRWLock(fifo)
+		l.RLock()
+
+		locked := make(chan bool)
+		go func() {
+			l.Lock()
+			locked <- true
+		}()
+		waitRWWaiters(t, l, 1)
+
+		// A waiting writer keeps newcomers from sharing the lock only in FIFO mode
+		if ok := l.TryRLock(); ok == fifo {
+			t.Errorf("fifo=%v: TryRLock() = %v while a writer is waiting", fifo, ok)
+		}
+		if !fifo {
+			l.RUnlock()
+		}
+		l.RUnlock()
+		<-locked
+
+		if l.TryRLock() || l.TryLock() {
+			t.Errorf("fifo=%v: Try*() should fail while the exclusive lock is held", fifo)
+		}
+		l.Unlock()
+		if !l.TryLock() {
+			t.Errorf("fifo=%v: TryLock() should succeed after the lock is released", fifo)
+		}
+	}
+}
+
+func TestRWLockFIFO(t *testing.T) {
+	l := NewRWLock(true)
+	l.Lock()
+
+	// Queue: W0, R1, R2, W3, R4
+	exclusive := []bool{true, false, false, true, false}
+	order := make(chan int, len(exclusive))
+	proceed := make([]chan bool, len(exclusive))
+	for i, x := range exclusive {
+		proceed[i] = make(chan bool)
+		go func(i int, x bool) {
+			if x {
+				l.Lock()
+				order <- i
+				<-proceed[i]
+				l.Unlock()
+			} else {
+				l.RLock()
+				order <- i
+				<-proceed[i]
+				l.RUnlock()
+			}
+		}(i, x)
+		// Enqueue the waiters one by one so that their arrival order is known
+		waitRWWaiters(t, l, i+1)
+	}
+
+	expect := func(ids ...int) {
+		t.Helper()
+		got := map[int]bool{}
+		for range ids {
+			got[<-order] = true
+		}
+		for _, id := range ids {
+			if !got[id] {
+				t.Fatalf("Waiter %d should be granted, got %v", id, got)
+			}
+		}
+		select {
+		case id := <-order:
+			t.Fatalf("Waiter %d is granted out of order", id)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	l.Unlock()
+	expect(0)
+	proceed[0] <- true
+	// Consecutive shared waiters are granted together
+	expect(1, 2)
+	proceed[1] <- true
+	proceed[2] <- true
+	expect(3)
+	proceed[3] <- true
+	expect(4)
+	proceed[4] <- true
+
+	if !l.TimedLock(time.Second) {
+		t.Error("TimedLock() should succeed after all waiters released the lock")
+	}
+}
+
+func TestRWLockTimeout(t *testing.T) {
+	l := NewRWLock(true)
+	l.RLock()
+
+	// A timed out writer is removed from the queue, and the readers queued behind it are granted
+	rlocked := make(chan bool)
+	go func() {
+		if l.TimedLock(20 * time.Millisecond) {
+			t.Error("TimedLock() should time out while the shared lock is held")
+			l.Unlock()
+		}
+	}()
+	waitRWWaiters(t, l, 1)
+	go func() {
+		l.RLock()
+		rlocked <- true
+	}()
+	select {
+	case <-rlocked:
+	case <-time.After(time.Second):
+		t.Fatal("RLock() should succeed after the waiting writer timed out")
+	}
+	l.RUnlock()
+	l.RUnlock()
+
+	l.Lock()
+	if l.TimedRLock(10*time.Millisecond) || l.TimedLock(10*time.Millisecond) {
+		t.Error("Timed*() should time out while the exclusive lock is held")
+	}
+	l.Unlock()
+	// The lock is left usable after the timeouts
+	if !l.TimedRLock(time.Second) {
+		t.Fatal("TimedRLock() should succeed after the lock is released")
+	}
+	l.RUnlock()
+	if !l.TryLock() {
+		t.Fatal("TryLock() should succeed after the lock is released")
+	}
+	l.Unlock()
+	if l.waiters.Len() != 0 || l.readers != 0 || l.writer {
+		t.Errorf("RWLock is left dirty: waiters=%d readers=%d writer=%v", l.waiters.Len(), l.readers, l.writer)
+	}
+}
+
+func TestRWLockTryConcurrent(t *testing.T) {
+	const kGoroutines = 8
+	const kLoops = 1000
+	for _, fifo := range []bool{true, false} {
+		l := NewRWLock(fifo)
+		var counter, readers, writers int32
+		var mu gosync.Mutex // Only guards the state checks, never blocks the RWLock
+		check := func() {
+			mu.Lock()
+			if writers > 1 || (writers == 1 && readers > 0) {
+				t.Errorf("fifo=%v: %d writers and %d readers hold the lock at the same time", fifo, writers, readers)
+			}
+			mu.Unlock()
+		}
+		update := func(r, w int32) {
+			mu.Lock()
+			readers += r
+			writers += w
+			mu.Unlock()
+		}
+
+		var wg gosync.WaitGroup
+		for i := 0; i < kGoroutines; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < kLoops; j++ {
+					switch (i + j) % 4 {
+					case 0:
+						if l.TryLock() {
+							update(0, 1)
+							check()
+							counter++ // Guarded by the exclusive lock, reported by -race otherwise
+							update(0, -1)
+							l.Unlock()
+						}
+					case 1:
+						if l.TimedLock(time.Millisecond) {
+							update(0, 1)
+							check()
+							counter++
+							update(0, -1)
+							l.Unlock()
+						}
+					case 2:
+						if l.TryRLock() {
+							update(1, 0)
+							check()
+							_ = counter
+							update(-1, 0)
+							l.RUnlock()
+						}
+					default:
+						if l.TimedRLock(time.Millisecond) {
+							update(1, 0)
+							check()
+							_ = counter
+							update(-1, 0)
+							l.RUnlock()
+						}
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if l.waiters.Len() != 0 || l.readers != 0 || l.writer {
+			t.Errorf("fifo=%v: RWLock is left dirty: waiters=%d readers=%d writer=%v", fifo, l.waiters.Len(), l.readers, l.writer)
+		}
+	}
+}
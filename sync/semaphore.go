@@ -18,7 +18,7 @@
  *
  */
 
-// Package sync provides extra synchronization facilities such as semaphore in addition to the standard sync package.
+// Package sync provides extra synchronization facilities such as semaphore, shared/exclusive lock and singleflight in addition to the standard sync package.
 package sync
 
 import (
@@ -44,6 +44,8 @@ func (sr *SemaphoreResource) Release() {
 }
 
 // Semaphore is a mimic of the POSIX semaphore based on channel and sync.Mutex. It could be used to limit the number of concurrent running goroutines.
+// Semaphore is FIFO-fair: released resources are handed over to the longest waiting goroutine directly, and newcomers never
+// barge in while there are goroutines waiting, so heavy contention can't starve long-waiting goroutines.
 // Basic example:
 //
 //	// Creates a ready-to-use semaphore
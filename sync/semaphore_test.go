@@ -0,0 +1,81 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2019 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+// waitWaiters blocks until `n` goroutines are queued on `s`
+func waitWaiters(t *testing.T, s *Semaphore, n int) {
+	for i := 0; i < 1000; i++ {
+		s.lock.Lock()
+		l := s.waiters.Len()
+		s.lock.Unlock()
+		if l == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Semaphore should have %d waiters", n)
+}
+
+func TestSemaphoreFIFO(t *testing.T) {
+	const kWaiters = 10
+	sema := NewSemaphore(1)
+	sr := sema.Acquire()
+
+	order := make(chan int)
+	proceed := make(chan bool)
+	for i := 0; i < kWaiters; i++ {
+		go func(i int) {
+			var r *SemaphoreResource
+			if i%2 == 0 {
+				r = sema.Acquire()
+			} else {
+				r = sema.TimedAcquire(time.Minute)
+			}
+			order <- i
+			<-proceed
+			r.Release()
+		}(i)
+		// Enqueue the waiters one by one so that their arrival order is known
+		waitWaiters(t, sema, i+1)
+	}
+
+	// The released resource is handed over to the first waiter, so newcomers can't barge in
+	sr.Release()
+	if r := sema.TryAcquire(); r != nil {
+		t.Error("TryAcquire() should fail while there are goroutines waiting")
+		r.Release()
+	}
+
+	for i := 0; i < kWaiters; i++ {
+		if n := <-order; n != i {
+			t.Fatalf("Waiter %d acquired the semaphore before waiter %d", n, i)
+		}
+		proceed <- true
+	}
+	if r := sema.TimedAcquire(time.Second); r == nil {
+		t.Error("TimedAcquire() should succeed after all waiters released the semaphore")
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2019 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrSingleflightPanicked is returned by Singleflight.Do to the callers sharing a call whose function panicked.
+// The caller executing the function gets the panic re-raised.
+var ErrSingleflightPanicked = errors.New("sync: singleflight function panicked")
+
+// OncePerKey performs an action exactly once for each key. The zero value is ready to use.
+// Basic example:
+//
+//	var once sync.OncePerKey[string]
+//	once.Do("tenant1", func() { initTenant("tenant1") }) // initTenant is called only once for tenant1
+type OncePerKey[K comparable] struct {
+	lock sync.Mutex
+	once map[K]*sync.Once
+}
+
+// Do calls `f` if and only if Do is being called for the first time with `key`.
+// Like sync.Once, no call to Do with the same key returns until the one call to `f` returns.
+func (o *OncePerKey[K]) Do(key K, f func()) {
+	o.lock.Lock()
+	once := o.once[key]
+	if once == nil {
+		if o.once == nil {
+			o.once = make(map[K]*sync.Once)
+		}
+		once = new(sync.Once)
+		o.once[key] = once
+	}
+	o.lock.Unlock()
+
+	once.Do(f)
+}
+
+// Forget makes the next call to Do with `key` call its function again.
+func (o *OncePerKey[K]) Forget(key K) {
+	o.lock.Lock()
+	delete(o.once, key)
+	o.lock.Unlock()
+}
+
+// Singleflight deduplicates concurrent calls with the same key: only one of them is executed,
+// and the others wait for it and share its result. It's useful to prevent cache stampedes. The zero value is ready to use.
+// Basic example:
+//
+//	var group sync.Singleflight[string, *User]
+//	user, err, shared := group.Do(uid, func() (*User, error) {
+//		if user, ok := cache.Get(uid); ok {
+//			return user.(*User), nil
+//		}
+//		user, err := loadUserFromDB(uid) // only one goroutine loads a missing user at a time
+//		if err == nil {
+//			cache.Add(uid, user, 1)
+//		}
+//		return user, err
+//	})
+type Singleflight[K comparable, V any] struct {
+	lock  sync.Mutex
+	calls map[K]*flightCall[V]
+}
+
+type flightCall[V any] struct {
+	done  chan struct{} // Closed when the call completes
+	value V
+	err   error
+	dups  int // Number of callers sharing the result
+}
+
+// Do executes `fn` and returns its results, making sure that only one execution is in-flight for `key` at a time.
+// If a duplicate call comes in, the duplicate caller waits for the original one to complete and receives the same results.
+// `shared` tells whether the results are given to multiple callers.
+func (g *Singleflight[K, V]) Do(key K, fn func() (V, error)) (value V, err error, shared bool) {
+	g.lock.Lock()
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.lock.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+
+	c := &flightCall[V]{done: make(chan struct{})}
+	if g.calls == nil {
+		g.calls = make(map[K]*flightCall[V])
+	}
+	g.calls[key] = c
+	g.lock.Unlock()
+
+	c.err = ErrSingleflightPanicked // Kept if `fn` panics
+	defer func() {
+		g.lock.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		shared = c.dups > 0
+		g.lock.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn()
+	return c.value, c.err, false
+}
+
+// Forget makes the next call to Do with `key` execute its function rather than waiting for an in-flight call.
+func (g *Singleflight[K, V]) Forget(key K) {
+	g.lock.Lock()
+	delete(g.calls, key)
+	g.lock.Unlock()
+}
@@ -0,0 +1,198 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2019 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sync
+
+import (
+	"errors"
+	gosync "sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitDups blocks until `n` duplicate callers are waiting for the in-flight call of `key`
+func waitDups[K comparable, V any](t *testing.T, g *Singleflight[K, V], key K, n int) {
+	for i := 0; i < 1000; i++ {
+		g.lock.Lock()
+		dups := -1
+		if c := g.calls[key]; c != nil {
+			dups = c.dups
+		}
+		g.lock.Unlock()
+		if dups == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Singleflight should have %d duplicate callers", n)
+}
+
+type flightResult struct {
+	value  int
+	err    error
+	shared bool
+}
+
+// startDups starts `n` callers sharing the in-flight call of `key`
+func startDups(t *testing.T, g *Singleflight[string, int], key string, n int) chan flightResult {
+	results := make(chan flightResult, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			value, err, shared := g.Do(key, func() (int, error) {
+				t.Error("Duplicate callers shouldn't execute their functions")
+				return 0, nil
+			})
+			results <- flightResult{value, err, shared}
+		}()
+	}
+	waitDups(t, g, key, n)
+	return results
+}
+
+func TestSingleflight(t *testing.T) {
+	errLoad := errors.New("load failed")
+	tests := []struct {
+		value int
+		err   error
+	}{
+		{1, nil},
+		{2, errLoad},
+	}
+
+	const kDups = 5
+	for _, tt := range tests {
+		var g Singleflight[string, int]
+		var calls int32
+		proceed := make(chan bool)
+		leader := make(chan flightResult)
+		go func() {
+			value, err, shared := g.Do("key", func() (int, error) {
+				atomic.AddInt32(&calls, 1)
+				<-proceed
+				return tt.value, tt.err
+			})
+			leader <- flightResult{value, err, shared}
+		}()
+		waitDups(t, &g, "key", 0)
+		results := startDups(t, &g, "key", kDups)
+		close(proceed)
+
+		// Both the value and the error are shared with all the callers
+		want := flightResult{tt.value, tt.err, true}
+		if r := <-leader; r != want {
+			t.Errorf("Leader got %+v, expected %+v", r, want)
+		}
+		for i := 0; i < kDups; i++ {
+			if r := <-results; r != want {
+				t.Errorf("Duplicate caller got %+v, expected %+v", r, want)
+			}
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("Function is executed %d times, expected once", n)
+		}
+
+		// The call is removed once completed
+		value, err, shared := g.Do("key", func() (int, error) { return 3, nil })
+		if value != 3 || err != nil || shared {
+			t.Errorf("Do() = %v, %v, %v after the call completed", value, err, shared)
+		}
+	}
+}
+
+func TestSingleflightPanic(t *testing.T) {
+	var g Singleflight[string, int]
+	proceed := make(chan bool)
+	recovered := make(chan interface{})
+	go func() {
+		defer func() { recovered <- recover() }()
+		g.Do("key", func() (int, error) {
+			<-proceed
+			panic("boom")
+		})
+	}()
+	waitDups(t, &g, "key", 0)
+
+	const kDups = 5
+	results := startDups(t, &g, "key", kDups)
+	close(proceed)
+
+	// The panic is re-raised in the leader, and reported to every waiter
+	if r := <-recovered; r != "boom" {
+		t.Errorf("Leader recovered %v, expected boom", r)
+	}
+	for i := 0; i < kDups; i++ {
+		if r := <-results; r.err != ErrSingleflightPanicked || !r.shared {
+			t.Errorf("Duplicate caller got %+v, expected ErrSingleflightPanicked", r)
+		}
+	}
+
+	value, err, _ := g.Do("key", func() (int, error) { return 1, nil })
+	if value != 1 || err != nil {
+		t.Errorf("Do() = %v, %v after the panicked call", value, err)
+	}
+}
+
+func TestSingleflightForget(t *testing.T) {
+	var g Singleflight[string, int]
+	proceed := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		g.Do("key", func() (int, error) {
+			<-proceed
+			return 1, nil
+		})
+		done <- true
+	}()
+	waitDups(t, &g, "key", 0)
+
+	// A forgotten in-flight call isn't shared any more
+	g.Forget("key")
+	value, _, shared := g.Do("key", func() (int, error) { return 2, nil })
+	if value != 2 || shared {
+		t.Errorf("Do() = %v, %v after Forget()", value, shared)
+	}
+	close(proceed)
+	<-done
+}
+
+func TestOncePerKey(t *testing.T) {
+	var once OncePerKey[string]
+	var calls [2]int32
+	var wg gosync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			once.Do([]string{"a", "b"}[i%2], func() { atomic.AddInt32(&calls[i%2], 1) })
+		}(i)
+	}
+	wg.Wait()
+	if calls != [2]int32{1, 1} {
+		t.Errorf("Functions are called %v times, expected once per key", calls)
+	}
+
+	once.Forget("a")
+	once.Do("a", func() { atomic.AddInt32(&calls[0], 1) })
+	once.Do("b", func() { atomic.AddInt32(&calls[1], 1) })
+	if calls != [2]int32{2, 1} {
+		t.Errorf("Functions are called %v times after Forget(a)", calls)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ *
+ * clock - Mockable time source.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package clock abstracts the time source, so that time-dependent behaviors can be unit-tested with a fake clock
+// instead of relying on sleeps.
+//
+// Components depending on time accept a Clock via options, and use Real by default. In tests, a Fake clock
+// is passed in and advanced manually:
+//
+//	fc := clock.NewFake(time.Date(2020, 12, 1, 23, 59, 59, 0, time.Local))
+//	lg, _ := logger.New(&logger.Config{..., Clock: fc})
+//	lg.Info("before midnight")
+//	fc.Advance(time.Second)
+//	lg.Info("after midnight") // written to a new log file
+package clock
+
+import "time"
+
+// Clock is a source of time.
+type Clock interface {
+	Now() time.Time                         // Returns the current time
+	After(d time.Duration) <-chan time.Time // Waits for `d` to elapse and then sends the current time on the returned channel
+	NewTimer(d time.Duration) Timer         // Creates a Timer that sends the current time on its channel after at least `d`
+	NewTicker(d time.Duration) Ticker       // Creates a Ticker that sends the current time on its channel every `d`
+}
+
+// Timer is the counterpart of time.Timer.
+type Timer interface {
+	C() <-chan time.Time        // Returns the channel on which the time is delivered
+	Stop() bool                 // Prevents the Timer from firing. It returns false if the timer has already expired or been stopped
+	Reset(d time.Duration) bool // Changes the timer to expire after `d`. It returns true if the timer had been active
+}
+
+// Ticker is the counterpart of time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time   // Returns the channel on which the ticks are delivered
+	Stop()                 // Turns off the Ticker
+	Reset(d time.Duration) // Stops the Ticker and resets its period to `d`
+}
+
+// Real is the Clock backed by the standard time package.
+var Real Clock = realClock{}
+
+// OrReal returns `c` if it's not nil, otherwise Real.
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
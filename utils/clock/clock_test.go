@@ -0,0 +1,86 @@
+/*
+ *
+ * clock - Mockable time source.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	fc := NewFake(start)
+
+	timer := fc.NewTimer(time.Second)
+	ticker := fc.NewTicker(400 * time.Millisecond)
+	after := fc.After(2 * time.Second)
+	if fc.Waiters() != 3 {
+		t.Fatalf("Waiters() = %d", fc.Waiters())
+	}
+
+	fc.Advance(400 * time.Millisecond)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(400 * time.Millisecond)) {
+		t.Errorf("Unexpected tick: %v", tick)
+	}
+	fc.Advance(599 * time.Millisecond) // Tick of 800ms
+	select {
+	case <-timer.C():
+		t.Fatal("Timer should not fire yet")
+	default:
+	}
+
+	fc.Advance(time.Millisecond)
+	if v := <-timer.C(); !v.Equal(start.Add(time.Second)) || timer.Stop() {
+		t.Errorf("Unexpected timer: %v", v)
+	}
+	if tick := <-ticker.C(); !tick.Equal(start.Add(800 * time.Millisecond)) {
+		t.Errorf("Unexpected tick: %v", tick)
+	}
+	if timer.Reset(time.Second) || fc.Waiters() != 3 {
+		t.Errorf("Waiters() = %d", fc.Waiters())
+	}
+
+	ticker.Stop()
+	fc.Advance(time.Second)
+	<-after
+	<-timer.C()
+	select {
+	case <-ticker.C():
+		t.Error("Stopped ticker should not fire")
+	default:
+	}
+	if fc.Waiters() != 0 || !fc.Now().Equal(start.Add(2*time.Second)) {
+		t.Errorf("Waiters() = %d, Now() = %v", fc.Waiters(), fc.Now())
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	fc := NewFake(time.Now())
+	done := make(chan struct{})
+	go func() {
+		<-fc.After(time.Minute)
+		close(done)
+	}()
+
+	fc.BlockUntil(1)
+	fc.Advance(time.Minute)
+	<-done
+}
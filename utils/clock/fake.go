@@ -0,0 +1,192 @@
+/*
+ *
+ * clock - Mockable time source.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time changes only when Advance or Set is called. Timers and tickers created from it
+// fire synchronously within Advance/Set once their deadlines are reached. It's goroutine-safe.
+type Fake struct {
+	lock    sync.Mutex
+	changed sync.Cond // Broadcast when the number of active timers/tickers changes
+	now     time.Time
+	waiters []*fakeWaiter // Active timers/tickers
+}
+
+// NewFake creates a Fake clock starting at `now`.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.changed.L = &f.lock
+	return f
+}
+
+// Now returns the current time of the Fake clock.
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// After waits for the Fake clock to be advanced by `d` and then sends the current time on the returned channel.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer creates a Timer that fires after the Fake clock is advanced by `d`.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{fake: f, c: make(chan time.Time, 1)}
+	w.Reset(d)
+	return w
+}
+
+// NewTicker creates a Ticker that fires every time the Fake clock is advanced by `d`. It panics if `d` <= 0.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{fake: f, c: make(chan time.Time, 1)}
+	w.reset(d, d)
+	return (*fakeTicker)(w)
+}
+
+// Advance moves the Fake clock forward by `d`, and fires the timers/tickers whose deadlines are reached in order.
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	f.now = f.now.Add(d)
+	f.fire()
+	f.lock.Unlock()
+}
+
+// Set sets the Fake clock to `t`, and fires the timers/tickers whose deadlines are reached in order.
+func (f *Fake) Set(t time.Time) {
+	f.lock.Lock()
+	f.now = t
+	f.fire()
+	f.lock.Unlock()
+}
+
+// Waiters returns the number of active timers/tickers.
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until there are at least `n` active timers/tickers. It's used to make sure that the goroutine
+// under test has started waiting before advancing the Fake clock.
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+	f.lock.Unlock()
+}
+
+// fire fires the waiters whose deadlines are reached in order. It should be called with the lock held.
+func (f *Fake) fire() {
+	for {
+		var next *fakeWaiter
+		for _, w := range f.waiters {
+			if !w.deadline.After(f.now) && (next == nil || w.deadline.Before(next.deadline)) {
+				next = w
+			}
+		}
+		if next == nil {
+			return
+		}
+
+		select {
+		case next.c <- next.deadline:
+		default: // Drops the tick like time.Ticker if the receiver is too slow
+		}
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			f.remove(next)
+		}
+	}
+}
+
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+type fakeWaiter struct {
+	fake     *Fake
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration // 0 for timers
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.fake.lock.Lock()
+	defer w.fake.lock.Unlock()
+	return w.fake.remove(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	return w.reset(d, 0) // Tickers are reset by fakeTicker.Reset
+}
+
+func (w *fakeWaiter) reset(d, period time.Duration) bool {
+	f := w.fake
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	active := f.remove(w)
+	w.period = period
+	w.deadline = f.now.Add(d)
+	f.waiters = append(f.waiters, w)
+	f.changed.Broadcast()
+	f.fire()
+	return active
+}
+
+type fakeTicker fakeWaiter
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	(*fakeWaiter)(t).Stop()
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+	(*fakeWaiter)(t).reset(d, d)
+}
@@ -0,0 +1,223 @@
+/*
+ *
+ * lifecycle - Graceful shutdown orchestrator.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package lifecycle orchestrates graceful shutdown of a service.
+//
+// Shutdown hooks (flushing logs, draining pools, closing muxes, unwatching configurations...) are registered to a Manager,
+// and they are executed in reverse registration order (just like `defer`) when SIGTERM/SIGINT is received
+// or Manager.Shutdown is called. All hooks share a global timeout.
+//
+// Example:
+//
+//	m := lifecycle.NewManager(lifecycle.WithTimeout(10 * time.Second))
+//	m.Register("logger", func(ctx context.Context) error { return lg.Close() })
+//	m.Register("conf", func(ctx context.Context) error { parser.Unwatch(); return nil })
+//	if err := m.Wait(); err != nil { // blocks until SIGTERM/SIGINT is received, then runs all hooks
+//		fmt.Println(err)
+//	}
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Hook is a shutdown hook. It should return as soon as possible after `ctx` is done.
+type Hook func(ctx context.Context) error
+
+// NewManager is the only way to get a new, ready-to-use Manager.
+// SIGTERM and SIGINT are handled by default, and the default global timeout is 30 seconds.
+func NewManager(opts ...option) *Manager {
+	m := &Manager{
+		shutdownCh: make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	m.opts.apply(opts...)
+	return m
+}
+
+// Manager manages shutdown hooks. All methods of Manager are goroutine-safe.
+type Manager struct {
+	opts         options
+	lock         sync.Mutex
+	hooks        []namedHook
+	shutdownOnce sync.Once
+	shutdownCh   chan struct{} // closed when shutdown is triggered
+	doneCh       chan struct{} // closed when all hooks have been executed
+	err          error
+}
+
+// Register registers a shutdown hook. Hooks are executed in reverse registration order.
+// Hooks registered after shutdown has been triggered are ignored.
+//
+//	name: name of the hook, used in error messages
+//	hook: the shutdown hook
+func (m *Manager) Register(name string, hook Hook) {
+	m.lock.Lock()
+	m.hooks = append(m.hooks, namedHook{name, hook})
+	m.lock.Unlock()
+}
+
+// Wait blocks until SIGTERM/SIGINT (or any signals set by WithSignals) is received or Shutdown is called,
+// then it executes all hooks and returns the result of Shutdown.
+func (m *Manager) Wait() error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, m.opts.signals...)
+	defer signal.Stop(sigCh)
+
+	select {
+	case <-sigCh:
+		return m.Shutdown()
+	case <-m.shutdownCh:
+		<-m.doneCh
+		return m.err
+	}
+}
+
+// Shutdown executes all registered hooks in reverse registration order within the global timeout.
+// It's safe to call Shutdown more than once, hooks are executed only once and the same result is returned.
+// A non-nil *ShutdownError is returned if any hook fails or the global timeout is exceeded.
+func (m *Manager) Shutdown() error {
+	m.shutdownOnce.Do(func() {
+		close(m.shutdownCh)
+
+		m.lock.Lock()
+		hooks := m.hooks
+		m.hooks = nil
+		m.lock.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.opts.timeout)
+		defer cancel()
+
+		var errs []HookError
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := runHook(ctx, hooks[i].hook); err != nil {
+				errs = append(errs, HookError{Name: hooks[i].name, Err: err})
+			}
+		}
+		if len(errs) > 0 {
+			m.err = &ShutdownError{Errors: errs}
+		}
+		close(m.doneCh)
+	})
+
+	<-m.doneCh
+	return m.err
+}
+
+// ShuttingDown returns a channel which is closed when shutdown is triggered.
+func (m *Manager) ShuttingDown() <-chan struct{} {
+	return m.shutdownCh
+}
+
+// Done returns a channel which is closed after all hooks have been executed.
+func (m *Manager) Done() <-chan struct{} {
+	return m.doneCh
+}
+
+// HookError is the error returned by a single hook.
+type HookError struct {
+	Name string // name of the hook
+	Err  error  // error returned by the hook, or context.DeadlineExceeded if the global timeout is exceeded
+}
+
+// ShutdownError holds all errors occurred during shutdown.
+type ShutdownError struct {
+	Errors []HookError
+}
+
+func (e *ShutdownError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("shutdown failed:")
+	for _, he := range e.Errors {
+		fmt.Fprintf(&sb, " [%s: %v]", he.Name, he.Err)
+	}
+	return sb.String()
+}
+
+// WithTimeout sets the global timeout shared by all hooks. Default is 30 seconds.
+// Hooks not yet finished when the timeout is exceeded are abandoned and reported as context.DeadlineExceeded.
+func WithTimeout(timeout time.Duration) option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithSignals sets signals which trigger shutdown in Wait. Default is SIGTERM and SIGINT.
+func WithSignals(signals ...os.Signal) option {
+	return func(o *options) {
+		o.signals = signals
+	}
+}
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// runHook runs `hook` and returns its result, or ctx.Err() if `ctx` is done before `hook` returns.
+func runHook(ctx context.Context, hook Hook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		ch <- hook(ctx)
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type option func(opts *options)
+
+type options struct {
+	timeout time.Duration
+	signals []os.Signal
+}
+
+func (o *options) apply(opts ...option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.timeout <= 0 {
+		o.timeout = 30 * time.Second
+	}
+	if len(o.signals) == 0 {
+		o.signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ *
+ * lifecycle - Graceful shutdown orchestrator.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	m := NewManager(WithTimeout(100 * time.Millisecond))
+
+	var order []string
+	m.Register("first", func(ctx context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	m.Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	m.Register("last", func(ctx context.Context) error {
+		order = append(order, "last")
+		return errors.New("oops")
+	})
+
+	go m.Shutdown()
+	err := m.Wait()
+
+	var se *ShutdownError
+	if !errors.As(err, &se) || len(se.Errors) != 3 {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if se.Errors[0].Name != "last" || se.Errors[1].Err != context.DeadlineExceeded || se.Errors[2].Err != context.DeadlineExceeded {
+		t.Errorf("Unexpected errors: %v", err)
+	}
+	if len(order) != 1 || order[0] != "last" {
+		t.Errorf("Hooks should be executed in reverse order: %v", order)
+	}
+	if m.Shutdown() != err {
+		t.Error("Shutdown should return the same result if called more than once")
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+// DefaultRetryPolicy is used by Retry if nil policy is passed. It makes at most 3 attempts, with delays starting from 100ms.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  3,
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     10 * time.Second,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+// RetryPolicy controls how Retry retries a failed operation.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one. <=0 means unlimited, until the context is done.
+	MaxAttempts int
+	// Delay before the first retry. <=0 means retrying immediately.
+	InitialDelay time.Duration
+	// Upper limit of the delay. <=0 means unlimited.
+	MaxDelay time.Duration
+	// Factor by which the delay grows after each retry. Values less than 1 are treated as 1, which means constant delay.
+	Multiplier float64
+	// Randomization factor in [0, 1]. Each delay is randomized within [delay*(1-Jitter), delay*(1+Jitter)],
+	// so that clients failed at the same time don't retry at the same time.
+	Jitter float64
+	// Classifies whether an error is worth retrying. If left nil, all errors except those wrapped by Permanent are retried.
+	Retryable func(err error) bool
+	// Source of the time used for waiting. If left nil, clock.Real is used.
+	Clock clock.Clock
+}
+
+// Backoff returns the delay before the `n`th retry (starting from 1), jitter included.
+func (p *RetryPolicy) Backoff(n int) time.Duration {
+	if p.InitialDelay <= 0 || n <= 0 {
+		return 0
+	}
+
+	delay := float64(p.InitialDelay)
+	for i := 1; i < n && p.Multiplier > 1; i++ {
+		delay *= p.Multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay *= 1 - jitter + 2*jitter*randFloat64()
+	}
+	return time.Duration(delay)
+}
+
+// Retry calls `fn` until it succeeds, the error is not retryable, attempts are used up, or `ctx` is done.
+// Delays between attempts grow exponentially as specified by `policy`. If `policy` is nil, DefaultRetryPolicy is used.
+//
+// It returns nil if `fn` succeeds. Otherwise, it returns the last error returned by `fn` (unwrapped if it's wrapped by Permanent
+// or RetryAfter), or ctx.Err() if `ctx` is done before the next attempt.
+//
+// Example:
+//
+//	err := utils.Retry(ctx, &utils.RetryPolicy{MaxAttempts: 5, InitialDelay: time.Second, Multiplier: 2, Jitter: 0.2},
+//		func() error {
+//			rsp, err := http.Get(url)
+//			if err != nil {
+//				return err // retried
+//			}
+//			defer rsp.Body.Close()
+//			if rsp.StatusCode == http.StatusBadRequest {
+//				return utils.Permanent(errors.New(rsp.Status)) // not retried
+//			}
+//			...
+//		})
+func Retry(ctx context.Context, policy *RetryPolicy, fn func() error) error {
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+	clk := clock.OrReal(policy.Clock)
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		var minDelay time.Duration
+		var after *retryAfterError
+		if errors.As(err, &after) {
+			err, minDelay = after.err, after.delay
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		delay := policy.Backoff(attempt)
+		if delay < minDelay {
+			delay = minDelay
+		}
+		if delay > 0 {
+			timer := clk.NewTimer(delay)
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Permanent wraps `err` to tell Retry not to retry it. Retry returns `err` itself rather than the wrapper.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter wraps `err` to tell Retry to wait at least `delay` before the next attempt, e.g. as requested by the server.
+// Retry returns `err` itself rather than the wrapper.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err, delay}
+}
+
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+var (
+	randLock sync.Mutex
+	randSrc  = rand.New(rand.NewSource(time.Now().UnixNano())) // The global source is not seeded before go1.20
+)
+
+func randFloat64() float64 {
+	randLock.Lock()
+	defer randLock.Unlock()
+	return randSrc.Float64()
+}
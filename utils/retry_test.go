@@ -0,0 +1,118 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	for n, expected := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if d := p.Backoff(n); d != expected {
+			t.Errorf("Backoff(%d) = %v, expecting %v", n, d, expected)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.Backoff(2); d < 100*time.Millisecond || d > 300*time.Millisecond {
+			t.Fatalf("Backoff(2) with jitter = %v", d)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	fc := clock.NewFake(time.Now())
+	p := &RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second, Multiplier: 2, Clock: fc}
+	errTemp := errors.New("temporary")
+
+	attempts := 0
+	done := make(chan error)
+	go func() {
+		done <- Retry(context.Background(), p, func() error {
+			attempts++
+			return errTemp
+		})
+	}()
+	fc.BlockUntil(1)
+	fc.Advance(time.Second) // 1st retry
+	fc.BlockUntil(1)
+	fc.Advance(2 * time.Second) // 2nd retry
+	if err := <-done; err != errTemp || attempts != 3 {
+		t.Errorf("Retry() = %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	errFatal := errors.New("fatal")
+	err := Retry(context.Background(), p, func() error {
+		attempts++
+		return Permanent(errFatal)
+	})
+	if err != errFatal || attempts != 1 {
+		t.Errorf("Permanent error should not be retried: %v after %d attempts", err, attempts)
+	}
+
+	p.Retryable = func(err error) bool { return err == errTemp }
+	if err = Retry(context.Background(), p, func() error { return errFatal }); err != errFatal {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		fc.BlockUntil(1)
+		cancel()
+	}()
+	if err = Retry(ctx, p, func() error { return errTemp }); err != context.Canceled {
+		t.Errorf("Expecting context.Canceled but gets %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	fc := clock.NewFake(time.Now())
+	p := &RetryPolicy{MaxAttempts: 2, InitialDelay: time.Second, Clock: fc}
+	errBusy := errors.New("busy")
+
+	attempts := 0
+	done := make(chan error)
+	go func() {
+		done <- Retry(context.Background(), p, func() error {
+			attempts++
+			return RetryAfter(errBusy, time.Minute)
+		})
+	}()
+	fc.BlockUntil(1)
+	fc.Advance(time.Second)
+	select {
+	case <-done:
+		t.Fatal("Retry should wait for at least the delay passed to RetryAfter")
+	case <-time.After(20 * time.Millisecond):
+	}
+	fc.Advance(time.Minute)
+	if err := <-done; err != errBusy || attempts != 2 {
+		t.Errorf("Retry() = %v after %d attempts", err, attempts)
+	}
+}
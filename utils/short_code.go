@@ -0,0 +1,146 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import "fmt"
+
+const kShortCodeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ShortCodeCodec is a reversible codec which converts integers such as database IDs into short alphanumeric strings
+// and vice versa, so that the IDs can be exposed in URLs without revealing their values or order.
+// Codes generated with different salts are different. It is goroutine-safe.
+//
+// Caution: It's obfuscation, not encryption. Never use it to protect sensitive data.
+//
+// Basic example:
+//
+//	codec := utils.NewShortCodeCodec("my secret salt", 6)
+//	code := codec.Encode(12345) // code is a string with at least 6 characters
+//	id, err := codec.Decode(code)
+type ShortCodeCodec struct {
+	salt      string
+	minLength int
+	alphabet  [len(kShortCodeAlphabet)]byte
+	indices   [256]int8 // index of each character in `alphabet`, -1 if not in
+}
+
+// NewShortCodeCodec creates a ready-to-use ShortCodeCodec.
+//
+//	salt: Secret salt used to shuffle the alphabet.
+//	minLength: Minimum length of the generated codes.
+func NewShortCodeCodec(salt string, minLength int) *ShortCodeCodec {
+	c := &ShortCodeCodec{salt: salt, minLength: minLength}
+	copy(c.alphabet[:], kShortCodeAlphabet)
+	consistentShuffle(c.alphabet[:], salt)
+	for i := range c.indices {
+		c.indices[i] = -1
+	}
+	for i, ch := range c.alphabet {
+		c.indices[ch] = int8(i)
+	}
+	return c
+}
+
+// Encode converts `id` into a short code.
+func (c *ShortCodeCodec) Encode(id uint64) string {
+	const base = uint64(len(kShortCodeAlphabet))
+
+	// The first character (lottery) determines how the digits are shuffled,
+	// so that codes of adjacent IDs look unrelated.
+	lottery := c.alphabet[id%base]
+	digits := c.digitAlphabet(lottery)
+
+	var buf [16]byte // 1 lottery + at most 11 digits for uint64
+	i := len(buf)
+	for n := id; ; {
+		i--
+		buf[i] = digits[n%base]
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+
+	code := make([]byte, 0, 1+c.minLength+len(buf)-i)
+	code = append(code, lottery)
+	for pad := c.minLength - 1 - (len(buf) - i); pad > 0; pad-- {
+		code = append(code, digits[0]) // Leading zeros
+	}
+	code = append(code, buf[i:]...)
+	return string(code)
+}
+
+// Decode converts a short code generated by Encode back into the original ID.
+// It returns an error if `code` is not generated by Encode of a ShortCodeCodec with the same salt and minimum length.
+func (c *ShortCodeCodec) Decode(code string) (uint64, error) {
+	const base = uint64(len(kShortCodeAlphabet))
+
+	if len(code) < 2 || c.indices[code[0]] < 0 {
+		return 0, fmt.Errorf("invalid short code %q", code)
+	}
+
+	digits := c.digitAlphabet(code[0])
+	var indices [256]int8
+	for i := range indices {
+		indices[i] = -1
+	}
+	for i, ch := range digits {
+		indices[ch] = int8(i)
+	}
+
+	var id uint64
+	for i := 1; i < len(code); i++ {
+		d := indices[code[i]]
+		if d < 0 || id > (^uint64(0)-uint64(d))/base {
+			return 0, fmt.Errorf("invalid short code %q", code)
+		}
+		id = id*base + uint64(d)
+	}
+
+	if c.Encode(id) != code { // Rejects codes with wrong lottery or redundant leading zeros
+		return 0, fmt.Errorf("invalid short code %q", code)
+	}
+	return id, nil
+}
+
+// digitAlphabet returns the alphabet for the digits of the code with the given `lottery`
+func (c *ShortCodeCodec) digitAlphabet(lottery byte) []byte {
+	digits := make([]byte, len(c.alphabet))
+	copy(digits, c.alphabet[:])
+	consistentShuffle(digits, string(lottery)+c.salt)
+	return digits
+}
+
+// consistentShuffle shuffles `alphabet` deterministically with `salt`
+func consistentShuffle(alphabet []byte, salt string) {
+	if len(salt) == 0 {
+		return
+	}
+
+	for i, v, p := len(alphabet)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		n := int(salt[v])
+		p += n
+		j := (n + v + p) % i
+		alphabet[i], alphabet[j] = alphabet[j], alphabet[i]
+		v++
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2018 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShortCodeCodec(t *testing.T) {
+	codec := NewShortCodeCodec("salt", 6)
+	other := NewShortCodeCodec("another salt", 6)
+
+	codes := map[string]uint64{}
+	for _, id := range []uint64{0, 1, 2, 61, 62, 12345, 1 << 40, math.MaxUint64} {
+		code := codec.Encode(id)
+		if len(code) < 6 {
+			t.Errorf("Code %q of %d is too short", code, id)
+		}
+		if prev, ok := codes[code]; ok {
+			t.Errorf("Duplicated code %q for %d and %d", code, prev, id)
+		}
+		codes[code] = id
+
+		decoded, err := codec.Decode(code)
+		if err != nil || decoded != id {
+			t.Errorf("Decode(%q) = %d, %v, expecting %d", code, decoded, err, id)
+		}
+		if other.Encode(id) == code {
+			t.Errorf("Codes of %d should differ with different salts", id)
+		}
+	}
+
+	for _, code := range []string{"", "a", "a-bcde", "zzzzzzzzzzzzzzzzzzzz"} {
+		if _, err := codec.Decode(code); err == nil {
+			t.Errorf("Decode(%q) should fail", code)
+		}
+	}
+}
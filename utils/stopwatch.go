@@ -0,0 +1,146 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+// Lap is a named section measured by Stopwatch.
+type Lap struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Stopwatch measures elapsed time of code sections. It's goroutine-safe.
+// The zero value is a stopped Stopwatch using clock.Real.
+//
+// Stopwatch implements fmt.Stringer, so it can be logged directly:
+//
+//	sw := utils.StartStopwatch(nil)
+//	parse()
+//	sw.Lap("parse")
+//	query()
+//	sw.Lap("query")
+//	logger.Infof("%v", sw) // total=12.5ms parse=2.1ms query=10.4ms
+type Stopwatch struct {
+	lock    sync.Mutex
+	clk     clock.Clock
+	start   time.Time
+	lastLap time.Time
+	laps    []Lap
+}
+
+// StartStopwatch creates a Stopwatch and starts it. If `clk` is nil, clock.Real is used.
+func StartStopwatch(clk clock.Clock) *Stopwatch {
+	sw := &Stopwatch{clk: clk}
+	sw.Start()
+	return sw
+}
+
+// Start (re)starts the Stopwatch. Laps recorded before are discarded.
+func (sw *Stopwatch) Start() {
+	sw.lock.Lock()
+	sw.start = clock.OrReal(sw.clk).Now()
+	sw.lastLap = sw.start
+	sw.laps = nil
+	sw.lock.Unlock()
+}
+
+// Lap records a lap named `name`, and returns the time elapsed since the previous lap, or since the Stopwatch started if it's the first lap.
+func (sw *Stopwatch) Lap(name string) time.Duration {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	now := clock.OrReal(sw.clk).Now()
+	d := now.Sub(sw.lastLap)
+	sw.lastLap = now
+	sw.laps = append(sw.laps, Lap{name, d})
+	return d
+}
+
+// Elapsed returns the time elapsed since the Stopwatch started. It returns 0 if the Stopwatch isn't started.
+func (sw *Stopwatch) Elapsed() time.Duration {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	return sw.elapsed()
+}
+
+// Laps returns a copy of the recorded laps.
+func (sw *Stopwatch) Laps() []Lap {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	return append([]Lap(nil), sw.laps...)
+}
+
+// String returns the elapsed time followed by the recorded laps, such as `total=12.5ms parse=2.1ms query=10.4ms`.
+func (sw *Stopwatch) String() string {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("total=")
+	sb.WriteString(sw.elapsed().String())
+	for _, lap := range sw.laps {
+		sb.WriteByte(' ')
+		sb.WriteString(lap.Name)
+		sb.WriteByte('=')
+		sb.WriteString(lap.Duration.String())
+	}
+	return sb.String()
+}
+
+func (sw *Stopwatch) elapsed() time.Duration {
+	if sw.start.IsZero() {
+		return 0
+	}
+	return clock.OrReal(sw.clk).Now().Sub(sw.start)
+}
+
+// WithDeadline calls `fn` with a context derived from `ctx` which is done at `deadline`.
+// It returns the error returned by `fn`, or ctx.Err() of the derived context if it's done before `fn` returns.
+// In the latter case, `fn` keeps running in background until it returns, so it should honor the context passed in.
+func WithDeadline(ctx context.Context, deadline time.Time, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithTimeout is a shorthand for WithDeadline(ctx, time.Now().Add(timeout), fn).
+func WithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	return WithDeadline(ctx, time.Now().Add(timeout), fn)
+}
@@ -0,0 +1,89 @@
+/*
+ *
+ * sync - Synchronization facilities.
+ * Copyright (C) 2026 Antigloss Huang (https://github.com/antigloss) All rights reserved.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/antigloss/go/utils/clock"
+)
+
+func TestStopwatch(t *testing.T) {
+	var zero Stopwatch
+	if zero.Elapsed() != 0 || zero.String() != "total=0s" {
+		t.Errorf("Unexpected zero Stopwatch: %v", &zero)
+	}
+
+	fc := clock.NewFake(time.Now())
+	sw := StartStopwatch(fc)
+	fc.Advance(2 * time.Millisecond)
+	if d := sw.Lap("parse"); d != 2*time.Millisecond {
+		t.Errorf("Lap(parse) = %v", d)
+	}
+	fc.Advance(10 * time.Millisecond)
+	if d := sw.Lap("query"); d != 10*time.Millisecond {
+		t.Errorf("Lap(query) = %v", d)
+	}
+	fc.Advance(time.Millisecond)
+	if d := sw.Elapsed(); d != 13*time.Millisecond {
+		t.Errorf("Elapsed() = %v", d)
+	}
+	if s := sw.String(); s != "total=13ms parse=2ms query=10ms" {
+		t.Errorf("String() = %s", s)
+	}
+	if laps := sw.Laps(); len(laps) != 2 || laps[1] != (Lap{"query", 10 * time.Millisecond}) {
+		t.Errorf("Laps() = %v", laps)
+	}
+
+	sw.Start()
+	if sw.Elapsed() != 0 || len(sw.Laps()) != 0 {
+		t.Errorf("Start() should reset the Stopwatch: %v", sw)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	errFn := errors.New("fn")
+	err := WithTimeout(context.Background(), time.Second, func(ctx context.Context) error {
+		return errFn
+	})
+	if err != errFn {
+		t.Errorf("WithTimeout() = %v", err)
+	}
+
+	err = WithTimeout(context.Background(), 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("WithTimeout() = %v, expecting %v", err, context.DeadlineExceeded)
+	}
+
+	err = WithDeadline(context.Background(), time.Now().Add(-time.Second), func(ctx context.Context) error {
+		return ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("WithDeadline() = %v, expecting %v", err, context.DeadlineExceeded)
+	}
+}